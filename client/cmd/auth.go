@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ms_graph/internal/auth"
+	"ms_graph/internal/config"
+	"ms_graph/internal/token"
+	"ms_graph/internal/tokencache"
+)
+
+// runLogin signs in with a device code and caches the tokens for the active
+// profile, so later commands find them in the token cache
+func runLogin(args []string) {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	tenantID := flags.String("tenant", "", "Tenant ID or domain (default: the profile's or MS_GRAPH_TENANT_ID)")
+	clientID := flags.String("client-id", "", "App registration client ID (default: the profile's, or Microsoft Graph Command Line Tools)")
+	flags.Parse(args)
+
+	opts, err := credentialOptions()
+	if err != nil {
+		fatal(err)
+	}
+	if opts.Cache == nil {
+		fatal(fmt.Errorf("login needs a token cache; check MS_GRAPH_TOKEN_CACHE"))
+	}
+	if *tenantID != "" {
+		opts.TenantID = *tenantID
+	}
+	if *clientID != "" {
+		opts.ClientID = *clientID
+	}
+	opts.Order = []string{auth.SourceDeviceCode}
+
+	cred, err := auth.NewDefaultCredential(opts)
+	if err != nil {
+		fatal(err)
+	}
+	tokenResp, err := cred.Token()
+	if err != nil {
+		fatal(&authError{err: err})
+	}
+
+	fmt.Fprintf(os.Stderr, "Signed in as %s\n", signedInAs(tokenResp.AccessToken))
+}
+
+// runLogout removes the active profile's cached tokens
+func runLogout(args []string) {
+	if len(args) != 0 {
+		usageError("usage: logout")
+	}
+
+	name, _, err := loadActiveProfile()
+	if err != nil {
+		fatal(err)
+	}
+	key := name
+	if key == "" {
+		key = tokencache.DefaultKey
+	}
+
+	if err := config.DeleteCachedTokens(key); err != nil {
+		fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "Removed cached tokens for %s\n", key)
+}
+
+// tokenDetails describes an access token for token --decode
+type tokenDetails struct {
+	Source    string    `json:"source"`
+	User      string    `json:"user,omitempty"`
+	TenantID  string    `json:"tenantId,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	ExpiresIn string    `json:"expiresIn"`
+}
+
+// runToken prints an access token for scripts, or its details
+func runToken(args []string) {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	scope := flags.String("scope", "", "Scope to request instead of Graph's default, e.g. \"Mail.Read offline_access\"")
+	decode := flags.Bool("decode", false, "Show the token's user, scopes and expiry instead of the token")
+	flags.Parse(args)
+
+	cred, tokenResp, err := resolveCredential()
+	if err != nil {
+		fatal(err)
+	}
+	accessToken := tokenResp.AccessToken
+	if *scope != "" {
+		clientOptions, err := graphOptions()
+		if err != nil {
+			fatal(err)
+		}
+		client := newClientWithCredential(cred, tokenResp, clientOptions)
+		scoped, err := client.TokenForScope(*scope)
+		if err != nil {
+			fatal(&authError{err: err})
+		}
+		accessToken = scoped.AccessToken
+	}
+
+	if !*decode {
+		fmt.Println(accessToken)
+		return
+	}
+
+	info, err := token.ParseToken(accessToken)
+	if err != nil {
+		fatal(err)
+	}
+	details := tokenDetails{
+		Source:    cred.Selected(),
+		User:      signedInAs(accessToken),
+		ExpiresAt: info.ExpiresAt,
+		ExpiresIn: info.TimeUntilExp.Round(time.Second).String(),
+	}
+	details.TenantID, _ = token.GetStringClaim(accessToken, "tid")
+	if scp, err := token.GetStringClaim(accessToken, "scp"); err == nil {
+		details.Scopes = strings.Fields(scp)
+	}
+	details.Roles = token.GetStringListClaim(accessToken, "roles")
+
+	if outputFormat() != config.OutputText || queryFlag != "" {
+		data, err := json.Marshal(details)
+		if err != nil {
+			fatal(fmt.Errorf("failed to encode output: %w", err))
+		}
+		if err := printItem(data, nil); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	fmt.Printf("Source: %s\n", details.Source)
+	if details.User != "" {
+		fmt.Printf("User: %s\n", details.User)
+	}
+	fmt.Printf("Tenant: %s\n", details.TenantID)
+	if len(details.Scopes) > 0 {
+		fmt.Printf("Scopes: %s\n", strings.Join(details.Scopes, " "))
+	}
+	if len(details.Roles) > 0 {
+		fmt.Printf("Roles: %s\n", strings.Join(details.Roles, " "))
+	}
+	fmt.Printf("Expires At: %s\n", details.ExpiresAt.Format(time.RFC3339))
+	switch {
+	case info.IsExpired:
+		fmt.Println("⚠️  Token is EXPIRED")
+	case info.ExpiresSoon:
+		fmt.Printf("⚠️  Token expires in %s\n", details.ExpiresIn)
+	default:
+		fmt.Printf("✓ Token is valid for %s\n", details.ExpiresIn)
+	}
+}
+
+// signedInAs returns the user a token was issued to, or its app ID for app-only tokens
+func signedInAs(accessToken string) string {
+	for _, claim := range []string{"upn", "preferred_username", "unique_name", "appid"} {
+		if value, err := token.GetStringClaim(accessToken, claim); err == nil && value != "" {
+			return value
+		}
+	}
+	return "unknown"
+}
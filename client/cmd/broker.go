@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ms_graph/internal/broker"
+)
+
+// runBroker serves tokens from one credential to local processes over a Unix socket
+func runBroker(args []string) {
+	defaultSocket, err := broker.DefaultSocketPath()
+	if err != nil {
+		fatal(err)
+	}
+
+	flags := flag.NewFlagSet("broker", flag.ExitOnError)
+	socketPath := flags.String("socket", defaultSocket, "Unix socket path to listen on")
+	flags.Parse(args)
+
+	clientOptions, err := graphOptions()
+	if err != nil {
+		fatal(err)
+	}
+
+	cred, tokenResp, err := resolveCredential()
+	if err != nil {
+		fatal(err)
+	}
+	log.Printf("Using credential source: %s", cred.Selected())
+	for _, skip := range cred.Skipped() {
+		log.Printf("  skipped %s: %v", skip.Source, skip.Err)
+	}
+
+	server := broker.NewServer(broker.NewClient(tokenResp, cred, clientOptions...))
+
+	// Shut down cleanly so the socket file is removed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	log.Printf("Token broker listening on %s", *socketPath)
+	if err := server.ListenAndServe(*socketPath); err != nil {
+		fatal(err)
+	}
+	log.Printf("Token broker stopped")
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"ms_graph/internal/graph"
+)
+
+// listFlags are the paging flags shared by list commands
+type listFlags struct {
+	top int
+	all bool
+}
+
+// register adds --top and --all to flags
+func (l *listFlags) register(flags *flag.FlagSet) {
+	flags.IntVar(&l.top, "top", 25, "Maximum number of items to show")
+	flags.BoolVar(&l.all, "all", false, "Show every item, following @odata.nextLink")
+}
+
+// check exits with a usage error for invalid paging flags, before any
+// request is sent
+func (l *listFlags) check() {
+	if l.top < 1 {
+		usageError("--top must be at least 1, got %d", l.top)
+	}
+}
+
+// listItems GETs a collection and follows @odata.nextLink until it has
+// lf.top items, or every item with --all
+func listItems(client graph.API, path string, query url.Values, header http.Header, lf listFlags) ([]json.RawMessage, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if !lf.all && lf.top > 0 {
+		query.Set("$top", strconv.Itoa(min(lf.top, 999)))
+	}
+	req := &graph.Request{Method: "GET", Path: path, Query: query, Header: header}
+
+	var items []json.RawMessage
+	for {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page graph.Collection[json.RawMessage]
+		if err := resp.Decode(&page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Value...)
+
+		if !lf.all && len(items) >= lf.top {
+			return items[:lf.top], nil
+		}
+		if page.NextLink == "" {
+			return items, nil
+		}
+		// The next link carries the query already
+		req = &graph.Request{Method: "GET", Path: page.NextLink, Header: header}
+	}
+}
+
+// getItem GETs a single resource as raw JSON
+func getItem(client graph.API, path string, query url.Values, header http.Header) (json.RawMessage, error) {
+	resp, err := client.Do(&graph.Request{Method: "GET", Path: path, Query: query, Header: header})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// selectQuery returns a query selecting the comma-separated properties, or
+// nil when there are none
+func selectQuery(properties string) url.Values {
+	if properties == "" {
+		return nil
+	}
+	return url.Values{"$select": {properties}}
+}
+
+// userColumns are the text columns of user lists
+var userColumns = []string{"id", "displayName", "userPrincipalName", "mail"}
+
+// meFields are the properties me shows as text
+var meFields = []string{"id", "displayName", "givenName", "surname", "mail", "userPrincipalName", "jobTitle", "department", "officeLocation", "mobilePhone", "businessPhones"}
+
+// runMe shows the signed-in user
+func runMe(args []string) {
+	flags := flag.NewFlagSet("me", flag.ExitOnError)
+	selectFields := flags.String("select", "", "Comma-separated properties to return")
+	flags.Parse(args)
+
+	fields := meFields
+	if *selectFields != "" {
+		fields = nil
+	}
+
+	client := newGraphClient()
+	user, err := getItem(client, "/me", selectQuery(*selectFields), nil)
+	if err != nil {
+		fatal(err)
+	}
+	if err := printItem(user, fields); err != nil {
+		fatal(err)
+	}
+}
+
+// runUsers lists, shows, creates and deletes users
+func runUsers(args []string) {
+	if len(args) == 0 {
+		usageError("usage: users list [--filter EXPR] [--search TEXT] [--top N] [--all] | get ID | create --name NAME --upn UPN --password PASSWORD | delete ID")
+	}
+
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("users list", flag.ExitOnError)
+		filter := flags.String("filter", "", "OData $filter expression")
+		search := flags.String("search", "", "Search text, e.g. displayName:ann")
+		var lf listFlags
+		lf.register(flags)
+		flags.Parse(args[1:])
+		lf.check()
+
+		query := url.Values{}
+		var header http.Header
+		if *filter != "" {
+			query.Set("$filter", *filter)
+		}
+		if *search != "" {
+			// $search on directory objects is an advanced query
+			query.Set("$search", strconv.Quote(*search))
+			header = http.Header{"ConsistencyLevel": {"eventual"}}
+		}
+
+		client := newGraphClient()
+		users, err := listItems(client, "/users", query, header, lf)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printList(users, userColumns); err != nil {
+			fatal(err)
+		}
+
+	case "get":
+		flags := flag.NewFlagSet("users get", flag.ExitOnError)
+		selectFields := flags.String("select", "", "Comma-separated properties to return")
+		ids := parseArgs(flags, args[1:])
+		if len(ids) != 1 {
+			usageError("usage: users get ID [--select PROPERTIES]")
+		}
+
+		client := newGraphClient()
+		user, err := getItem(client, "/users/"+url.PathEscape(ids[0]), selectQuery(*selectFields), nil)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printItem(user, nil); err != nil {
+			fatal(err)
+		}
+
+	case "create":
+		flags := flag.NewFlagSet("users create", flag.ExitOnError)
+		name := flags.String("name", "", "Display name")
+		upn := flags.String("upn", "", "User principal name, e.g. ann@contoso.com")
+		nickname := flags.String("nickname", "", "Mail nickname (default: the UPN's local part)")
+		password := flags.String("password", "", "Initial password, which must be changed at first sign-in")
+		flags.Parse(args[1:])
+		if *name == "" || *upn == "" || *password == "" {
+			usageError("usage: users create --name NAME --upn UPN --password PASSWORD [--nickname NICKNAME]")
+		}
+		if *nickname == "" {
+			*nickname = localPart(*upn)
+		}
+
+		payload := map[string]interface{}{
+			"accountEnabled":    true,
+			"displayName":       *name,
+			"userPrincipalName": *upn,
+			"mailNickname":      *nickname,
+			"passwordProfile": map[string]interface{}{
+				"password":                      *password,
+				"forceChangePasswordNextSignIn": true,
+			},
+		}
+		client := newGraphClient()
+		var created json.RawMessage
+		if err := client.Post("/users", payload, &created); err != nil {
+			fatal(err)
+		}
+		if len(created) > 0 {
+			if err := printItem(created, userColumns); err != nil {
+				fatal(err)
+			}
+		}
+
+	case "delete":
+		if len(args) != 2 {
+			usageError("usage: users delete ID")
+		}
+		client := newGraphClient()
+		if err := client.Delete("/users/" + url.PathEscape(args[1])); err != nil {
+			fatal(err)
+		}
+		if !dryRun {
+			fmt.Fprintf(os.Stderr, "Deleted user %s\n", args[1])
+		}
+
+	default:
+		usageError("unknown users command %q", args[0])
+	}
+}
+
+// groupColumns are the text columns of group lists
+var groupColumns = []string{"id", "displayName", "mail", "groupTypes"}
+
+// runGroups lists and shows groups and their members
+func runGroups(args []string) {
+	if len(args) == 0 {
+		usageError("usage: groups list [--filter EXPR] [--top N] [--all] | get ID | members ID [--top N] [--all]")
+	}
+
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("groups list", flag.ExitOnError)
+		filter := flags.String("filter", "", "OData $filter expression")
+		var lf listFlags
+		lf.register(flags)
+		flags.Parse(args[1:])
+		lf.check()
+
+		query := url.Values{}
+		if *filter != "" {
+			query.Set("$filter", *filter)
+		}
+		client := newGraphClient()
+		groups, err := listItems(client, "/groups", query, nil, lf)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printList(groups, groupColumns); err != nil {
+			fatal(err)
+		}
+
+	case "get":
+		if len(args) != 2 {
+			usageError("usage: groups get ID")
+		}
+		client := newGraphClient()
+		group, err := getItem(client, "/groups/"+url.PathEscape(args[1]), nil, nil)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printItem(group, nil); err != nil {
+			fatal(err)
+		}
+
+	case "members":
+		flags := flag.NewFlagSet("groups members", flag.ExitOnError)
+		var lf listFlags
+		lf.register(flags)
+		ids := parseArgs(flags, args[1:])
+		if len(ids) != 1 {
+			usageError("usage: groups members ID [--top N] [--all]")
+		}
+		lf.check()
+
+		client := newGraphClient()
+		members, err := listItems(client, "/groups/"+url.PathEscape(ids[0])+"/members", nil, nil, lf)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printList(members, userColumns); err != nil {
+			fatal(err)
+		}
+
+	default:
+		usageError("unknown groups command %q", args[0])
+	}
+}
+
+// localPart returns the part of an address before the @
+func localPart(address string) string {
+	local, _, _ := strings.Cut(address, "@")
+	return local
+}
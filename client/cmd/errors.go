@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"ms_graph/internal/auth"
+	"ms_graph/internal/graph"
+)
+
+// Exit codes, by error category, so scripts can tell failures apart
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitAuth      = 3
+	exitNotFound  = 4
+	exitThrottled = 5
+	exitNetwork   = 6
+	exitConflict  = 7
+)
+
+// authError marks a failure to obtain a token
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string {
+	return e.err.Error()
+}
+
+func (e *authError) Unwrap() error {
+	return e.err
+}
+
+// authSource wraps a credential so the errors of token refreshes made by the
+// client are recognized as authentication failures
+type authSource struct {
+	cred *auth.ChainedCredential
+}
+
+// Token returns a token from the credential
+func (s authSource) Token() (*graph.TokenResponse, error) {
+	tokenResp, err := s.cred.Token()
+	if err != nil {
+		return nil, &authError{err: err}
+	}
+	return tokenResp, nil
+}
+
+// exitCode returns the exit code for err's category
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var graphErr *graph.GraphError
+	if errors.As(err, &graphErr) {
+		switch {
+		case graphErr.StatusCode == http.StatusUnauthorized || graphErr.StatusCode == http.StatusForbidden:
+			return exitAuth
+		case graphErr.StatusCode == http.StatusNotFound:
+			return exitNotFound
+		case graph.IsRetryable(graphErr.StatusCode):
+			return exitThrottled
+		case graphErr.StatusCode == http.StatusConflict || graphErr.StatusCode == http.StatusPreconditionFailed:
+			return exitConflict
+		}
+		return exitError
+	}
+
+	// Checked before authError: a token refresh that cannot reach the login
+	// endpoint is a network problem, not a rejected credential
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return exitNetwork
+	}
+	var authErr *authError
+	if errors.As(err, &authErr) {
+		return exitAuth
+	}
+	return exitError
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"ms_graph/internal/graph"
+)
+
+// simpleUploadLimit is the largest file sent in a single PUT; larger files
+// go through an upload session
+const simpleUploadLimit = 4 << 20
+
+// driveColumns are the text columns of drive item lists
+var driveColumns = []string{"name", "size", "lastModifiedDateTime", "id"}
+
+// runFiles lists, downloads, uploads and deletes files in the user's OneDrive
+func runFiles(args []string) {
+	if len(args) == 0 {
+		usageError("usage: files list [PATH] [--top N] [--all] | get PATH [--out FILE] | put LOCAL [PATH] | rm PATH")
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		flags := flag.NewFlagSet("files list", flag.ExitOnError)
+		var lf listFlags
+		lf.register(flags)
+		paths := parseArgs(flags, args[1:])
+		if len(paths) > 1 {
+			usageError("usage: files list [PATH] [--top N] [--all]")
+		}
+		lf.check()
+		folder := ""
+		if len(paths) == 1 {
+			folder = paths[0]
+		}
+
+		client := newGraphClient()
+		items, err := listItems(client, drivePath(folder)+"/children", nil, nil, lf)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printList(items, driveColumns); err != nil {
+			fatal(err)
+		}
+
+	case "get":
+		flags := flag.NewFlagSet("files get", flag.ExitOnError)
+		out := flags.String("out", "", "Local file to write, or - for stdout (default: the file's name)")
+		paths := parseArgs(flags, args[1:])
+		if len(paths) != 1 {
+			usageError("usage: files get PATH [--out FILE]")
+		}
+		if *out == "" {
+			*out = path.Base(strings.Trim(paths[0], "/"))
+		}
+
+		client := newGraphClient()
+		body, _, err := client.GetStream(drivePath(paths[0])+"/content", nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer body.Close()
+		n, err := writeTo(*out, body)
+		if err != nil {
+			fatal(err)
+		}
+		if *out != "-" {
+			fmt.Fprintf(os.Stderr, "Saved %d bytes to %s\n", n, *out)
+		}
+
+	case "put":
+		if len(args) != 2 && len(args) != 3 {
+			usageError("usage: files put LOCAL [PATH]")
+		}
+		local := args[1]
+		remote := filepath.Base(local)
+		if len(args) == 3 {
+			remote = args[2]
+			if strings.HasSuffix(remote, "/") {
+				remote += filepath.Base(local)
+			}
+		}
+
+		f, err := os.Open(local)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			fatal(err)
+		}
+
+		client := newGraphClient()
+		var item json.RawMessage
+		switch {
+		case info.Size() <= simpleUploadLimit:
+			contentType := mime.TypeByExtension(filepath.Ext(local))
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			err = client.PutContent(drivePath(remote)+"/content", contentType, f, &item)
+		default:
+			opts := graph.UploadOptions{}
+			if verbose {
+				opts.Progress = func(uploaded, total int64) {
+					fmt.Fprintf(os.Stderr, "Uploaded %d of %d bytes\n", uploaded, total)
+				}
+			}
+			err = client.UploadLargeFile(drivePath(remote)+"/createUploadSession", uploadSessionPayload(), f, info.Size(), opts, &item)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if len(item) > 0 {
+			if err := printItem(item, driveColumns); err != nil {
+				fatal(err)
+			}
+		}
+
+	case "rm", "delete":
+		if len(args) != 2 {
+			usageError("usage: files rm PATH")
+		}
+		client := newGraphClient()
+		if err := client.Delete(drivePath(args[1])); err != nil {
+			fatal(err)
+		}
+		if !dryRun {
+			fmt.Fprintf(os.Stderr, "Deleted %s\n", args[1])
+		}
+
+	default:
+		usageError("unknown files command %q", args[0])
+	}
+}
+
+// drivePath returns the Graph path of the OneDrive item at a path such as
+// "Documents/report.docx", or of the drive's root for an empty path
+func drivePath(itemPath string) string {
+	itemPath = strings.Trim(itemPath, "/")
+	if itemPath == "" {
+		return "/me/drive/root"
+	}
+
+	segments := strings.Split(itemPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/me/drive/root:/" + strings.Join(segments, "/") + ":"
+}
+
+// uploadSessionPayload replaces an existing file rather than failing
+func uploadSessionPayload() interface{} {
+	return map[string]interface{}{
+		"item": map[string]string{"@microsoft.graph.conflictBehavior": "replace"},
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// errInterrupted is returned by readLine when Ctrl-C abandons the line
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines from a terminal in raw mode, with cursor movement,
+// history and tab completion
+type lineEditor struct {
+	fd  uintptr
+	in  *bufio.Reader
+	out io.Writer
+
+	// history holds earlier lines, oldest first, for the up and down keys
+	history []string
+
+	// complete returns candidates for the word that ends line, and the byte
+	// offset where that word starts
+	complete func(line string) (candidates []string, start int)
+}
+
+// ctrl returns the character a control key sends
+func ctrl(key rune) rune {
+	return key & 0x1f
+}
+
+// readLine prints prompt and reads a line, returning io.EOF for Ctrl-D on an
+// empty line and errInterrupted for Ctrl-C
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from terminal: %w", err)
+	}
+	defer restore()
+
+	var line []rune
+	pos := 0
+	historyIndex := len(e.history)
+	var editing []rune // the new line, kept while browsing history
+	lastTab := false
+
+	// browse replaces the line with the history entry delta away
+	browse := func(delta int) {
+		i := historyIndex + delta
+		if i < 0 || i > len(e.history) {
+			return
+		}
+		if historyIndex == len(e.history) {
+			editing = line
+		}
+		historyIndex = i
+		if i == len(e.history) {
+			line = editing
+		} else {
+			line = []rune(e.history[i])
+		}
+		pos = len(line)
+	}
+
+	e.refresh(prompt, line, pos)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		tab := false
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\n")
+			return string(line), nil
+		case ctrl('C'):
+			io.WriteString(e.out, "^C\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(line) == 0 {
+				io.WriteString(e.out, "\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos:pos], line[pos+1:]...)
+			}
+		case 127, ctrl('H'):
+			if pos > 0 {
+				line = append(line[:pos-1:pos-1], line[pos:]...)
+				pos--
+			}
+		case ctrl('A'):
+			pos = 0
+		case ctrl('E'):
+			pos = len(line)
+		case ctrl('B'):
+			pos = max(pos-1, 0)
+		case ctrl('F'):
+			pos = min(pos+1, len(line))
+		case ctrl('K'):
+			line = line[:pos]
+		case ctrl('U'):
+			line = line[pos:]
+			pos = 0
+		case ctrl('W'):
+			start := wordStart(line, pos)
+			line = append(line[:start:start], line[pos:]...)
+			pos = start
+		case ctrl('L'):
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case ctrl('P'):
+			browse(-1)
+		case ctrl('N'):
+			browse(1)
+		case '\t':
+			tab = true
+			line, pos = e.completeLine(line, pos, lastTab)
+		case 0x1b:
+			switch e.readEscape() {
+			case "[A", "OA":
+				browse(-1)
+			case "[B", "OB":
+				browse(1)
+			case "[C", "OC":
+				pos = min(pos+1, len(line))
+			case "[D", "OD":
+				pos = max(pos-1, 0)
+			case "[H", "OH", "[1~", "[7~":
+				pos = 0
+			case "[F", "OF", "[4~", "[8~":
+				pos = len(line)
+			case "[3~":
+				if pos < len(line) {
+					line = append(line[:pos:pos], line[pos+1:]...)
+				}
+			case "b":
+				pos = wordStart(line, pos)
+			case "f":
+				for pos < len(line) && unicode.IsSpace(line[pos]) {
+					pos++
+				}
+				for pos < len(line) && !unicode.IsSpace(line[pos]) {
+					pos++
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line[:pos:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+		lastTab = tab
+		e.refresh(prompt, line, pos)
+	}
+}
+
+// readEscape reads the rest of an escape sequence, such as "[A" for the up
+// key, or the key pressed with Alt
+func (e *lineEditor) readEscape() string {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return ""
+	}
+	if r != '[' && r != 'O' {
+		return string(r)
+	}
+	sequence := []rune{r}
+	for {
+		next, _, err := e.in.ReadRune()
+		if err != nil {
+			return string(sequence)
+		}
+		sequence = append(sequence, next)
+		// The final byte of a control sequence is in @ to ~
+		if next >= '@' && next <= '~' {
+			return string(sequence)
+		}
+	}
+}
+
+// wordStart returns where the word before pos starts
+func wordStart(line []rune, pos int) int {
+	for pos > 0 && unicode.IsSpace(line[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !unicode.IsSpace(line[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// completeLine completes the word before pos as far as every candidate
+// agrees, and lists the candidates when that adds nothing and list is set,
+// after a second tab
+func (e *lineEditor) completeLine(line []rune, pos int, list bool) ([]rune, int) {
+	if e.complete == nil {
+		return line, pos
+	}
+	before := string(line[:pos])
+	candidates, start := e.complete(before)
+	if len(candidates) == 0 {
+		io.WriteString(e.out, "\a")
+		return line, pos
+	}
+
+	word := before[start:]
+	completion := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "/") {
+		completion += " "
+	}
+	if len(completion) > len(word) {
+		completed := []rune(before[:start] + completion)
+		return append(completed, line[pos:]...), len(completed)
+	}
+	if !list {
+		io.WriteString(e.out, "\a")
+		return line, pos
+	}
+
+	// List the candidates' last path segments, in columns
+	dir := word[:strings.LastIndexByte(word, '/')+1]
+	names := make([]string, len(candidates))
+	width := 0
+	for i, candidate := range candidates {
+		names[i] = strings.TrimPrefix(candidate, dir)
+		width = max(width, utf8.RuneCountInString(names[i])+columnGap)
+	}
+	sort.Strings(names)
+	screen := terminalWidth()
+	if screen == 0 {
+		screen = 80
+	}
+	perRow := max(screen/width, 1)
+	var b strings.Builder
+	b.WriteString("\n")
+	for i, name := range names {
+		if (i+1)%perRow == 0 || i == len(names)-1 {
+			b.WriteString(name)
+			b.WriteString("\n")
+		} else {
+			fmt.Fprintf(&b, "%-*s", width, name)
+		}
+	}
+	io.WriteString(e.out, b.String())
+	return line, pos
+}
+
+// commonPrefix returns the longest prefix shared by every string
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// refresh redraws the prompt and line with the cursor at pos, scrolling
+// lines too long for the terminal sideways
+func (e *lineEditor) refresh(prompt string, line []rune, pos int) {
+	start, end := 0, len(line)
+	if width := stdoutWidth(); width > 0 {
+		visible := max(width-utf8.RuneCountInString(prompt)-1, 1)
+		if pos > visible {
+			start = pos - visible
+		}
+		end = min(end, start+visible)
+	}
+
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(prompt)
+	b.WriteString(string(line[start:end]))
+	b.WriteString("\x1b[K")
+	if back := end - pos; back > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", back)
+	}
+	io.WriteString(e.out, b.String())
+}
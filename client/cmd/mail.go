@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// messageColumns are the text columns of message lists
+var messageColumns = []string{"receivedDateTime", "from.emailAddress.address", "subject", "isRead", "id"}
+
+// runMail lists, shows and sends messages
+func runMail(args []string) {
+	if len(args) == 0 {
+		usageError("usage: mail list [--folder NAME] [--unread] [--top N] [--all] | get ID | send --to ADDRESSES --subject TEXT --body TEXT")
+	}
+
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("mail list", flag.ExitOnError)
+		folder := flags.String("folder", "", "Mail folder ID or well-known name such as inbox or sentitems (default: all messages)")
+		unread := flags.Bool("unread", false, "Only unread messages")
+		var lf listFlags
+		lf.register(flags)
+		flags.Parse(args[1:])
+		lf.check()
+
+		path := "/me/messages"
+		if *folder != "" {
+			path = "/me/mailFolders/" + url.PathEscape(*folder) + "/messages"
+		}
+		query := url.Values{
+			"$select":  {"id,receivedDateTime,from,subject,isRead"},
+			"$orderby": {"receivedDateTime desc"},
+		}
+		if *unread {
+			query.Set("$filter", "isRead eq false")
+		}
+
+		client := newGraphClient()
+		messages, err := listItems(client, path, query, nil, lf)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printList(messages, messageColumns); err != nil {
+			fatal(err)
+		}
+
+	case "get":
+		if len(args) != 2 {
+			usageError("usage: mail get ID")
+		}
+		client := newGraphClient()
+		message, err := getItem(client, "/me/messages/"+url.PathEscape(args[1]), nil, nil)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printItem(message, []string{"id", "receivedDateTime", "from.emailAddress.address", "toRecipients", "subject", "bodyPreview"}); err != nil {
+			fatal(err)
+		}
+
+	case "send":
+		flags := flag.NewFlagSet("mail send", flag.ExitOnError)
+		to := flags.String("to", "", "Comma-separated recipient addresses")
+		cc := flags.String("cc", "", "Comma-separated CC addresses")
+		subject := flags.String("subject", "", "Subject")
+		body := flags.String("body", "", "Body text, or - to read it from stdin")
+		html := flags.Bool("html", false, "Send the body as HTML")
+		flags.Parse(args[1:])
+		if *to == "" || *subject == "" {
+			usageError("usage: mail send --to ADDRESSES --subject TEXT [--body TEXT|-] [--cc ADDRESSES] [--html]")
+		}
+		if *body == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fatal(fmt.Errorf("failed to read body: %w", err))
+			}
+			*body = string(data)
+		}
+
+		contentType := "Text"
+		if *html {
+			contentType = "HTML"
+		}
+		message := map[string]interface{}{
+			"subject":      *subject,
+			"body":         map[string]string{"contentType": contentType, "content": *body},
+			"toRecipients": recipients(*to),
+		}
+		if *cc != "" {
+			message["ccRecipients"] = recipients(*cc)
+		}
+
+		client := newGraphClient()
+		if err := client.Post("/me/sendMail", map[string]interface{}{"message": message, "saveToSentItems": true}, nil); err != nil {
+			fatal(err)
+		}
+		if !dryRun {
+			fmt.Fprintln(os.Stderr, "Message sent")
+		}
+
+	default:
+		usageError("unknown mail command %q", args[0])
+	}
+}
+
+// recipients converts comma-separated addresses to Graph recipients
+func recipients(addresses string) []map[string]interface{} {
+	var list []map[string]interface{}
+	for _, address := range splitList(addresses) {
+		list = append(list, map[string]interface{}{"emailAddress": map[string]string{"address": address}})
+	}
+	return list
+}
+
+// eventColumns are the text columns of event lists
+var eventColumns = []string{"start.dateTime", "end.dateTime", "subject", "location.displayName", "id"}
+
+// runCalendar lists and shows events
+func runCalendar(args []string) {
+	if len(args) == 0 {
+		usageError("usage: calendar list [--start TIME] [--days N] [--top N] [--all] | get ID")
+	}
+
+	// Ask for UTC so times are unambiguous whatever the mailbox's time zone
+	header := http.Header{"Prefer": {`outlook.timezone="UTC"`}}
+
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("calendar list", flag.ExitOnError)
+		start := flags.String("start", "", "Start of the window, as RFC 3339 or YYYY-MM-DD (default: now)")
+		days := flags.Int("days", 7, "Length of the window in days")
+		var lf listFlags
+		lf.register(flags)
+		flags.Parse(args[1:])
+		lf.check()
+
+		from := time.Now()
+		if *start != "" {
+			var err error
+			if from, err = parseTime(*start); err != nil {
+				usageError("%v", err)
+			}
+		}
+		to := from.AddDate(0, 0, *days)
+
+		query := url.Values{
+			"startDateTime": {from.UTC().Format(time.RFC3339)},
+			"endDateTime":   {to.UTC().Format(time.RFC3339)},
+			"$orderby":      {"start/dateTime"},
+		}
+		client := newGraphClient()
+		events, err := listItems(client, "/me/calendarView", query, header, lf)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printList(events, eventColumns); err != nil {
+			fatal(err)
+		}
+
+	case "get":
+		if len(args) != 2 {
+			usageError("usage: calendar get ID")
+		}
+		client := newGraphClient()
+		event, err := getItem(client, "/me/events/"+url.PathEscape(args[1]), nil, header)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printItem(event, []string{"id", "subject", "start.dateTime", "end.dateTime", "location.displayName", "organizer.emailAddress.address", "attendees", "bodyPreview"}); err != nil {
+			fatal(err)
+		}
+
+	default:
+		usageError("unknown calendar command %q", args[0])
+	}
+}
+
+// parseTime accepts RFC 3339 times and local YYYY-MM-DD dates
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339 or YYYY-MM-DD)", value)
+	}
+	return t, nil
+}
@@ -1,83 +1,415 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
 	"time"
+
+	"ms_graph/internal/auth"
+	"ms_graph/internal/config"
 	"ms_graph/internal/graph"
-	"ms_graph/internal/profile"
-	"ms_graph/internal/token"
 )
 
+var (
+	// profileName is the --profile flag, defaulting to MS_GRAPH_PROFILE
+	profileName = os.Getenv("MS_GRAPH_PROFILE")
+
+	// outputFlag is the --output flag; empty uses the profile's format
+	outputFlag string
+
+	// columnsFlag is the --columns flag, comma-separated property paths
+	columnsFlag string
+
+	// templateFlag is the --template flag, a text/template or @FILE
+	templateFlag string
+
+	// queryFlag is the --query flag, a JMESPath expression applied to output
+	queryFlag string
+
+	// apiVersionFlag is the --api-version flag; empty uses MS_GRAPH_API_VERSION
+	apiVersionFlag string
+
+	// verbose is the --verbose flag
+	verbose bool
+)
+
+const usage = `Usage: msgraph [global flags] COMMAND [args]
+
+Commands:
+  login                 Sign in with a device code and cache the tokens
+  logout                Remove the cached tokens
+  token                 Print an access token, or its details with --decode
+  me                    Show the signed-in user
+  users                 List, show, create and delete users
+  groups                List and show groups and their members
+  mail                  List, show and send messages
+  calendar              List and show events
+  files                 List, download, upload and delete OneDrive files
+  request               Send any request to Graph
+  shell                 Browse Graph interactively, with completion and history
+  config                Manage profiles
+  plan                  Show or apply a plan saved with --plan
+  broker                Serve tokens to local processes over a Unix socket
+  proxy                 Serve an authenticating reverse proxy for Graph
+
+Global flags:
+  --profile NAME        Profile to use (default: MS_GRAPH_PROFILE or the current profile)
+  -o, --output FORMAT   Output format: text, json, ndjson, yaml, table, csv, tsv or
+                        template (default: the profile's format or text)
+  --columns PATHS       Comma-separated properties for text, table, csv and tsv output,
+                        with dots for nested ones, e.g. id,from.emailAddress.address
+  --template TEXT       Go text/template applied to each item, or @FILE; implies -o template
+  -q, --query EXPR      JMESPath expression applied to the output, where lists are
+                        {"value": [...]}, e.g. "value[?jobTitle=='Dev'].mail"; after
+                        request, --query sets URL parameters, so use -q
+  --api-version VERSION Graph API version: v1.0 or beta (default: MS_GRAPH_API_VERSION or v1.0)
+  -v, --verbose         Log requests and credential resolution to stderr
+  --dry-run             Send reads but only print the writes that would be sent
+  --plan FILE           Like --dry-run, and save the writes to FILE
+
+Exit codes: 0 success, 1 error, 2 usage, 3 authentication or permission,
+4 not found, 5 throttled, 6 network, 7 conflict
+`
+
 func main() {
-	// Get access token from environment variable
-	accessToken := os.Getenv("MS_GRAPH_ACCESS_TOKEN")
-	if accessToken == "" {
-		fmt.Fprintf(os.Stderr, "Error: MS_GRAPH_ACCESS_TOKEN environment variable is not set\n")
-		fmt.Fprintf(os.Stderr, "Please set it with: export MS_GRAPH_ACCESS_TOKEN=your_token_here\n")
-		os.Exit(1)
-	}
-
-	// Get refresh token and tenant ID (optional)
-	refreshToken := os.Getenv("MS_GRAPH_REFRESH_TOKEN")
-	tenantID := os.Getenv("MS_GRAPH_TENANT_ID")
-
-	// Check token expiration and display info
-	tokenInfo, err := token.ParseToken(accessToken)
-	if err == nil {
-		fmt.Println("=== Token Information ===")
-		fmt.Printf("Expires At: %s\n", tokenInfo.ExpiresAt.Format(time.RFC3339))
-		fmt.Printf("Time Until Expiration: %v\n", tokenInfo.TimeUntilExp.Round(time.Second))
-		if tokenInfo.IsExpired {
-			fmt.Println("⚠️  Token is EXPIRED")
-		} else if tokenInfo.ExpiresSoon {
-			fmt.Println("⚠️  Token is expiring soon (within 10 minutes)")
-		} else {
-			fmt.Println("✓ Token is valid")
+	args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		usageError("%v", err)
+	}
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+
+	if dryRun && (args[0] == "broker" || args[0] == "proxy") {
+		usageError("--dry-run is not supported by %s", args[0])
+	}
+
+	switch args[0] {
+	case "login":
+		runLogin(args[1:])
+	case "logout":
+		runLogout(args[1:])
+	case "token":
+		runToken(args[1:])
+	case "me":
+		runMe(args[1:])
+	case "users":
+		runUsers(args[1:])
+	case "groups":
+		runGroups(args[1:])
+	case "mail":
+		runMail(args[1:])
+	case "calendar":
+		runCalendar(args[1:])
+	case "files":
+		runFiles(args[1:])
+	case "request":
+		runRequest(args[1:])
+	case "shell":
+		runShell(args[1:])
+	case "config", "profile":
+		runConfig(args[1:])
+	case "plan":
+		runPlan(args[1:])
+	case "broker":
+		runBroker(args[1:])
+	case "proxy":
+		runProxy(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		usageError("unknown command %q (run \"msgraph help\" for usage)", args[0])
+	}
+	reportPlan(false)
+}
+
+// parseGlobalFlags removes global flags such as --profile and --dry-run from
+// args. They may appear before or after the command, except after config,
+// whose own flags such as --output describe the profile being added, and
+// --query after request, which sets URL parameters there.
+func parseGlobalFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || (len(rest) > 0 && (rest[0] == "config" || rest[0] == "profile")) {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			rest = append(rest, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == "query" && len(rest) > 0 && rest[0] == "request" {
+			// request's own --query sets URL parameters
+			name = ""
+		}
+		switch name {
+		case "profile", "output", "o", "columns", "template", "query", "q", "api-version", "plan":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("%s requires a value", arg)
+				}
+				i++
+				value = args[i]
+			}
+			switch name {
+			case "profile":
+				profileName = value
+			case "output", "o":
+				outputFlag = value
+			case "columns":
+				columnsFlag = value
+			case "template":
+				templateFlag = value
+			case "query", "q":
+				queryFlag = value
+			case "api-version":
+				apiVersionFlag = value
+			case "plan":
+				planPath = value
+				dryRun = true
+			}
+		case "verbose", "v":
+			verbose = !hasValue || value == "true"
+		case "dry-run":
+			dryRun = !hasValue || value == "true"
+		default:
+			rest = append(rest, arg)
 		}
-		fmt.Println()
 	}
+	return rest, nil
+}
 
-	// Create Graph API client with automatic refresh if refresh token is available
-	var client *graph.Client
-	if refreshToken != "" {
-		fmt.Println("Using client with automatic token refresh...")
-		client = graph.NewClientWithRefresh(accessToken, refreshToken, tenantID).Client
-	} else {
-		fmt.Println("Using basic client (no automatic refresh - token will be checked but not refreshed)")
-		client = graph.NewClient(accessToken)
+// parseArgs parses flags that may come before, between or after positional
+// arguments, which the flag package alone stops at, and returns the
+// positional arguments. Everything after "--" is positional.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		rest := flags.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
 	}
+}
+
+// usageError prints a usage error and exits with exitUsage
+func usageError(format string, args ...interface{}) {
+	reportPlan(true)
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(exitUsage)
+}
+
+// fatal prints err and exits with the code for its category
+func fatal(err error) {
+	reportPlan(true)
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+// exit exits with code after printing the writes a failed dry run recorded
+func exit(code int) {
+	reportPlan(true)
+	os.Exit(code)
+}
 
-	// Get current user profile
-	fmt.Println("Fetching your profile...")
-	user, err := profile.GetMyProfile(client)
+// loadActiveProfile returns the profile selected by --profile or the config's
+// current profile; p is nil when no profiles are in use
+func loadActiveProfile() (name string, p *config.Profile, err error) {
+	cfg, err := config.LoadDefault()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error retrieving profile: %v\n", err)
-		os.Exit(1)
+		return "", nil, err
 	}
+	if profileName == "" && cfg.CurrentProfile == "" {
+		return "", nil, nil
+	}
+	return cfg.Get(profileName)
+}
 
-	// Display user information
-	fmt.Println("\n=== Your Profile ===")
-	fmt.Printf("ID: %s\n", user.ID)
-	fmt.Printf("Display Name: %s\n", user.DisplayName)
-	fmt.Printf("Given Name: %s\n", user.GivenName)
-	fmt.Printf("Surname: %s\n", user.Surname)
-	fmt.Printf("Email: %s\n", user.Mail)
-	fmt.Printf("User Principal Name: %s\n", user.UserPrincipalName)
-	if user.JobTitle != "" {
-		fmt.Printf("Job Title: %s\n", user.JobTitle)
+// credentialOptions returns the active profile's credential chain options, or
+// the environment's
+func credentialOptions() (auth.Options, error) {
+	name, p, err := loadActiveProfile()
+	if err != nil {
+		return auth.Options{}, err
 	}
-	if user.Department != "" {
-		fmt.Printf("Department: %s\n", user.Department)
+	if p != nil {
+		return p.CredentialOptions(name)
 	}
-	if user.OfficeLocation != "" {
-		fmt.Printf("Office Location: %s\n", user.OfficeLocation)
+	return auth.OptionsFromEnv()
+}
+
+// resolveCredential runs the active profile's credential chain, or the default chain:
+// environment tokens, app credentials, managed identity, token cache, Azure CLI,
+// then device code sign-in
+func resolveCredential() (*auth.ChainedCredential, *graph.TokenResponse, error) {
+	opts, err := credentialOptions()
+	if err != nil {
+		return nil, nil, err
 	}
-	if user.MobilePhone != "" {
-		fmt.Printf("Mobile Phone: %s\n", user.MobilePhone)
+
+	cred, err := auth.NewDefaultCredential(opts)
+	if err != nil {
+		return nil, nil, err
 	}
-	if len(user.BusinessPhones) > 0 {
-		fmt.Printf("Business Phones: %v\n", user.BusinessPhones)
+
+	tokenResp, err := cred.Token()
+	if err != nil {
+		return nil, nil, &authError{err: err}
 	}
+	return cred, tokenResp, nil
 }
 
+// newGraphClient returns a client for the active profile with the global
+// flags applied, exiting if no credential works
+func newGraphClient() *graph.ClientWithRefresh {
+	clientOptions, err := graphOptions()
+	if err != nil {
+		fatal(err)
+	}
+
+	cred, tokenResp, err := resolveCredential()
+	if err != nil {
+		reportPlan(true)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Run \"msgraph login\", set MS_GRAPH_ACCESS_TOKEN or configure another credential source\n")
+		os.Exit(exitCode(err))
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Using credential source: %s\n", cred.Selected())
+		for _, skip := range cred.Skipped() {
+			fmt.Fprintf(os.Stderr, "  skipped %s: %v\n", skip.Source, skip.Err)
+		}
+	}
+
+	return newClientWithCredential(cred, tokenResp, clientOptions)
+}
+
+// newClientWithCredential returns a client that renews tokens through cred,
+// reporting its failures as authentication errors
+func newClientWithCredential(cred *auth.ChainedCredential, tokenResp *graph.TokenResponse, clientOptions []graph.Option) *graph.ClientWithRefresh {
+	return graph.NewClientWithTokenSource(tokenResp.AccessToken, authSource{cred}, clientOptions...)
+}
+
+// activeCloud returns the active profile's cloud, or MS_GRAPH_CLOUD
+func activeCloud() (graph.Cloud, error) {
+	_, p, err := loadActiveProfile()
+	if err != nil {
+		return graph.Cloud{}, err
+	}
+
+	cloudName := os.Getenv("MS_GRAPH_CLOUD")
+	if p != nil && p.Cloud != "" {
+		cloudName = p.Cloud
+	}
+	return graph.CloudByName(cloudName)
+}
+
+// graphOptions returns Graph client options for the active profile's cloud,
+// or MS_GRAPH_CLOUD, the MS_GRAPH_LOG, MS_GRAPH_CACHE_TTL and
+// MS_GRAPH_API_VERSION environment variables, and --api-version, --verbose
+// and --dry-run. The API version falls back to the active profile's.
+func graphOptions() ([]graph.Option, error) {
+	cloud, err := activeCloud()
+	if err != nil {
+		return nil, err
+	}
+	opts := []graph.Option{
+		graph.WithCloud(cloud),
+		graph.WithMiddleware(graph.UserAgent("msgraph-cli"), graph.ClientRequestID()),
+	}
+
+	level := os.Getenv("MS_GRAPH_LOG")
+	if level == "" && verbose {
+		level = "debug"
+	}
+	if level != "" {
+		var logLevel slog.Level
+		if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid MS_GRAPH_LOG level %q (valid levels: debug, info, warn, error)", level)
+		}
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+		opts = append(opts, graph.WithLogger(logger))
+	}
+
+	if ttl := os.Getenv("MS_GRAPH_CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MS_GRAPH_CACHE_TTL %q: %w", ttl, err)
+		}
+		dir, err := graph.DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		store := graph.NewDiskCache(dir)
+		if err := store.Check(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, graph.WithCache(graph.NewCache(store, d)))
+	}
+
+	version := apiVersionFlag
+	if version == "" {
+		version = os.Getenv("MS_GRAPH_API_VERSION")
+	}
+	if version == "" {
+		_, p, err := loadActiveProfile()
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			version = p.APIVersion
+		}
+	}
+	switch version {
+	case "":
+	case graph.APIVersionV1, graph.APIVersionBeta:
+		opts = append(opts, graph.WithAPIVersion(version))
+	default:
+		return nil, fmt.Errorf("unknown API version %q (valid versions: %s, %s)", version, graph.APIVersionV1, graph.APIVersionBeta)
+	}
+
+	// Last, so logging and other middleware still see the planned writes
+	opts = append(opts, dryRunOptions()...)
+	return opts, nil
+}
+
+// outputFormat returns --output, or template when --template is given, or
+// the active profile's format, or text
+func outputFormat() string {
+	format := outputFlag
+	if format == "" && templateFlag != "" {
+		format = outputTemplate
+	}
+	if format == "" {
+		if _, p, err := loadActiveProfile(); err == nil && p != nil {
+			format = p.Output
+		}
+	}
+	if format == "" {
+		format = config.OutputText
+	}
+
+	switch {
+	case format == outputTemplate:
+		if templateFlag == "" {
+			usageError("-o template requires --template")
+		}
+	case !slices.Contains(config.OutputFormats, format):
+		usageError("unknown output format %q (valid formats: %s, %s)", format, strings.Join(config.OutputFormats, ", "), outputTemplate)
+	}
+	return format
+}
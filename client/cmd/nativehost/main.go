@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ms_graph/internal/nativemsg"
+	"ms_graph/internal/tokencache"
+)
+
+func main() {
+	extensionIDs := flag.String("extension-id", "", "Comma-separated IDs of the extension allowed to connect")
+	printManifest := flag.Bool("manifest", false, "Print the host manifest JSON and exit")
+	install := flag.Bool("install", false, "Install the host manifest for Chrome and Chromium and exit")
+	flag.Parse()
+
+	if *printManifest || *install {
+		if err := writeManifest(*extensionIDs, *install); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Chrome starts the host with the caller's origin as the first argument.
+	// Stdout belongs to the protocol, so diagnostics go to stderr (Chrome's log).
+	cache, err := tokencache.Default()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := nativemsg.Serve(os.Stdin, os.Stdout, cache); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeManifest prints or installs the manifest for this executable
+func writeManifest(extensionIDs string, install bool) error {
+	if extensionIDs == "" {
+		return fmt.Errorf("-extension-id is required (see chrome://extensions with Developer mode enabled)")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate host executable: %w", err)
+	}
+
+	manifest, err := nativemsg.NewManifest(exe, strings.Split(extensionIDs, ",")...)
+	if err != nil {
+		return err
+	}
+
+	if !install {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(manifest)
+	}
+
+	dirs, err := nativemsg.ManifestDirs()
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		path, err := manifest.Install(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Installed native messaging host manifest: %s\n", path)
+	}
+	return nil
+}
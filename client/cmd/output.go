@@ -0,0 +1,672 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"ms_graph/internal/config"
+	"ms_graph/internal/jmespath"
+)
+
+// outputTemplate is the -o format that runs --template; profiles cannot
+// select it, since it needs a template
+const outputTemplate = "template"
+
+const (
+	// columnGap separates table columns
+	columnGap = 2
+
+	// minColumnWidth is the narrowest a table column is squeezed to fit
+	// the terminal
+	minColumnWidth = 6
+)
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	indented.WriteByte('\n')
+	_, err = os.Stdout.Write(indented.Bytes())
+	return err
+}
+
+// printLine prints JSON compacted onto one line, for NDJSON output
+func printLine(data []byte) {
+	var line bytes.Buffer
+	if err := json.Compact(&line, data); err != nil {
+		fatal(fmt.Errorf("failed to encode output: %w", err))
+	}
+	line.WriteByte('\n')
+	os.Stdout.Write(line.Bytes())
+}
+
+// printList prints collection items in the output format, or the result of
+// --query against {"value": items}. columns are the command's text and table
+// columns, dotted property paths such as "from.emailAddress.address";
+// --columns replaces them, and nil shows every property. CSV and TSV show
+// every property unless --columns is given.
+func printList(items []json.RawMessage, columns []string) error {
+	if queryFlag != "" {
+		if items == nil {
+			items = []json.RawMessage{}
+		}
+		data, err := json.Marshal(map[string][]json.RawMessage{"value": items})
+		if err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		return printQuery(data)
+	}
+	return renderList(items, columns)
+}
+
+// renderList prints items in the output format
+func renderList(items []json.RawMessage, columns []string) error {
+	switch format := outputFormat(); format {
+	case config.OutputJSON:
+		if items == nil {
+			items = []json.RawMessage{}
+		}
+		return printJSON(items)
+	case config.OutputNDJSON:
+		for _, item := range items {
+			printLine(item)
+		}
+		return nil
+	case outputTemplate:
+		return printTemplate(items)
+	default:
+		values, err := decodeValues(items)
+		if err != nil {
+			return err
+		}
+		switch format {
+		case config.OutputYAML:
+			return writeYAML(os.Stdout, values)
+		case config.OutputCSV, config.OutputTSV:
+			return writeDelimited(os.Stdout, values, selectColumns(nil, values), format == config.OutputTSV)
+		default:
+			return writeTable(os.Stdout, values, selectColumns(columns, values), terminalWidth())
+		}
+	}
+}
+
+// printItem prints one resource in the output format, or the result of
+// --query against it: text as "name: value" lines of fields, or of every
+// top-level property except OData annotations when fields is nil, and
+// tables, CSV and TSV as a single row
+func printItem(item json.RawMessage, fields []string) error {
+	if queryFlag != "" {
+		return printQuery(item)
+	}
+	return renderItem(item, fields)
+}
+
+// renderItem prints one resource in the output format
+func renderItem(item json.RawMessage, fields []string) error {
+	switch format := outputFormat(); format {
+	case config.OutputJSON:
+		return printJSON(item)
+	case config.OutputNDJSON:
+		printLine(item)
+		return nil
+	case outputTemplate:
+		return printTemplate([]json.RawMessage{item})
+	default:
+		value, err := decodeValue(item)
+		if err != nil {
+			return fmt.Errorf("failed to decode output: %w", err)
+		}
+		values := []interface{}{value}
+		switch format {
+		case config.OutputYAML:
+			return writeYAML(os.Stdout, value)
+		case config.OutputCSV, config.OutputTSV:
+			return writeDelimited(os.Stdout, values, selectColumns(nil, values), format == config.OutputTSV)
+		case config.OutputTable:
+			return writeTable(os.Stdout, values, selectColumns(fields, values), terminalWidth())
+		}
+
+		if columnsFlag != "" {
+			fields = splitList(columnsFlag)
+		}
+		if fields == nil {
+			object, _ := value.(jsonObject)
+			for _, f := range object {
+				if !strings.HasPrefix(f.key, "@odata.") {
+					fields = append(fields, f.key)
+				}
+			}
+		}
+		width := 0
+		for _, field := range fields {
+			width = max(width, utf8.RuneCountInString(field)+1)
+		}
+		var b strings.Builder
+		for _, field := range fields {
+			line := fmt.Sprintf("%-*s%s%s", width, field+":", strings.Repeat(" ", columnGap), formatValue(lookup(value, field)))
+			b.WriteString(strings.TrimRight(line, " "))
+			b.WriteByte('\n')
+		}
+		_, err = io.WriteString(os.Stdout, b.String())
+		return err
+	}
+}
+
+// printQuery evaluates --query against data and prints the result: objects
+// as items, arrays of objects as lists, and in text, table, CSV and TSV,
+// other values one per line
+func printQuery(data []byte) error {
+	expression, err := jmespath.Compile(queryFlag)
+	if err != nil {
+		usageError("%v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var input interface{}
+	if err := decoder.Decode(&input); err != nil {
+		return fmt.Errorf("failed to decode output: %w", err)
+	}
+	result, err := expression.Search(input)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate query: %w", err)
+	}
+
+	format := outputFormat()
+	lines := format == config.OutputText || format == config.OutputTable || format == config.OutputCSV || format == config.OutputTSV
+	switch v := result.(type) {
+	case map[string]interface{}:
+		item, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		return renderItem(item, nil)
+
+	case []interface{}:
+		objects := len(v) > 0
+		items := make([]json.RawMessage, len(v))
+		for i, element := range v {
+			if _, ok := element.(map[string]interface{}); !ok {
+				objects = false
+			}
+			if items[i], err = json.Marshal(element); err != nil {
+				return fmt.Errorf("failed to encode output: %w", err)
+			}
+		}
+		if objects || !lines {
+			return renderList(items, nil)
+		}
+		if format == config.OutputCSV || format == config.OutputTSV {
+			return writeRows(os.Stdout, v, format == config.OutputTSV)
+		}
+		var b strings.Builder
+		for _, element := range v {
+			b.WriteString(formatValue(element))
+			b.WriteByte('\n')
+		}
+		_, err := io.WriteString(os.Stdout, b.String())
+		return err
+
+	default:
+		if lines {
+			if v == nil {
+				return nil
+			}
+			_, err := fmt.Fprintln(os.Stdout, formatValue(v))
+			return err
+		}
+		item, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		return renderItem(item, nil)
+	}
+}
+
+// selectColumns returns --columns, or defaults, or every flattened property
+// of values when defaults is nil
+func selectColumns(defaults []string, values []interface{}) []string {
+	if columnsFlag != "" {
+		return splitList(columnsFlag)
+	}
+	if defaults != nil {
+		return defaults
+	}
+	return flattenedKeys(values)
+}
+
+// printTemplate executes --template once per item. Items are decoded JSON, so
+// properties are reached as {{.displayName}} or {{.from.emailAddress.address}}.
+func printTemplate(items []json.RawMessage) error {
+	text := templateFlag
+	if name, ok := strings.CutPrefix(text, "@"); ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read template: %w", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		usageError("invalid template: %v", err)
+	}
+
+	for _, item := range items {
+		decoder := json.NewDecoder(bytes.NewReader(item))
+		decoder.UseNumber()
+		var data interface{}
+		if err := decoder.Decode(&data); err != nil {
+			return fmt.Errorf("failed to decode output: %w", err)
+		}
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return fmt.Errorf("failed to execute template: %w", err)
+		}
+		if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+			b.WriteByte('\n')
+		}
+		if _, err := os.Stdout.Write(b.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateFuncs are the functions available to --template besides the
+// text/template built-ins
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": func(sep string, v interface{}) string {
+		list, ok := v.([]interface{})
+		if !ok {
+			return formatValue(v)
+		}
+		parts := make([]string, len(list))
+		for i, element := range list {
+			parts[i] = formatValue(element)
+		}
+		return strings.Join(parts, sep)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// writeTable writes values as a table of columns under uppercase headers.
+// When width is positive, the widest columns are narrowed, and their values
+// truncated, until the table fits.
+func writeTable(w io.Writer, values []interface{}, columns []string, width int) error {
+	rows := make([][]string, 0, len(values)+1)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = strings.ToUpper(column)
+	}
+	rows = append(rows, header)
+	for _, value := range values {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = formatValue(lookup(value, column))
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(columns))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	fitWidths(widths, width)
+
+	var b strings.Builder
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			cell = truncate(cell, widths[i])
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+columnGap))
+			}
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteByte('\n')
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fitWidths narrows the widest columns one character at a time until the
+// table fits width, or every column is down to minColumnWidth
+func fitWidths(widths []int, width int) {
+	if width <= 0 || len(widths) == 0 {
+		return
+	}
+	total := columnGap * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	for total > width {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+// truncate shortens s to width characters, ending it with an ellipsis
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	if width <= 1 {
+		return string(runes[:width])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// writeDelimited writes values as CSV, or as TSV when tabs is set, with a
+// header row of columns
+func writeDelimited(w io.Writer, values []interface{}, columns []string, tabs bool) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	if tabs {
+		cw.Comma = '\t'
+	}
+	if err := cw.Write(columns); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	for _, value := range values {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = cellValue(lookup(value, column))
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// cellValue formats a CSV or TSV cell: strings as is, and other values as
+// in tables
+func cellValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return formatValue(value)
+}
+
+// writeRows writes query results as CSV, or TSV when tabs is set, without a
+// header: arrays, such as those from "[*].[a, b]", as rows of cells, and
+// other values as rows of one cell
+func writeRows(w io.Writer, values []interface{}, tabs bool) error {
+	cw := csv.NewWriter(w)
+	if tabs {
+		cw.Comma = '\t'
+	}
+	for _, value := range values {
+		cells, ok := value.([]interface{})
+		if !ok {
+			cells = []interface{}{value}
+		}
+		row := make([]string, len(cells))
+		for i, cell := range cells {
+			row[i] = cellValue(cell)
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// flattenedKeys returns the dotted paths of every scalar, array and empty
+// object in values, in order of first appearance, skipping OData annotations
+func flattenedKeys(values []interface{}) []string {
+	var keys []string
+	seen := map[string]bool{}
+	var flatten func(prefix string, value interface{})
+	flatten = func(prefix string, value interface{}) {
+		if object, ok := value.(jsonObject); ok && (len(object) > 0 || prefix == "") {
+			for _, f := range object {
+				if strings.HasPrefix(f.key, "@odata.") {
+					continue
+				}
+				key := f.key
+				if prefix != "" {
+					key = prefix + "." + f.key
+				}
+				flatten(key, f.value)
+			}
+			return
+		}
+		if !seen[prefix] {
+			seen[prefix] = true
+			keys = append(keys, prefix)
+		}
+	}
+	for _, value := range values {
+		flatten("", value)
+	}
+	return keys
+}
+
+// jsonObject is a decoded JSON object that keeps its keys in document order
+type jsonObject []jsonField
+
+// jsonField is one property of a jsonObject
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// get returns the value of a property
+func (o jsonObject) get(key string) (interface{}, bool) {
+	for _, f := range o {
+		if f.key == key {
+			return f.value, true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON encodes the object with its keys in their original order
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// decodeValue decodes JSON with objects as jsonObject and numbers as
+// json.Number, so output keeps Graph's property order and number formatting
+func decodeValue(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decodeNext(decoder)
+}
+
+// decodeValues decodes each item with decodeValue
+func decodeValues(items []json.RawMessage) ([]interface{}, error) {
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		value, err := decodeValue(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode output: %w", err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// decodeNext decodes the next JSON value from decoder
+func decodeNext(decoder *json.Decoder) (interface{}, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		object := jsonObject{}
+		for decoder.More() {
+			keyTok, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := keyTok.(string)
+			value, err := decodeNext(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, jsonField{key: key, value: value})
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeNext(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	default:
+		return tok, nil
+	}
+}
+
+// lookup follows a dotted path such as "start.dateTime" into a decoded value.
+// Property names that contain dots themselves, such as
+// "@microsoft.graph.downloadUrl", are matched whole.
+func lookup(value interface{}, path string) interface{} {
+	object, ok := value.(jsonObject)
+	if !ok {
+		return nil
+	}
+	if v, ok := object.get(path); ok {
+		return v
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if v, ok := object.get(path[:i]); ok {
+			if found := lookup(v, path[i+1:]); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// formatValue renders a decoded JSON value for a text column: scalars as is,
+// arrays of scalars comma-separated, and anything else as compact JSON
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.Join(strings.Fields(v), " ")
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, element := range v {
+			switch element.(type) {
+			case jsonObject, map[string]interface{}, []interface{}:
+				data, _ := json.Marshal(v)
+				return string(data)
+			}
+			parts = append(parts, formatValue(element))
+		}
+		return strings.Join(parts, ", ")
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// terminalWidth returns COLUMNS, or the width of the terminal on stdout, or
+// 0 when stdout is not a terminal
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return stdoutWidth()
+}
+
+// writeTo copies r to the file at path, or to stdout when path is "-"
+func writeTo(path string, r io.Reader) (int64, error) {
+	if path == "-" {
+		return io.Copy(os.Stdout, r)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return n, nil
+}
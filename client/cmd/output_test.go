@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setOutputFlags sets the output flags for a test and restores them after it
+func setOutputFlags(t *testing.T, output, template, columns string) {
+	t.Helper()
+	saved := [...]string{outputFlag, templateFlag, columnsFlag, queryFlag}
+	outputFlag, templateFlag, columnsFlag, queryFlag = output, template, columns, ""
+	t.Cleanup(func() {
+		outputFlag, templateFlag, columnsFlag, queryFlag = saved[0], saved[1], saved[2], saved[3]
+	})
+}
+
+// captureStdout returns what f writes to stdout
+func captureStdout(t *testing.T, f func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	err = f()
+	os.Stdout = stdout
+	w.Close()
+	out := <-done
+	r.Close()
+	if err != nil {
+		t.Fatalf("output failed: %v", err)
+	}
+	return string(out)
+}
+
+var testItems = []json.RawMessage{
+	json.RawMessage(`{"id":"1","displayName":"Adele Vance","businessPhones":["+1 425 555 0109"],"manager":{"displayName":"Alex Wilber"},"@odata.etag":"W/1"}`),
+	json.RawMessage(`{"id":"2","displayName":"no","businessPhones":[],"manager":{}}`),
+}
+
+func TestRenderList(t *testing.T) {
+	t.Setenv("COLUMNS", "200")
+	tests := []struct {
+		format, template, columns string
+		items                     []json.RawMessage
+		want                      string
+	}{
+		{format: "json", items: testItems, want: `[
+  {
+    "id": "1",
+    "displayName": "Adele Vance",
+    "businessPhones": [
+      "+1 425 555 0109"
+    ],
+    "manager": {
+      "displayName": "Alex Wilber"
+    },
+    "@odata.etag": "W/1"
+  },
+  {
+    "id": "2",
+    "displayName": "no",
+    "businessPhones": [],
+    "manager": {}
+  }
+]
+`},
+		{format: "ndjson", items: testItems, want: string(testItems[0]) + "\n" + string(testItems[1]) + "\n"},
+		{format: "yaml", items: testItems, want: `- id: "1"
+  displayName: Adele Vance
+  businessPhones:
+    - +1 425 555 0109
+  manager:
+    displayName: Alex Wilber
+  "@odata.etag": W/1
+- id: "2"
+  displayName: "no"
+  businessPhones: []
+  manager: {}
+`},
+		{format: "csv", items: testItems, want: `id,displayName,businessPhones,manager.displayName,manager
+1,Adele Vance,+1 425 555 0109,Alex Wilber,"{""displayName"":""Alex Wilber""}"
+2,no,,,{}
+`},
+		{format: "tsv", items: testItems, want: "id\tdisplayName\tbusinessPhones\tmanager.displayName\tmanager\n" +
+			"1\tAdele Vance\t+1 425 555 0109\tAlex Wilber\t\"{\"\"displayName\"\":\"\"Alex Wilber\"\"}\"\n" +
+			"2\tno\t\t\t{}\n"},
+		{format: "csv", columns: "displayName,manager.displayName", items: testItems, want: "displayName,manager.displayName\nAdele Vance,Alex Wilber\nno,\n"},
+		{format: "table", items: testItems, want: "ID  DISPLAYNAME\n1   Adele Vance\n2   no\n"},
+		{format: "text", items: testItems, want: "ID  DISPLAYNAME\n1   Adele Vance\n2   no\n"},
+		{format: "text", columns: "manager.displayName,businessPhones", items: testItems, want: "MANAGER.DISPLAYNAME  BUSINESSPHONES\nAlex Wilber          +1 425 555 0109\n\n"},
+		{format: "template", template: "{{.id}} {{.displayName}}", items: testItems, want: "1 Adele Vance\n2 no\n"},
+
+		{format: "json", want: "[]\n"},
+		{format: "ndjson", want: ""},
+		{format: "yaml", want: "[]\n"},
+		{format: "csv", want: ""},
+		{format: "tsv", want: ""},
+		{format: "table", want: "ID  DISPLAYNAME\n"},
+		{format: "template", template: "{{.id}}", want: ""},
+	}
+	for _, tc := range tests {
+		name := tc.format
+		if tc.items == nil {
+			name += " empty"
+		}
+		if tc.columns != "" {
+			name += " columns"
+		}
+		t.Run(name, func(t *testing.T) {
+			setOutputFlags(t, tc.format, tc.template, tc.columns)
+			got := captureStdout(t, func() error { return printList(tc.items, []string{"id", "displayName"}) })
+			if got != tc.want {
+				t.Errorf("output =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderItemText(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []string
+		columns string
+		want    string
+	}{
+		{
+			name: "every property",
+			want: "id:              1\n" +
+				"displayName:     Adele Vance\n" +
+				"businessPhones:  +1 425 555 0109\n" +
+				"manager:         {\"displayName\":\"Alex Wilber\"}\n",
+		},
+		{name: "fields", fields: []string{"displayName", "manager.displayName"}, want: "displayName:          Adele Vance\nmanager.displayName:  Alex Wilber\n"},
+		{name: "columns", fields: []string{"displayName"}, columns: "id", want: "id:  1\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setOutputFlags(t, "text", "", tc.columns)
+			got := captureStdout(t, func() error { return printItem(testItems[0], tc.fields) })
+			if got != tc.want {
+				t.Errorf("output =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriteTableFitsWidth(t *testing.T) {
+	values, err := decodeValues([]json.RawMessage{
+		json.RawMessage(`{"name":"report-final.docx","size":1024,"tags":["q1","sales"],"owner":{"id":"7"}}`),
+		json.RawMessage(`{"name":"a.txt","size":3,"tags":[{"k":"v"}]}`),
+	})
+	if err != nil {
+		t.Fatalf("decodeValues: %v", err)
+	}
+	tests := []struct {
+		name    string
+		columns []string
+		width   int
+		want    string
+	}{
+		{
+			name:    "unlimited",
+			columns: []string{"name", "size", "tags", "owner.id"},
+			want: "NAME               SIZE  TAGS         OWNER.ID\n" +
+				"report-final.docx  1024  q1, sales    7\n" +
+				"a.txt              3     [{\"k\":\"v\"}]\n",
+		},
+		{
+			name:    "fits",
+			columns: []string{"name", "size"},
+			width:   23,
+			want:    "NAME               SIZE\nreport-final.docx  1024\na.txt              3\n",
+		},
+		{
+			name:    "truncated",
+			columns: []string{"name", "size"},
+			width:   16,
+			want:    "NAME        SIZE\nreport-fi…  1024\na.txt       3\n",
+		},
+		{
+			name:    "no rows",
+			columns: nil,
+			want:    "\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rows := values
+			if tc.columns == nil {
+				rows = nil
+			}
+			var b strings.Builder
+			if err := writeTable(&b, rows, tc.columns, tc.width); err != nil {
+				t.Fatalf("writeTable: %v", err)
+			}
+			if b.String() != tc.want {
+				t.Errorf("writeTable =\n%s\nwant\n%s", b.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestFitWidths(t *testing.T) {
+	tests := []struct {
+		widths []int
+		width  int
+		want   []int
+	}{
+		{[]int{10, 20}, 0, []int{10, 20}},
+		{[]int{10, 20}, 40, []int{10, 20}},
+		{[]int{10, 20}, 25, []int{10, 13}},
+		{[]int{10, 20}, 16, []int{7, 7}},
+		{[]int{10, 20}, 5, []int{minColumnWidth, minColumnWidth}},
+		{[]int{3, 20}, 5, []int{3, minColumnWidth}},
+		{nil, 10, nil},
+	}
+	for _, tc := range tests {
+		widths := append([]int(nil), tc.widths...)
+		fitWidths(widths, tc.width)
+		if !reflect.DeepEqual(widths, tc.want) {
+			t.Errorf("fitWidths(%v, %d) = %v, want %v", tc.widths, tc.width, widths, tc.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"hello", 5, "hello"},
+		{"hello world", 6, "hello…"},
+		{"héllo wörld", 4, "hél…"},
+		{"abc", 1, "a"},
+		{"abc", 0, ""},
+	}
+	for _, tc := range tests {
+		if got := truncate(tc.s, tc.width); got != tc.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tc.s, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestFlattenedKeys(t *testing.T) {
+	values, err := decodeValues([]json.RawMessage{
+		json.RawMessage(`{"id":"1","from":{"emailAddress":{"name":"Adele","address":"adele@contoso.com"}},"to":[{"address":"alex@contoso.com"}],"@odata.etag":"W/1"}`),
+		json.RawMessage(`{"id":"2","from":{},"flag":{},"@microsoft.graph.downloadUrl":"https://example.com"}`),
+		json.RawMessage(`"scalar"`),
+	})
+	if err != nil {
+		t.Fatalf("decodeValues: %v", err)
+	}
+	want := []string{"id", "from.emailAddress.name", "from.emailAddress.address", "to", "from", "flag", "@microsoft.graph.downloadUrl", ""}
+	if got := flattenedKeys(values); !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenedKeys = %q, want %q", got, want)
+	}
+}
+
+func TestWriteRows(t *testing.T) {
+	values := []interface{}{
+		[]interface{}{"Adele Vance", json.Number("3"), nil},
+		"a, b",
+		[]interface{}{true, []interface{}{"x", "y"}},
+	}
+	tests := []struct {
+		tabs bool
+		want string
+	}{
+		{false, "Adele Vance,3,\n\"a, b\"\ntrue,\"x, y\"\n"},
+		{true, "Adele Vance\t3\t\na, b\ntrue\tx, y\n"},
+	}
+	for _, tc := range tests {
+		var b strings.Builder
+		if err := writeRows(&b, values, tc.tabs); err != nil {
+			t.Fatalf("writeRows: %v", err)
+		}
+		if b.String() != tc.want {
+			t.Errorf("writeRows(tabs=%v) = %q, want %q", tc.tabs, b.String(), tc.want)
+		}
+	}
+}
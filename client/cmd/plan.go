@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"ms_graph/internal/graph"
+)
+
+var (
+	// dryRun is the --dry-run flag; planPath is the --plan flag, which
+	// implies it
+	dryRun   bool
+	planPath string
+
+	// plan collects the writes of a dry run
+	plan *graph.Plan
+)
+
+// dryRunOptions returns the option that records writes in plan instead of
+// sending them, or none without --dry-run
+func dryRunOptions() []graph.Option {
+	if !dryRun {
+		return nil
+	}
+	plan = graph.NewPlan()
+	return []graph.Option{graph.WithDryRun(plan)}
+}
+
+// reportPlan prints the writes a dry run recorded to stderr, keeping stdout
+// for command output, and saves them to the --plan file. It reports once, so
+// a command that fails after main's report does not repeat it.
+func reportPlan(failed bool) {
+	p := plan
+	if p == nil {
+		return
+	}
+	plan = nil
+	if err := writePlan(os.Stderr, p, failed); err != nil {
+		fatal(err)
+	}
+}
+
+// writePlan writes p for review to w and saves it to the --plan file. When
+// the command failed, the writes it recorded before failing are shown but
+// not saved, since the plan is incomplete.
+func writePlan(w io.Writer, p *graph.Plan, failed bool) error {
+	if failed && len(p.Requests()) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	if err := p.WriteText(w); err != nil {
+		return err
+	}
+	if planPath == "" {
+		return nil
+	}
+	if failed {
+		fmt.Fprintf(w, "\nPlan not saved to %s because the command failed\n", planPath)
+		return nil
+	}
+	if err := p.Save(planPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nPlan saved to %s; apply it with: msgraph plan apply %s\n", planPath, planPath)
+	return nil
+}
+
+// runPlan shows or applies a plan saved with --plan
+func runPlan(args []string) {
+	if len(args) != 2 || (args[0] != "show" && args[0] != "apply") {
+		usageError("usage: plan show FILE | apply FILE")
+	}
+
+	if dryRun && args[0] == "apply" {
+		usageError("--dry-run is not supported by plan apply")
+	}
+
+	saved, err := graph.LoadPlan(args[1])
+	if err != nil {
+		fatal(err)
+	}
+
+	if args[0] == "show" {
+		if err := saved.WriteText(os.Stdout); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	client := newGraphClient()
+	total := len(saved.Requests())
+	applied, err := saved.Apply(client)
+	fmt.Printf("Applied %d of %d request(s)\n", applied, total)
+	if err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ms_graph/internal/graph"
+)
+
+// recordWrite records a POST in p through its middleware
+func recordWrite(t *testing.T, p *graph.Plan) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "https://graph.microsoft.com/v1.0/me/sendMail", strings.NewReader(`{"message":{"subject":"Hello"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := p.Middleware()(nil)(req); err != nil {
+		t.Fatalf("failed to record write: %v", err)
+	}
+}
+
+func TestWritePlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		writes    bool
+		failed    bool
+		save      bool
+		want      []string
+		wantSaved bool
+	}{
+		{name: "no writes", want: []string{"No changes planned"}},
+		{name: "writes", writes: true, want: []string{"Planned 1 request(s):", "1. POST https://graph.microsoft.com/v1.0/me/sendMail", `"subject": "Hello"`}},
+		{name: "saved", writes: true, save: true, want: []string{"Planned 1 request(s):", "Plan saved to "}, wantSaved: true},
+		{name: "failed without writes", failed: true, save: true},
+		{name: "failed", writes: true, failed: true, want: []string{"Planned 1 request(s):", "1. POST"}},
+		{name: "failed not saved", writes: true, failed: true, save: true, want: []string{"Planned 1 request(s):", "because the command failed"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			saved := planPath
+			t.Cleanup(func() { planPath = saved })
+			planPath = ""
+			if tc.save {
+				planPath = filepath.Join(t.TempDir(), "plan.json")
+			}
+
+			p := graph.NewPlan()
+			if tc.writes {
+				recordWrite(t, p)
+			}
+			var b strings.Builder
+			if err := writePlan(&b, p, tc.failed); err != nil {
+				t.Fatalf("writePlan: %v", err)
+			}
+
+			out := b.String()
+			if len(tc.want) == 0 && out != "" {
+				t.Errorf("output = %q, want none", out)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output = %q, want it to contain %q", out, want)
+				}
+			}
+			if !tc.save {
+				return
+			}
+			loaded, err := graph.LoadPlan(planPath)
+			if !tc.wantSaved {
+				if err == nil {
+					t.Errorf("plan was saved to %s", planPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPlan: %v", err)
+			}
+			if got := len(loaded.Requests()); got != 1 {
+				t.Errorf("saved plan has %d requests, want 1", got)
+			}
+		})
+	}
+}
+
+func TestReportPlanReportsOnce(t *testing.T) {
+	saved := plan
+	t.Cleanup(func() { plan = saved })
+	plan = graph.NewPlan()
+
+	// A failed command with no writes prints nothing
+	reportPlan(true)
+	if plan != nil {
+		t.Error("plan is still set after reportPlan, want it reported once")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"ms_graph/internal/config"
+	"ms_graph/internal/graph"
+	"ms_graph/internal/tokencache"
+)
+
+// runConfig shows the configuration and manages named profiles
+func runConfig(args []string) {
+	if len(args) == 0 {
+		usageError("usage: config show | path | list | use NAME | add NAME [flags] | remove NAME")
+	}
+
+	switch args[0] {
+	case "path":
+		path, err := config.DefaultPath()
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(path)
+	case "show":
+		showConfig()
+	default:
+		runProfile(args)
+	}
+}
+
+// showConfig prints the active profile and the settings it resolves to
+func showConfig() {
+	name, p, err := loadActiveProfile()
+	if err != nil {
+		fatal(err)
+	}
+	configPath, err := config.DefaultPath()
+	if err != nil {
+		fatal(err)
+	}
+	cachePath, err := tokencache.DefaultPath()
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("Config file: %s\n", configPath)
+	fmt.Printf("Token cache: %s\n", cachePath)
+	if p == nil {
+		fmt.Println("Profile: none (using the environment)")
+		return
+	}
+	fmt.Printf("Profile: %s\n", name)
+	fmt.Printf("  auth=%s tenant=%s client-id=%s cloud=%s api=%s output=%s\n",
+		p.AuthMethod, valueOr(p.TenantID, "-"), valueOr(p.ClientID, "-"), valueOr(p.Cloud, "global"), valueOr(p.APIVersion, graph.APIVersionV1), valueOr(p.Output, config.OutputText))
+	if p.CertificatePath != "" {
+		fmt.Printf("  certificate=%s\n", p.CertificatePath)
+	}
+}
+
+// runProfile manages named profiles: list, use, add and remove
+func runProfile(args []string) {
+	path, err := config.DefaultPath()
+	if err != nil {
+		fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		fatal(err)
+	}
+
+	switch args[0] {
+	case "list":
+		if len(cfg.Profiles) == 0 {
+			fmt.Printf("No profiles configured in %s\n", path)
+			return
+		}
+		for _, name := range cfg.Names() {
+			p := cfg.Profiles[name]
+			marker := " "
+			if name == cfg.CurrentProfile {
+				marker = "*"
+			}
+			fmt.Printf("%s %-20s auth=%s tenant=%s cloud=%s api=%s output=%s\n",
+				marker, name, p.AuthMethod, valueOr(p.TenantID, "-"), valueOr(p.Cloud, "global"), valueOr(p.APIVersion, graph.APIVersionV1), valueOr(p.Output, config.OutputText))
+		}
+		return
+
+	case "use":
+		if len(args) != 2 {
+			usageError("usage: config use NAME")
+		}
+		if err := cfg.Use(args[1]); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Switched to profile %q\n", args[1])
+
+	case "add":
+		if len(args) < 2 {
+			usageError("usage: config add NAME [--auth METHOD] [--tenant ID] [--client-id ID] [--certificate PATH] [--cloud CLOUD] [--api-version VERSION] [--output FORMAT]")
+		}
+		name := args[1]
+
+		flags := flag.NewFlagSet("config add", flag.ExitOnError)
+		authMethod := flags.String("auth", config.AuthDefault, "Auth method: default, environment, client-credential, managed-identity, token-cache, azure-cli or device-code")
+		tenantID := flags.String("tenant", "", "Tenant ID or domain")
+		clientID := flags.String("client-id", "", "App registration client ID")
+		certificate := flags.String("certificate", "", "PEM certificate and key for client-credential")
+		cloud := flags.String("cloud", "", "National cloud: global, usgovhigh, usgovdod or china")
+		apiVersion := flags.String("api-version", "", "Default API version: v1.0 or beta")
+		output := flags.String("output", "", "Default output format: text, json, ndjson, yaml, table, csv or tsv")
+		flags.Parse(args[2:])
+
+		p := &config.Profile{
+			AuthMethod:      *authMethod,
+			TenantID:        *tenantID,
+			ClientID:        *clientID,
+			CertificatePath: *certificate,
+			Cloud:           *cloud,
+			APIVersion:      *apiVersion,
+			Output:          *output,
+		}
+		if err := cfg.Add(name, p); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Added profile %q\n", name)
+
+	case "remove":
+		if len(args) != 2 {
+			usageError("usage: config remove NAME")
+		}
+		if err := cfg.Remove(args[1]); err != nil {
+			fatal(err)
+		}
+		// Keep the tokens until the profile is gone from the file, so a failed
+		// save leaves a working profile behind
+		if err := cfg.Save(path); err != nil {
+			fatal(err)
+		}
+		// Cached tokens belong to the profile and go with it
+		if err := config.DeleteCachedTokens(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove cached tokens: %v\n", err)
+		}
+		fmt.Printf("Removed profile %q\n", args[1])
+		return
+
+	default:
+		usageError("unknown config command %q", args[0])
+	}
+
+	if err := cfg.Save(path); err != nil {
+		fatal(err)
+	}
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
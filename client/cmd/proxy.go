@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/proxy"
+)
+
+// runProxy serves an authenticating reverse proxy for Graph on a local port
+func runProxy(args []string) {
+	flags := flag.NewFlagSet("proxy", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8080", "Address to listen on")
+	upstream := flags.String("upstream", "", "Graph host to forward to (default: the profile's cloud)")
+	insecureUpstream := flags.Bool("insecure-upstream", false, "Allow an https --upstream other than the cloud's Graph endpoint, such as a test server")
+	methods := flags.String("allow-method", "GET", "Comma-separated HTTP methods to forward")
+	paths := flags.String("allow-path", "/v1.0,/beta", "Comma-separated path prefixes to forward (* matches one segment)")
+	maxRetries := flags.Int("max-retries", proxy.DefaultMaxRetries, "Retries for throttled (429/503/504) responses; 0 disables retries")
+	flags.Parse(args)
+
+	// The proxy hands out your identity to anyone who can reach it
+	if host, _, err := net.SplitHostPort(*listen); err == nil {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			log.Printf("Warning: listening on %s exposes your Graph credentials beyond this machine", *listen)
+		}
+	}
+
+	clientOptions, err := graphOptions()
+	if err != nil {
+		fatal(err)
+	}
+	// The proxy forwards to the client's cloud, so an upstream replaces its
+	// Graph endpoint
+	cloud, err := activeCloud()
+	if err != nil {
+		fatal(err)
+	}
+	cloud, err = proxy.UpstreamCloud(cloud, *upstream, *insecureUpstream)
+	if err != nil {
+		fatal(err)
+	}
+	clientOptions = append(clientOptions, graph.WithCloud(cloud))
+
+	cred, tokenResp, err := resolveCredential()
+	if err != nil {
+		fatal(err)
+	}
+	log.Printf("Using credential source: %s", cred.Selected())
+	for _, skip := range cred.Skipped() {
+		log.Printf("  skipped %s: %v", skip.Source, skip.Err)
+	}
+
+	client := graph.NewClientWithTokenSource(tokenResp.AccessToken, cred, clientOptions...)
+	handler, err := proxy.New(client, proxy.Config{
+		ListenAddr:     *listen,
+		AllowedMethods: splitList(*methods),
+		AllowedPaths:   splitList(*paths),
+		MaxRetries:     *maxRetries,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	server := &http.Server{Addr: *listen, Handler: handler}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	log.Printf("Graph proxy listening on http://%s (methods: %s; paths: %s)", *listen, *methods, *paths)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal(err)
+	}
+	log.Printf("Graph proxy stopped")
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
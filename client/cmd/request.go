@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ms_graph/internal/config"
+	"ms_graph/internal/graph"
+)
+
+// repeatedFlag collects every value of a flag that may be given more than once
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string { return strings.Join(*r, ", ") }
+
+func (r *repeatedFlag) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// runRequest sends any request to Graph, like an authenticated curl, and
+// prints the response body
+func runRequest(args []string) {
+	const usage = "usage: request METHOD PATH [--query NAME=VALUE]... [--header 'NAME: VALUE']... [--body JSON|@FILE|@-] [--paginate] [--include]"
+
+	flags := flag.NewFlagSet("request", flag.ExitOnError)
+	var queries, headers repeatedFlag
+	flags.Var(&queries, "query", "Query parameter as NAME=VALUE, e.g. '$top=5' (repeatable)")
+	flags.Var(&headers, "header", "Request header as 'NAME: VALUE' (repeatable)")
+	body := flags.String("body", "", "Request body: JSON, @FILE to read a file, or @- to read stdin")
+	paginate := flags.Bool("paginate", false, "Follow @odata.nextLink and print each item as a line of JSON")
+	include := flags.Bool("include", false, "Print the response status and headers before the body")
+	positional := parseArgs(flags, args)
+	if len(positional) != 2 {
+		usageError(usage)
+	}
+
+	req := &graph.Request{Method: strings.ToUpper(positional[0]), Path: positional[1]}
+	if len(queries) > 0 {
+		req.Query = url.Values{}
+		for _, query := range queries {
+			name, value, ok := strings.Cut(query, "=")
+			if !ok || name == "" {
+				usageError("invalid --query %q (use NAME=VALUE)", query)
+			}
+			req.Query.Add(name, value)
+		}
+	}
+	if len(headers) > 0 {
+		req.Header = http.Header{}
+		for _, header := range headers {
+			name, value, ok := strings.Cut(header, ":")
+			if !ok || strings.TrimSpace(name) == "" {
+				usageError("invalid --header %q (use 'NAME: VALUE')", header)
+			}
+			req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		// The client sets Content-Type from the request's ContentType
+		req.ContentType = req.Header.Get("Content-Type")
+		req.Header.Del("Content-Type")
+	}
+	if *body != "" {
+		data, contentType, err := readBody(*body)
+		if err != nil {
+			fatal(err)
+		}
+		req.Body = bytes.NewReader(data)
+		if req.ContentType == "" {
+			req.ContentType = contentType
+		}
+	}
+	if *paginate && req.Method != http.MethodGet {
+		usageError("--paginate only applies to GET requests")
+	}
+
+	// Text and JSON print the body as is, and text and NDJSON stream pages
+	// as NDJSON; other formats and --query render the item, or the
+	// collection's items
+	format := outputFormat()
+	raw := (format == config.OutputText || format == config.OutputNDJSON) && queryFlag == ""
+
+	client := newGraphClient()
+	var items []json.RawMessage
+	for {
+		resp, err := client.Do(req)
+		if err != nil {
+			var graphErr *graph.GraphError
+			if *include && errors.As(err, &graphErr) {
+				printStatus(graphErr.StatusCode, graphErr.Header)
+				printBody([]byte(graphErr.Body))
+				exit(exitCode(err))
+			}
+			fatal(err)
+		}
+		if *include {
+			printStatus(resp.StatusCode, resp.Header)
+		}
+
+		if !*paginate && ((format == config.OutputText || format == config.OutputJSON) && queryFlag == "" || !json.Valid(resp.Body)) {
+			printBody(resp.Body)
+			return
+		}
+
+		var page graph.Collection[json.RawMessage]
+		isCollection := resp.Decode(&page) == nil && page.Value != nil
+		if !isCollection || (!*paginate && queryFlag != "") {
+			// Not a collection, or a query against the whole body
+			if raw {
+				printLine(resp.Body)
+			} else if err := printItem(resp.Body, nil); err != nil {
+				fatal(err)
+			}
+			return
+		}
+		if raw {
+			for _, item := range page.Value {
+				printLine(item)
+			}
+		} else {
+			items = append(items, page.Value...)
+		}
+		if !*paginate || page.NextLink == "" {
+			break
+		}
+		// The next link carries the query already
+		req = &graph.Request{Method: http.MethodGet, Path: page.NextLink, Header: req.Header}
+	}
+	if !raw {
+		if err := printList(items, nil); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// readBody reads a --body value: @FILE reads a file and @- reads stdin, and
+// anything else is the body itself. Bodies that are not JSON are sent with
+// the file's MIME type, or as application/octet-stream.
+func readBody(value string) ([]byte, string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return []byte(value), "", nil
+	}
+
+	name := strings.TrimPrefix(value, "@")
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read body: %w", err)
+	}
+
+	if json.Valid(data) {
+		return data, "", nil
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return data, contentType, nil
+}
+
+// printStatus prints a status line and headers sorted by name, then a blank line
+func printStatus(statusCode int, header http.Header) {
+	fmt.Printf("HTTP %d %s\n", statusCode, http.StatusText(statusCode))
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Printf("%s: %s\n", name, value)
+		}
+	}
+	fmt.Println()
+}
+
+// printBody prints a response body, indented when it is JSON
+func printBody(body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	if json.Valid(body) {
+		if err := printJSON(json.RawMessage(body)); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	os.Stdout.Write(body)
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ms_graph/internal/config"
+	"ms_graph/internal/graph"
+)
+
+const (
+	// shellHistoryLimit is how many lines the shell's history file keeps
+	shellHistoryLimit = 1000
+
+	// shellRefreshInterval is how often the shell checks whether its token
+	// needs refreshing
+	shellRefreshInterval = time.Minute
+
+	// shellListingLimit is how many paths the shell remembers listed IDs for
+	shellListingLimit = 50
+)
+
+// shellColumns are the properties ls shows, when items have them, after id
+var shellColumns = []string{"displayName", "name", "subject", "userPrincipalName", "mail", "lastModifiedDateTime"}
+
+// odataOptions are the query options set accepts without their "$"
+var odataOptions = []string{"count", "expand", "filter", "format", "orderby", "search", "select", "skip", "skipToken", "top"}
+
+// shellCommand is a command of the interactive shell
+type shellCommand struct {
+	name  string
+	usage string
+	help  string
+
+	// completesPath is set for commands whose first argument is a path
+	completesPath bool
+
+	run func(sh *shell, args string) error
+}
+
+// shellCommands are the shell's commands, in the order help lists them. They
+// are set in init, since help refers to them.
+var shellCommands []shellCommand
+
+func init() {
+	shellCommands = []shellCommand{
+		{name: "cd", usage: "cd [PATH]", help: "Change the current path, or go back to /", completesPath: true, run: (*shell).cd},
+		{name: "pwd", usage: "pwd", help: "Print the current path", run: (*shell).pwd},
+		{name: "ls", usage: "ls [PATH]", help: "List a collection, remembering IDs for completion", completesPath: true, run: (*shell).ls},
+		{name: "next", usage: "next", help: "Show the next page of the last listing", run: (*shell).nextPage},
+		{name: "get", usage: "get [PATH]", help: "Show a resource or collection", completesPath: true, run: (*shell).get},
+		{name: "post", usage: "post PATH [JSON]", help: "Create a resource or call an action", completesPath: true, run: shellWrite(http.MethodPost)},
+		{name: "patch", usage: "patch PATH JSON", help: "Update a resource", completesPath: true, run: shellWrite(http.MethodPatch)},
+		{name: "put", usage: "put PATH JSON", help: "Replace a resource", completesPath: true, run: shellWrite(http.MethodPut)},
+		{name: "delete", usage: "delete PATH", help: "Delete a resource", completesPath: true, run: (*shell).delete},
+		{name: "set", usage: "set [NAME VALUE]", help: "Set a query option for ls and get, e.g. set top 10, or list them", run: (*shell).set},
+		{name: "unset", usage: "unset NAME|all", help: "Remove a query option", run: (*shell).unset},
+		{name: "history", usage: "history", help: "Print the command history", run: (*shell).showHistory},
+		{name: "help", usage: "help", help: "Print this help", run: (*shell).help},
+		{name: "exit", usage: "exit", help: "Leave the shell, as does Ctrl-D"},
+	}
+}
+
+// findShellCommand returns the command called name, or nil
+func findShellCommand(name string) *shellCommand {
+	if name == "quit" {
+		name = "exit"
+	}
+	for i := range shellCommands {
+		if shellCommands[i].name == name {
+			return &shellCommands[i]
+		}
+	}
+	return nil
+}
+
+// shell is an interactive session sharing one client, so its token is
+// refreshed in the background rather than on each command
+type shell struct {
+	client *graph.ClientWithRefresh
+	cwd    string
+
+	// query holds the default query options for ls and get
+	query url.Values
+
+	// next is the @odata.nextLink of the last listing, which listed nextPath
+	next     string
+	nextPath string
+
+	// listings holds the IDs ls found, by path, for completion
+	listings     map[string][]string
+	listingOrder []string
+
+	history []string
+
+	mu         sync.Mutex
+	notices    []string
+	lastNotice string
+}
+
+// runShell starts an interactive shell. Commands are read with line editing
+// when stdin is a terminal, and as plain lines otherwise, so a script can be
+// piped in.
+func runShell(args []string) {
+	if len(args) != 0 {
+		usageError("usage: shell")
+	}
+
+	sh := &shell{
+		client:   newGraphClient(),
+		cwd:      "/",
+		query:    url.Values{},
+		listings: map[string][]string{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sh.client.RefreshInBackground(ctx, shellRefreshInterval, sh.notice)
+
+	if !isTerminal(os.Stdin.Fd()) {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if !sh.execute(scanner.Text()) {
+				break
+			}
+		}
+		return
+	}
+
+	historyPath, err := shellHistoryPath()
+	if err != nil {
+		fatal(err)
+	}
+	if sh.history, err = loadShellHistory(historyPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	editor := &lineEditor{
+		fd:       os.Stdin.Fd(),
+		in:       bufio.NewReader(os.Stdin),
+		out:      os.Stdout,
+		complete: sh.complete,
+	}
+	fmt.Println(`Type "help" for commands and Tab to complete paths; Ctrl-D exits`)
+	for {
+		sh.showNotices()
+		editor.history = sh.history
+		line, err := editor.readLine("msgraph:" + sh.cwd + "> ")
+		if errors.Is(err, errInterrupted) {
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				fatal(err)
+			}
+			return
+		}
+
+		if line = strings.TrimSpace(line); line != "" && (len(sh.history) == 0 || sh.history[len(sh.history)-1] != line) {
+			sh.history = append(sh.history, line)
+			if err := appendShellHistory(historyPath, line); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		if !sh.execute(line) {
+			return
+		}
+	}
+}
+
+// execute runs a command line, printing any error, and reports whether the
+// shell should go on
+func (sh *shell) execute(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return true
+	}
+	name, args, _ := strings.Cut(line, " ")
+	command := findShellCommand(name)
+	if command == nil {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q (type \"help\" for commands)\n", name)
+		return true
+	}
+	if command.run == nil {
+		return false
+	}
+	if err := command.run(sh, strings.TrimSpace(args)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return true
+}
+
+// notice records a background refresh failure to show before the next
+// prompt, skipping repeats of the last one
+func (sh *shell) notice(err error) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if message := err.Error(); message != sh.lastNotice {
+		sh.notices = append(sh.notices, message)
+		sh.lastNotice = message
+	}
+}
+
+// showNotices prints the notices recorded since the last prompt
+func (sh *shell) showNotices() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for _, message := range sh.notices {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+	}
+	sh.notices = nil
+}
+
+// resolve returns the absolute path for p relative to the current path,
+// keeping any query string
+func (sh *shell) resolve(p string) string {
+	p, query, hasQuery := strings.Cut(p, "?")
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(sh.cwd, p)
+	}
+	p = path.Clean(p)
+	if hasQuery {
+		p += "?" + query
+	}
+	return p
+}
+
+// header returns the headers for ls and get: advanced queries with $search
+// or $count need ConsistencyLevel: eventual
+func (sh *shell) header() http.Header {
+	if sh.query.Has("$search") || sh.query.Has("$count") {
+		return http.Header{"ConsistencyLevel": {"eventual"}}
+	}
+	return nil
+}
+
+// cd changes the current path
+func (sh *shell) cd(args string) error {
+	if args == "" {
+		args = "/"
+	}
+	target := sh.resolve(args)
+	if strings.Contains(target, "?") {
+		return errors.New("cd takes a path without a query")
+	}
+	sh.cwd = target
+	return nil
+}
+
+// pwd prints the current path
+func (sh *shell) pwd(args string) error {
+	fmt.Println(sh.cwd)
+	return nil
+}
+
+// ls lists the collection at a path, a page at a time
+func (sh *shell) ls(args string) error {
+	target := sh.resolve(args)
+	resp, err := sh.client.Do(&graph.Request{Method: http.MethodGet, Path: target, Query: sh.query, Header: sh.header()})
+	if err != nil {
+		return err
+	}
+	var page graph.Collection[json.RawMessage]
+	if err := resp.Decode(&page); err != nil || page.Value == nil {
+		// Not a collection, so show the resource instead
+		return printItem(resp.Body, nil)
+	}
+
+	listed, _, _ := strings.Cut(target, "?")
+	sh.next, sh.nextPath = page.NextLink, listed
+	sh.remember(listed, page.Value, false)
+	return sh.printPage(page)
+}
+
+// nextPage lists the next page of the last listing
+func (sh *shell) nextPage(args string) error {
+	if sh.next == "" {
+		return errors.New("no more items")
+	}
+	var page graph.Collection[json.RawMessage]
+	resp, err := sh.client.Do(&graph.Request{Method: http.MethodGet, Path: sh.next, Header: sh.header()})
+	if err != nil {
+		return err
+	}
+	if err := resp.Decode(&page); err != nil {
+		return err
+	}
+	sh.next = page.NextLink
+	sh.remember(sh.nextPath, page.Value, true)
+	return sh.printPage(page)
+}
+
+// printPage prints a page of items with ls's columns, and how to get more
+func (sh *shell) printPage(page graph.Collection[json.RawMessage]) error {
+	var columns []string
+	if len(page.Value) > 0 {
+		var first map[string]json.RawMessage
+		json.Unmarshal(page.Value[0], &first)
+		columns = []string{"id"}
+		for _, column := range shellColumns {
+			if _, ok := first[column]; ok && len(columns) < 4 {
+				columns = append(columns, column)
+			}
+		}
+	}
+	if err := printList(page.Value, columns); err != nil {
+		return err
+	}
+	if page.NextLink != "" {
+		fmt.Fprintln(os.Stderr, `More items: type "next"`)
+	}
+	return nil
+}
+
+// remember records the IDs of listed items for completing paths under
+// listed, forgetting the oldest listing beyond shellListingLimit
+func (sh *shell) remember(listed string, items []json.RawMessage, more bool) {
+	var ids []string
+	if more {
+		ids = sh.listings[listed]
+	}
+	for _, item := range items {
+		var resource struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(item, &resource) == nil && resource.ID != "" {
+			ids = append(ids, resource.ID)
+		}
+	}
+
+	if _, ok := sh.listings[listed]; !ok {
+		sh.listingOrder = append(sh.listingOrder, listed)
+		if len(sh.listingOrder) > shellListingLimit {
+			delete(sh.listings, sh.listingOrder[0])
+			sh.listingOrder = sh.listingOrder[1:]
+		}
+	}
+	sh.listings[listed] = ids
+}
+
+// get shows the resource or collection at a path as it is returned
+func (sh *shell) get(args string) error {
+	resp, err := sh.client.Do(&graph.Request{Method: http.MethodGet, Path: sh.resolve(args), Query: sh.query, Header: sh.header()})
+	if err != nil {
+		return err
+	}
+	if outputFormat() == config.OutputText && queryFlag == "" || !json.Valid(resp.Body) {
+		printBody(resp.Body)
+		return nil
+	}
+	return printItem(resp.Body, nil)
+}
+
+// shellWrite returns a command that sends method with an inline JSON body
+// after the path, which only POST may leave out
+func shellWrite(method string) func(*shell, string) error {
+	return func(sh *shell, args string) error {
+		target, body, _ := strings.Cut(args, " ")
+		if target == "" {
+			return fmt.Errorf("usage: %s PATH [JSON]", strings.ToLower(method))
+		}
+		req := &graph.Request{Method: method, Path: sh.resolve(target)}
+		if body = strings.TrimSpace(body); body != "" {
+			if !json.Valid([]byte(body)) {
+				return errors.New("the body is not valid JSON")
+			}
+			req.Body = bytes.NewReader([]byte(body))
+		} else if method != http.MethodPost {
+			return fmt.Errorf("usage: %s PATH JSON", strings.ToLower(method))
+		}
+		return sh.send(req)
+	}
+}
+
+// delete deletes the resource at a path, which must be given
+func (sh *shell) delete(args string) error {
+	if args == "" {
+		return errors.New("usage: delete PATH")
+	}
+	return sh.send(&graph.Request{Method: http.MethodDelete, Path: sh.resolve(args)})
+}
+
+// send sends a write and prints the response body, or its status when there
+// is none
+func (sh *shell) send(req *graph.Request) error {
+	resp, err := sh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if len(resp.Body) == 0 {
+		fmt.Printf("%d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+		return nil
+	}
+	printBody(resp.Body)
+	return nil
+}
+
+// set sets a default query option, adding the "$" that OData options need,
+// or lists the options when no name is given
+func (sh *shell) set(args string) error {
+	if args == "" {
+		names := make([]string, 0, len(sh.query))
+		for name := range sh.query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s=%s\n", name, sh.query.Get(name))
+		}
+		return nil
+	}
+
+	name, value, _ := strings.Cut(args, " ")
+	if value = strings.TrimSpace(value); value == "" {
+		return errors.New("usage: set NAME VALUE")
+	}
+	sh.query.Set(queryOptionName(name), value)
+	return nil
+}
+
+// unset removes a default query option, or all of them
+func (sh *shell) unset(args string) error {
+	switch args {
+	case "":
+		return errors.New("usage: unset NAME|all")
+	case "all":
+		sh.query = url.Values{}
+	default:
+		name := queryOptionName(args)
+		if !sh.query.Has(name) {
+			return fmt.Errorf("%s is not set", name)
+		}
+		sh.query.Del(name)
+	}
+	return nil
+}
+
+// queryOptionName returns name with the "$" prefix if it is an OData option
+func queryOptionName(name string) string {
+	for _, option := range odataOptions {
+		if strings.EqualFold(name, option) {
+			return "$" + option
+		}
+	}
+	return name
+}
+
+// showHistory prints the command history, numbered
+func (sh *shell) showHistory(args string) error {
+	for i, line := range sh.history {
+		fmt.Printf("%5d  %s\n", i+1, line)
+	}
+	return nil
+}
+
+// help lists the commands
+func (sh *shell) help(args string) error {
+	width := 0
+	for _, command := range shellCommands {
+		width = max(width, len(command.usage))
+	}
+	for _, command := range shellCommands {
+		fmt.Printf("  %-*s  %s\n", width, command.usage, command.help)
+	}
+	fmt.Println("\nPaths are relative to the current path unless they start with /, and may")
+	fmt.Println("include a query, e.g. ls messages?$filter=isRead eq false")
+	return nil
+}
+
+// complete returns completions for the word that ends line: commands first,
+// then navigation properties and listed IDs for paths, and option names for
+// set and unset
+func (sh *shell) complete(line string) ([]string, int) {
+	start := strings.LastIndexByte(line, ' ') + 1
+	word := line[start:]
+	fields := strings.Fields(line[:start])
+
+	var names []string
+	switch {
+	case len(fields) == 0:
+		for _, command := range shellCommands {
+			names = append(names, command.name)
+		}
+	case len(fields) > 1:
+		return nil, start
+	case fields[0] == "set":
+		names = odataOptions
+	case fields[0] == "unset":
+		for name := range sh.query {
+			names = append(names, strings.TrimPrefix(name, "$"))
+		}
+		names = append(names, "all")
+	default:
+		if command := findShellCommand(fields[0]); command != nil && command.completesPath {
+			return sh.completePath(word), start
+		}
+		return nil, start
+	}
+
+	var candidates []string
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates, start
+}
+
+// completePath returns the paths that complete word, from the navigation
+// properties of the path it is in and the IDs last listed there
+func (sh *shell) completePath(word string) []string {
+	dir, partial := "", word
+	if i := strings.LastIndexByte(word, '/'); i >= 0 {
+		dir, partial = word[:i+1], word[i+1:]
+	}
+	parent := sh.resolve(dir)
+
+	seen := map[string]bool{}
+	var candidates []string
+	for _, name := range append(navigationProperties(parent), sh.listings[parent]...) {
+		if strings.HasPrefix(name, partial) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, dir+name+"/")
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// shellHistoryPath returns MS_GRAPH_HISTORY, or shell_history next to the
+// config file
+func shellHistoryPath() (string, error) {
+	if p := os.Getenv("MS_GRAPH_HISTORY"); p != "" {
+		return p, nil
+	}
+	configPath, err := config.DefaultPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "shell_history"), nil
+}
+
+// loadShellHistory reads the history file, trimming it to the last
+// shellHistoryLimit lines; a missing or unreadable file is an empty history.
+// The lines are returned along with any error rewriting the trimmed file.
+func loadShellHistory(p string) ([]string, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, nil
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > shellHistoryLimit {
+		lines = lines[len(lines)-shellHistoryLimit:]
+		if err := os.WriteFile(p, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+			return lines, fmt.Errorf("failed to trim history file: %w", err)
+		}
+	}
+	return lines, nil
+}
+
+// appendShellHistory adds a line to the history file, which is private to
+// the user since commands may contain data
+func appendShellHistory(p, line string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestShell returns a shell without a client, for its local commands
+func newTestShell(cwd string) *shell {
+	return &shell{cwd: cwd, query: url.Values{}, listings: map[string][]string{}}
+}
+
+// listed returns items with the given IDs, as ls decodes them
+func listed(ids ...string) []json.RawMessage {
+	items := make([]json.RawMessage, len(ids))
+	for i, id := range ids {
+		items[i] = json.RawMessage(fmt.Sprintf(`{"id":%q,"displayName":"Item %d"}`, id, i))
+	}
+	return items
+}
+
+func TestShellResolve(t *testing.T) {
+	tests := []struct {
+		cwd, path, want string
+	}{
+		{"/me", "", "/me"},
+		{"/me", "messages", "/me/messages"},
+		{"/me", "/users", "/users"},
+		{"/me", "..", "/"},
+		{"/", "..", "/"},
+		{"/me", "../users/1/", "/users/1"},
+		{"/me", "./mailFolders//inbox", "/me/mailFolders/inbox"},
+		{"/me", "messages?$top=5", "/me/messages?$top=5"},
+		{"/me", "messages?$filter=from/address eq 'a/../b'", "/me/messages?$filter=from/address eq 'a/../b'"},
+	}
+	for _, tc := range tests {
+		if got := newTestShell(tc.cwd).resolve(tc.path); got != tc.want {
+			t.Errorf("resolve(%q) in %s = %q, want %q", tc.path, tc.cwd, got, tc.want)
+		}
+	}
+}
+
+func TestShellCd(t *testing.T) {
+	sh := newTestShell("/")
+	for _, step := range []struct {
+		args, want string
+	}{
+		{"me", "/me"},
+		{"messages", "/me/messages"},
+		{"..", "/me"},
+		{"", "/"},
+	} {
+		if err := sh.cd(step.args); err != nil {
+			t.Fatalf("cd %s: %v", step.args, err)
+		}
+		if sh.cwd != step.want {
+			t.Errorf("cd %q: cwd = %s, want %s", step.args, sh.cwd, step.want)
+		}
+	}
+	if err := sh.cd("users?$top=1"); err == nil {
+		t.Error("cd accepted a path with a query")
+	}
+}
+
+func TestQueryOptionName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"top", "$top"},
+		{"TOP", "$top"},
+		{"skiptoken", "$skipToken"},
+		{"orderBy", "$orderby"},
+		{"$top", "$top"},
+		{"api-version", "api-version"},
+	}
+	for _, tc := range tests {
+		if got := queryOptionName(tc.name); got != tc.want {
+			t.Errorf("queryOptionName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestShellSetAndUnset(t *testing.T) {
+	sh := newTestShell("/")
+	steps := []struct {
+		command string
+		args    string
+		wantErr string
+		want    url.Values
+	}{
+		{command: "set", args: "top 10", want: url.Values{"$top": {"10"}}},
+		{command: "set", args: "Filter isRead eq false", want: url.Values{"$top": {"10"}, "$filter": {"isRead eq false"}}},
+		{command: "set", args: "top 5", want: url.Values{"$top": {"5"}, "$filter": {"isRead eq false"}}},
+		{command: "set", args: "custom yes", want: url.Values{"$top": {"5"}, "$filter": {"isRead eq false"}, "custom": {"yes"}}},
+		{command: "set", args: "top", wantErr: "usage: set NAME VALUE"},
+		{command: "set", args: "top   ", wantErr: "usage: set NAME VALUE"},
+		{command: "unset", args: "TOP", want: url.Values{"$filter": {"isRead eq false"}, "custom": {"yes"}}},
+		{command: "unset", args: "top", wantErr: "$top is not set"},
+		{command: "unset", args: "", wantErr: "usage: unset NAME|all"},
+		{command: "unset", args: "all", want: url.Values{}},
+	}
+	for _, step := range steps {
+		run := sh.set
+		if step.command == "unset" {
+			run = sh.unset
+		}
+		err := run(step.args)
+		if step.wantErr != "" {
+			if err == nil || err.Error() != step.wantErr {
+				t.Errorf("%s %q error = %v, want %q", step.command, step.args, err, step.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s %q: %v", step.command, step.args, err)
+		}
+		if !reflect.DeepEqual(sh.query, step.want) {
+			t.Errorf("after %s %q, query = %v, want %v", step.command, step.args, sh.query, step.want)
+		}
+	}
+}
+
+func TestShellHeader(t *testing.T) {
+	tests := []struct {
+		query url.Values
+		want  string
+	}{
+		{url.Values{}, ""},
+		{url.Values{"$top": {"5"}}, ""},
+		{url.Values{"$search": {`"displayName:adele"`}}, "eventual"},
+		{url.Values{"$count": {"true"}}, "eventual"},
+	}
+	for _, tc := range tests {
+		sh := newTestShell("/")
+		sh.query = tc.query
+		// The header is keyed as Graph spells it, not in canonical form
+		if got := strings.Join(sh.header()["ConsistencyLevel"], ","); got != tc.want {
+			t.Errorf("ConsistencyLevel for %v = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestShellRemember(t *testing.T) {
+	sh := newTestShell("/")
+	sh.remember("/users", listed("1", "2"), false)
+	sh.remember("/users", listed("3"), true)
+	items := append(listed("4"), json.RawMessage(`{"displayName":"no id"}`), json.RawMessage(`"not an object"`))
+	sh.remember("/groups", items, false)
+
+	if got, want := sh.listings["/users"], []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("/users IDs = %v, want the next page appended: %v", got, want)
+	}
+	if got, want := sh.listings["/groups"], []string{"4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("/groups IDs = %v, want %v", got, want)
+	}
+
+	// Listing a path again replaces its IDs without moving it in the order
+	sh.remember("/users", listed("5"), false)
+	if got, want := sh.listings["/users"], []string{"5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("/users IDs = %v, want %v after listing again", got, want)
+	}
+	if want := []string{"/users", "/groups"}; !reflect.DeepEqual(sh.listingOrder, want) {
+		t.Errorf("listing order = %v, want %v", sh.listingOrder, want)
+	}
+
+	// Past the limit the oldest listing is forgotten
+	for i := 0; len(sh.listingOrder) < shellListingLimit; i++ {
+		sh.remember(fmt.Sprintf("/drives/%d/items", i), listed("x"), false)
+	}
+	sh.remember("/sites", listed("6"), false)
+	if _, ok := sh.listings["/users"]; ok {
+		t.Error("the oldest listing was kept past the limit")
+	}
+	if len(sh.listings) != shellListingLimit || len(sh.listingOrder) != shellListingLimit {
+		t.Errorf("listings = %d, order = %d, want %d", len(sh.listings), len(sh.listingOrder), shellListingLimit)
+	}
+	if sh.listingOrder[len(sh.listingOrder)-1] != "/sites" || sh.listings["/groups"] == nil {
+		t.Errorf("listing order = %v, want /groups kept and /sites last", sh.listingOrder)
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	sh := newTestShell("/me")
+	sh.query.Set("$top", "5")
+	sh.query.Set("custom", "yes")
+	sh.remember("/me/messages", listed("AAA", "AAB", "BBB"), false)
+
+	tests := []struct {
+		line      string
+		want      []string
+		wantStart int
+	}{
+		{"", []string{"cd", "delete", "exit", "get", "help", "history", "ls", "next", "patch", "post", "put", "pwd", "set", "unset"}, 0},
+		{"p", []string{"patch", "post", "put", "pwd"}, 0},
+		{"x", nil, 0},
+		{"set to", []string{"top"}, 4},
+		{"set s", []string{"search", "select", "skip", "skipToken"}, 4},
+		{"unset ", []string{"all", "custom", "top"}, 6},
+		{"ls mess", []string{"messages/"}, 3},
+		{"get /me/ma", []string{"/me/mailFolders/", "/me/mailboxSettings/", "/me/manager/"}, 4},
+		{"cd messages/AA", []string{"messages/AAA/", "messages/AAB/"}, 3},
+		{"ls /me/messages/", []string{"/me/messages/AAA/", "/me/messages/AAB/", "/me/messages/BBB/"}, 3},
+		{"ls ../users/", nil, 3},
+		{"pwd x", nil, 4},
+		{"patch messages/AAA ", nil, 19},
+		{"nosuch mess", nil, 7},
+	}
+	for _, tc := range tests {
+		got, start := sh.complete(tc.line)
+		if !reflect.DeepEqual(got, tc.want) || start != tc.wantStart {
+			t.Errorf("complete(%q) = %q at %d, want %q at %d", tc.line, got, start, tc.want, tc.wantStart)
+		}
+	}
+}
+
+func TestLoadShellHistory(t *testing.T) {
+	many := make([]string, shellHistoryLimit+5)
+	for i := range many {
+		many[i] = fmt.Sprintf("get /me/messages/%d", i)
+	}
+	tests := []struct {
+		name     string
+		content  *string
+		want     []string
+		wantFile string
+	}{
+		{name: "missing"},
+		{name: "empty", content: new(string)},
+		{name: "blank lines", content: ptr("\n\n")},
+		{name: "lines", content: ptr("ls /me\nget /me\n"), want: []string{"ls /me", "get /me"}},
+		{name: "no final newline", content: ptr("ls /me\nget /me"), want: []string{"ls /me", "get /me"}},
+		{
+			name:     "trimmed",
+			content:  ptr(strings.Join(many, "\n") + "\n"),
+			want:     many[5:],
+			wantFile: strings.Join(many[5:], "\n") + "\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "shell_history")
+			if tc.content != nil {
+				if err := os.WriteFile(p, []byte(*tc.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := loadShellHistory(p)
+			if err != nil {
+				t.Fatalf("loadShellHistory: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("history = %d lines, want %d", len(got), len(tc.want))
+			}
+			if tc.wantFile == "" {
+				return
+			}
+			data, _ := os.ReadFile(p)
+			if string(data) != tc.wantFile {
+				t.Errorf("history file has %d lines, want it trimmed to %d", strings.Count(string(data), "\n"), shellHistoryLimit)
+			}
+		})
+	}
+}
+
+func TestLoadShellHistoryReportsTrimFailure(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root can write to a read-only file")
+	}
+	lines := make([]string, shellHistoryLimit+1)
+	for i := range lines {
+		lines[i] = "ls"
+	}
+	p := filepath.Join(t.TempDir(), "shell_history")
+	if err := os.WriteFile(p, []byte(strings.Join(lines, "\n")), 0400); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadShellHistory(p)
+	if err == nil || !strings.Contains(err.Error(), "failed to trim history file") {
+		t.Errorf("loadShellHistory error = %v, want the failed rewrite", err)
+	}
+	if len(got) != shellHistoryLimit {
+		t.Errorf("history = %d lines, want %d", len(got), shellHistoryLimit)
+	}
+}
+
+// ptr returns a pointer to s
+func ptr(s string) *string {
+	return &s
+}
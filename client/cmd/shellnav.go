@@ -0,0 +1,234 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// navigationSchema maps entity types to their navigation properties and the
+// types they lead to, for tab completion in the shell. A "[]" suffix marks
+// a collection, whose next path segment is an item ID. It covers the
+// commonly used parts of Graph rather than the whole metadata document;
+// "entity" stands for types whose properties the shell does not complete.
+var navigationSchema = map[string]map[string]string{
+	"root": {
+		"me":                     "user",
+		"users":                  "user[]",
+		"groups":                 "group[]",
+		"drives":                 "drive[]",
+		"sites":                  "site[]",
+		"teams":                  "team[]",
+		"chats":                  "chat[]",
+		"applications":           "application[]",
+		"servicePrincipals":      "servicePrincipal[]",
+		"devices":                "entity[]",
+		"directoryObjects":       "entity[]",
+		"directoryRoles":         "entity[]",
+		"contacts":               "entity[]",
+		"domains":                "entity[]",
+		"organization":           "entity[]",
+		"subscribedSkus":         "entity[]",
+		"groupLifecyclePolicies": "entity[]",
+		"auditLogs":              "entity",
+		"communications":         "entity",
+		"deviceManagement":       "entity",
+		"directory":              "entity",
+		"education":              "entity",
+		"identity":               "entity",
+		"planner":                "entity",
+		"policies":               "entity",
+		"reports":                "entity",
+		"security":               "entity",
+		"solutions":              "entity",
+	},
+	"user": {
+		"messages":                "message[]",
+		"mailFolders":             "mailFolder[]",
+		"calendar":                "calendar",
+		"calendars":               "calendar[]",
+		"calendarGroups":          "entity[]",
+		"events":                  "event[]",
+		"calendarView":            "event[]",
+		"contacts":                "contact[]",
+		"contactFolders":          "contactFolder[]",
+		"drive":                   "drive",
+		"drives":                  "drive[]",
+		"followedSites":           "site[]",
+		"manager":                 "user",
+		"directReports":           "user[]",
+		"memberOf":                "entity[]",
+		"transitiveMemberOf":      "entity[]",
+		"ownedObjects":            "entity[]",
+		"ownedDevices":            "entity[]",
+		"registeredDevices":       "entity[]",
+		"appRoleAssignments":      "entity[]",
+		"oauth2PermissionGrants":  "entity[]",
+		"licenseDetails":          "entity[]",
+		"joinedTeams":             "team[]",
+		"chats":                   "chat[]",
+		"onlineMeetings":          "entity[]",
+		"people":                  "entity[]",
+		"photos":                  "entity[]",
+		"extensions":              "entity[]",
+		"todo":                    "todo",
+		"authentication":          "entity",
+		"inferenceClassification": "entity",
+		"insights":                "entity",
+		"mailboxSettings":         "entity",
+		"onenote":                 "entity",
+		"outlook":                 "entity",
+		"photo":                   "entity",
+		"planner":                 "entity",
+		"presence":                "entity",
+		"settings":                "entity",
+	},
+	"message": {
+		"attachments": "entity[]",
+		"extensions":  "entity[]",
+	},
+	"mailFolder": {
+		"messages":     "message[]",
+		"childFolders": "mailFolder[]",
+		"messageRules": "entity[]",
+	},
+	"calendar": {
+		"events":              "event[]",
+		"calendarView":        "event[]",
+		"calendarPermissions": "entity[]",
+	},
+	"event": {
+		"attachments": "entity[]",
+		"calendar":    "calendar",
+		"extensions":  "entity[]",
+		"instances":   "event[]",
+	},
+	"contact": {
+		"extensions": "entity[]",
+		"photo":      "entity",
+	},
+	"contactFolder": {
+		"contacts":     "contact[]",
+		"childFolders": "contactFolder[]",
+	},
+	"drive": {
+		"root":      "driveItem",
+		"items":     "driveItem[]",
+		"special":   "driveItem[]",
+		"following": "driveItem[]",
+		"list":      "entity",
+	},
+	"driveItem": {
+		"children":    "driveItem[]",
+		"permissions": "entity[]",
+		"thumbnails":  "entity[]",
+		"versions":    "entity[]",
+		"listItem":    "entity",
+		"workbook":    "entity",
+	},
+	"group": {
+		"members":            "entity[]",
+		"transitiveMembers":  "entity[]",
+		"owners":             "entity[]",
+		"memberOf":           "entity[]",
+		"transitiveMemberOf": "entity[]",
+		"appRoleAssignments": "entity[]",
+		"calendar":           "calendar",
+		"events":             "event[]",
+		"conversations":      "entity[]",
+		"threads":            "entity[]",
+		"drive":              "drive",
+		"drives":             "drive[]",
+		"sites":              "site[]",
+		"team":               "team",
+		"photo":              "entity",
+		"planner":            "entity",
+	},
+	"site": {
+		"drive":        "drive",
+		"drives":       "drive[]",
+		"sites":        "site[]",
+		"lists":        "entity[]",
+		"columns":      "entity[]",
+		"contentTypes": "entity[]",
+		"pages":        "entity[]",
+	},
+	"team": {
+		"channels":       "channel[]",
+		"primaryChannel": "channel",
+		"members":        "entity[]",
+		"installedApps":  "entity[]",
+		"tags":           "entity[]",
+		"schedule":       "entity",
+	},
+	"channel": {
+		"messages":    "chatMessage[]",
+		"members":     "entity[]",
+		"tabs":        "entity[]",
+		"filesFolder": "driveItem",
+	},
+	"chat": {
+		"messages":      "chatMessage[]",
+		"members":       "entity[]",
+		"tabs":          "entity[]",
+		"installedApps": "entity[]",
+	},
+	"chatMessage": {
+		"replies":        "chatMessage[]",
+		"hostedContents": "entity[]",
+	},
+	"application": {
+		"owners":                       "entity[]",
+		"extensionProperties":          "entity[]",
+		"federatedIdentityCredentials": "entity[]",
+	},
+	"servicePrincipal": {
+		"appRoleAssignedTo":      "entity[]",
+		"appRoleAssignments":     "entity[]",
+		"oauth2PermissionGrants": "entity[]",
+		"memberOf":               "entity[]",
+		"owners":                 "entity[]",
+	},
+	"todo": {
+		"lists": "todoTaskList[]",
+	},
+	"todoTaskList": {
+		"tasks": "todoTask[]",
+	},
+	"todoTask": {
+		"attachments":     "entity[]",
+		"checklistItems":  "entity[]",
+		"linkedResources": "entity[]",
+	},
+}
+
+// navigationProperties returns the navigation properties of the resource at
+// the absolute path p, sorted, or nil when p is a collection or leaves the
+// schema
+func navigationProperties(p string) []string {
+	typ, collection := "root", false
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "" {
+			continue
+		}
+		if collection {
+			// An item ID, of the collection's type
+			collection = false
+			continue
+		}
+		target, ok := navigationSchema[typ][segment]
+		if !ok {
+			return nil
+		}
+		typ, collection = strings.CutSuffix(target, "[]")
+	}
+	if collection {
+		return nil
+	}
+
+	names := make([]string, 0, len(navigationSchema[typ]))
+	for name := range navigationSchema[typ] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,21 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package main
+
+import "errors"
+
+// stdoutWidth returns 0, so tables are never narrowed, where the terminal
+// size is not available
+func stdoutWidth() int {
+	return 0
+}
+
+// isTerminal reports false, so the shell reads plain lines
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+// makeRaw is not supported on this platform
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
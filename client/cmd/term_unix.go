@@ -0,0 +1,58 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// stdoutWidth returns the width of the terminal on stdout, or 0 when stdout
+// is not a terminal
+func stdoutWidth() int {
+	var size struct {
+		rows, cols, xPixels, yPixels uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0
+	}
+	return int(size.cols)
+}
+
+// isTerminal reports whether fd is a terminal
+func isTerminal(fd uintptr) bool {
+	var state syscall.Termios
+	return termios(fd, ioctlGetTermios, &state) == nil
+}
+
+// makeRaw puts the terminal on fd into raw mode, so keys are read one at a
+// time without echo, and returns a function that restores it. Output
+// processing stays on, so "\n" still starts a new line.
+func makeRaw(fd uintptr) (func(), error) {
+	var saved syscall.Termios
+	if err := termios(fd, ioctlGetTermios, &saved); err != nil {
+		return nil, err
+	}
+
+	raw := saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := termios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { termios(fd, ioctlSetTermios, &saved) }, nil
+}
+
+// termios gets or sets terminal attributes
+func termios(fd uintptr, request uintptr, state *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(state))); errno != 0 {
+		return errno
+	}
+	return nil
+}
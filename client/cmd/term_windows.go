@@ -0,0 +1,43 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procGetConsoleScreenBufferInfo = syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleScreenBufferInfo")
+
+// consoleScreenBufferInfo is CONSOLE_SCREEN_BUFFER_INFO
+type consoleScreenBufferInfo struct {
+	size              [2]int16
+	cursorPosition    [2]int16
+	attributes        uint16
+	window            [4]int16 // left, top, right, bottom
+	maximumWindowSize [2]int16
+}
+
+// stdoutWidth returns the width of the console window on stdout, or 0 when
+// stdout is not a console
+func stdoutWidth() int {
+	var info consoleScreenBufferInfo
+	ok, _, _ := procGetConsoleScreenBufferInfo.Call(os.Stdout.Fd(), uintptr(unsafe.Pointer(&info)))
+	if ok == 0 {
+		return 0
+	}
+	return int(info.window[2]-info.window[0]) + 1
+}
+
+// isTerminal reports false, so the shell reads plain lines, without line
+// editing, on Windows
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+// makeRaw is not supported on Windows
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on Windows")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// writeYAML writes a value decoded by decodeValue as a YAML document. Strings
+// that YAML would read as something else are written as JSON strings, which
+// are valid YAML double-quoted scalars.
+func writeYAML(w io.Writer, value interface{}) error {
+	var b strings.Builder
+	if isYAMLBlock(value) {
+		writeYAMLBlock(&b, value, "")
+	} else {
+		b.WriteString(yamlScalar(value))
+		b.WriteByte('\n')
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// isYAMLBlock reports whether value is written as indented lines: a
+// non-empty object or array
+func isYAMLBlock(value interface{}) bool {
+	switch v := value.(type) {
+	case jsonObject:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// writeYAMLBlock writes a non-empty object or array with every line
+// starting at indent
+func writeYAMLBlock(b *strings.Builder, value interface{}, indent string) {
+	switch v := value.(type) {
+	case jsonObject:
+		for _, f := range v {
+			b.WriteString(indent)
+			b.WriteString(yamlScalar(f.key))
+			b.WriteByte(':')
+			if isYAMLBlock(f.value) {
+				b.WriteByte('\n')
+				writeYAMLBlock(b, f.value, indent+"  ")
+				continue
+			}
+			b.WriteByte(' ')
+			b.WriteString(yamlScalar(f.value))
+			b.WriteByte('\n')
+		}
+	case []interface{}:
+		for _, element := range v {
+			if !isYAMLBlock(element) {
+				b.WriteString(indent)
+				b.WriteString("- ")
+				b.WriteString(yamlScalar(element))
+				b.WriteByte('\n')
+				continue
+			}
+			// Nested blocks start on the dash's line: "- key: value"
+			var nested strings.Builder
+			writeYAMLBlock(&nested, element, indent+"  ")
+			b.WriteString(indent)
+			b.WriteString("- ")
+			b.WriteString(nested.String()[len(indent)+2:])
+		}
+	}
+}
+
+// yamlScalar formats a scalar, or an empty object or array, on one line
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if yamlNeedsQuotes(v) {
+			data, _ := json.Marshal(v)
+			return string(data)
+		}
+		return v
+	case jsonObject:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// yamlNumber matches the YAML 1.1 integer and float forms that
+// strconv.ParseFloat rejects: binary, octal and hexadecimal integers, digits
+// separated by underscores, and base 60 numbers such as 190:20:30
+var yamlNumber = regexp.MustCompile(`^[-+]?(0b[01_]+|0o?[0-7_]+|0x[0-9a-fA-F_]+|[0-9][0-9_]*(\.[0-9_]*)?([eE][-+]?[0-9]+)?|\.[0-9_]+([eE][-+]?[0-9]+)?|[1-9][0-9_]*(:[0-5]?[0-9])+(\.[0-9_]*)?)$`)
+
+// yamlTimestamp matches the start of a YAML 1.1 timestamp, a date such as
+// 2024-06-03 optionally followed by a time
+var yamlTimestamp = regexp.MustCompile(`^[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}([Tt \t]|$)`)
+
+// yamlNeedsQuotes reports whether a plain YAML scalar would not read back as
+// the string s: it is empty, looks like another type, starts with an
+// indicator character, or contains a comment, mapping separator or control
+// character. Other types include YAML 1.1's, so "yes", "0x1F", "1_000" and
+// "2024-06-03T10:00:00Z" are quoted.
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n", ".inf", "-.inf", "+.inf", ".nan", "<<", "=":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if yamlNumber.MatchString(s) || yamlTimestamp.MatchString(s) {
+		return true
+	}
+	if strings.ContainsRune("-?:,[]{}#&*!|>'\"%@`", rune(s[0])) {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
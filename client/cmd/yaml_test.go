@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYAMLNeedsQuotes(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"", true},
+		{" padded", true},
+		{"null", true},
+		{"~", true},
+		{"Yes", true},
+		{"no", true},
+		{"off", true},
+		{".nan", true},
+		{"123", true},
+		{"-1.5e3", true},
+		{"0x1F", true},
+		{"0o17", true},
+		{"0777", true},
+		{"0b101", true},
+		{"1_000", true},
+		{"190:20:30", true},
+		{"2024-06-03", true},
+		{"2024-06-03T10:00:00Z", true},
+		{"2024-6-3 10:00:00", true},
+		{"-dash", true},
+		{"@odata.etag", true},
+		{"key: value", true},
+		{"a #comment", true},
+		{"trailing:", true},
+		{"tab\there", true},
+		{"Adele Vance", false},
+		{"adele@contoso.com", false},
+		{"https://graph.microsoft.com/v1.0", false},
+		{"+1 425 555 0109", false},
+		{"10:00 standup", false},
+		{"2024-06-03-notes", false},
+		{"v1.0", false},
+		{"1.2.3", false},
+		{"0xZZ", false},
+		{"W/1", false},
+	}
+	for _, tc := range tests {
+		if got := yamlNeedsQuotes(tc.s); got != tc.want {
+			t.Errorf("yamlNeedsQuotes(%q) = %v, want %v", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{
+			name: "nested",
+			json: `{"id":"1","enabled":true,"count":3,"note":null,"answer":"yes","created":"2024-06-03T10:00:00Z","hex":"0x1F","amount":"1_000",` +
+				`"tags":["a","no"],"empty":{},"none":[],"items":[{"name":"x","sizes":[1,2]},"plain"],"nested":{"inner":{"key":"value: colon"}}}`,
+			want: `id: "1"
+enabled: true
+count: 3
+note: null
+answer: "yes"
+created: "2024-06-03T10:00:00Z"
+hex: "0x1F"
+amount: "1_000"
+tags:
+  - a
+  - "no"
+empty: {}
+none: []
+items:
+  - name: x
+    sizes:
+      - 1
+      - 2
+  - plain
+nested:
+  inner:
+    key: "value: colon"
+`,
+		},
+		{name: "empty object", json: `{}`, want: "{}\n"},
+		{name: "empty array", json: `[]`, want: "[]\n"},
+		{name: "scalar", json: `"2024-06-03"`, want: "\"2024-06-03\"\n"},
+		{name: "null", json: `null`, want: "null\n"},
+		{name: "array of arrays", json: `[[1,2],[]]`, want: "- - 1\n  - 2\n- []\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := decodeValue([]byte(tc.json))
+			if err != nil {
+				t.Fatalf("decodeValue: %v", err)
+			}
+			var b strings.Builder
+			if err := writeYAML(&b, value); err != nil {
+				t.Fatalf("writeYAML: %v", err)
+			}
+			if b.String() != tc.want {
+				t.Errorf("writeYAML =\n%s\nwant\n%s", b.String(), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ms_graph/internal/graph"
+)
+
+// azureCLIClientID is the public client the Azure CLI signs in with
+const azureCLIClientID = "04b07795-8ddb-461a-bbee-02f9e1bf7b46"
+
+// AzureCLICredential reuses the MSAL token cache written by `az login`.
+// Only the plaintext cache used on Linux is supported.
+type AzureCLICredential struct {
+	tenantID string
+	cloud    graph.Cloud
+}
+
+// NewAzureCLICredential creates a credential backed by the Azure CLI cache.
+// tenantID is used when redeeming the CLI's refresh token; empty uses the
+// tenant of the cached account.
+func NewAzureCLICredential(tenantID string) *AzureCLICredential {
+	return &AzureCLICredential{tenantID: tenantID}
+}
+
+// Name identifies the credential source
+func (c *AzureCLICredential) Name() string {
+	return SourceAzureCLI
+}
+
+// msalCacheEntry represents an access or refresh token in the MSAL cache
+type msalCacheEntry struct {
+	HomeAccountID string `json:"home_account_id"`
+	ClientID      string `json:"client_id"`
+	Secret        string `json:"secret"`
+	Realm         string `json:"realm"`
+	Target        string `json:"target"`
+	ExpiresOn     string `json:"expires_on"`
+}
+
+// msalCache represents the parts of msal_token_cache.json we read
+type msalCache struct {
+	AccessToken  map[string]msalCacheEntry `json:"AccessToken"`
+	RefreshToken map[string]msalCacheEntry `json:"RefreshToken"`
+}
+
+// Token returns a cached Graph token from the Azure CLI or redeems its refresh token
+func (c *AzureCLICredential) Token() (*graph.TokenResponse, error) {
+	path, err := azureCLICachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("Azure CLI token cache not found at %s (run `az login`)", path)
+		}
+		return nil, fmt.Errorf("failed to read Azure CLI token cache: %w", err)
+	}
+
+	var cache msalCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("failed to parse Azure CLI token cache: %w", err)
+	}
+
+	// Prefer a live Graph access token for the requested tenant
+	realm := ""
+	for _, entry := range cache.AccessToken {
+		if c.tenantID != "" && entry.Realm != c.tenantID {
+			continue
+		}
+		if realm == "" {
+			realm = entry.Realm
+		}
+		if !strings.Contains(entry.Target, cloudOrGlobal(c.cloud).GraphEndpoint) {
+			continue
+		}
+		expiresOn := time.Unix(parseSeconds(entry.ExpiresOn), 0)
+		if time.Until(expiresOn) > 10*time.Minute {
+			return &graph.TokenResponse{
+				AccessToken: entry.Secret,
+				TokenType:   "Bearer",
+				ExpiresIn:   int(time.Until(expiresOn).Seconds()),
+			}, nil
+		}
+	}
+
+	for _, entry := range cache.RefreshToken {
+		if entry.ClientID != azureCLIClientID || entry.Secret == "" {
+			continue
+		}
+
+		tenantID := c.tenantID
+		if tenantID == "" {
+			tenantID = realm
+		}
+		if tenantID == "" {
+			tenantID = "organizations"
+		}
+
+		tokenResp, err := redeemRefreshToken(c.cloud, entry.Secret, tenantID, azureCLIClientID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to redeem Azure CLI refresh token: %w", err)
+		}
+		// The rotated refresh token belongs to the CLI's cache, not ours
+		tokenResp.RefreshToken = ""
+		return tokenResp, nil
+	}
+
+	return nil, fmt.Errorf("Azure CLI token cache has no usable Graph token (run `az login`)")
+}
+
+// azureCLICachePath returns the location of the Azure CLI MSAL cache
+func azureCLICachePath() (string, error) {
+	dir := os.Getenv("AZURE_CONFIG_DIR")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".azure")
+	}
+	return filepath.Join(dir, "msal_token_cache.json"), nil
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/tokencache"
+)
+
+// CacheCredential uses tokens from the persistent token cache, refreshing them
+// and writing rotated refresh tokens back to the cache
+type CacheCredential struct {
+	cache  *tokencache.Cache
+	key    string
+	cloud  graph.Cloud
+	served bool
+	mu     sync.Mutex
+}
+
+// NewCacheCredential creates a credential for the cache entry stored under key
+func NewCacheCredential(cache *tokencache.Cache, key string) *CacheCredential {
+	if key == "" {
+		key = tokencache.DefaultKey
+	}
+	return &CacheCredential{cache: cache, key: key}
+}
+
+// Name identifies the credential source
+func (c *CacheCredential) Name() string {
+	return SourceTokenCache
+}
+
+// Token returns the cached access token while it is valid, then refreshes it
+func (c *CacheCredential) Token() (*graph.TokenResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cache == nil {
+		return nil, fmt.Errorf("token cache is not configured")
+	}
+
+	entry, err := c.cache.Load(c.key)
+	if err != nil {
+		if errors.Is(err, tokencache.ErrNotFound) {
+			return nil, fmt.Errorf("no cached token for %q in %s", c.key, c.cache.Path())
+		}
+		return nil, err
+	}
+
+	// Another process may have refreshed the entry, so check it before refreshing ourselves
+	if !c.served && usableToken(entry.AccessToken) {
+		c.served = true
+		return &graph.TokenResponse{
+			AccessToken:  entry.AccessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    expiresIn(entry.AccessToken),
+			RefreshToken: entry.RefreshToken,
+		}, nil
+	}
+
+	if entry.RefreshToken == "" {
+		return nil, fmt.Errorf("cached token for %q is expired and has no refresh token", c.key)
+	}
+
+	tokenResp, err := redeemRefreshToken(c.cloud, entry.RefreshToken, entry.TenantID, entry.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh cached token: %w", err)
+	}
+	c.served = true
+
+	entry.AccessToken = tokenResp.AccessToken
+	entry.ExpiresAt = expiresAt(tokenResp)
+	// Update refresh token if a new one is provided (token rotation)
+	if tokenResp.RefreshToken != "" {
+		entry.RefreshToken = tokenResp.RefreshToken
+	}
+	if err := c.cache.Save(c.key, entry); err != nil {
+		return nil, fmt.Errorf("failed to update token cache: %w", err)
+	}
+
+	return tokenResp, nil
+}
+
+// saveToCache stores a freshly acquired token so later runs can use the cache source
+func saveToCache(cache *tokencache.Cache, key, source, tenantID, clientID string, tokenResp *graph.TokenResponse) error {
+	if cache == nil {
+		return nil
+	}
+	if key == "" {
+		key = tokencache.DefaultKey
+	}
+	return cache.Save(key, &tokencache.Entry{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresAt:    expiresAt(tokenResp),
+		TenantID:     tenantID,
+		ClientID:     clientID,
+		Source:       source,
+	})
+}
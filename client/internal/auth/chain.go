@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/tokencache"
+)
+
+// Credential source names, used in MS_GRAPH_CREDENTIAL_CHAIN and diagnostics
+const (
+	SourceEnvironment      = "environment"
+	SourceClientCredential = "client-credential"
+	SourceManagedIdentity  = "managed-identity"
+	SourceTokenCache       = "token-cache"
+	SourceAzureCLI         = "azure-cli"
+	SourceDeviceCode       = "device-code"
+)
+
+// DefaultOrder is the order in which the default chain tries credential sources
+var DefaultOrder = []string{
+	SourceEnvironment,
+	SourceClientCredential,
+	SourceManagedIdentity,
+	SourceTokenCache,
+	SourceAzureCLI,
+	SourceDeviceCode,
+}
+
+// SkipReason records why a credential source was not used
+type SkipReason struct {
+	Source string
+	Err    error
+}
+
+// ChainedCredential tries credential sources in order and sticks with the
+// first one that returns a token
+type ChainedCredential struct {
+	sources  []Credential
+	selected Credential
+	skipped  []SkipReason
+	mu       sync.Mutex
+}
+
+// NewChainedCredential creates a chain over sources, tried in the given order
+func NewChainedCredential(sources ...Credential) *ChainedCredential {
+	return &ChainedCredential{sources: sources}
+}
+
+// Name identifies the credential source
+func (c *ChainedCredential) Name() string {
+	return "chain"
+}
+
+// Token returns a token from the selected source, resolving the chain on first use
+func (c *ChainedCredential) Token() (*graph.TokenResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.selected != nil {
+		return c.selected.Token()
+	}
+
+	c.skipped = nil
+	for _, source := range c.sources {
+		tokenResp, err := source.Token()
+		if err != nil {
+			c.skipped = append(c.skipped, SkipReason{Source: source.Name(), Err: err})
+			continue
+		}
+		c.selected = source
+		return tokenResp, nil
+	}
+
+	var reasons []string
+	for _, skip := range c.skipped {
+		reasons = append(reasons, fmt.Sprintf("  %s: %v", skip.Source, skip.Err))
+	}
+	return nil, fmt.Errorf("no credential source returned a token:\n%s", strings.Join(reasons, "\n"))
+}
+
+// Selected returns the name of the source that supplied the token, or "" before resolution
+func (c *ChainedCredential) Selected() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.selected == nil {
+		return ""
+	}
+	return c.selected.Name()
+}
+
+// Skipped returns why each source before the selected one was passed over
+func (c *ChainedCredential) Skipped() []SkipReason {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]SkipReason(nil), c.skipped...)
+}
+
+// Options configures the default credential chain
+type Options struct {
+	// Order lists source names to try; nil uses DefaultOrder
+	Order []string
+	// TenantID and ClientID apply to every source that signs in to a tenant or app,
+	// overriding the environment for client credentials
+	TenantID string
+	ClientID string
+	// CertificatePath overrides MS_GRAPH_CLIENT_CERTIFICATE_PATH for client credentials
+	CertificatePath string
+	// ManagedIdentityClientID selects a user-assigned managed identity
+	ManagedIdentityClientID string
+	// Cache is the persistent token cache; nil disables the cache source
+	Cache *tokencache.Cache
+	// CacheKey selects the cache entry; empty uses tokencache.DefaultKey
+	CacheKey string
+	// Prompt receives device code instructions; nil uses stderr
+	Prompt io.Writer
+	// Cloud selects the login authority and token audience; the zero value is graph.Global
+	Cloud graph.Cloud
+}
+
+// OptionsFromEnv builds chain options from the environment.
+// MS_GRAPH_CREDENTIAL_CHAIN holds a comma-separated source order and
+// MS_GRAPH_CLOUD names a national cloud.
+func OptionsFromEnv() (Options, error) {
+	opts := Options{
+		TenantID:                os.Getenv("MS_GRAPH_TENANT_ID"),
+		ClientID:                os.Getenv("MS_GRAPH_CLIENT_ID"),
+		ManagedIdentityClientID: getenv("MS_GRAPH_MANAGED_IDENTITY_CLIENT_ID", "AZURE_CLIENT_ID"),
+	}
+
+	cloud, err := graph.CloudByName(os.Getenv("MS_GRAPH_CLOUD"))
+	if err != nil {
+		return Options{}, err
+	}
+	opts.Cloud = cloud
+
+	if chain := os.Getenv("MS_GRAPH_CREDENTIAL_CHAIN"); chain != "" {
+		for _, name := range strings.Split(chain, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.Order = append(opts.Order, name)
+			}
+		}
+	}
+
+	if cache, err := tokencache.Default(); err == nil {
+		opts.Cache = cache
+	}
+
+	return opts, nil
+}
+
+// NewDefaultCredential builds the standard chain: environment tokens, app
+// credentials, managed identity, the token cache, the Azure CLI cache and
+// finally interactive device code sign-in
+func NewDefaultCredential(opts Options) (*ChainedCredential, error) {
+	cloud := cloudOrGlobal(opts.Cloud)
+
+	order := opts.Order
+	if order == nil {
+		order = DefaultOrder
+	}
+
+	var sources []Credential
+	for _, name := range order {
+		switch name {
+		case SourceEnvironment:
+			cred := NewEnvironmentCredential()
+			cred.cloud = cloud
+			sources = append(sources, cred)
+		case SourceClientCredential:
+			cred := NewClientCredentialFromEnv()
+			cred.cloud = cloud
+			if opts.TenantID != "" {
+				cred.tenantID = opts.TenantID
+			}
+			if opts.ClientID != "" {
+				cred.clientID = opts.ClientID
+			}
+			if opts.CertificatePath != "" {
+				cred.certificatePath = opts.CertificatePath
+				cred.clientSecret = ""
+			}
+			sources = append(sources, cred)
+		case SourceManagedIdentity:
+			cred := NewManagedIdentityCredential(opts.ManagedIdentityClientID)
+			cred.cloud = cloud
+			sources = append(sources, cred)
+		case SourceTokenCache:
+			cred := NewCacheCredential(opts.Cache, opts.CacheKey)
+			cred.cloud = cloud
+			sources = append(sources, cred)
+		case SourceAzureCLI:
+			cred := NewAzureCLICredential(opts.TenantID)
+			cred.cloud = cloud
+			sources = append(sources, cred)
+		case SourceDeviceCode:
+			cred := NewDeviceCodeCredential(opts.TenantID, opts.ClientID, opts.Prompt, opts.Cache, opts.CacheKey)
+			cred.cloud = cloud
+			sources = append(sources, cred)
+		default:
+			return nil, fmt.Errorf("unknown credential source %q (valid sources: %s)", name, strings.Join(DefaultOrder, ", "))
+		}
+	}
+
+	return NewChainedCredential(sources...), nil
+}
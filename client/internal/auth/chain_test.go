@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ms_graph/internal/graph"
+)
+
+// fakeCredential returns a fixed token or error and counts its calls
+type fakeCredential struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (c *fakeCredential) Name() string {
+	return c.name
+}
+
+func (c *fakeCredential) Token() (*graph.TokenResponse, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &graph.TokenResponse{AccessToken: c.name + "-token"}, nil
+}
+
+func TestChainedCredentialUsesFirstWorkingSource(t *testing.T) {
+	errEnv := errors.New("not set")
+	errCache := errors.New("no cached sign-in")
+	env := &fakeCredential{name: "environment", err: errEnv}
+	cache := &fakeCredential{name: "token-cache", err: errCache}
+	cli := &fakeCredential{name: "azure-cli"}
+	device := &fakeCredential{name: "device-code"}
+	chain := NewChainedCredential(env, cache, cli, device)
+
+	if got := chain.Selected(); got != "" {
+		t.Errorf("Selected before Token = %q, want empty", got)
+	}
+	tokenResp, err := chain.Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if tokenResp.AccessToken != "azure-cli-token" {
+		t.Errorf("token = %q, want the Azure CLI's", tokenResp.AccessToken)
+	}
+	if got := chain.Selected(); got != "azure-cli" {
+		t.Errorf("Selected = %q, want azure-cli", got)
+	}
+	if device.calls != 0 {
+		t.Error("device code was tried after an earlier source succeeded")
+	}
+
+	want := []SkipReason{{Source: "environment", Err: errEnv}, {Source: "token-cache", Err: errCache}}
+	if got := chain.Skipped(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Skipped = %v, want %v", got, want)
+	}
+
+	// Later tokens come from the selected source alone
+	if _, err := chain.Token(); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if env.calls != 1 || cache.calls != 1 || cli.calls != 2 {
+		t.Errorf("calls = environment %d, token-cache %d, azure-cli %d, want 1, 1, 2", env.calls, cache.calls, cli.calls)
+	}
+}
+
+func TestChainedCredentialReportsEverySkippedSource(t *testing.T) {
+	chain := NewChainedCredential(
+		&fakeCredential{name: "environment", err: errors.New("not set")},
+		&fakeCredential{name: "managed-identity", err: errors.New("not reachable")},
+	)
+
+	_, err := chain.Token()
+	if err == nil {
+		t.Fatal("Token succeeded with no working source")
+	}
+	for _, want := range []string{"environment: not set", "managed-identity: not reachable"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if got := len(chain.Skipped()); got != 2 {
+		t.Errorf("Skipped has %d entries, want 2", got)
+	}
+	if got := chain.Selected(); got != "" {
+		t.Errorf("Selected = %q, want empty", got)
+	}
+}
+
+func TestNewDefaultCredentialOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []string
+		want  []string
+	}{
+		{"default", nil, DefaultOrder},
+		{"custom", []string{SourceAzureCLI, SourceEnvironment}, []string{SourceAzureCLI, SourceEnvironment}},
+		{"single source", []string{SourceManagedIdentity}, []string{SourceManagedIdentity}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			chain, err := NewDefaultCredential(Options{Order: tc.order})
+			if err != nil {
+				t.Fatalf("NewDefaultCredential: %v", err)
+			}
+			var got []string
+			for _, source := range chain.sources {
+				got = append(got, source.Name())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("sources = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := NewDefaultCredential(Options{Order: []string{"keychain"}}); err == nil {
+		t.Error("NewDefaultCredential accepted an unknown source")
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("MS_GRAPH_CREDENTIAL_CHAIN", " azure-cli, ,device-code ")
+	t.Setenv("MS_GRAPH_CLOUD", "usgovhigh")
+	t.Setenv("MS_GRAPH_MANAGED_IDENTITY_CLIENT_ID", "")
+	t.Setenv("AZURE_CLIENT_ID", "azure-client")
+
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatalf("OptionsFromEnv: %v", err)
+	}
+	if want := []string{SourceAzureCLI, SourceDeviceCode}; !reflect.DeepEqual(opts.Order, want) {
+		t.Errorf("Order = %v, want %v", opts.Order, want)
+	}
+	if opts.Cloud != graph.USGovHigh {
+		t.Errorf("Cloud = %+v, want USGovHigh", opts.Cloud)
+	}
+	if opts.ManagedIdentityClientID != "azure-client" {
+		t.Errorf("ManagedIdentityClientID = %q, want the AZURE_CLIENT_ID fallback", opts.ManagedIdentityClientID)
+	}
+
+	t.Setenv("MS_GRAPH_MANAGED_IDENTITY_CLIENT_ID", "graph-identity")
+	if opts, _ := OptionsFromEnv(); opts.ManagedIdentityClientID != "graph-identity" {
+		t.Errorf("ManagedIdentityClientID = %q, want MS_GRAPH_MANAGED_IDENTITY_CLIENT_ID over AZURE_CLIENT_ID", opts.ManagedIdentityClientID)
+	}
+
+	t.Setenv("MS_GRAPH_CLOUD", "moon")
+	if _, err := OptionsFromEnv(); err == nil {
+		t.Error("OptionsFromEnv accepted an unknown cloud")
+	}
+}
+
+func TestClientCredentialFromEnvPrefersGraphNames(t *testing.T) {
+	for _, name := range []string{"TENANT_ID", "CLIENT_ID", "CLIENT_SECRET", "CLIENT_CERTIFICATE_PATH"} {
+		t.Setenv("AZURE_"+name, "azure")
+		t.Setenv("MS_GRAPH_"+name, "")
+	}
+	t.Setenv("MS_GRAPH_CLIENT_ID", "graph")
+	t.Setenv("MS_GRAPH_CLIENT_SECRET", "graph")
+
+	cred := NewClientCredentialFromEnv()
+	got := map[string]string{
+		"tenant":      cred.tenantID,
+		"client":      cred.clientID,
+		"secret":      cred.clientSecret,
+		"certificate": cred.certificatePath,
+	}
+	want := map[string]string{
+		"tenant":      "azure",
+		"client":      "graph",
+		"secret":      "graph",
+		"certificate": "azure",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("credential = %v, want %v", got, want)
+	}
+}
+
+func TestNewDefaultCredentialOverridesClientCredential(t *testing.T) {
+	t.Setenv("MS_GRAPH_TENANT_ID", "env-tenant")
+	t.Setenv("MS_GRAPH_CLIENT_ID", "env-client")
+	t.Setenv("MS_GRAPH_CLIENT_SECRET", "env-secret")
+
+	chain, err := NewDefaultCredential(Options{
+		Order:           []string{SourceClientCredential},
+		TenantID:        "profile-tenant",
+		CertificatePath: "/etc/app.pem",
+	})
+	if err != nil {
+		t.Fatalf("NewDefaultCredential: %v", err)
+	}
+	cred := chain.sources[0].(*ClientCredential)
+	if cred.tenantID != "profile-tenant" || cred.clientID != "env-client" {
+		t.Errorf("tenant %q, client %q, want the option's tenant and the environment's client", cred.tenantID, cred.clientID)
+	}
+	if cred.certificatePath != "/etc/app.pem" || cred.clientSecret != "" {
+		t.Errorf("certificate %q, secret %q, want the option's certificate and no secret", cred.certificatePath, cred.clientSecret)
+	}
+}
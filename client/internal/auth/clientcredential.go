@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"ms_graph/internal/graph"
+)
+
+// ClientCredential authenticates an app registration with a client secret or
+// certificate using the OAuth2 client credentials grant
+type ClientCredential struct {
+	tenantID        string
+	clientID        string
+	clientSecret    string
+	certificatePath string
+	cloud           graph.Cloud
+}
+
+// NewClientCredentialFromEnv reads app credentials from MS_GRAPH_CLIENT_ID,
+// MS_GRAPH_CLIENT_SECRET and MS_GRAPH_CLIENT_CERTIFICATE_PATH, falling back to
+// the AZURE_* names used by the Azure SDKs
+func NewClientCredentialFromEnv() *ClientCredential {
+	return &ClientCredential{
+		tenantID:        getenv("MS_GRAPH_TENANT_ID", "AZURE_TENANT_ID"),
+		clientID:        getenv("MS_GRAPH_CLIENT_ID", "AZURE_CLIENT_ID"),
+		clientSecret:    getenv("MS_GRAPH_CLIENT_SECRET", "AZURE_CLIENT_SECRET"),
+		certificatePath: getenv("MS_GRAPH_CLIENT_CERTIFICATE_PATH", "AZURE_CLIENT_CERTIFICATE_PATH"),
+	}
+}
+
+// NewClientSecretCredential creates a credential for an app registration's client secret
+func NewClientSecretCredential(tenantID, clientID, clientSecret string) *ClientCredential {
+	return &ClientCredential{
+		tenantID:     tenantID,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+}
+
+// NewClientCertificateCredential creates a credential for an app registration's
+// certificate. The PEM file must hold the certificate and its RSA private key.
+func NewClientCertificateCredential(tenantID, clientID, certificatePath string) *ClientCredential {
+	return &ClientCredential{
+		tenantID:        tenantID,
+		clientID:        clientID,
+		certificatePath: certificatePath,
+	}
+}
+
+// Name identifies the credential source
+func (c *ClientCredential) Name() string {
+	return SourceClientCredential
+}
+
+// Token requests a new app-only token
+func (c *ClientCredential) Token() (*graph.TokenResponse, error) {
+	if c.clientID == "" || (c.clientSecret == "" && c.certificatePath == "") {
+		return nil, fmt.Errorf("MS_GRAPH_CLIENT_ID with MS_GRAPH_CLIENT_SECRET or MS_GRAPH_CLIENT_CERTIFICATE_PATH is not set")
+	}
+	// App-only tokens cannot be issued by the "common" endpoint
+	if c.tenantID == "" {
+		return nil, fmt.Errorf("MS_GRAPH_TENANT_ID is required for client credentials")
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	data.Set("client_id", c.clientID)
+	data.Set("scope", cloudOrGlobal(c.cloud).Scope())
+
+	if c.clientSecret != "" {
+		data.Set("client_secret", c.clientSecret)
+	} else {
+		assertion, err := c.clientAssertion()
+		if err != nil {
+			return nil, err
+		}
+		data.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		data.Set("client_assertion", assertion)
+	}
+
+	return requestToken(c.cloud, c.tenantID, data)
+}
+
+// clientAssertion builds a signed JWT proving possession of the certificate's key
+func (c *ClientCredential) clientAssertion() (string, error) {
+	cert, key, err := loadCertificate(c.certificatePath)
+	if err != nil {
+		return "", err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("failed to generate assertion ID: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{tokenEndpoint(c.cloud, c.tenantID)},
+		Issuer:    c.clientID,
+		Subject:   c.clientID,
+		ID:        hex.EncodeToString(jti),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(10 * time.Minute)),
+	}
+
+	thumbprint := sha1.Sum(cert.Raw)
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	assertion.Header["x5t"] = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+
+	signed, err := assertion.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign client assertion: %w", err)
+	}
+	return signed, nil
+}
+
+// loadCertificate reads the first certificate and private key from a PEM file
+func loadCertificate(path string) (*x509.Certificate, crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+
+	var cert *x509.Certificate
+	var key crypto.Signer
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			if cert == nil {
+				cert, err = x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to parse client certificate: %w", err)
+				}
+			}
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+		case "PRIVATE KEY":
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+			rsaKey, ok := parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, fmt.Errorf("client certificate key must be RSA")
+			}
+			key = rsaKey
+		}
+	}
+
+	if cert == nil {
+		return nil, nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("no private key found in %s", path)
+	}
+	return cert, key, nil
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/token"
+)
+
+const (
+	// DefaultClientID is the public client used for interactive sign-in
+	// (Microsoft Graph Command Line Tools)
+	DefaultClientID = "14d82eec-204b-4c2f-b7e8-296a70dab67e"
+)
+
+// Credential is a source of Microsoft Graph tokens.
+// Every Credential also satisfies graph.TokenSource.
+type Credential interface {
+	// Name identifies the credential source in diagnostics
+	Name() string
+	// Token returns a token, acquiring or refreshing it as needed
+	Token() (*graph.TokenResponse, error)
+}
+
+// oauthErrorResponse represents an error response from the OAuth2 token endpoint
+type oauthErrorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// oauthError is returned when the token endpoint rejects a request
+type oauthError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *oauthError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("token request failed (status %d): %s", e.StatusCode, e.Description)
+	}
+	// Descriptions are multi-line and carry trace IDs; the first line is enough
+	description := strings.SplitN(e.Description, "\r\n", 2)[0]
+	return fmt.Sprintf("token request failed: %s - %s", e.Code, description)
+}
+
+// cloudOrGlobal returns cloud, or graph.Global for an unset cloud
+func cloudOrGlobal(cloud graph.Cloud) graph.Cloud {
+	if cloud.GraphEndpoint == "" {
+		return graph.Global
+	}
+	return cloud
+}
+
+// tokenEndpoint returns the OAuth2 v2.0 token endpoint for a tenant
+func tokenEndpoint(cloud graph.Cloud, tenantID string) string {
+	// Default to "common" if tenant ID is not provided
+	if tenantID == "" {
+		tenantID = "common"
+	}
+	return fmt.Sprintf("%s/%s/oauth2/v2.0/token", cloudOrGlobal(cloud).LoginEndpoint, tenantID)
+}
+
+// requestToken posts form to the tenant's token endpoint
+func requestToken(cloud graph.Cloud, tenantID string, form url.Values) (*graph.TokenResponse, error) {
+	req, err := http.NewRequest("POST", tokenEndpoint(cloud, tenantID), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errorResp oauthErrorResponse
+		if err := json.Unmarshal(body, &errorResp); err != nil {
+			return nil, &oauthError{StatusCode: resp.StatusCode, Description: string(body)}
+		}
+		return nil, &oauthError{StatusCode: resp.StatusCode, Code: errorResp.Error, Description: errorResp.Description}
+	}
+
+	var tokenResp graph.TokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("token response does not contain access_token")
+	}
+
+	return &tokenResp, nil
+}
+
+// redeemRefreshToken exchanges a refresh token for a new Graph access token
+func redeemRefreshToken(cloud graph.Cloud, refreshToken, tenantID, clientID string) (*graph.TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	data.Set("scope", cloudOrGlobal(cloud).Scope())
+	if clientID != "" {
+		data.Set("client_id", clientID)
+	}
+	return requestToken(cloud, tenantID, data)
+}
+
+// usableToken reports whether an access token can still be sent as-is
+func usableToken(accessToken string) bool {
+	if accessToken == "" {
+		return false
+	}
+	info, err := token.ParseToken(accessToken)
+	if err != nil {
+		return false
+	}
+	return !info.IsExpired && !info.ExpiresSoon
+}
+
+// expiresIn returns the seconds remaining on an access token, or 0 if unknown
+func expiresIn(accessToken string) int {
+	exp, err := token.GetExpirationTime(accessToken)
+	if err != nil {
+		return 0
+	}
+	seconds := int(time.Until(exp).Seconds())
+	if seconds < 0 {
+		return 0
+	}
+	return seconds
+}
+
+// expiresAt converts a token response lifetime into an absolute time
+func expiresAt(tokenResp *graph.TokenResponse) time.Time {
+	if exp, err := token.GetExpirationTime(tokenResp.AccessToken); err == nil {
+		return exp
+	}
+	return time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+}
+
+// parseSeconds reads numeric fields that endpoints encode as either numbers or strings
+func parseSeconds(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case string:
+		parsed, _ := strconv.ParseInt(n, 10, 64)
+		return parsed
+	default:
+		return 0
+	}
+}
+
+// getenv returns the first non-empty environment variable among names
+func getenv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/tokencache"
+)
+
+// DeviceCodeCredential signs a user in interactively with the OAuth2 device
+// code flow and saves the result to the token cache
+type DeviceCodeCredential struct {
+	tenantID     string
+	clientID     string
+	prompt       io.Writer
+	cache        *tokencache.Cache
+	cacheKey     string
+	cloud        graph.Cloud
+	refreshToken string
+	mu           sync.Mutex
+}
+
+// NewDeviceCodeCredential creates a device code credential.
+// Sign-in instructions are written to prompt; tokens are saved to cache under
+// cacheKey when cache is non-nil.
+func NewDeviceCodeCredential(tenantID, clientID string, prompt io.Writer, cache *tokencache.Cache, cacheKey string) *DeviceCodeCredential {
+	if clientID == "" {
+		clientID = DefaultClientID
+	}
+	if prompt == nil {
+		prompt = os.Stderr
+	}
+	return &DeviceCodeCredential{
+		tenantID: tenantID,
+		clientID: clientID,
+		prompt:   prompt,
+		cache:    cache,
+		cacheKey: cacheKey,
+	}
+}
+
+// Name identifies the credential source
+func (c *DeviceCodeCredential) Name() string {
+	return SourceDeviceCode
+}
+
+// deviceCodeResponse represents a response from the device code endpoint
+type deviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Message         string `json:"message"`
+}
+
+// Token signs the user in on first use and refreshes the session afterwards
+func (c *DeviceCodeCredential) Token() (*graph.TokenResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshToken != "" {
+		tokenResp, err := redeemRefreshToken(c.cloud, c.refreshToken, c.tenantID, c.clientID)
+		if err == nil {
+			return c.remember(tokenResp)
+		}
+		// Fall through to a new sign-in if the session was revoked
+	}
+
+	if !isTerminal(os.Stdin) {
+		return nil, fmt.Errorf("device code sign-in requires an interactive terminal")
+	}
+
+	code, err := c.requestDeviceCode()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(c.prompt, code.Message)
+
+	tokenResp, err := c.pollForToken(code)
+	if err != nil {
+		return nil, err
+	}
+	return c.remember(tokenResp)
+}
+
+// remember keeps the refresh token for later calls and persists it to the cache
+func (c *DeviceCodeCredential) remember(tokenResp *graph.TokenResponse) (*graph.TokenResponse, error) {
+	if tokenResp.RefreshToken != "" {
+		c.refreshToken = tokenResp.RefreshToken
+	}
+	if err := saveToCache(c.cache, c.cacheKey, SourceDeviceCode, c.tenantID, c.clientID, tokenResp); err != nil {
+		fmt.Fprintf(c.prompt, "Warning: failed to save token cache: %v\n", err)
+	}
+	return tokenResp, nil
+}
+
+// requestDeviceCode starts the device code flow
+func (c *DeviceCodeCredential) requestDeviceCode() (*deviceCodeResponse, error) {
+	tenantID := c.tenantID
+	if tenantID == "" {
+		tenantID = "organizations"
+	}
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/devicecode", cloudOrGlobal(c.cloud).LoginEndpoint, tenantID)
+
+	data := url.Values{}
+	data.Set("client_id", c.clientID)
+	data.Set("scope", cloudOrGlobal(c.cloud).Scope()+" offline_access")
+
+	resp, err := http.PostForm(endpoint, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request device code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errorResp oauthErrorResponse
+		if err := json.Unmarshal(body, &errorResp); err != nil {
+			return nil, &oauthError{StatusCode: resp.StatusCode, Description: string(body)}
+		}
+		return nil, &oauthError{StatusCode: resp.StatusCode, Code: errorResp.Error, Description: errorResp.Description}
+	}
+
+	var code deviceCodeResponse
+	if err := json.Unmarshal(body, &code); err != nil {
+		return nil, fmt.Errorf("failed to parse device code response: %w", err)
+	}
+	return &code, nil
+}
+
+// pollForToken waits for the user to complete sign-in
+func (c *DeviceCodeCredential) pollForToken(code *deviceCodeResponse) (*graph.TokenResponse, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	tenantID := c.tenantID
+	if tenantID == "" {
+		tenantID = "organizations"
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+	data.Set("client_id", c.clientID)
+	data.Set("device_code", code.DeviceCode)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tokenResp, err := requestToken(c.cloud, tenantID, data)
+		if err == nil {
+			return tokenResp, nil
+		}
+
+		var oauthErr *oauthError
+		if !errors.As(err, &oauthErr) {
+			return nil, err
+		}
+		switch oauthErr.Code {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			return nil, fmt.Errorf("device code sign-in failed: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("device code expired before sign-in completed")
+}
+
+// isTerminal reports whether f is attached to a character device other than /dev/null
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if devNull, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, devNull) {
+		return false
+	}
+	return !strings.EqualFold(os.Getenv("TERM"), "dumb")
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"ms_graph/internal/graph"
+)
+
+// EnvironmentCredential uses tokens exported in MS_GRAPH_ACCESS_TOKEN and
+// MS_GRAPH_REFRESH_TOKEN, such as those copied from the Chrome extension
+type EnvironmentCredential struct {
+	accessToken  string
+	refreshToken string
+	tenantID     string
+	clientID     string
+	cloud        graph.Cloud
+	served       bool
+	mu           sync.Mutex
+}
+
+// NewEnvironmentCredential reads tokens from the environment
+func NewEnvironmentCredential() *EnvironmentCredential {
+	return &EnvironmentCredential{
+		accessToken:  os.Getenv("MS_GRAPH_ACCESS_TOKEN"),
+		refreshToken: os.Getenv("MS_GRAPH_REFRESH_TOKEN"),
+		tenantID:     os.Getenv("MS_GRAPH_TENANT_ID"),
+		clientID:     os.Getenv("MS_GRAPH_CLIENT_ID"),
+	}
+}
+
+// Name identifies the credential source
+func (c *EnvironmentCredential) Name() string {
+	return SourceEnvironment
+}
+
+// Token returns the exported access token while it is valid, then refreshes it
+func (c *EnvironmentCredential) Token() (*graph.TokenResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accessToken == "" && c.refreshToken == "" {
+		return nil, fmt.Errorf("MS_GRAPH_ACCESS_TOKEN and MS_GRAPH_REFRESH_TOKEN are not set")
+	}
+
+	// Hand out the exported token once; later calls mean it expired or was rejected
+	if !c.served && usableToken(c.accessToken) {
+		c.served = true
+		return &graph.TokenResponse{
+			AccessToken:  c.accessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    expiresIn(c.accessToken),
+			RefreshToken: c.refreshToken,
+		}, nil
+	}
+
+	if c.refreshToken == "" {
+		return nil, fmt.Errorf("MS_GRAPH_ACCESS_TOKEN is expired or invalid and MS_GRAPH_REFRESH_TOKEN is not set")
+	}
+
+	tokenResp, err := redeemRefreshToken(c.cloud, c.refreshToken, c.tenantID, c.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh MS_GRAPH_REFRESH_TOKEN: %w", err)
+	}
+
+	c.served = true
+	c.accessToken = tokenResp.AccessToken
+	// Update refresh token if a new one is provided (token rotation)
+	if tokenResp.RefreshToken != "" {
+		c.refreshToken = tokenResp.RefreshToken
+	}
+
+	return tokenResp, nil
+}
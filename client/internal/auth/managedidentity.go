@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"ms_graph/internal/graph"
+)
+
+const (
+	// imdsEndpoint is the Azure Instance Metadata Service token endpoint
+	imdsEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+	// imdsConnectTimeout bounds how long we wait to reach IMDS, which is
+	// unreachable off Azure
+	imdsConnectTimeout = 2 * time.Second
+
+	// imdsTimeout bounds the whole IMDS request; the first token on a cold
+	// VM can take several seconds to issue
+	imdsTimeout = 30 * time.Second
+)
+
+// ManagedIdentityCredential obtains tokens from the Azure managed identity
+// endpoint of an App Service, Functions app, VM or container host
+type ManagedIdentityCredential struct {
+	clientID string
+	cloud    graph.Cloud
+}
+
+// NewManagedIdentityCredential creates a managed identity credential.
+// clientID selects a user-assigned identity; empty uses the system-assigned one.
+func NewManagedIdentityCredential(clientID string) *ManagedIdentityCredential {
+	return &ManagedIdentityCredential{clientID: clientID}
+}
+
+// Name identifies the credential source
+func (c *ManagedIdentityCredential) Name() string {
+	return SourceManagedIdentity
+}
+
+// managedIdentityResponse represents a token from a managed identity endpoint.
+// Lifetimes are strings on some hosts and numbers on others.
+type managedIdentityResponse struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	ExpiresIn   interface{} `json:"expires_in"`
+	ExpiresOn   interface{} `json:"expires_on"`
+}
+
+// Token requests a token for Microsoft Graph from the managed identity endpoint
+func (c *ManagedIdentityCredential) Token() (*graph.TokenResponse, error) {
+	query := url.Values{}
+	query.Set("resource", cloudOrGlobal(c.cloud).GraphEndpoint)
+	if c.clientID != "" {
+		query.Set("client_id", c.clientID)
+	}
+
+	var req *http.Request
+	var err error
+	client := &http.Client{}
+
+	// App Service and Functions expose a local endpoint; VMs use IMDS
+	if endpoint, secret := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER"); endpoint != "" && secret != "" {
+		query.Set("api-version", "2019-08-01")
+		req, err = http.NewRequest("GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("X-IDENTITY-HEADER", secret)
+	} else {
+		query.Set("api-version", "2018-02-01")
+		req, err = http.NewRequest("GET", imdsEndpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Metadata", "true")
+		dialer := &net.Dialer{Timeout: imdsConnectTimeout}
+		client.Transport = &http.Transport{DialContext: dialer.DialContext}
+		client.Timeout = imdsTimeout
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("managed identity endpoint is not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("managed identity request failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var miResp managedIdentityResponse
+	if err := json.Unmarshal(body, &miResp); err != nil {
+		return nil, fmt.Errorf("failed to parse managed identity response: %w", err)
+	}
+	if miResp.AccessToken == "" {
+		return nil, fmt.Errorf("managed identity response does not contain access_token")
+	}
+
+	lifetime := parseSeconds(miResp.ExpiresIn)
+	if lifetime == 0 {
+		if expiresOn := parseSeconds(miResp.ExpiresOn); expiresOn > 0 {
+			lifetime = int64(time.Until(time.Unix(expiresOn, 0)).Seconds())
+		}
+	}
+
+	return &graph.TokenResponse{
+		AccessToken: miResp.AccessToken,
+		TokenType:   miResp.TokenType,
+		ExpiresIn:   int(lifetime),
+	}, nil
+}
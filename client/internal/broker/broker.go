@@ -0,0 +1,319 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/token"
+)
+
+// DefaultSocketPath returns the broker socket location.
+// MS_GRAPH_BROKER_SOCKET overrides the default of $XDG_RUNTIME_DIR/msgraph/broker.sock,
+// or ~/.config/msgraph/broker/broker.sock when XDG_RUNTIME_DIR is not set. Both
+// directories are the broker's own, so it can create them with mode 0700.
+func DefaultSocketPath() (string, error) {
+	if path := os.Getenv("MS_GRAPH_BROKER_SOCKET"); path != "" {
+		return path, nil
+	}
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "msgraph", "broker.sock"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "msgraph", "broker", "broker.sock"), nil
+}
+
+// tokenReply is the broker's response to a token request
+type tokenReply struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// errorReply is the broker's response when a token cannot be issued
+type errorReply struct {
+	Error string `json:"error"`
+}
+
+// tokenTimeout is how long a token request waits for a token, shorter than
+// the TokenSource's client timeout so callers see the broker's error
+const tokenTimeout = 20 * time.Second
+
+// fetch is an in-flight token request shared by every caller of its scope
+type fetch struct {
+	done  chan struct{} // Closed once token or err is set
+	token *graph.TokenResponse
+	err   error
+}
+
+// Server hands out access tokens from a single ClientWithRefresh to local
+// processes, so only the broker ever holds and rotates the refresh token
+type Server struct {
+	client  *graph.ClientWithRefresh
+	scopes  map[string]*graph.TokenResponse // Tokens for non-default scopes
+	fetches map[string]*fetch               // Token requests in flight, by scope
+	mu      sync.Mutex                      // Protects scopes and fetches
+	timeout time.Duration
+	server  *http.Server
+}
+
+// NewClient builds the client a broker serves tokens from, given the first
+// token from source. The client alone must redeem and rotate the refresh
+// token, so when the token carries one the client refreshes with it and
+// never asks source again. Otherwise, as for app credentials and managed
+// identity, source supplies every new token and only the default scope is
+// available.
+func NewClient(tokenResp *graph.TokenResponse, source graph.TokenSource, opts ...graph.Option) *graph.ClientWithRefresh {
+	if tokenResp.RefreshToken == "" {
+		return graph.NewClientWithTokenSource(tokenResp.AccessToken, source, opts...)
+	}
+	// Redeem the refresh token against the tenant that issued it
+	tenantID, _ := token.GetStringClaim(tokenResp.AccessToken, "tid")
+	return graph.NewClientWithRefresh(tokenResp.AccessToken, tokenResp.RefreshToken, tenantID, opts...)
+}
+
+// NewServer creates a broker backed by client
+func NewServer(client *graph.ClientWithRefresh) *Server {
+	s := &Server{
+		client:  client,
+		scopes:  make(map[string]*graph.TokenResponse),
+		fetches: make(map[string]*fetch),
+		timeout: tokenTimeout,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", s.handleToken)
+	s.server = &http.Server{Handler: mux}
+
+	return s
+}
+
+// ListenAndServe serves tokens on a Unix socket at socketPath until Shutdown is called.
+// A missing socket directory is created with mode 0700 and the socket itself with 0600,
+// so only the broker's user can connect. An existing directory is never changed: it
+// must belong to the broker's user and be closed to other users, or the broker refuses
+// to listen there.
+func (s *Server) ListenAndServe(socketPath string) error {
+	dir := filepath.Dir(socketPath)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create socket directory: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to check socket directory: %w", err)
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		return err
+	}
+
+	// Remove a socket left behind by a broker that did not shut down cleanly
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("a broker is already listening on %s", socketPath)
+	}
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	err = s.server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the broker and waits for in-flight requests to finish
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// handleToken serves GET /token?scope=...
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorReply{Error: "method not allowed"})
+		return
+	}
+
+	scope := strings.TrimSpace(r.URL.Query().Get("scope"))
+	if scope == "" {
+		scope = s.client.Cloud().Scope()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	reply, err := s.token(ctx, scope)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeJSON(w, http.StatusGatewayTimeout, errorReply{Error: fmt.Sprintf("timed out waiting for a token for scope %q", scope)})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, errorReply{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+// token returns a token for scope, from the client's own lifecycle for the
+// default scope or from the per-scope cache otherwise. Callers asking for the
+// same scope share one request for a new token, and each stops waiting for
+// it when ctx is done; the request still completes and fills the cache.
+func (s *Server) token(ctx context.Context, scope string) (*tokenReply, error) {
+	s.mu.Lock()
+	if cached, ok := s.scopes[scope]; ok {
+		if info, err := token.ParseToken(cached.AccessToken); err == nil && !info.IsExpired && !info.ExpiresSoon {
+			s.mu.Unlock()
+			return newTokenReply(cached.AccessToken, scope), nil
+		}
+	}
+	f, ok := s.fetches[scope]
+	if !ok {
+		f = &fetch{done: make(chan struct{})}
+		s.fetches[scope] = f
+		go s.fetch(scope, f)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return newTokenReply(f.token.AccessToken, scope), nil
+}
+
+// fetch obtains a token for scope without holding s.mu, so the network call
+// never blocks other scopes, and caches it for non-default scopes
+func (s *Server) fetch(scope string, f *fetch) {
+	if scope == s.client.Cloud().Scope() {
+		var accessToken string
+		accessToken, f.err = s.client.AccessToken()
+		f.token = &graph.TokenResponse{AccessToken: accessToken}
+	} else {
+		f.token, f.err = s.client.TokenForScope(scope)
+	}
+
+	s.mu.Lock()
+	delete(s.fetches, scope)
+	if f.err == nil && scope != s.client.Cloud().Scope() {
+		s.scopes[scope] = f.token
+	}
+	s.mu.Unlock()
+	close(f.done)
+}
+
+// newTokenReply builds a reply with the token's remaining lifetime
+func newTokenReply(accessToken, scope string) *tokenReply {
+	expiresIn := 0
+	if remaining, err := token.GetTimeUntilExpiration(accessToken); err == nil && remaining > 0 {
+		expiresIn = int(remaining.Seconds())
+	}
+	return &tokenReply{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		Scope:       scope,
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// TokenSource fetches tokens from a running broker. It satisfies graph.TokenSource,
+// so graph.NewClientWithTokenSource("", broker.NewTokenSource(path, "")) gives a
+// client that never touches a refresh token itself.
+type TokenSource struct {
+	socketPath string
+	scope      string
+	httpClient *http.Client
+}
+
+// NewTokenSource creates a token source for the broker listening on socketPath.
+// An empty scope requests the default Graph scope.
+func NewTokenSource(socketPath, scope string) *TokenSource {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &TokenSource{
+		socketPath: socketPath,
+		scope:      scope,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Name identifies the credential source
+func (t *TokenSource) Name() string {
+	return "broker"
+}
+
+// Token requests a token from the broker
+func (t *TokenSource) Token() (*graph.TokenResponse, error) {
+	endpoint := "http://broker/token"
+	if t.scope != "" {
+		endpoint += "?scope=" + url.QueryEscape(t.scope)
+	}
+
+	resp, err := t.httpClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach token broker at %s: %w", t.socketPath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorReply
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+			return nil, fmt.Errorf("token broker error (status %d)", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("token broker error: %s", errResp.Error)
+	}
+
+	var reply tokenReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("failed to parse token broker response: %w", err)
+	}
+
+	return &graph.TokenResponse{
+		AccessToken: reply.AccessToken,
+		TokenType:   reply.TokenType,
+		ExpiresIn:   reply.ExpiresIn,
+		Scope:       reply.Scope,
+	}, nil
+}
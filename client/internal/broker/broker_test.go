@@ -0,0 +1,258 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+// startBroker serves client's tokens on a socket in a temporary directory
+func startBroker(t *testing.T, client *graph.ClientWithRefresh) (*Server, string) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "broker", "broker.sock")
+	s := NewServer(client)
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.ListenAndServe(socketPath) }()
+	t.Cleanup(func() {
+		s.Shutdown(context.Background())
+		if err := <-errc; err != nil {
+			t.Errorf("ListenAndServe: %v", err)
+		}
+	})
+
+	// Wait for the socket to accept connections
+	for i := 0; ; i++ {
+		if _, err := NewTokenSource(socketPath, "").httpClient.Get("http://broker/"); err == nil {
+			break
+		} else if i == 100 {
+			t.Fatalf("broker did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s, socketPath
+}
+
+func TestTokenSourceDefaultScope(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+	_, socketPath := startBroker(t, client)
+
+	tokenResp, err := NewTokenSource(socketPath, "").Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	want, _ := client.AccessToken()
+	if tokenResp.AccessToken != want {
+		t.Error("broker returned a token other than the client's")
+	}
+	if tokenResp.TokenType != "Bearer" || tokenResp.ExpiresIn <= 0 {
+		t.Errorf("token type %q, expires in %d, want a live bearer token", tokenResp.TokenType, tokenResp.ExpiresIn)
+	}
+	if tokenResp.RefreshToken != "" {
+		t.Error("broker handed out a refresh token")
+	}
+
+	// A client built on the broker reaches Graph with its token
+	brokered := graph.NewClientWithTokenSource("", NewTokenSource(socketPath, ""), srv.ClientOptions()...)
+	if _, err := brokered.Do(&graph.Request{Method: http.MethodGet, Path: "/me"}); err != nil {
+		t.Fatalf("GET /me through a brokered client: %v", err)
+	}
+	if got := len(srv.TokenRequests()); got != 0 {
+		t.Errorf("token requests = %d, want 0 for the default scope", got)
+	}
+}
+
+func TestTokenSourceCachesScopes(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	_, socketPath := startBroker(t, srv.NewClientWithRefresh(me.ID))
+
+	source := NewTokenSource(socketPath, "Mail.Read")
+	first, err := source.Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if first.Scope != "Mail.Read" {
+		t.Errorf("scope = %q, want Mail.Read", first.Scope)
+	}
+	second, err := source.Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if second.AccessToken != first.AccessToken {
+		t.Error("second request for the scope got a new token, want the cached one")
+	}
+	if got := len(srv.TokenRequests()); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+
+	if _, err := NewTokenSource(socketPath, "Files.Read").Token(); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got := len(srv.TokenRequests()); got != 2 {
+		t.Errorf("token requests = %d, want 2 after another scope", got)
+	}
+}
+
+func TestTokenSourceReportsBrokerErrors(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	_, socketPath := startBroker(t, srv.NewClientWithRefresh(me.ID))
+
+	srv.RevokeRefreshTokens()
+	_, err := NewTokenSource(socketPath, "Mail.Read").Token()
+	if err == nil || !strings.Contains(err.Error(), "token broker error:") {
+		t.Errorf("Token error = %v, want the broker's error", err)
+	}
+
+	source := NewTokenSource(socketPath, "")
+	resp, err := source.httpClient.Post("http://broker/token", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("POST /token: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /token = %d, want 405", resp.StatusCode)
+	}
+
+	if _, err := NewTokenSource(filepath.Join(t.TempDir(), "none.sock"), "").Token(); err == nil {
+		t.Error("Token succeeded without a broker")
+	}
+}
+
+func TestSlowScopeTimesOutAndStillFillsCache(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+
+	release := make(chan struct{})
+	hold := func(next graph.Handler) graph.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			if graph.IsTokenRequest(req) {
+				<-release
+			}
+			return next(req)
+		}
+	}
+	s, socketPath := startBroker(t, srv.NewClientWithRefresh(me.ID, graph.WithMiddleware(hold)))
+	s.timeout = 50 * time.Millisecond
+
+	// Every caller of the slow scope gives up after the timeout
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = NewTokenSource(socketPath, "Mail.Read").Token()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("Token error = %v, want a timeout", err)
+		}
+	}
+
+	// The shared request completes and later callers get its token
+	close(release)
+	s.timeout = tokenTimeout
+	if _, err := NewTokenSource(socketPath, "Mail.Read").Token(); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got := len(srv.TokenRequests()); got != 1 {
+		t.Errorf("token requests = %d, want 1 shared by every caller", got)
+	}
+}
+
+// countingSource is a token source that counts its calls
+type countingSource struct {
+	tokenResp *graph.TokenResponse
+	calls     int
+}
+
+func (s *countingSource) Name() string {
+	return "counting"
+}
+
+func (s *countingSource) Token() (*graph.TokenResponse, error) {
+	s.calls++
+	return s.tokenResp, nil
+}
+
+func TestNewClientOwnsTheRefreshToken(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	first := srv.IssueTokens(me.ID)
+	source := &countingSource{tokenResp: srv.IssueTokens(me.ID)}
+	_, socketPath := startBroker(t, NewClient(first, source, srv.ClientOptions()...))
+
+	for _, scope := range []string{"Mail.Read", "Files.Read"} {
+		if _, err := NewTokenSource(socketPath, scope).Token(); err != nil {
+			t.Fatalf("Token(%q): %v", scope, err)
+		}
+	}
+	if source.calls != 0 {
+		t.Errorf("credential asked for %d tokens, want none once the client holds the refresh token", source.calls)
+	}
+
+	// Each redemption uses the refresh token the previous one rotated to
+	requests := srv.TokenRequests()
+	if len(requests) != 2 {
+		t.Fatalf("token requests = %d, want 2", len(requests))
+	}
+	var redeemed []string
+	for _, req := range requests {
+		form, err := url.ParseQuery(string(req.Body))
+		if err != nil {
+			t.Fatalf("failed to parse token request: %v", err)
+		}
+		redeemed = append(redeemed, form.Get("refresh_token"))
+	}
+	if redeemed[0] != first.RefreshToken {
+		t.Errorf("first redemption used %q, want the first token's refresh token", redeemed[0])
+	}
+	if redeemed[1] == first.RefreshToken || redeemed[1] == source.tokenResp.RefreshToken {
+		t.Errorf("second redemption used %q, want the rotated refresh token", redeemed[1])
+	}
+	if srv.ValidRefreshToken(redeemed[1]) {
+		t.Error("the rotated refresh token was not redeemed")
+	}
+}
+
+func TestNewClientWithoutRefreshTokenUsesSource(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	tokenResp := srv.IssueTokens(me.ID)
+	tokenResp.RefreshToken = ""
+	source := &countingSource{tokenResp: tokenResp}
+	client := NewClient(tokenResp, source, srv.ClientOptions()...)
+
+	srv.ExpireAccessTokens()
+	source.tokenResp = srv.IssueTokens(me.ID)
+	source.tokenResp.RefreshToken = ""
+	if _, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me"}); err != nil {
+		t.Fatalf("GET /me: %v", err)
+	}
+	if source.calls != 1 {
+		t.Errorf("credential asked for %d tokens, want 1 after the 401", source.calls)
+	}
+	if got := len(srv.TokenRequests()); got != 0 {
+		t.Errorf("token requests = %d, want 0 without a refresh token", got)
+	}
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"ms_graph/internal/auth"
+	"ms_graph/internal/graph"
+	"ms_graph/internal/tokencache"
+)
+
+// Output formats a profile may select as its default
+const (
+	OutputText   = "text"
+	OutputJSON   = "json"
+	OutputNDJSON = "ndjson"
+	OutputYAML   = "yaml"
+	OutputTable  = "table"
+	OutputCSV    = "csv"
+	OutputTSV    = "tsv"
+)
+
+// OutputFormats lists the valid output formats
+var OutputFormats = []string{OutputText, OutputJSON, OutputNDJSON, OutputYAML, OutputTable, OutputCSV, OutputTSV}
+
+// AuthDefault resolves credentials with the full default chain
+const AuthDefault = "default"
+
+// Profile holds the settings for one account or tenant
+type Profile struct {
+	// AuthMethod is a credential source name such as "device-code" or
+	// "client-credential", or "default" for the full credential chain
+	AuthMethod string `json:"authMethod"`
+	TenantID   string `json:"tenantId,omitempty"`
+	ClientID   string `json:"clientId,omitempty"`
+	// CertificatePath is used by the client-credential method; secrets are
+	// never stored here and come from MS_GRAPH_CLIENT_SECRET instead
+	CertificatePath string `json:"certificatePath,omitempty"`
+	Cloud           string `json:"cloud,omitempty"`
+	// APIVersion is the default Graph API version, v1.0 or beta; empty uses v1.0
+	APIVersion string `json:"apiVersion,omitempty"`
+	Output     string `json:"output,omitempty"`
+}
+
+// Config is the contents of the profile configuration file
+type Config struct {
+	CurrentProfile string              `json:"currentProfile,omitempty"`
+	Profiles       map[string]*Profile `json:"profiles"`
+}
+
+// DefaultPath returns the config file location.
+// MS_GRAPH_CONFIG overrides the default of ~/.config/msgraph/config.json.
+func DefaultPath() (string, error) {
+	if path := os.Getenv("MS_GRAPH_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine home directory: %w", err)
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "msgraph", "config.json"), nil
+}
+
+// Load reads the config file at path; a missing file is an empty config
+func Load(path string) (*Config, error) {
+	cfg := &Config{Profiles: map[string]*Profile{}}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	return cfg, nil
+}
+
+// LoadDefault reads the config file at DefaultPath
+func LoadDefault() (*Config, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return Load(path)
+}
+
+// Save writes the config to path
+func (c *Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// Names returns the profile names in sorted order
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the named profile, or the current profile when name is empty
+func (c *Config) Get(name string) (string, *Profile, error) {
+	if name == "" {
+		name = c.CurrentProfile
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("no profile selected (use `profile use NAME` or --profile)")
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return "", nil, fmt.Errorf("profile %q not found", name)
+	}
+	return name, p, nil
+}
+
+// Add stores p under name, replacing any existing profile with that name.
+// The first profile added becomes the current profile.
+func (c *Config) Add(name string, p *Profile) error {
+	if name == "" || strings.ContainsAny(name, " \t/\\") {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	// Profile tokens are cached under the profile name, so a profile named
+	// like the entry used without a profile would share its tokens
+	if name == tokencache.DefaultKey {
+		return fmt.Errorf("profile name %q is reserved", name)
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	c.Profiles[name] = p
+	if c.CurrentProfile == "" {
+		c.CurrentProfile = name
+	}
+	return nil
+}
+
+// Remove deletes the named profile, clearing the current profile if it was selected
+func (c *Config) Remove(name string) error {
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("profile %q not found", name)
+	}
+
+	delete(c.Profiles, name)
+	if c.CurrentProfile == name {
+		c.CurrentProfile = ""
+	}
+	return nil
+}
+
+// Use makes the named profile current
+func (c *Config) Use(name string) error {
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("profile %q not found", name)
+	}
+	c.CurrentProfile = name
+	return nil
+}
+
+// Validate checks that the profile's settings are recognized
+func (p *Profile) Validate() error {
+	switch p.AuthMethod {
+	case AuthDefault, auth.SourceEnvironment, auth.SourceClientCredential, auth.SourceManagedIdentity,
+		auth.SourceTokenCache, auth.SourceAzureCLI, auth.SourceDeviceCode:
+	default:
+		return fmt.Errorf("unknown auth method %q (valid methods: %s, %s)", p.AuthMethod, AuthDefault, strings.Join(auth.DefaultOrder, ", "))
+	}
+
+	if p.AuthMethod == auth.SourceClientCredential && p.TenantID == "" {
+		return fmt.Errorf("auth method %s requires a tenant ID", auth.SourceClientCredential)
+	}
+
+	if _, err := graph.CloudByName(p.Cloud); err != nil {
+		return err
+	}
+
+	switch p.APIVersion {
+	case "", graph.APIVersionV1, graph.APIVersionBeta:
+	default:
+		return fmt.Errorf("unknown API version %q (valid versions: %s, %s)", p.APIVersion, graph.APIVersionV1, graph.APIVersionBeta)
+	}
+
+	if p.Output != "" && !slices.Contains(OutputFormats, p.Output) {
+		return fmt.Errorf("unknown output format %q (valid formats: %s)", p.Output, strings.Join(OutputFormats, ", "))
+	}
+
+	return nil
+}
+
+// CredentialOptions returns credential chain options for the profile. Tokens
+// are cached under the profile's name so accounts never share a cache entry.
+func (p *Profile) CredentialOptions(name string) (auth.Options, error) {
+	opts, err := auth.OptionsFromEnv()
+	if err != nil {
+		return auth.Options{}, err
+	}
+	opts.CacheKey = name
+	if p.TenantID != "" {
+		opts.TenantID = p.TenantID
+	}
+	if p.ClientID != "" {
+		opts.ClientID = p.ClientID
+	}
+	if p.CertificatePath != "" {
+		opts.CertificatePath = p.CertificatePath
+	}
+	if p.Cloud != "" {
+		cloud, err := graph.CloudByName(p.Cloud)
+		if err != nil {
+			return auth.Options{}, err
+		}
+		opts.Cloud = cloud
+	}
+
+	switch p.AuthMethod {
+	case AuthDefault:
+		// Keep the environment's order, or the default order
+	case auth.SourceDeviceCode:
+		// Reuse the cached sign-in before prompting again
+		opts.Order = []string{auth.SourceTokenCache, auth.SourceDeviceCode}
+	default:
+		opts.Order = []string{p.AuthMethod}
+	}
+	return opts, nil
+}
+
+// Credential builds the credential chain for the profile
+func (p *Profile) Credential(name string) (*auth.ChainedCredential, error) {
+	opts, err := p.CredentialOptions(name)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewDefaultCredential(opts)
+}
+
+// NewClient builds a Graph client for the named profile from the default
+// config file. An empty name selects the current profile. opts are applied
+// after the profile's cloud and API version, so they can override either.
+func NewClient(name string, opts ...graph.Option) (*graph.ClientWithRefresh, error) {
+	cfg, err := LoadDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	name, p, err := cfg.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cloud, err := graph.CloudByName(p.Cloud)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := p.Credential(name)
+	if err != nil {
+		return nil, err
+	}
+	options := []graph.Option{graph.WithCloud(cloud)}
+	if p.APIVersion != "" {
+		options = append(options, graph.WithAPIVersion(p.APIVersion))
+	}
+	return graph.NewClientWithTokenSource("", cred, append(options, opts...)...), nil
+}
+
+// DeleteCachedTokens removes the profile's entry from the default token cache
+func DeleteCachedTokens(name string) error {
+	cache, err := tokencache.Default()
+	if err != nil {
+		return err
+	}
+	return cache.Delete(name)
+}
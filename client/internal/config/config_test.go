@@ -0,0 +1,241 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"ms_graph/internal/auth"
+	"ms_graph/internal/graph"
+	"ms_graph/internal/tokencache"
+)
+
+func TestLoadMissingFileIsEmpty(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.CurrentProfile != "" || len(cfg.Profiles) != 0 {
+		t.Errorf("config = %+v, want empty", cfg)
+	}
+	if cfg.Profiles == nil {
+		t.Error("Profiles is nil, want an empty map to add to")
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "msgraph", "config.json")
+	cfg := &Config{Profiles: map[string]*Profile{}}
+	work := &Profile{AuthMethod: auth.SourceDeviceCode, TenantID: "contoso.com", Cloud: "usgovhigh", APIVersion: graph.APIVersionBeta, Output: OutputJSON}
+	if err := cfg.Add("work", work); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("config file mode = %o, want 600", perm)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("loaded %+v, want %+v", loaded, cfg)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load accepted a malformed file")
+	}
+}
+
+func TestAddValidatesProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		p       Profile
+	}{
+		{"empty name", "", Profile{AuthMethod: AuthDefault}},
+		{"name with a space", "my work", Profile{AuthMethod: AuthDefault}},
+		{"name with a slash", "a/b", Profile{AuthMethod: AuthDefault}},
+		{"reserved name", tokencache.DefaultKey, Profile{AuthMethod: AuthDefault}},
+		{"unknown auth method", "work", Profile{AuthMethod: "password"}},
+		{"client credential without tenant", "work", Profile{AuthMethod: auth.SourceClientCredential}},
+		{"unknown cloud", "work", Profile{AuthMethod: AuthDefault, Cloud: "moon"}},
+		{"unknown API version", "work", Profile{AuthMethod: AuthDefault, APIVersion: "v2.0"}},
+		{"unknown output", "work", Profile{AuthMethod: AuthDefault, Output: "xml"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{Profiles: map[string]*Profile{}}
+			if err := cfg.Add(tc.profile, &tc.p); err == nil {
+				t.Errorf("Add(%q, %+v) succeeded, want an error", tc.profile, tc.p)
+			}
+			if len(cfg.Profiles) != 0 {
+				t.Error("an invalid profile was stored")
+			}
+		})
+	}
+}
+
+func TestCurrentProfile(t *testing.T) {
+	cfg := &Config{Profiles: map[string]*Profile{}}
+	if _, _, err := cfg.Get(""); err == nil {
+		t.Error("Get with no current profile succeeded")
+	}
+
+	// The first profile becomes current and later ones do not
+	for _, name := range []string{"work", "home"} {
+		if err := cfg.Add(name, &Profile{AuthMethod: AuthDefault}); err != nil {
+			t.Fatalf("Add(%q): %v", name, err)
+		}
+	}
+	if name, _, err := cfg.Get(""); err != nil || name != "work" {
+		t.Errorf("Get(\"\") = %q, %v, want work", name, err)
+	}
+	if got := cfg.Names(); !reflect.DeepEqual(got, []string{"home", "work"}) {
+		t.Errorf("Names = %v, want sorted names", got)
+	}
+
+	if err := cfg.Use("home"); err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	if err := cfg.Use("school"); err == nil {
+		t.Error("Use accepted an unknown profile")
+	}
+	if name, _, _ := cfg.Get(""); name != "home" {
+		t.Errorf("current profile = %q, want home", name)
+	}
+
+	// Removing the current profile leaves none selected
+	if err := cfg.Remove("home"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if cfg.CurrentProfile != "" {
+		t.Errorf("current profile = %q after removing it, want none", cfg.CurrentProfile)
+	}
+	if err := cfg.Remove("home"); err == nil {
+		t.Error("Remove accepted an unknown profile")
+	}
+	if _, _, err := cfg.Get("home"); err == nil {
+		t.Error("Get found a removed profile")
+	}
+}
+
+func TestCredentialOptions(t *testing.T) {
+	t.Setenv("MS_GRAPH_CREDENTIAL_CHAIN", "")
+	t.Setenv("MS_GRAPH_CLOUD", "")
+	t.Setenv("MS_GRAPH_TENANT_ID", "env-tenant")
+	t.Setenv("MS_GRAPH_CLIENT_ID", "env-client")
+
+	tests := []struct {
+		name       string
+		p          Profile
+		wantOrder  []string
+		wantTenant string
+		wantClient string
+		wantCloud  graph.Cloud
+	}{
+		{
+			name:       "default keeps the environment",
+			p:          Profile{AuthMethod: AuthDefault},
+			wantTenant: "env-tenant",
+			wantClient: "env-client",
+			wantCloud:  graph.Global,
+		},
+		{
+			name:       "device code checks the cache first",
+			p:          Profile{AuthMethod: auth.SourceDeviceCode, TenantID: "contoso.com", Cloud: "china"},
+			wantOrder:  []string{auth.SourceTokenCache, auth.SourceDeviceCode},
+			wantTenant: "contoso.com",
+			wantClient: "env-client",
+			wantCloud:  graph.China,
+		},
+		{
+			name:       "single source",
+			p:          Profile{AuthMethod: auth.SourceClientCredential, TenantID: "fabrikam.com", ClientID: "app"},
+			wantOrder:  []string{auth.SourceClientCredential},
+			wantTenant: "fabrikam.com",
+			wantClient: "app",
+			wantCloud:  graph.Global,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tc.p.CredentialOptions("work")
+			if err != nil {
+				t.Fatalf("CredentialOptions: %v", err)
+			}
+			if !reflect.DeepEqual(opts.Order, tc.wantOrder) {
+				t.Errorf("Order = %v, want %v", opts.Order, tc.wantOrder)
+			}
+			if opts.TenantID != tc.wantTenant || opts.ClientID != tc.wantClient {
+				t.Errorf("tenant %q, client %q, want %q, %q", opts.TenantID, opts.ClientID, tc.wantTenant, tc.wantClient)
+			}
+			if opts.Cloud != tc.wantCloud {
+				t.Errorf("Cloud = %s, want %s", opts.Cloud.Name, tc.wantCloud.Name)
+			}
+			if opts.CacheKey != "work" {
+				t.Errorf("CacheKey = %q, want the profile name", opts.CacheKey)
+			}
+		})
+	}
+
+	t.Setenv("MS_GRAPH_CLOUD", "moon")
+	if _, err := (&Profile{AuthMethod: AuthDefault}).CredentialOptions("work"); err == nil {
+		t.Error("CredentialOptions ignored an invalid MS_GRAPH_CLOUD")
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("MS_GRAPH_CONFIG", path)
+	t.Setenv("MS_GRAPH_CLOUD", "")
+	t.Setenv("MS_GRAPH_TOKEN_CACHE", filepath.Join(t.TempDir(), "tokens.json"))
+
+	cfg := &Config{Profiles: map[string]*Profile{}}
+	cfg.Add("work", &Profile{AuthMethod: auth.SourceAzureCLI, Cloud: "usgovhigh", APIVersion: graph.APIVersionBeta})
+	cfg.Add("home", &Profile{AuthMethod: auth.SourceDeviceCode})
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	client, err := NewClient("")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if client.Cloud() != graph.USGovHigh || client.APIVersion() != graph.APIVersionBeta {
+		t.Errorf("client uses %s %s, want the profile's usgovhigh beta", client.Cloud().Name, client.APIVersion())
+	}
+
+	// Options apply after the profile's settings
+	client, err = NewClient("work", graph.WithAPIVersion(graph.APIVersionV1))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if client.APIVersion() != graph.APIVersionV1 {
+		t.Errorf("API version = %s, want the option's v1.0", client.APIVersion())
+	}
+
+	client, err = NewClient("home")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if client.Cloud() != graph.Global || client.APIVersion() != graph.APIVersionV1 {
+		t.Errorf("client uses %s %s, want global v1.0", client.Cloud().Name, client.APIVersion())
+	}
+
+	if _, err := NewClient("school"); err == nil {
+		t.Error("NewClient accepted an unknown profile")
+	}
+}
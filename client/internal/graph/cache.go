@@ -0,0 +1,403 @@
+package graph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ms_graph/internal/token"
+)
+
+// cacheVaryHeaders are request headers that change what Graph returns, so
+// they are part of a cache key
+var cacheVaryHeaders = []string{"Accept", "Accept-Language", "ConsistencyLevel", "Prefer"}
+
+// CacheEntry is a cached GET response
+type CacheEntry struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	// ETag is used to revalidate the entry once it expires
+	ETag      string    `json:"etag,omitempty"`
+	StoredAt  time.Time `json:"storedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// CacheStore holds cache entries. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the entry for key, including expired ones
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry) error
+	Delete(key string) error
+}
+
+// CacheStats counts how cacheable requests were answered
+type CacheStats struct {
+	// Hits were answered from the cache without contacting Graph
+	Hits uint64
+	// Revalidations were answered from the cache after Graph returned 304
+	Revalidations uint64
+	// Misses were fetched from Graph
+	Misses uint64
+}
+
+// Cache caches successful GET responses for a TTL. Once an entry expires it is
+// revalidated with If-None-Match if Graph returned an ETag, and fetched again
+// otherwise. Keys include the tenant and object ID of the caller's token, so
+// users sharing a store never see each other's data. Graph's own
+// Cache-Control headers are ignored since it marks nearly everything no-cache.
+type Cache struct {
+	store CacheStore
+	ttl   time.Duration
+
+	hits          atomic.Uint64
+	revalidations atomic.Uint64
+	misses        atomic.Uint64
+}
+
+// NewCache creates a cache that keeps entries fresh for ttl
+func NewCache(store CacheStore, ttl time.Duration) *Cache {
+	return &Cache{store: store, ttl: ttl}
+}
+
+// WithCache answers repeated GET requests from cache. Successful PATCH, PUT,
+// POST and DELETE requests evict the cached GET of the same URL only: keys are
+// hashed, so a PATCH to /me/messages/{id} leaves /me/messages/{id}?$select=...
+// and the /me/messages collection cached until their TTL runs out. Send
+// Cache-Control: no-store to bypass the cache where that matters.
+func WithCache(cache *Cache) Option {
+	return WithMiddleware(cache.Middleware())
+}
+
+// Stats returns the cache's hit and miss counts
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Revalidations: c.revalidations.Load(),
+		Misses:        c.misses.Load(),
+	}
+}
+
+// Middleware returns the cache as middleware, for use with WithMiddleware
+func (c *Cache) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			if IsTokenRequest(req) || isStreamRequest(req) {
+				return next(req)
+			}
+			if req.Method != http.MethodGet {
+				return c.invalidate(req, next)
+			}
+			if !cacheable(req) {
+				return next(req)
+			}
+			key, ok := cacheKey(req, req.URL.String())
+			if !ok {
+				return next(req)
+			}
+
+			entry, found := c.store.Get(key)
+			if found && req.Header.Get("Cache-Control") != "no-cache" {
+				if time.Now().Before(entry.ExpiresAt) {
+					c.hits.Add(1)
+					return entry.response(req), nil
+				}
+				if entry.ETag != "" {
+					req.Header.Set("If-None-Match", entry.ETag)
+				}
+			}
+
+			resp, err := next(req)
+			if err != nil {
+				return nil, err
+			}
+
+			if found && entry.ETag != "" && resp.StatusCode == http.StatusNotModified {
+				resp.Body.Close()
+				c.revalidations.Add(1)
+				entry.ExpiresAt = time.Now().Add(c.ttl)
+				c.store.Set(key, entry)
+				return entry.response(req), nil
+			}
+
+			c.misses.Add(1)
+			if resp.StatusCode != http.StatusOK {
+				return resp, nil
+			}
+
+			body, err := peekResponseBody(resp)
+			if err != nil {
+				return nil, err
+			}
+			now := time.Now()
+			c.store.Set(key, &CacheEntry{
+				StatusCode: resp.StatusCode,
+				Header:     resp.Header.Clone(),
+				Body:       body,
+				ETag:       ETag(resp.Header, body),
+				StoredAt:   now,
+				ExpiresAt:  now.Add(c.ttl),
+			})
+			return resp, nil
+		}
+	}
+}
+
+// invalidate sends a modifying request and evicts the cached GET of its URL
+// if it succeeds. Writes a dry run planned leave the cache alone.
+func (c *Cache) invalidate(req *http.Request, next Handler) (*http.Response, error) {
+	resp, err := next(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 || isPlanned(resp) {
+		return resp, err
+	}
+	if key, ok := cacheKey(req, req.URL.String()); ok {
+		c.store.Delete(key)
+	}
+	return resp, nil
+}
+
+// cacheable reports whether a GET request's response may be stored. Requests
+// with their own conditions or ranges are the caller's business.
+func cacheable(req *http.Request) bool {
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "Range"} {
+		if req.Header.Get(name) != "" {
+			return false
+		}
+	}
+	return req.Header.Get("Cache-Control") != "no-store"
+}
+
+// cacheKey derives a key from the caller's tenant and object ID, the URL and
+// the headers that vary the response. Requests without a bearer token that
+// identifies a user or app are not cached.
+func cacheKey(req *http.Request, url string) (string, bool) {
+	accessToken, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	tid, err := token.GetStringClaim(accessToken, "tid")
+	if err != nil {
+		return "", false
+	}
+	oid, err := token.GetStringClaim(accessToken, "oid")
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", tid, oid, url)
+	for _, name := range cacheVaryHeaders {
+		fmt.Fprintf(h, "%s: %s\n", name, strings.Join(req.Header.Values(name), ","))
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// response builds a response to req from the entry
+func (e *CacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// MemoryCache is an in-memory CacheStore
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+}
+
+// NewMemoryCache creates an in-memory store. When it holds maxEntries, the
+// oldest entry is evicted to make room; 0 means no limit.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{maxEntries: maxEntries, entries: make(map[string]*CacheEntry)}
+}
+
+// Get returns a copy of the entry for key
+func (m *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	copied := *entry
+	return &copied, true
+}
+
+// Set stores an entry, evicting the oldest one if the store is full
+func (m *MemoryCache) Set(key string, entry *CacheEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.entries[key]; !exists && m.maxEntries > 0 && len(m.entries) >= m.maxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range m.entries {
+			if oldestKey == "" || e.StoredAt.Before(oldest) {
+				oldestKey, oldest = k, e.StoredAt
+			}
+		}
+		delete(m.entries, oldestKey)
+	}
+	copied := *entry
+	m.entries[key] = &copied
+	return nil
+}
+
+// Delete removes the entry for key
+func (m *MemoryCache) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// Len returns the number of entries
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.entries)
+}
+
+// DiskCache is a CacheStore that keeps one JSON file per entry in a
+// directory readable only by the owner. A missing directory is created with
+// mode 0700; an existing one that other users can reach is refused, not
+// changed, so it is never used.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache creates a store in dir
+func NewDiskCache(dir string) *DiskCache {
+	return &DiskCache{dir: dir}
+}
+
+// DefaultCacheDir returns the response cache directory.
+// MS_GRAPH_CACHE_DIR overrides the default of <user cache dir>/msgraph/responses.
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv("MS_GRAPH_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine cache directory: %w", err)
+	}
+	return filepath.Join(base, "msgraph", "responses"), nil
+}
+
+// Check creates the directory if it is missing and returns an error unless
+// it is private to the current user
+func (d *DiskCache) Check() error {
+	if _, err := os.Stat(d.dir); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(d.dir, 0700); err != nil {
+			return fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to check cache directory: %w", err)
+	}
+	return checkPrivateDir(d.dir)
+}
+
+// Get reads the entry for key; unreadable entries, and every entry of a
+// directory other users can reach, count as missing
+func (d *DiskCache) Get(key string) (*CacheEntry, bool) {
+	if checkPrivateDir(d.dir) != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Set atomically writes the entry for key
+func (d *DiskCache) Set(key string, entry *CacheEntry) error {
+	if err := d.Check(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(d.dir, ".entry-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set cache entry permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		return fmt.Errorf("failed to replace cache entry: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the entry for key
+func (d *DiskCache) Delete(key string) error {
+	if err := os.Remove(d.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete cache entry: %w", err)
+	}
+	return nil
+}
+
+// Clear removes every entry
+func (d *DiskCache) Clear() error {
+	paths, err := filepath.Glob(filepath.Join(d.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list cache entries: %w", err)
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete cache entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// path returns the file holding the entry for key
+func (d *DiskCache) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
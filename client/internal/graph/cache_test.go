@@ -0,0 +1,270 @@
+package graph_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+// getUser GETs path and decodes the user it returns
+func getUser(t *testing.T, client graph.API, path string, header http.Header) graph.User {
+	t.Helper()
+	resp, err := client.Do(&graph.Request{Method: http.MethodGet, Path: path, Header: header})
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	var user graph.User
+	if err := resp.Decode(&user); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return user
+}
+
+// assertStats compares cache statistics
+func assertStats(t *testing.T, cache *graph.Cache, want graph.CacheStats) {
+	t.Helper()
+	if got := cache.Stats(); got != want {
+		t.Errorf("cache stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestCacheAnswersRepeatedGets(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	cache := graph.NewCache(graph.NewMemoryCache(0), time.Hour)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithCache(cache))
+
+	for i := 0; i < 3; i++ {
+		if user := getUser(t, client, "/me", nil); user.DisplayName != "Adele Vance" {
+			t.Errorf("GET %d returned %q", i+1, user.DisplayName)
+		}
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 1)
+	assertStats(t, cache, graph.CacheStats{Hits: 2, Misses: 1})
+}
+
+func TestCacheKeysByCaller(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	adele := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	alex := srv.AddUser(graph.User{DisplayName: "Alex Wilber"})
+	cache := graph.NewCache(graph.NewMemoryCache(0), time.Hour)
+
+	// Both callers share one store, but /me must not leak between them
+	if user := getUser(t, srv.NewClientWithRefresh(adele.ID, graph.WithCache(cache)), "/me", nil); user.DisplayName != "Adele Vance" {
+		t.Errorf("Adele's /me = %q", user.DisplayName)
+	}
+	if user := getUser(t, srv.NewClientWithRefresh(alex.ID, graph.WithCache(cache)), "/me", nil); user.DisplayName != "Alex Wilber" {
+		t.Errorf("Alex's /me = %q, want Alex's own profile", user.DisplayName)
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 2)
+	assertStats(t, cache, graph.CacheStats{Misses: 2})
+
+	// A new client for the same user, with a new token, shares the entries
+	getUser(t, srv.NewClientWithRefresh(adele.ID, graph.WithCache(cache)), "/me", nil)
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 2)
+}
+
+func TestCacheKeysByURLAndVaryHeaders(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance", JobTitle: "Engineer"})
+	store := graph.NewMemoryCache(0)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithCache(graph.NewCache(store, time.Hour)))
+
+	getUser(t, client, "/me", nil)
+	if user := getUser(t, client, "/me?$select=displayName", nil); user.JobTitle != "" {
+		t.Errorf("$select response came from the unselected entry: jobTitle %q", user.JobTitle)
+	}
+	getUser(t, client, "/me", http.Header{"ConsistencyLevel": {"eventual"}})
+	getUser(t, client, "/me", http.Header{"Accept-Language": {"de-DE"}})
+	// Headers outside the vary list share the entry
+	getUser(t, client, "/me", http.Header{"X-Custom": {"1"}})
+
+	if got := len(srv.Matching(http.MethodGet, "/me")); got != 4 {
+		t.Errorf("requests to /me = %d, want 4", got)
+	}
+	if store.Len() != 4 {
+		t.Errorf("cache entries = %d, want 4", store.Len())
+	}
+}
+
+func TestCacheRevalidatesExpiredEntryWithETag(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	// Entries expire at once, so every repeat is revalidated
+	cache := graph.NewCache(graph.NewMemoryCache(0), time.Nanosecond)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithCache(cache))
+
+	first, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me"})
+	if err != nil {
+		t.Fatalf("GET /me: %v", err)
+	}
+	etag := first.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("graphtest returned no ETag")
+	}
+
+	second, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me"})
+	if err != nil {
+		t.Fatalf("revalidated GET /me: %v", err)
+	}
+	// The 304 is answered with the cached 200 and body
+	if second.StatusCode != http.StatusOK || string(second.Body) != string(first.Body) {
+		t.Errorf("revalidated response = %d %s, want the cached 200 %s", second.StatusCode, second.Body, first.Body)
+	}
+	srv.AssertRequested(t, http.MethodGet, "/me").AssertHeader(t, "If-None-Match", etag)
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 2)
+	assertStats(t, cache, graph.CacheStats{Revalidations: 1, Misses: 1})
+}
+
+func TestCacheRefetchesChangedResource(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance", JobTitle: "Engineer"})
+	cache := graph.NewCache(graph.NewMemoryCache(0), time.Nanosecond)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithCache(cache))
+
+	getUser(t, client, "/me", nil)
+	// Another writer changes the user, so the cached ETag no longer matches
+	if err := srv.NewClient(me.ID).Patch("/me", map[string]string{"jobTitle": "Manager"}, nil); err != nil {
+		t.Fatalf("PATCH /me: %v", err)
+	}
+	if user := getUser(t, client, "/me", nil); user.JobTitle != "Manager" {
+		t.Errorf("JobTitle = %q, want the changed %q", user.JobTitle, "Manager")
+	}
+	assertStats(t, cache, graph.CacheStats{Misses: 2})
+	// The fresh response replaced the entry, so it revalidates with 304 now
+	getUser(t, client, "/me", nil)
+	assertStats(t, cache, graph.CacheStats{Revalidations: 1, Misses: 2})
+}
+
+func TestCacheRefetchesExpiredEntryWithoutETag(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	cache := graph.NewCache(graph.NewMemoryCache(0), time.Nanosecond)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithCache(cache))
+
+	// Collections carry no ETag, so an expired entry is fetched again
+	for i := 0; i < 2; i++ {
+		if _, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/users"}); err != nil {
+			t.Fatalf("GET /users: %v", err)
+		}
+	}
+	srv.AssertRequested(t, http.MethodGet, "/users").AssertHeader(t, "If-None-Match", "")
+	assertStats(t, cache, graph.CacheStats{Misses: 2})
+}
+
+func TestCacheEvictsEntryAfterWrite(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance", JobTitle: "Engineer"})
+	cache := graph.NewCache(graph.NewMemoryCache(0), time.Hour)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithCache(cache))
+
+	getUser(t, client, "/me", nil)
+	if err := client.Patch("/me", map[string]string{"jobTitle": "Manager"}, nil); err != nil {
+		t.Fatalf("PATCH /me: %v", err)
+	}
+	if user := getUser(t, client, "/me", nil); user.JobTitle != "Manager" {
+		t.Errorf("JobTitle = %q after PATCH, want %q", user.JobTitle, "Manager")
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 2)
+}
+
+func TestCacheBypassedByRequestHeaders(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	store := graph.NewMemoryCache(0)
+	cache := graph.NewCache(store, time.Hour)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithCache(cache))
+
+	getUser(t, client, "/me", nil)
+	// no-cache skips the stored entry, without revalidating it
+	getUser(t, client, "/me", http.Header{"Cache-Control": {"no-cache"}})
+	srv.AssertRequested(t, http.MethodGet, "/me").AssertHeader(t, "If-None-Match", "")
+	// no-store and the caller's own conditions are not cached at all
+	getUser(t, client, "/users/"+me.ID, http.Header{"Cache-Control": {"no-store"}})
+	getUser(t, client, "/users/"+me.ID, http.Header{"If-None-Match": {`W/"other"`}})
+
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 2)
+	srv.AssertRequestCount(t, http.MethodGet, "/users/"+me.ID, 2)
+	if store.Len() != 1 {
+		t.Errorf("cache entries = %d, want only the first /me", store.Len())
+	}
+}
+
+func TestDiskCacheCreatesPrivateDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "msgraph", "responses")
+	store := graph.NewDiskCache(dir)
+
+	entry := &graph.CacheEntry{StatusCode: http.StatusOK, Body: []byte(`{"id":"1"}`)}
+	if err := store.Set("key", entry); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	got, ok := store.Get("key")
+	if !ok || string(got.Body) != `{"id":"1"}` {
+		t.Fatalf("Get = %+v, %v, want the stored entry", got, ok)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("directory mode = %04o, want 0700", perm)
+	}
+	files, _ := os.ReadDir(dir)
+	for _, f := range files {
+		info, _ := f.Info()
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s mode = %04o, want 0600", f.Name(), perm)
+		}
+	}
+}
+
+func TestDiskCacheRefusesSharedDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permission bits")
+	}
+	dir := filepath.Join(t.TempDir(), "responses")
+	store := graph.NewDiskCache(dir)
+	if err := store.Set("key", &graph.CacheEntry{StatusCode: http.StatusOK}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// Once others can reach the directory it is neither used nor changed
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	if err := store.Check(); err == nil || !strings.Contains(err.Error(), "accessible to other users") {
+		t.Errorf("Check error = %v, want the directory refused", err)
+	}
+	if err := store.Set("other", &graph.CacheEntry{StatusCode: http.StatusOK}); err == nil {
+		t.Error("Set succeeded in a shared directory")
+	}
+	if _, ok := store.Get("key"); ok {
+		t.Error("Get answered from a shared directory")
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0755 {
+		t.Errorf("directory mode = %04o, want the existing mode left alone", perm)
+	}
+}
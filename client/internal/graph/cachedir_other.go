@@ -0,0 +1,21 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package graph
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkPrivateDir returns an error unless dir is a directory. Windows and
+// other platforms have no Unix permission bits to check.
+func checkPrivateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check cache directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cache directory %s is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package graph
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPrivateDir returns an error unless dir is a directory owned by the
+// current user that no other user can read, write or list, so cached
+// responses stay private and no one else can plant entries
+func checkPrivateDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check cache directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cache directory %s is not a directory", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("cache directory %s is not owned by the current user; choose a private directory", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("cache directory %s is accessible to other users (mode %04o); use a directory with mode 0700", dir, info.Mode().Perm())
+	}
+	return nil
+}
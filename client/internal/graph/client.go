@@ -1,7 +1,7 @@
 package graph
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"ms_graph/internal/token"
 )
@@ -16,6 +17,9 @@ import (
 const (
 	// BaseURL is the base URL for Microsoft Graph API
 	BaseURL = "https://graph.microsoft.com/v1.0"
+
+	// DefaultScope is the scope requested when refreshing Graph access tokens
+	DefaultScope = "https://graph.microsoft.com/.default"
 )
 
 // Client represents a Microsoft Graph API client
@@ -23,7 +27,17 @@ type Client struct {
 	accessToken string
 	httpClient  *http.Client
 	baseURL     string
-	mu          sync.RWMutex // Protects accessToken updates
+	cloud       Cloud
+	apiVersion  string
+	middleware  []Middleware
+	handler     Handler
+	limits      limits
+	// instrumentation receives token refresh events; request events flow
+	// through middleware
+	instrumentation []Instrumentation
+	// plan is set by WithDryRun
+	plan *Plan
+	mu   sync.RWMutex // Protects accessToken updates
 }
 
 // ClientWithRefresh represents a Microsoft Graph API client with automatic token refresh
@@ -31,33 +45,86 @@ type ClientWithRefresh struct {
 	*Client
 	refreshToken string
 	tenantID     string
+	tokenSource  TokenSource
 	mu           sync.Mutex // Protects refresh operations
 }
 
+// TokenSource supplies new tokens to a ClientWithRefresh when the current one
+// is expired, expiring soon, or rejected with a 401
+type TokenSource interface {
+	Token() (*TokenResponse, error)
+}
+
 // NewClient creates a new Graph API client with the provided access token
-func NewClient(accessToken string) *Client {
-	return &Client{
-		accessToken: accessToken,
-		httpClient:  &http.Client{},
-		baseURL:     BaseURL,
-	}
+func NewClient(accessToken string, opts ...Option) *Client {
+	return newClient(accessToken, opts)
 }
 
 // NewClientWithRefresh creates a new Graph API client with automatic token refresh capability
-func NewClientWithRefresh(accessToken, refreshToken, tenantID string) *ClientWithRefresh {
+func NewClientWithRefresh(accessToken, refreshToken, tenantID string, opts ...Option) *ClientWithRefresh {
 	return &ClientWithRefresh{
-		Client: &Client{
-			accessToken: accessToken,
-			httpClient:  &http.Client{},
-			baseURL:     BaseURL,
-		},
+		Client:       newClient(accessToken, opts),
 		refreshToken: refreshToken,
 		tenantID:     tenantID,
 	}
 }
 
+// NewClientWithTokenSource creates a new Graph API client that obtains new tokens from source.
+// accessToken may be empty, in which case a token is requested before the first call.
+func NewClientWithTokenSource(accessToken string, source TokenSource, opts ...Option) *ClientWithRefresh {
+	return &ClientWithRefresh{
+		Client:      newClient(accessToken, opts),
+		tokenSource: source,
+	}
+}
+
+// canRefresh reports whether the client has a way to obtain a new token
+func (c *ClientWithRefresh) canRefresh() bool {
+	return c.tokenSource != nil || c.refreshToken != ""
+}
+
+// acquireToken obtains a new token from the token source or the refresh token.
+// reason is one of the Refresh* constants, for instrumentation.
+func (c *ClientWithRefresh) acquireToken(reason string) (tokenResp *TokenResponse, err error) {
+	start := time.Now()
+	defer func() {
+		c.reportTokenRefresh(reason, start, err)
+	}()
+
+	if c.tokenSource != nil {
+		return c.tokenSource.Token()
+	}
+	return refreshToken(c.do, c.cloud, c.refreshToken, c.tenantID)
+}
+
 // checkAndRefreshToken checks if token is expired or expiring soon and refreshes if needed
 func (c *ClientWithRefresh) checkAndRefreshToken() error {
+	return c.refreshIfExpiring(RefreshExpiring)
+}
+
+// RefreshInBackground checks the token every interval until ctx is done and
+// refreshes it when it is expired or expiring soon, so requests rarely wait
+// for a refresh. Failures are passed to onError, if set, and retried at the
+// next check.
+func (c *ClientWithRefresh) RefreshInBackground(ctx context.Context, interval time.Duration, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.refreshIfExpiring(RefreshBackground); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// refreshIfExpiring refreshes the token for reason if it is expired or expiring soon
+func (c *ClientWithRefresh) refreshIfExpiring(reason string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -65,7 +132,7 @@ func (c *ClientWithRefresh) checkAndRefreshToken() error {
 	tokenInfo, err := token.ParseToken(c.accessToken)
 	if err != nil {
 		// If we can't parse the token, try to refresh anyway if we have a refresh token
-		if c.refreshToken == "" {
+		if !c.canRefresh() {
 			return fmt.Errorf("failed to parse token and no refresh token available: %w", err)
 		}
 	} else {
@@ -76,7 +143,7 @@ func (c *ClientWithRefresh) checkAndRefreshToken() error {
 	}
 
 	// Refresh token if we have one
-	if c.refreshToken == "" {
+	if !c.canRefresh() {
 		if tokenInfo != nil && tokenInfo.IsExpired {
 			return fmt.Errorf("token is expired and no refresh token available. Please get a new token from Graph Explorer")
 		}
@@ -84,495 +151,194 @@ func (c *ClientWithRefresh) checkAndRefreshToken() error {
 	}
 
 	// Attempt to refresh
-	tokenResp, err := refreshToken(c.refreshToken, c.tenantID)
+	tokenResp, err := c.acquireToken(reason)
 	if err != nil {
 		return fmt.Errorf("failed to refresh token: %w", err)
 	}
 
-	// Update access token
-	c.Client.mu.Lock()
-	c.Client.accessToken = tokenResp.AccessToken
-	c.Client.mu.Unlock()
-
-	// Update refresh token if a new one is provided (token rotation)
-	if tokenResp.RefreshToken != "" {
-		c.refreshToken = tokenResp.RefreshToken
-	}
-
+	c.updateTokens(tokenResp)
 	return nil
 }
 
-// refreshTokenOn401 attempts to refresh token and retry the request on 401 errors
-func (c *ClientWithRefresh) refreshTokenOn401(endpoint string, method string, body io.Reader, result interface{}) error {
+// Refresh obtains a new access token even if the current one has not expired,
+// for example after Graph rejected it
+func (c *ClientWithRefresh) Refresh() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.refreshToken == "" {
-		return fmt.Errorf("received 401 error and no refresh token available for automatic refresh")
+	if !c.canRefresh() {
+		return fmt.Errorf("no refresh token available for automatic refresh")
 	}
 
-	// Attempt to refresh
-	tokenResp, err := refreshToken(c.refreshToken, c.tenantID)
+	tokenResp, err := c.acquireToken(RefreshRequested)
 	if err != nil {
-		return fmt.Errorf("received 401 error and failed to refresh token: %w", err)
+		return fmt.Errorf("failed to refresh token: %w", err)
 	}
 
+	c.updateTokens(tokenResp)
+	return nil
+}
+
+// updateTokens stores a newly acquired token; callers must hold c.mu
+func (c *ClientWithRefresh) updateTokens(tokenResp *TokenResponse) {
 	// Update access token
 	c.Client.mu.Lock()
 	c.Client.accessToken = tokenResp.AccessToken
 	c.Client.mu.Unlock()
 
-	// Update refresh token if a new one is provided
+	// Update refresh token if a new one is provided (token rotation)
 	if tokenResp.RefreshToken != "" {
 		c.refreshToken = tokenResp.RefreshToken
 	}
-
-	// Retry the original request
-	url := c.baseURL + endpoint
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return fmt.Errorf("failed to create retry request: %w", err)
-	}
-
-	c.Client.mu.RLock()
-	req.Header.Set("Authorization", "Bearer "+c.Client.accessToken)
-	c.Client.mu.RUnlock()
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute retry request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read retry response body: %w", err)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(respBody, &errorResp); err != nil {
-			return fmt.Errorf("API error after refresh (status %d): %s", resp.StatusCode, string(respBody))
-		}
-		return fmt.Errorf("API error after refresh: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
-
-	if result != nil && len(respBody) > 0 {
-		if err := json.Unmarshal(respBody, result); err != nil {
-			return fmt.Errorf("failed to unmarshal retry response: %w", err)
-		}
-	}
-
-	return nil
 }
 
-// Get performs a GET request to the specified endpoint
-func (c *Client) Get(endpoint string, result interface{}) error {
-	c.mu.RLock()
-	accessToken := c.accessToken
-	c.mu.RUnlock()
-
-	url := c.baseURL + endpoint
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+// refreshAfter401 obtains a new token after Graph rejected the current one,
+// leaving the retry to the caller
+func (c *ClientWithRefresh) refreshAfter401() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+	if !c.canRefresh() {
+		return fmt.Errorf("received 401 error and no refresh token available for automatic refresh")
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	tokenResp, err := c.acquireToken(RefreshUnauthorized)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(body, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-		}
-		return fmt.Errorf("API error: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
-
-	if err := json.Unmarshal(body, result); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
+		return fmt.Errorf("received 401 error and failed to refresh token: %w", err)
 	}
 
+	c.updateTokens(tokenResp)
 	return nil
 }
 
-// Get performs a GET request with automatic token refresh
-func (c *ClientWithRefresh) Get(endpoint string, result interface{}) error {
-	// Check and refresh token before request
+// AccessToken returns a valid access token, refreshing it first if it is expired or expiring soon
+func (c *ClientWithRefresh) AccessToken() (string, error) {
 	if err := c.checkAndRefreshToken(); err != nil {
-		return fmt.Errorf("token check failed: %w", err)
+		return "", fmt.Errorf("token check failed: %w", err)
 	}
 
-	// Perform the request
 	c.Client.mu.RLock()
-	accessToken := c.Client.accessToken
-	c.Client.mu.RUnlock()
-
-	url := c.baseURL + endpoint
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
+	defer c.Client.mu.RUnlock()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+	if c.Client.accessToken == "" {
+		return "", fmt.Errorf("no access token available")
 	}
+	return c.Client.accessToken, nil
+}
 
-	// Handle 401 errors by refreshing and retrying
-	if resp.StatusCode == 401 {
-		return c.refreshTokenOn401(endpoint, "GET", nil, result)
-	}
+// TokenForScope redeems the client's refresh token for an access token with a different scope,
+// such as "Mail.Read offline_access". The client's own token is not changed.
+func (c *ClientWithRefresh) TokenForScope(scope string) (*TokenResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(body, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	// A token source only hands over its refresh token with a new token
+	if c.refreshToken == "" && c.tokenSource != nil {
+		tokenResp, err := c.tokenSource.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh token: %w", err)
 		}
-		return fmt.Errorf("API error: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
 
-	if err := json.Unmarshal(body, result); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
+		c.updateTokens(tokenResp)
 	}
 
-	return nil
-}
-
-// Post performs a POST request to the specified endpoint
-func (c *Client) Post(endpoint string, payload interface{}, result interface{}) error {
-	c.mu.RLock()
-	accessToken := c.accessToken
-	c.mu.RUnlock()
-
-	url := c.baseURL + endpoint
-
-	var body bytes.Buffer
-	if payload != nil {
-		if err := json.NewEncoder(&body).Encode(payload); err != nil {
-			return fmt.Errorf("failed to encode payload: %w", err)
-		}
+	if c.refreshToken == "" {
+		return nil, fmt.Errorf("scope %q requires a refresh token", scope)
 	}
 
-	req, err := http.NewRequest("POST", url, &body)
+	start := time.Now()
+	tokenResp, err := refreshTokenForScope(c.do, c.cloud, c.refreshToken, c.tenantID, scope)
+	c.reportTokenRefresh(RefreshScope, start, err)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to get token for scope %q: %w", scope, err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+	// Update refresh token if a new one is provided (token rotation)
+	if tokenResp.RefreshToken != "" {
+		c.refreshToken = tokenResp.RefreshToken
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
+	return tokenResp, nil
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(respBody, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-		}
-		return fmt.Errorf("API error: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
+// Get performs a GET request to the specified endpoint
+func (c *Client) Get(endpoint string, result interface{}) error {
+	return getJSON(c.Do, endpoint, result)
+}
 
-	if result != nil && len(respBody) > 0 {
-		if err := json.Unmarshal(respBody, result); err != nil {
-			return fmt.Errorf("failed to unmarshal response: %w", err)
-		}
-	}
+// Get performs a GET request with automatic token refresh
+func (c *ClientWithRefresh) Get(endpoint string, result interface{}) error {
+	return getJSON(c.Do, endpoint, result)
+}
 
-	return nil
+// Post performs a POST request to the specified endpoint
+func (c *Client) Post(endpoint string, payload interface{}, result interface{}) error {
+	return sendJSON(c.Do, "POST", endpoint, payload, result)
 }
 
 // Post performs a POST request with automatic token refresh
 func (c *ClientWithRefresh) Post(endpoint string, payload interface{}, result interface{}) error {
-	// Check and refresh token before request
-	if err := c.checkAndRefreshToken(); err != nil {
-		return fmt.Errorf("token check failed: %w", err)
-	}
-
-	// Prepare body
-	var body bytes.Buffer
-	if payload != nil {
-		if err := json.NewEncoder(&body).Encode(payload); err != nil {
-			return fmt.Errorf("failed to encode payload: %w", err)
-		}
-	}
-
-	// Perform the request
-	c.Client.mu.RLock()
-	accessToken := c.Client.accessToken
-	c.Client.mu.RUnlock()
-
-	url := c.baseURL + endpoint
-	req, err := http.NewRequest("POST", url, &body)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	// Handle 401 errors by refreshing and retrying
-	if resp.StatusCode == 401 {
-		var retryBody bytes.Buffer
-		if payload != nil {
-			json.NewEncoder(&retryBody).Encode(payload)
-		}
-		return c.refreshTokenOn401(endpoint, "POST", &retryBody, result)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(respBody, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-		}
-		return fmt.Errorf("API error: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
-
-	if result != nil && len(respBody) > 0 {
-		if err := json.Unmarshal(respBody, result); err != nil {
-			return fmt.Errorf("failed to unmarshal response: %w", err)
-		}
-	}
-
-	return nil
+	return sendJSON(c.Do, "POST", endpoint, payload, result)
 }
 
 // Patch performs a PATCH request to the specified endpoint
 func (c *Client) Patch(endpoint string, payload interface{}, result interface{}) error {
-	c.mu.RLock()
-	accessToken := c.accessToken
-	c.mu.RUnlock()
-
-	url := c.baseURL + endpoint
-
-	var body bytes.Buffer
-	if payload != nil {
-		if err := json.NewEncoder(&body).Encode(payload); err != nil {
-			return fmt.Errorf("failed to encode payload: %w", err)
-		}
-	}
-
-	req, err := http.NewRequest("PATCH", url, &body)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(respBody, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-		}
-		return fmt.Errorf("API error: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
-
-	if result != nil && len(respBody) > 0 {
-		if err := json.Unmarshal(respBody, result); err != nil {
-			return fmt.Errorf("failed to unmarshal response: %w", err)
-		}
-	}
-
-	return nil
+	return sendJSON(c.Do, "PATCH", endpoint, payload, result)
 }
 
 // Patch performs a PATCH request with automatic token refresh
 func (c *ClientWithRefresh) Patch(endpoint string, payload interface{}, result interface{}) error {
-	// Check and refresh token before request
-	if err := c.checkAndRefreshToken(); err != nil {
-		return fmt.Errorf("token check failed: %w", err)
-	}
-
-	// Prepare body
-	var body bytes.Buffer
-	if payload != nil {
-		if err := json.NewEncoder(&body).Encode(payload); err != nil {
-			return fmt.Errorf("failed to encode payload: %w", err)
-		}
-	}
-
-	// Perform the request
-	c.Client.mu.RLock()
-	accessToken := c.Client.accessToken
-	c.Client.mu.RUnlock()
-
-	url := c.baseURL + endpoint
-	req, err := http.NewRequest("PATCH", url, &body)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+	return sendJSON(c.Do, "PATCH", endpoint, payload, result)
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
+// Put performs a PUT request with a JSON payload to the specified endpoint
+func (c *Client) Put(endpoint string, payload interface{}, result interface{}) error {
+	return sendJSON(c.Do, "PUT", endpoint, payload, result)
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
+// Put performs a PUT request with a JSON payload and automatic token refresh
+func (c *ClientWithRefresh) Put(endpoint string, payload interface{}, result interface{}) error {
+	return sendJSON(c.Do, "PUT", endpoint, payload, result)
+}
 
-	// Handle 401 errors by refreshing and retrying
-	if resp.StatusCode == 401 {
-		var retryBody bytes.Buffer
-		if payload != nil {
-			json.NewEncoder(&retryBody).Encode(payload)
-		}
-		return c.refreshTokenOn401(endpoint, "PATCH", &retryBody, result)
-	}
+// PutContent performs a PUT request with a raw body, such as a small file for
+// /me/drive/root:/name:/content or an image for /me/photo/$value
+func (c *Client) PutContent(endpoint, contentType string, content io.Reader, result interface{}) error {
+	return putContent(c.Do, endpoint, contentType, content, result)
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(respBody, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-		}
-		return fmt.Errorf("API error: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
+// PutContent performs a PUT request with a raw body and automatic token refresh
+func (c *ClientWithRefresh) PutContent(endpoint, contentType string, content io.Reader, result interface{}) error {
+	return putContent(c.Do, endpoint, contentType, content, result)
+}
 
-	if result != nil && len(respBody) > 0 {
-		if err := json.Unmarshal(respBody, result); err != nil {
-			return fmt.Errorf("failed to unmarshal response: %w", err)
-		}
-	}
+// Head performs a HEAD request and returns the response headers
+func (c *Client) Head(endpoint string) (http.Header, error) {
+	return head(c.Do, endpoint)
+}
 
-	return nil
+// Head performs a HEAD request with automatic token refresh
+func (c *ClientWithRefresh) Head(endpoint string) (http.Header, error) {
+	return head(c.Do, endpoint)
 }
 
 // Delete performs a DELETE request to the specified endpoint
 func (c *Client) Delete(endpoint string) error {
-	c.mu.RLock()
-	accessToken := c.accessToken
-	c.mu.RUnlock()
-
-	url := c.baseURL + endpoint
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(body, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-		}
-		return fmt.Errorf("API error: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
-
-	return nil
+	return deleteResource(c.Do, endpoint)
 }
 
 // Delete performs a DELETE request with automatic token refresh
 func (c *ClientWithRefresh) Delete(endpoint string) error {
-	// Check and refresh token before request
-	if err := c.checkAndRefreshToken(); err != nil {
-		return fmt.Errorf("token check failed: %w", err)
-	}
-
-	// Perform the request
-	c.Client.mu.RLock()
-	accessToken := c.Client.accessToken
-	c.Client.mu.RUnlock()
-
-	url := c.baseURL + endpoint
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Handle 401 errors by refreshing and retrying
-	if resp.StatusCode == 401 {
-		return c.refreshTokenOn401(endpoint, "DELETE", nil, nil)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(body, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-		}
-		return fmt.Errorf("API error: %s - %s", errorResp.Error.Code, errorResp.Error.Message)
-	}
+	return deleteResource(c.Do, endpoint)
+}
 
-	return nil
+// refreshToken refreshes an access token for the cloud's Graph audience using a refresh token
+func refreshToken(do Handler, cloud Cloud, refreshToken, tenantID string) (*TokenResponse, error) {
+	return refreshTokenForScope(do, cloud, refreshToken, tenantID, cloud.Scope())
 }
 
-// refreshToken refreshes an access token using a refresh token
-func refreshToken(refreshToken, tenantID string) (*TokenResponse, error) {
+// refreshTokenForScope redeems a refresh token for an access token with the given scope
+func refreshTokenForScope(do Handler, cloud Cloud, refreshToken, tenantID, scope string) (*TokenResponse, error) {
 	if refreshToken == "" {
 		return nil, fmt.Errorf("refresh token is required")
 	}
@@ -582,13 +348,13 @@ func refreshToken(refreshToken, tenantID string) (*TokenResponse, error) {
 		tenantID = "common"
 	}
 
-	endpoint := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenantID)
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", cloud.LoginEndpoint, tenantID)
 
 	// Prepare form data
 	data := url.Values{}
 	data.Set("grant_type", "refresh_token")
 	data.Set("refresh_token", refreshToken)
-	data.Set("scope", "https://graph.microsoft.com/.default")
+	data.Set("scope", scope)
 
 	// Create request
 	req, err := http.NewRequest("POST", endpoint, strings.NewReader(data.Encode()))
@@ -597,10 +363,10 @@ func refreshToken(refreshToken, tenantID string) (*TokenResponse, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = withRequestInfo(req, requestInfo{tokenRequest: true})
 
 	// Execute request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
@@ -630,4 +396,3 @@ func refreshToken(refreshToken, tenantID string) (*TokenResponse, error) {
 
 	return &tokenResp, nil
 }
-
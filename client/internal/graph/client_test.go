@@ -0,0 +1,264 @@
+package graph_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+// events records instrumentation events
+type events struct {
+	graph.NopInstrumentation
+
+	mu        sync.Mutex
+	throttles []graph.ThrottleEvent
+	refreshes []graph.TokenRefreshEvent
+}
+
+func (e *events) Throttle(_ *http.Request, event graph.ThrottleEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.throttles = append(e.throttles, event)
+}
+
+func (e *events) TokenRefresh(event graph.TokenRefreshEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.refreshes = append(e.refreshes, event)
+}
+
+// refreshToken returns the refresh token a token request redeemed
+func refreshToken(t *testing.T, req graphtest.Request) string {
+	t.Helper()
+	form, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		t.Fatalf("failed to parse token request: %v", err)
+	}
+	return form.Get("refresh_token")
+}
+
+func TestClientWithRefreshRetriesAfter401(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	recorded := &events{}
+	client := srv.NewClientWithRefresh(me.ID, graph.WithInstrumentation(recorded))
+
+	srv.ExpireAccessTokens()
+	var user graph.User
+	if err := client.Get("/me", &user); err != nil {
+		t.Fatalf("Get /me: %v", err)
+	}
+	if user.DisplayName != "Adele Vance" {
+		t.Errorf("DisplayName = %q, want %q", user.DisplayName, "Adele Vance")
+	}
+
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 2)
+	if got := len(srv.TokenRequests()); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+	requests := srv.Matching(http.MethodGet, "/me")
+	if requests[0].Header.Get("Authorization") == requests[1].Header.Get("Authorization") {
+		t.Error("retry after 401 reused the rejected token")
+	}
+	if len(recorded.refreshes) != 1 || recorded.refreshes[0].Reason != graph.RefreshUnauthorized {
+		t.Errorf("refresh events = %+v, want one %q", recorded.refreshes, graph.RefreshUnauthorized)
+	}
+}
+
+func TestClientWithRefreshRefreshesExpiringToken(t *testing.T) {
+	// Tokens that expire within ten minutes are refreshed before each request
+	srv := graphtest.NewServer(graphtest.WithTokenLifetime(5 * time.Minute))
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	for i := 0; i < 2; i++ {
+		if _, err := graph.GetAs[graph.User](client, "/me"); err != nil {
+			t.Fatalf("Get /me: %v", err)
+		}
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 2)
+	if got := len(srv.TokenRequests()); got != 2 {
+		t.Errorf("token requests = %d, want 2", got)
+	}
+}
+
+func TestClientWithRefreshUsesRotatedRefreshToken(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	tokens := srv.IssueTokens(me.ID)
+	client := graph.NewClientWithRefresh(tokens.AccessToken, tokens.RefreshToken, graphtest.DefaultTenantID, srv.ClientOptions()...)
+
+	for i := 0; i < 2; i++ {
+		srv.ExpireAccessTokens()
+		if _, err := graph.GetAs[graph.User](client, "/me"); err != nil {
+			t.Fatalf("Get /me after refresh %d: %v", i+1, err)
+		}
+	}
+
+	tokenRequests := srv.TokenRequests()
+	if len(tokenRequests) != 2 {
+		t.Fatalf("token requests = %d, want 2", len(tokenRequests))
+	}
+	first, second := refreshToken(t, tokenRequests[0]), refreshToken(t, tokenRequests[1])
+	if first != tokens.RefreshToken {
+		t.Errorf("first refresh redeemed %q, want the issued %q", first, tokens.RefreshToken)
+	}
+	if second == first {
+		t.Error("second refresh redeemed the already rotated refresh token")
+	}
+	if srv.ValidRefreshToken(first) || srv.ValidRefreshToken(second) {
+		t.Error("a redeemed refresh token is still valid after rotation")
+	}
+}
+
+func TestClientWithRefreshFailsWhenRefreshTokenRevoked(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	srv.ExpireAccessTokens()
+	srv.RevokeRefreshTokens()
+	if _, err := graph.GetAs[graph.User](client, "/me"); err == nil {
+		t.Fatal("Get /me succeeded with a revoked refresh token")
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 1)
+}
+
+func TestListAsFollowsNextLink(t *testing.T) {
+	srv := graphtest.NewServer(graphtest.WithPageSize(2))
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	for _, name := range []string{"Alex Wilber", "Diego Siciliani", "Grady Archie", "Isaiah Langer"} {
+		srv.AddUser(graph.User{DisplayName: name})
+	}
+	client := srv.NewClientWithRefresh(me.ID)
+
+	users, err := graph.ListAs[graph.User](client, "/users")
+	if err != nil {
+		t.Fatalf("ListAs /users: %v", err)
+	}
+	if len(users) != 5 {
+		t.Fatalf("got %d users, want 5", len(users))
+	}
+	if users[0].DisplayName != "Adele Vance" || users[4].DisplayName != "Isaiah Langer" {
+		t.Errorf("users out of order: first %q, last %q", users[0].DisplayName, users[4].DisplayName)
+	}
+
+	requests := srv.Matching(http.MethodGet, "/users")
+	if len(requests) != 3 {
+		t.Fatalf("requests = %d, want 3 pages", len(requests))
+	}
+	for i, want := range []string{"", "2", "4"} {
+		if got := requests[i].Query.Get("$skiptoken"); got != want {
+			t.Errorf("page %d $skiptoken = %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func TestThrottledRequestReportsRetryAfter(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	recorded := &events{}
+	client := srv.NewClientWithRefresh(me.ID, graph.WithInstrumentation(recorded))
+
+	srv.Inject(graphtest.Fault{Path: "/me", StatusCode: http.StatusTooManyRequests, RetryAfter: 7 * time.Second})
+	_, err := graph.GetAs[graph.User](client, "/me")
+	var graphErr *graph.GraphError
+	if !errors.As(err, &graphErr) {
+		t.Fatalf("Get /me error = %v, want a GraphError", err)
+	}
+	if graphErr.StatusCode != http.StatusTooManyRequests || graphErr.Code != "TooManyRequests" {
+		t.Errorf("error = %d %s, want 429 TooManyRequests", graphErr.StatusCode, graphErr.Code)
+	}
+	if !graph.IsRetryable(graphErr.StatusCode) {
+		t.Error("429 is not retryable")
+	}
+	if graphErr.RequestID == "" {
+		t.Error("throttled error has no request ID")
+	}
+	if got := graphErr.Header.Get("Retry-After"); got != "7" {
+		t.Errorf("error header Retry-After = %q, want %q", got, "7")
+	}
+	if len(recorded.throttles) != 1 || recorded.throttles[0].RetryAfter != 7*time.Second {
+		t.Errorf("throttle events = %+v, want one with RetryAfter 7s", recorded.throttles)
+	}
+	if got := len(srv.TokenRequests()); got != 0 {
+		t.Errorf("token requests = %d, want 0 for a throttled request", got)
+	}
+
+	// The fault fired once, so the retry succeeds
+	if _, err := graph.GetAs[graph.User](client, "/me"); err != nil {
+		t.Fatalf("Get /me after throttling: %v", err)
+	}
+}
+
+func TestPatchIfMatchFailsWhenResourceChanged(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	var user graph.User
+	etag, err := client.GetWithETag("/me", &user)
+	if err != nil {
+		t.Fatalf("GetWithETag /me: %v", err)
+	}
+	if etag == "" {
+		t.Fatal("GetWithETag returned no ETag")
+	}
+
+	if err := client.PatchIfMatch("/me", etag, map[string]string{"jobTitle": "Engineer"}, nil); err != nil {
+		t.Fatalf("PatchIfMatch with the current ETag: %v", err)
+	}
+	srv.AssertRequested(t, http.MethodPatch, "/me").AssertHeader(t, "If-Match", etag)
+
+	// The first patch changed the user, so the same ETag is now stale
+	err = client.PatchIfMatch("/me", etag, map[string]string{"jobTitle": "Manager"}, nil)
+	if !errors.Is(err, graph.ErrPreconditionFailed) {
+		t.Fatalf("PatchIfMatch with a stale ETag error = %v, want ErrPreconditionFailed", err)
+	}
+	if current, _ := srv.User(me.ID); current.JobTitle != "Engineer" {
+		t.Errorf("JobTitle = %q, want the first patch's %q", current.JobTitle, "Engineer")
+	}
+}
+
+func TestReadModifyWriteRetriesAfter412(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance", JobTitle: "Engineer"})
+	client := srv.NewClientWithRefresh(me.ID)
+	other := srv.NewClient(me.ID)
+
+	attempts := 0
+	err := graph.ReadModifyWrite[graph.User](client, "/me", 0, func(current *graph.User) (interface{}, error) {
+		attempts++
+		if attempts == 1 {
+			// Another writer changes the user between our read and write
+			if err := other.Patch("/me", map[string]string{"officeLocation": "Seattle"}, nil); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]string{"jobTitle": current.JobTitle + " II"}, nil
+	})
+	if err != nil {
+		t.Fatalf("ReadModifyWrite: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+	current, _ := srv.User(me.ID)
+	if current.JobTitle != "Engineer II" || current.OfficeLocation != "Seattle" {
+		t.Errorf("user = %q in %q, want %q in %q", current.JobTitle, current.OfficeLocation, "Engineer II", "Seattle")
+	}
+}
@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// DefaultConflictAttempts is how many times ReadModifyWrite tries before
+// giving up when maxAttempts is 0
+const DefaultConflictAttempts = 3
+
+// ConditionalClient is implemented by Client and ClientWithRefresh
+type ConditionalClient interface {
+	GetWithETag(endpoint string, result interface{}) (string, error)
+	PatchIfMatch(endpoint, etag string, payload interface{}, result interface{}) error
+}
+
+// ETag returns the ETag of a resource: the "@odata.etag" property of its JSON
+// body if present, else the ETag response header
+func ETag(header http.Header, body []byte) string {
+	var annotated struct {
+		ETag string `json:"@odata.etag"`
+	}
+	if json.Unmarshal(body, &annotated) == nil && annotated.ETag != "" {
+		return annotated.ETag
+	}
+	return header.Get("ETag")
+}
+
+// GetWithETag performs a GET request and returns the resource's ETag
+func (c *Client) GetWithETag(endpoint string, result interface{}) (string, error) {
+	return getWithETag(c.Do, endpoint, result)
+}
+
+// GetIfNoneMatch performs a GET request that Graph answers with 304 Not
+// Modified if the resource still has etag. modified is false in that case and
+// result is left untouched; otherwise result holds the resource and newETag its
+// current ETag.
+func (c *Client) GetIfNoneMatch(endpoint, etag string, result interface{}) (newETag string, modified bool, err error) {
+	return getIfNoneMatch(c.Do, endpoint, etag, result)
+}
+
+// PatchIfMatch performs a PATCH request that only applies if the resource
+// still has etag. If it changed, the error matches ErrPreconditionFailed.
+func (c *Client) PatchIfMatch(endpoint, etag string, payload interface{}, result interface{}) error {
+	return sendIfMatch(c.Do, "PATCH", endpoint, etag, payload, result)
+}
+
+// DeleteIfMatch performs a DELETE request that only applies if the resource
+// still has etag. If it changed, the error matches ErrPreconditionFailed.
+func (c *Client) DeleteIfMatch(endpoint, etag string) error {
+	return sendIfMatch(c.Do, "DELETE", endpoint, etag, nil, nil)
+}
+
+// GetWithETag performs a GET request with automatic token refresh and returns
+// the resource's ETag
+func (c *ClientWithRefresh) GetWithETag(endpoint string, result interface{}) (string, error) {
+	return getWithETag(c.Do, endpoint, result)
+}
+
+// GetIfNoneMatch performs a conditional GET request with automatic token refresh
+func (c *ClientWithRefresh) GetIfNoneMatch(endpoint, etag string, result interface{}) (newETag string, modified bool, err error) {
+	return getIfNoneMatch(c.Do, endpoint, etag, result)
+}
+
+// PatchIfMatch performs a conditional PATCH request with automatic token refresh
+func (c *ClientWithRefresh) PatchIfMatch(endpoint, etag string, payload interface{}, result interface{}) error {
+	return sendIfMatch(c.Do, "PATCH", endpoint, etag, payload, result)
+}
+
+// DeleteIfMatch performs a conditional DELETE request with automatic token refresh
+func (c *ClientWithRefresh) DeleteIfMatch(endpoint, etag string) error {
+	return sendIfMatch(c.Do, "DELETE", endpoint, etag, nil, nil)
+}
+
+// ReadModifyWrite updates a resource with optimistic concurrency. It GETs
+// endpoint into a new T, passes it to mutate, and PATCHes the returned payload
+// with If-Match set to the ETag it read. If the resource changed in between,
+// it starts over, up to maxAttempts times (DefaultConflictAttempts if 0).
+// mutate may be called more than once and should not have side effects.
+func ReadModifyWrite[T any](client ConditionalClient, endpoint string, maxAttempts int, mutate func(current *T) (interface{}, error)) error {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultConflictAttempts
+	}
+
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		var current T
+		etag, getErr := client.GetWithETag(endpoint, &current)
+		if getErr != nil {
+			return getErr
+		}
+		if etag == "" {
+			return fmt.Errorf("%s has no ETag", endpoint)
+		}
+
+		payload, mutateErr := mutate(&current)
+		if mutateErr != nil {
+			return mutateErr
+		}
+
+		err = client.PatchIfMatch(endpoint, etag, payload, nil)
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", maxAttempts, err)
+}
+
+// getWithETag GETs endpoint into result and returns its ETag
+func getWithETag(do doFunc, endpoint string, result interface{}) (string, error) {
+	resp, err := do(&Request{Method: "GET", Path: endpoint})
+	if err != nil {
+		return "", err
+	}
+	if err := resp.Decode(result); err != nil {
+		return "", err
+	}
+	return ETag(resp.Header, resp.Body), nil
+}
+
+// getIfNoneMatch GETs endpoint unless it still has etag
+func getIfNoneMatch(do doFunc, endpoint, etag string, result interface{}) (string, bool, error) {
+	resp, err := do(&Request{Method: "GET", Path: endpoint, Header: ifNoneMatch(etag)})
+	if err != nil {
+		return "", false, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return etag, false, nil
+	}
+	if err := resp.Decode(result); err != nil {
+		return "", false, err
+	}
+	return ETag(resp.Header, resp.Body), true, nil
+}
+
+// sendIfMatch sends payload as JSON with If-Match set to etag
+func sendIfMatch(do doFunc, method, endpoint, etag string, payload, result interface{}) error {
+	req, err := NewJSONRequest(method, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	req.Header = ifMatch(etag)
+	resp, err := do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Decode(result)
+}
+
+// ifMatch returns headers for a request that must not overwrite a newer version
+func ifMatch(etag string) http.Header {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	}
+	return header
+}
+
+// ifNoneMatch returns headers for a GET that may be answered with 304
+func ifNoneMatch(etag string) http.Header {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	return header
+}
@@ -0,0 +1,245 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlannedRequest is a write that a dry-run client recorded instead of sending
+type PlannedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Header holds the request's headers except Authorization and the
+	// per-request IDs and trace context, which are new when the plan is applied
+	Header http.Header `json:"header,omitempty"`
+	// Body is a JSON body; Content holds any other body
+	Body    json.RawMessage `json:"body,omitempty"`
+	Content []byte          `json:"content,omitempty"`
+}
+
+// Plan collects the POST, PATCH, PUT and DELETE requests of a dry-run client
+// so they can be reviewed, saved and applied later
+type Plan struct {
+	mu        sync.Mutex
+	createdAt time.Time
+	requests  []PlannedRequest
+}
+
+// unplannedHeaders are left out of planned requests
+var unplannedHeaders = []string{"Authorization", "client-request-id", "return-client-request-id", "traceparent"}
+
+// plannedKey is the context key that marks the request of a planned response
+type plannedKey struct{}
+
+// planFile is the JSON form of a Plan
+type planFile struct {
+	CreatedAt time.Time        `json:"createdAt"`
+	Requests  []PlannedRequest `json:"requests"`
+}
+
+// NewPlan creates an empty plan
+func NewPlan() *Plan {
+	return &Plan{createdAt: time.Now().UTC().Truncate(time.Second)}
+}
+
+// WithDryRun records writes in plan and answers them with 204 No Content
+// instead of sending them. GET and HEAD requests and token refreshes are sent
+// as usual. Middleware added before this option still sees the writes, and a
+// cache keeps the GETs they would have evicted. Results decoded from a
+// planned write are left empty; UploadLargeFile plans only the session
+// request, since chunks go to the URL Graph would have returned.
+func WithDryRun(plan *Plan) Option {
+	return func(c *Client) {
+		c.plan = plan
+		c.middleware = append(c.middleware, plan.Middleware())
+	}
+}
+
+// isPlanned reports whether a response answers a write that a dry run
+// recorded instead of sending
+func isPlanned(resp *http.Response) bool {
+	return resp.Request != nil && resp.Request.Context().Value(plannedKey{}) != nil
+}
+
+// Middleware returns middleware that records writes in the plan rather than
+// sending them
+func (p *Plan) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			if IsTokenRequest(req) || req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+				return next(req)
+			}
+
+			planned := PlannedRequest{
+				Method: req.Method,
+				URL:    req.URL.String(),
+				Header: req.Header.Clone(),
+			}
+			for _, name := range unplannedHeaders {
+				planned.Header.Del(name)
+			}
+			if len(planned.Header) == 0 {
+				planned.Header = nil
+			}
+			if req.Body != nil {
+				body, err := io.ReadAll(req.Body)
+				req.Body.Close()
+				if err != nil {
+					return nil, fmt.Errorf("failed to read request body: %w", err)
+				}
+				if strings.Contains(req.Header.Get("Content-Type"), "json") && json.Valid(body) {
+					planned.Body = body
+				} else if len(body) > 0 {
+					planned.Content = body
+				}
+			}
+			p.add(planned)
+
+			return &http.Response{
+				Status:     "204 No Content",
+				StatusCode: http.StatusNoContent,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     http.Header{},
+				Body:       http.NoBody,
+				Request:    req.WithContext(context.WithValue(req.Context(), plannedKey{}, true)),
+			}, nil
+		}
+	}
+}
+
+// add appends a request to the plan
+func (p *Plan) add(planned PlannedRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, planned)
+}
+
+// Requests returns the planned requests in the order they were made
+func (p *Plan) Requests() []PlannedRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]PlannedRequest(nil), p.requests...)
+}
+
+// WriteText writes the plan for review: one numbered entry per request with
+// its headers and indented body
+func (p *Plan) WriteText(w io.Writer) error {
+	requests := p.Requests()
+	if len(requests) == 0 {
+		_, err := fmt.Fprintln(w, "No changes planned")
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Planned %d request(s):\n", len(requests))
+	for i, planned := range requests {
+		fmt.Fprintf(&buf, "\n%d. %s %s\n", i+1, planned.Method, planned.URL)
+
+		names := make([]string, 0, len(planned.Header))
+		for name := range planned.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&buf, "   %s: %s\n", name, strings.Join(planned.Header[name], ", "))
+		}
+
+		switch {
+		case len(planned.Body) > 0:
+			var indented bytes.Buffer
+			if json.Indent(&indented, planned.Body, "   ", "  ") != nil {
+				indented.Reset()
+				indented.Write(planned.Body)
+			}
+			fmt.Fprintf(&buf, "   %s\n", bytes.TrimSpace(indented.Bytes()))
+		case len(planned.Content) > 0:
+			fmt.Fprintf(&buf, "   (%d bytes of %s)\n", len(planned.Content), firstNonEmpty(planned.Header.Get("Content-Type"), "content"))
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// MarshalJSON encodes the plan with its creation time
+func (p *Plan) MarshalJSON() ([]byte, error) {
+	return json.Marshal(planFile{CreatedAt: p.createdAt, Requests: p.Requests()})
+}
+
+// UnmarshalJSON decodes a plan written by MarshalJSON
+func (p *Plan) UnmarshalJSON(data []byte) error {
+	var file planFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.createdAt = file.CreatedAt
+	p.requests = file.Requests
+	return nil
+}
+
+// Save writes the plan to path as JSON. Plans can hold secrets such as
+// initial passwords, so the file is only readable by the owner.
+func (p *Plan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// LoadPlan reads a plan saved with Save
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	p := &Plan{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Apply sends the planned requests in order, stopping at the first failure.
+// It returns how many requests succeeded. URLs must be on client's Graph host.
+func (p *Plan) Apply(client API) (int, error) {
+	requests := p.Requests()
+	for i, planned := range requests {
+		req := &Request{Method: planned.Method, Path: planned.URL, Header: planned.Header.Clone()}
+		if req.Header != nil {
+			req.ContentType = req.Header.Get("Content-Type")
+			req.Header.Del("Content-Type")
+		}
+		switch {
+		case len(planned.Body) > 0:
+			req.Body = bytes.NewReader(planned.Body)
+		case len(planned.Content) > 0:
+			req.Body = bytes.NewReader(planned.Content)
+		}
+
+		if _, err := client.Do(req); err != nil {
+			return i, fmt.Errorf("failed to apply request %d (%s %s): %w", i+1, planned.Method, planned.URL, err)
+		}
+	}
+	return len(requests), nil
+}
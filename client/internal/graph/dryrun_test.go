@@ -0,0 +1,96 @@
+package graph_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+func TestDryRunLeavesPerRequestHeadersOutOfPlan(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance", JobTitle: "Engineer"})
+	plan := graph.NewPlan()
+	client := srv.NewClientWithRefresh(me.ID,
+		graph.WithMiddleware(graph.ClientRequestID()),
+		graph.WithDryRun(plan))
+
+	header := http.Header{
+		"Prefer":                   {"return=minimal"},
+		"Return-Client-Request-Id": {"true"},
+		"Traceparent":              {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+	}
+	req, err := graph.NewJSONRequest(http.MethodPatch, "/me", map[string]string{"jobTitle": "Manager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("dry-run PATCH /me: %v", err)
+	}
+	srv.AssertNotRequested(t, http.MethodPatch, "/me")
+
+	requests := plan.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("planned requests = %d, want 1", len(requests))
+	}
+	for _, name := range []string{"Authorization", "client-request-id", "return-client-request-id", "traceparent"} {
+		if value := requests[0].Header.Get(name); value != "" {
+			t.Errorf("planned %s = %q, want it left out", name, value)
+		}
+	}
+	if got := requests[0].Header.Get("Prefer"); got != "return=minimal" {
+		t.Errorf("planned Prefer = %q, want it kept", got)
+	}
+
+	// Applying the plan sends the write with a fresh request ID
+	if _, err := plan.Apply(srv.NewClientWithRefresh(me.ID, graph.WithMiddleware(graph.ClientRequestID()))); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if got := srv.AssertRequested(t, http.MethodPatch, "/me").Header.Get("client-request-id"); got == "" {
+		t.Error("applied request has no client-request-id")
+	}
+}
+
+func TestDryRunKeepsCachedGets(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	cache := graph.NewCache(graph.NewMemoryCache(0), time.Hour)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithCache(cache), graph.WithDryRun(graph.NewPlan()))
+
+	getUser(t, client, "/me", nil)
+	if err := client.Patch("/me", map[string]string{"jobTitle": "Manager"}, nil); err != nil {
+		t.Fatalf("dry-run PATCH /me: %v", err)
+	}
+	getUser(t, client, "/me", nil)
+
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 1)
+	assertStats(t, cache, graph.CacheStats{Hits: 1, Misses: 1})
+}
+
+func TestDryRunPlansOnlyTheUploadSession(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	plan := graph.NewPlan()
+	client := srv.NewClientWithRefresh(me.ID, graph.WithDryRun(plan))
+
+	content := uploadContent(graph.UploadChunkAlignment + 1)
+	if err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), graph.UploadOptions{}, nil); err != nil {
+		t.Fatalf("dry-run UploadLargeFile: %v", err)
+	}
+
+	requests := plan.Requests()
+	if len(requests) != 1 || requests[0].Method != http.MethodPost || !strings.HasSuffix(requests[0].URL, uploadEndpoint) {
+		t.Fatalf("planned requests = %+v, want only the session POST", requests)
+	}
+	if got := len(uploadRequests(srv)); got != 0 {
+		t.Errorf("upload requests = %d, want none", got)
+	}
+}
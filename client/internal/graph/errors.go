@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrPreconditionFailed matches errors for 412 responses, returned when an
+// If-Match or If-None-Match condition fails because the resource changed
+// since its ETag was read. Check for it with errors.Is.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// GraphError is returned when Graph answers with a non-2xx status
+type GraphError struct {
+	StatusCode int
+	// Code and Message come from the Graph error body; both are empty when
+	// the body is not a Graph error
+	Code    string
+	Message string
+	// RequestID identifies the request in Graph's logs, for support cases
+	RequestID string
+	// Header is the response header, e.g. for Retry-After
+	Header http.Header
+	// Body is the raw response body
+	Body string
+
+	// afterRefresh is set when the request failed again after a 401 and a token refresh
+	afterRefresh bool
+}
+
+// Error formats the error the way the client always has, so messages stay stable
+func (e *GraphError) Error() string {
+	prefix := "API error"
+	if e.afterRefresh {
+		prefix = "API error after refresh"
+	}
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("%s (status %d): %s", prefix, e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("%s: %s - %s", prefix, e.Code, e.Message)
+}
+
+// Is reports whether the error is a 412 when target is ErrPreconditionFailed
+func (e *GraphError) Is(target error) bool {
+	return target == ErrPreconditionFailed && e.StatusCode == http.StatusPreconditionFailed
+}
+
+// newGraphError builds a GraphError from a failed response and its body
+func newGraphError(resp *http.Response, body []byte) *GraphError {
+	graphErr := &GraphError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("request-id"),
+		Header:     resp.Header.Clone(),
+		Body:       string(body),
+	}
+
+	var errorResp ErrorResponse
+	if err := json.Unmarshal(body, &errorResp); err == nil {
+		graphErr.Code = errorResp.Error.Code
+		graphErr.Message = errorResp.Error.Message
+		if graphErr.RequestID == "" && errorResp.Error.InnerError != nil {
+			graphErr.RequestID = errorResp.Error.InnerError.RequestID
+		}
+	}
+	return graphErr
+}
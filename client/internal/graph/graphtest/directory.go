@@ -0,0 +1,546 @@
+package graphtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ms_graph/internal/graph"
+)
+
+// Domain is the verified domain of the fake tenant
+const Domain = "graphtest.onmicrosoft.com"
+
+// Group represents a Microsoft Graph group object
+type Group struct {
+	ID              string   `json:"id"`
+	DisplayName     string   `json:"displayName"`
+	Description     string   `json:"description,omitempty"`
+	Mail            string   `json:"mail,omitempty"`
+	MailNickname    string   `json:"mailNickname,omitempty"`
+	MailEnabled     bool     `json:"mailEnabled"`
+	SecurityEnabled bool     `json:"securityEnabled"`
+	GroupTypes      []string `json:"groupTypes"`
+}
+
+// Message represents a Microsoft Graph mail message
+type Message struct {
+	ID               string      `json:"id"`
+	Subject          string      `json:"subject"`
+	BodyPreview      string      `json:"bodyPreview"`
+	IsRead           bool        `json:"isRead"`
+	ReceivedDateTime time.Time   `json:"receivedDateTime"`
+	From             *Recipient  `json:"from,omitempty"`
+	ToRecipients     []Recipient `json:"toRecipients,omitempty"`
+}
+
+// Recipient represents a message sender or recipient
+type Recipient struct {
+	EmailAddress EmailAddress `json:"emailAddress"`
+}
+
+// EmailAddress represents a name and SMTP address
+type EmailAddress struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+// AddUser adds a user to the tenant and returns it. An empty ID is generated,
+// and an empty user principal name is derived from the display name.
+func (s *Server) AddUser(user graph.User) graph.User {
+	if user.ID == "" {
+		user.ID = graph.NewRequestID()
+	}
+	if user.UserPrincipalName == "" {
+		user.UserPrincipalName = strings.ToLower(strings.ReplaceAll(user.DisplayName, " ", ".")) + "@" + Domain
+	}
+	if user.BusinessPhones == nil {
+		user.BusinessPhones = []string{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = append(s.users, &user)
+	return user
+}
+
+// User returns the user with the given ID or user principal name
+func (s *Server) User(id string) (graph.User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(id)
+	if user == nil {
+		return graph.User{}, false
+	}
+	return *user, true
+}
+
+// Users returns the tenant's users in the order they were added
+func (s *Server) Users() []graph.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]graph.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, *user)
+	}
+	return users
+}
+
+// AddGroup adds a group to the tenant and returns it. An empty ID is generated.
+func (s *Server) AddGroup(group Group) Group {
+	if group.ID == "" {
+		group.ID = graph.NewRequestID()
+	}
+	if group.GroupTypes == nil {
+		group.GroupTypes = []string{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups = append(s.groups, &group)
+	return group
+}
+
+// Groups returns the tenant's groups in the order they were added
+func (s *Server) Groups() []Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := make([]Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, *group)
+	}
+	return groups
+}
+
+// AddMember adds a user to a group's members
+func (s *Server) AddMember(groupID, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members[groupID] = append(s.members[groupID], userID)
+}
+
+// AddMessage adds a message to a user's mailbox and returns it. An empty ID is
+// generated and a zero received time is set to now.
+func (s *Server) AddMessage(userID string, message Message) Message {
+	if message.ID == "" {
+		message.ID = graph.NewRequestID()
+	}
+	if message.ReceivedDateTime.IsZero() {
+		message.ReceivedDateTime = time.Now().UTC().Truncate(time.Second)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages[userID] = append(s.messages[userID], &message)
+	return message
+}
+
+// Messages returns the messages in a user's mailbox
+func (s *Server) Messages(userID string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.messages[userID]))
+	for _, message := range s.messages[userID] {
+		messages = append(messages, *message)
+	}
+	return messages
+}
+
+// findUser looks a user up by ID or user principal name; callers must hold s.mu
+func (s *Server) findUser(id string) *graph.User {
+	for _, user := range s.users {
+		if user.ID == id || strings.EqualFold(user.UserPrincipalName, id) {
+			return user
+		}
+	}
+	return nil
+}
+
+// findGroup looks a group up by ID; callers must hold s.mu
+func (s *Server) findGroup(id string) *Group {
+	for _, group := range s.groups {
+		if group.ID == id {
+			return group
+		}
+	}
+	return nil
+}
+
+// serveGraph routes a Graph request for the signed-in user userID
+func (s *Server) serveGraph(w http.ResponseWriter, r *http.Request, version, path, userID string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if segments[0] == "me" {
+		segments = append([]string{"users", userID}, segments[1:]...)
+	}
+
+	switch segments[0] {
+	case "users":
+		s.serveUsers(w, r, version, segments[1:])
+	case "groups":
+		s.serveGroups(w, r, version, segments[1:])
+	default:
+		writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Resource not found for the segment '%s'.", segments[0]))
+	}
+}
+
+// serveUsers handles /users, /users/{id}, /users/{id}/messages and /users/{id}/drive
+func (s *Server) serveUsers(w http.ResponseWriter, r *http.Request, version string, segments []string) {
+	if len(segments) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			s.mu.Lock()
+			items := make([]interface{}, 0, len(s.users))
+			for _, user := range s.users {
+				items = append(items, *user)
+			}
+			s.mu.Unlock()
+			s.writeCollection(w, r, version, "users", items)
+		case http.MethodPost:
+			var user graph.User
+			if !decodeBody(w, r, &user) {
+				return
+			}
+			user.ID = ""
+			writeJSON(w, http.StatusCreated, s.AddUser(user))
+		default:
+			writeMethodNotAllowed(w, r)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	user := s.findUser(segments[0])
+	s.mu.Unlock()
+	if user == nil {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist or one of its queried reference-property objects are not present.", segments[0]))
+		return
+	}
+
+	if len(segments) > 1 {
+		switch segments[1] {
+		case "messages":
+			s.serveMessages(w, r, version, user.ID, segments[2:])
+		case "drive":
+			s.serveDrive(w, r, version, user.ID, segments[2:])
+		default:
+			writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Resource not found for the segment '%s'.", segments[1]))
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		item := *user
+		s.mu.Unlock()
+		s.writeEntity(w, r, http.StatusOK, item)
+	case http.MethodPatch:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !checkIfMatch(w, r, *user) {
+			return
+		}
+		updated := *user
+		if !decodeBody(w, r, &updated) {
+			return
+		}
+		updated.ID = user.ID
+		*user = updated
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !checkIfMatch(w, r, *user) {
+			return
+		}
+		for i, u := range s.users {
+			if u == user {
+				s.users = append(s.users[:i], s.users[i+1:]...)
+				break
+			}
+		}
+		delete(s.messages, user.ID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// serveGroups handles /groups, /groups/{id} and /groups/{id}/members
+func (s *Server) serveGroups(w http.ResponseWriter, r *http.Request, version string, segments []string) {
+	if len(segments) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			s.mu.Lock()
+			items := make([]interface{}, 0, len(s.groups))
+			for _, group := range s.groups {
+				items = append(items, *group)
+			}
+			s.mu.Unlock()
+			s.writeCollection(w, r, version, "groups", items)
+		case http.MethodPost:
+			var group Group
+			if !decodeBody(w, r, &group) {
+				return
+			}
+			group.ID = ""
+			writeJSON(w, http.StatusCreated, s.AddGroup(group))
+		default:
+			writeMethodNotAllowed(w, r)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	group := s.findGroup(segments[0])
+	s.mu.Unlock()
+	if group == nil {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist or one of its queried reference-property objects are not present.", segments[0]))
+		return
+	}
+
+	if len(segments) > 1 {
+		if segments[1] != "members" || len(segments) > 2 || r.Method != http.MethodGet {
+			writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Resource not found for the segment '%s'.", strings.Join(segments[1:], "/")))
+			return
+		}
+		s.mu.Lock()
+		var items []interface{}
+		for _, id := range s.members[group.ID] {
+			if user := s.findUser(id); user != nil {
+				items = append(items, *user)
+			}
+		}
+		s.mu.Unlock()
+		s.writeCollection(w, r, version, "directoryObjects", items)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		item := *group
+		s.mu.Unlock()
+		s.writeEntity(w, r, http.StatusOK, item)
+	case http.MethodPatch:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !checkIfMatch(w, r, *group) {
+			return
+		}
+		updated := *group
+		if !decodeBody(w, r, &updated) {
+			return
+		}
+		updated.ID = group.ID
+		*group = updated
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !checkIfMatch(w, r, *group) {
+			return
+		}
+		for i, g := range s.groups {
+			if g == group {
+				s.groups = append(s.groups[:i], s.groups[i+1:]...)
+				break
+			}
+		}
+		delete(s.members, group.ID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// serveMessages handles a user's /messages and /messages/{id}
+func (s *Server) serveMessages(w http.ResponseWriter, r *http.Request, version, userID string, segments []string) {
+	if len(segments) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			s.mu.Lock()
+			items := make([]interface{}, 0, len(s.messages[userID]))
+			for _, message := range s.messages[userID] {
+				items = append(items, *message)
+			}
+			s.mu.Unlock()
+			s.writeCollection(w, r, version, "messages", items)
+		case http.MethodPost:
+			var message Message
+			if !decodeBody(w, r, &message) {
+				return
+			}
+			message.ID = ""
+			writeJSON(w, http.StatusCreated, s.AddMessage(userID, message))
+		default:
+			writeMethodNotAllowed(w, r)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := -1
+	for i, message := range s.messages[userID] {
+		if message.ID == segments[0] {
+			index = i
+			break
+		}
+	}
+	if index < 0 || len(segments) > 1 {
+		writeError(w, http.StatusNotFound, "ErrorItemNotFound", "The specified object was not found in the store.")
+		return
+	}
+	message := s.messages[userID][index]
+	if (r.Method == http.MethodPatch || r.Method == http.MethodDelete) && !checkIfMatch(w, r, *message) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.writeEntity(w, r, http.StatusOK, *message)
+	case http.MethodPatch:
+		updated := *message
+		if !decodeBody(w, r, &updated) {
+			return
+		}
+		updated.ID = message.ID
+		*message = updated
+		s.writeEntity(w, r, http.StatusOK, updated)
+	case http.MethodDelete:
+		s.messages[userID] = append(s.messages[userID][:index], s.messages[userID][index+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// writeCollection writes one page of items, honoring $top, $skiptoken, $select
+// and $count, with an @odata.nextLink when more items remain
+func (s *Server) writeCollection(w http.ResponseWriter, r *http.Request, version, entitySet string, items []interface{}) {
+	query := r.URL.Query()
+
+	top := s.pageSize
+	if value := query.Get("$top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Invalid value '%s' for $top query option.", value))
+			return
+		}
+		top = n
+	}
+
+	skip := 0
+	if value := query.Get("$skiptoken"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "BadRequest", "Invalid $skiptoken.")
+			return
+		}
+		skip = n
+	}
+	if skip > len(items) {
+		skip = len(items)
+	}
+
+	end := skip + top
+	if end > len(items) {
+		end = len(items)
+	}
+
+	page := make([]interface{}, 0, end-skip)
+	for _, item := range items[skip:end] {
+		page = append(page, selectFields(item, query.Get("$select")))
+	}
+
+	body := map[string]interface{}{
+		"@odata.context": s.URL + "/" + version + "/$metadata#" + entitySet,
+		"value":          page,
+	}
+	if query.Get("$count") == "true" {
+		body["@odata.count"] = len(items)
+	}
+	if end < len(items) {
+		next := url.Values{}
+		for key, values := range query {
+			next[key] = values
+		}
+		next.Set("$skiptoken", strconv.Itoa(end))
+		body["@odata.nextLink"] = s.URL + r.URL.Path + "?" + next.Encode()
+	}
+
+	writeJSON(w, http.StatusOK, body)
+}
+
+// writeEntity writes a single item with its ETag, honoring $select and
+// answering 304 when If-None-Match names the current ETag
+func (s *Server) writeEntity(w http.ResponseWriter, r *http.Request, status int, item interface{}) {
+	etag := entityETag(item)
+	w.Header().Set("ETag", etag)
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && etagListContains(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var fields map[string]interface{}
+	data, _ := json.Marshal(selectFields(item, r.URL.Query().Get("$select")))
+	if err := json.Unmarshal(data, &fields); err != nil {
+		writeJSON(w, status, item)
+		return
+	}
+	fields["@odata.etag"] = etag
+	writeJSON(w, status, fields)
+}
+
+// selectFields keeps the id and the comma-separated properties of item
+func selectFields(item interface{}, selection string) interface{} {
+	if selection == "" {
+		return item
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return item
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return item
+	}
+
+	selected := map[string]interface{}{"id": fields["id"]}
+	for _, name := range strings.Split(selection, ",") {
+		name = strings.TrimSpace(name)
+		if value, ok := fields[name]; ok {
+			selected[name] = value
+		}
+	}
+	return selected
+}
+
+// decodeBody parses a JSON request body into v, writing a 400 on failure
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Unable to read JSON request payload: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeMethodNotAllowed rejects a method the resource does not support
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, "Request_BadRequest", fmt.Sprintf("The HTTP method '%s' is not supported for this resource.", r.Method))
+}
@@ -0,0 +1,224 @@
+package graphtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"ms_graph/internal/graph"
+)
+
+// DriveItem represents a file in a user's OneDrive
+type DriveItem struct {
+	ID                   string    `json:"id"`
+	Name                 string    `json:"name"`
+	Size                 int64     `json:"size"`
+	File                 *FileInfo `json:"file,omitempty"`
+	LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+}
+
+// FileInfo describes a drive item's content
+type FileInfo struct {
+	MimeType string `json:"mimeType"`
+}
+
+// driveFile is a drive item and its content
+type driveFile struct {
+	item    DriveItem
+	content []byte
+}
+
+// AddFile adds a file to a user's drive and returns its item
+func (s *Server) AddFile(userID, name string, content []byte) DriveItem {
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	file := &driveFile{
+		item: DriveItem{
+			ID:                   graph.NewRequestID(),
+			Name:                 name,
+			Size:                 int64(len(content)),
+			File:                 &FileInfo{MimeType: mimeType},
+			LastModifiedDateTime: time.Now().UTC().Truncate(time.Second),
+		},
+		content: append([]byte(nil), content...),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[userID] = append(s.files[userID], file)
+	return file.item
+}
+
+// FileContent returns the content of a file in a user's drive
+func (s *Server) FileContent(userID, itemID string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.findFile(userID, itemID)
+	if file == nil {
+		return nil, false
+	}
+	return append([]byte(nil), file.content...), true
+}
+
+// findFile looks a drive item up by ID or name; callers must hold s.mu
+func (s *Server) findFile(userID, id string) *driveFile {
+	for _, file := range s.files[userID] {
+		if file.item.ID == id || file.item.Name == id {
+			return file
+		}
+	}
+	return nil
+}
+
+// serveDrive handles a user's /drive/root/children, /drive/items/{id} and
+// /drive/root:/{name}: with /content or /copy, and
+// /drive/root:/{name}:/createUploadSession. Content GETs are redirected to a
+// pre-authenticated download URL, as Graph does; content PUTs replace the file.
+func (s *Server) serveDrive(w http.ResponseWriter, r *http.Request, version, userID string, segments []string) {
+	if len(segments) == 2 && segments[0] == "root" && segments[1] == "children" {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r)
+			return
+		}
+		s.mu.Lock()
+		items := make([]interface{}, 0, len(s.files[userID]))
+		for _, file := range s.files[userID] {
+			items = append(items, file.item)
+		}
+		s.mu.Unlock()
+		s.writeCollection(w, r, version, "drive/root/children", items)
+		return
+	}
+
+	// Path-addressed items are looked up by name, like items/{id}
+	if len(segments) >= 2 && segments[0] == "root:" && strings.HasSuffix(segments[1], ":") {
+		name := strings.TrimSuffix(segments[1], ":")
+		switch {
+		case len(segments) == 3 && segments[2] == "createUploadSession":
+			s.createUploadSession(w, r, userID, name)
+			return
+		case len(segments) == 3 && segments[2] == "content" && r.Method == http.MethodPut:
+			s.putFile(w, r, userID, name)
+			return
+		}
+		segments = append([]string{"items", name}, segments[2:]...)
+	}
+	if len(segments) < 2 || segments[0] != "items" || len(segments) > 3 || (len(segments) == 3 && segments[2] != "content" && segments[2] != "copy") {
+		writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Resource not found for the segment '%s'.", strings.Join(segments, "/")))
+		return
+	}
+
+	s.mu.Lock()
+	file := s.findFile(userID, segments[1])
+	var item DriveItem
+	if file != nil {
+		item = file.item
+	}
+	s.mu.Unlock()
+	if file == nil {
+		writeError(w, http.StatusNotFound, "itemNotFound", "The resource could not be found.")
+		return
+	}
+	if len(segments) == 3 && segments[2] == "copy" {
+		s.copyFile(w, r, userID, item)
+		return
+	}
+	if len(segments) == 3 && r.Method == http.MethodPut {
+		s.putFile(w, r, userID, item.Name)
+		return
+	}
+	if len(segments) == 2 && r.Method == http.MethodDelete {
+		s.deleteFile(userID, item.ID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && !(r.Method == http.MethodHead && len(segments) == 2) {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	if len(segments) == 2 {
+		s.writeEntity(w, r, http.StatusOK, item)
+		return
+	}
+	w.Header().Set("Location", s.URL+"/download/"+userID+"/"+item.ID+"?tempauth="+graph.NewRequestID())
+	w.WriteHeader(http.StatusFound)
+}
+
+// deleteFile removes a file from a user's drive
+func (s *Server) deleteFile(userID, itemID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := s.files[userID]
+	for i, file := range files {
+		if file.item.ID == itemID {
+			s.files[userID] = append(files[:i:i], files[i+1:]...)
+			return
+		}
+	}
+}
+
+// putFile stores a request body as the content of a file, creating it with
+// 201 or replacing it with 200
+func (s *Server) putFile(w http.ResponseWriter, r *http.Request, userID, name string) {
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Failed to read the request body.")
+		return
+	}
+
+	s.mu.Lock()
+	file := s.findFile(userID, name)
+	if file != nil {
+		file.content = content
+		file.item.Size = int64(len(content))
+		file.item.LastModifiedDateTime = time.Now().UTC().Truncate(time.Second)
+		item := file.item
+		s.mu.Unlock()
+		s.writeEntity(w, r, http.StatusOK, item)
+		return
+	}
+	s.mu.Unlock()
+
+	s.writeEntity(w, r, http.StatusCreated, s.AddFile(userID, name, content))
+}
+
+// serveDownload serves file content at a pre-authenticated download URL,
+// honoring Range. Like SharePoint, it rejects requests carrying a bearer token.
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "" {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Pre-authenticated download URLs must not carry an Authorization header.")
+		return
+	}
+	if r.URL.Query().Get("tempauth") == "" {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Missing tempauth.")
+		return
+	}
+
+	userID, itemID, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/download/"), "/")
+	s.mu.Lock()
+	file := s.findFile(userID, itemID)
+	var item DriveItem
+	var content []byte
+	if file != nil {
+		item, content = file.item, file.content
+	}
+	s.mu.Unlock()
+	if file == nil {
+		writeError(w, http.StatusNotFound, "itemNotFound", "The resource could not be found.")
+		return
+	}
+
+	w.Header().Set("Content-Type", item.File.MimeType)
+	http.ServeContent(w, r, item.Name, item.LastModifiedDateTime, bytes.NewReader(content))
+}
@@ -0,0 +1,40 @@
+package graphtest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// entityETag returns a weak ETag derived from an entity's JSON, so it changes
+// whenever the entity does
+func entityETag(item interface{}) string {
+	data, _ := json.Marshal(item)
+	sum := sha256.Sum256(data)
+	return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:12]) + `"`
+}
+
+// checkIfMatch writes a 412 and returns false when the request's If-Match
+// header names neither "*" nor the entity's current ETag
+func checkIfMatch(w http.ResponseWriter, r *http.Request, item interface{}) bool {
+	value := r.Header.Get("If-Match")
+	if value == "" || etagListContains(value, entityETag(item)) {
+		return true
+	}
+	writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "The request ETag value does not match the object's ETag value.")
+	return false
+}
+
+// etagListContains reports whether a comma-separated If-Match or If-None-Match
+// value is "*" or includes etag
+func etagListContains(value, etag string) bool {
+	for _, candidate := range strings.Split(value, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
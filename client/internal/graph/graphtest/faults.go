@@ -0,0 +1,119 @@
+package graphtest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault is an error response injected in place of a Graph response.
+// Faults apply to Graph requests, upload session URLs and operation monitor
+// URLs, never to the token endpoint or download URLs.
+type Fault struct {
+	// Method restricts the fault to one HTTP method; empty matches any
+	Method string
+	// Path restricts the fault to request paths with this prefix, without
+	// the API version (e.g. "/me"); empty matches any. Upload session URLs
+	// have paths under "/upload" and monitor URLs under "/monitor".
+	Path string
+	// StatusCode is the response status, e.g. 401, 429 or 503
+	StatusCode int
+	// Code is the Graph error code; empty picks one for the status
+	Code string
+	// Message is the Graph error message; empty picks one for the status
+	Message string
+	// RetryAfter sets the Retry-After header when positive
+	RetryAfter time.Duration
+	// Times is how many matching requests fail; 0 means once
+	Times int
+}
+
+// Inject queues a fault. Faults are matched in the order they were injected
+// and are removed once they have fired Times times.
+func (s *Server) Inject(f Fault) {
+	if f.Times <= 0 {
+		f.Times = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// FailNext fails the next n Graph requests with status, e.g. FailNext(429, 2)
+func (s *Server) FailNext(status, n int) {
+	s.Inject(Fault{StatusCode: status, Times: n})
+}
+
+// ClearFaults removes faults that have not fired yet
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// takeFault returns the first fault matching the request and uses up one of its times
+func (s *Server) takeFault(method, path string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if f.Method != "" && !strings.EqualFold(f.Method, method) {
+			continue
+		}
+		if f.Path != "" && path != f.Path && !strings.HasPrefix(path, strings.TrimSuffix(f.Path, "/")+"/") {
+			continue
+		}
+
+		f.Times--
+		if f.Times == 0 {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+		}
+		return f
+	}
+	return nil
+}
+
+// write sends the fault's error response
+func (f *Fault) write(w http.ResponseWriter) {
+	code, message := f.Code, f.Message
+	if code == "" {
+		code = defaultErrorCode(f.StatusCode)
+	}
+	if message == "" {
+		message = http.StatusText(f.StatusCode)
+	}
+	if f.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter.Seconds())))
+	}
+	writeError(w, f.StatusCode, code, message)
+}
+
+// defaultErrorCode returns the error code Graph uses for a status
+func defaultErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "BadRequest"
+	case http.StatusUnauthorized:
+		return "InvalidAuthenticationToken"
+	case http.StatusForbidden:
+		return "Authorization_RequestDenied"
+	case http.StatusNotFound:
+		return "Request_ResourceNotFound"
+	case http.StatusConflict:
+		return "Conflict"
+	case http.StatusPreconditionFailed:
+		return "PreconditionFailed"
+	case http.StatusTooManyRequests:
+		return "TooManyRequests"
+	case http.StatusServiceUnavailable:
+		return "ServiceUnavailable"
+	case http.StatusGatewayTimeout:
+		return "GatewayTimeout"
+	default:
+		return "UnknownError"
+	}
+}
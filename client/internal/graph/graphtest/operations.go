@@ -0,0 +1,125 @@
+package graphtest
+
+import (
+	"net/http"
+	"strings"
+
+	"ms_graph/internal/graph"
+)
+
+// copyProgressStep is how far a copy advances each time its monitor is polled
+const copyProgressStep = 50
+
+// operation is an asynchronous drive item copy
+type operation struct {
+	userID  string
+	source  DriveItem
+	name    string
+	percent int
+	// errorCode is set once the copy has failed
+	errorCode string
+	// resourceID is set once the copy has completed
+	resourceID string
+}
+
+// copyFile starts copying a drive item, answering 202 Accepted with a
+// pre-authenticated monitor URL in Location, as Graph does. The copy
+// completes after the monitor has been polled twice, and fails if an item with
+// the new name already exists.
+func (s *Server) copyFile(w http.ResponseWriter, r *http.Request, userID string, source DriveItem) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 && !decodeBody(w, r, &body) {
+		return
+	}
+	if body.Name == "" {
+		body.Name = "Copy of " + source.Name
+	}
+
+	id := graph.NewRequestID()
+	s.mu.Lock()
+	s.operations[id] = &operation{userID: userID, source: source, name: body.Name}
+	s.mu.Unlock()
+
+	w.Header().Set("Location", s.URL+"/monitor/"+id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveMonitor reports an operation's progress in the asyncJobStatus format
+// and advances it. Like Graph's monitor URLs, it rejects requests carrying a
+// bearer token.
+func (s *Server) serveMonitor(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "" {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Monitor URLs must not carry an Authorization header.")
+		return
+	}
+	if fault := s.takeFault(r.Method, r.URL.Path); fault != nil {
+		fault.write(w)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, ok := s.operations[strings.TrimPrefix(r.URL.Path, "/monitor/")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "itemNotFound", "The operation could not be found.")
+		return
+	}
+
+	if op.errorCode == "" && op.resourceID == "" {
+		op.percent += copyProgressStep
+		if op.percent >= 100 {
+			s.finishCopy(op)
+		}
+	}
+
+	status := map[string]interface{}{
+		"operation":          "itemCopy",
+		"status":             "inProgress",
+		"percentageComplete": op.percent,
+	}
+	code := http.StatusAccepted
+	switch {
+	case op.errorCode != "":
+		status["status"] = "failed"
+		status["errorCode"] = op.errorCode
+		code = http.StatusOK
+	case op.resourceID != "":
+		status["status"] = "completed"
+		status["resourceId"] = op.resourceID
+		code = http.StatusOK
+	}
+	writeJSON(w, code, status)
+}
+
+// finishCopy creates the copied item, or records why it could not be
+// created; callers must hold s.mu
+func (s *Server) finishCopy(op *operation) {
+	op.percent = 100
+	if s.findFile(op.userID, op.name) != nil {
+		op.errorCode = "nameAlreadyExists"
+		return
+	}
+	source := s.findFile(op.userID, op.source.ID)
+	if source == nil {
+		op.errorCode = "itemNotFound"
+		return
+	}
+
+	copied := &driveFile{item: source.item, content: append([]byte(nil), source.content...)}
+	copied.item.ID = graph.NewRequestID()
+	copied.item.Name = op.name
+	s.files[op.userID] = append(s.files[op.userID], copied)
+	op.resourceID = copied.item.ID
+}
@@ -0,0 +1,147 @@
+package graphtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	// Path is the full request path, including the API version
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// TB is the subset of testing.TB used by the assertion helpers
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// record stores a copy of the request and restores its body for the handler
+func (s *Server) record(r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+}
+
+// Requests returns the requests received so far, oldest first
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// ResetRequests forgets the requests received so far
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+}
+
+// Matching returns the received requests with the given method and path.
+// path may include the API version ("/v1.0/me") or omit it ("/me").
+func (s *Server) Matching(method, path string) []Request {
+	var matched []Request
+	for _, req := range s.Requests() {
+		if req.Method != method {
+			continue
+		}
+		if req.Path == path {
+			matched = append(matched, req)
+			continue
+		}
+		if _, rest, ok := splitVersion(req.Path); ok && rest == path {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// AssertRequested reports an error unless a matching request was received,
+// and returns the most recent match
+func (s *Server) AssertRequested(t TB, method, path string) Request {
+	t.Helper()
+
+	matched := s.Matching(method, path)
+	if len(matched) == 0 {
+		t.Errorf("graphtest: expected %s %s, got %s", method, path, s.summary())
+		return Request{}
+	}
+	return matched[len(matched)-1]
+}
+
+// AssertNotRequested reports an error if a matching request was received
+func (s *Server) AssertNotRequested(t TB, method, path string) {
+	t.Helper()
+
+	if matched := s.Matching(method, path); len(matched) > 0 {
+		t.Errorf("graphtest: unexpected %s %s (%d times)", method, path, len(matched))
+	}
+}
+
+// AssertRequestCount reports an error unless exactly want matching requests were received
+func (s *Server) AssertRequestCount(t TB, method, path string, want int) {
+	t.Helper()
+
+	if got := len(s.Matching(method, path)); got != want {
+		t.Errorf("graphtest: expected %d requests to %s %s, got %d", want, method, path, got)
+	}
+}
+
+// AssertHeader reports an error unless the request carried header with value
+func (r Request) AssertHeader(t TB, header, value string) {
+	t.Helper()
+
+	if got := r.Header.Get(header); got != value {
+		t.Errorf("graphtest: %s %s: expected header %s %q, got %q", r.Method, r.Path, header, value, got)
+	}
+}
+
+// TokenRequests returns the requests received by the token endpoint, and
+// not downloads, upload chunks or operation polls, which also fall outside
+// the API version paths
+func (s *Server) TokenRequests() []Request {
+	var matched []Request
+	for _, req := range s.Requests() {
+		if strings.HasSuffix(req.Path, "/oauth2/v2.0/token") {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// summary lists the received requests for assertion messages
+func (s *Server) summary() string {
+	requests := s.Requests()
+	if len(requests) == 0 {
+		return "no requests"
+	}
+
+	var buf bytes.Buffer
+	for i, req := range requests {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(req.Method + " " + req.Path)
+	}
+	return buf.String()
+}
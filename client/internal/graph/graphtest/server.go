@@ -0,0 +1,227 @@
+// Package graphtest provides an in-process fake of Microsoft Graph and the
+// Microsoft identity platform token endpoint for exercising graph clients
+// without network access.
+//
+// A Server holds an in-memory tenant of users, groups, messages and files,
+// pages collections with @odata.nextLink, issues and rotates tokens, can
+// inject failures, and records every request for later assertions:
+//
+//	srv := graphtest.NewServer(graphtest.WithPageSize(2))
+//	defer srv.Close()
+//	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+//	client := srv.NewClientWithRefresh(me.ID)
+package graphtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"ms_graph/internal/graph"
+)
+
+const (
+	// DefaultTenantID is the tenant ID placed in issued tokens
+	DefaultTenantID = "00000000-0000-0000-0000-0000000000aa"
+
+	// DefaultPageSize is the page size used when a request has no $top
+	DefaultPageSize = 100
+
+	// DefaultTokenLifetime is the lifetime of issued access tokens
+	DefaultTokenLifetime = time.Hour
+)
+
+// Server is a fake Microsoft Graph tenant. Graph requests are served under
+// /v1.0 and /beta, and tokens under /{tenant}/oauth2/v2.0/token, both on the
+// server's URL.
+type Server struct {
+	*httptest.Server
+
+	tenantID      string
+	pageSize      int
+	tokenLifetime time.Duration
+	rotate        bool
+
+	mu            sync.Mutex
+	users         []*graph.User
+	groups        []*Group
+	members       map[string][]string
+	messages      map[string][]*Message
+	files         map[string][]*driveFile
+	uploads       map[string]*uploadSession
+	operations    map[string]*operation
+	accessTokens  map[string]issuedToken
+	refreshTokens map[string]string
+	faults        []*Fault
+	requests      []Request
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithTenantID sets the tenant ID placed in issued tokens
+func WithTenantID(tenantID string) Option {
+	return func(s *Server) {
+		s.tenantID = tenantID
+	}
+}
+
+// WithPageSize sets the page size used when a request has no $top
+func WithPageSize(size int) Option {
+	return func(s *Server) {
+		s.pageSize = size
+	}
+}
+
+// WithTokenLifetime sets the lifetime of issued access tokens. Lifetimes
+// under ten minutes make graph.ClientWithRefresh refresh before every call.
+func WithTokenLifetime(lifetime time.Duration) Option {
+	return func(s *Server) {
+		s.tokenLifetime = lifetime
+	}
+}
+
+// WithoutRefreshTokenRotation keeps refresh tokens valid after they are
+// redeemed instead of replacing them with a new one
+func WithoutRefreshTokenRotation() Option {
+	return func(s *Server) {
+		s.rotate = false
+	}
+}
+
+// NewServer starts a fake Graph server. Callers must Close it when done.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		tenantID:      DefaultTenantID,
+		pageSize:      DefaultPageSize,
+		tokenLifetime: DefaultTokenLifetime,
+		rotate:        true,
+		members:       make(map[string][]string),
+		messages:      make(map[string][]*Message),
+		files:         make(map[string][]*driveFile),
+		uploads:       make(map[string]*uploadSession),
+		operations:    make(map[string]*operation),
+		accessTokens:  make(map[string]issuedToken),
+		refreshTokens: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Cloud returns a cloud whose Graph and login endpoints are the server
+func (s *Server) Cloud() graph.Cloud {
+	return graph.Cloud{
+		Name:          "graphtest",
+		GraphEndpoint: s.URL,
+		LoginEndpoint: s.URL,
+	}
+}
+
+// ClientOptions returns options that point a graph client at the server
+func (s *Server) ClientOptions() []graph.Option {
+	return []graph.Option{
+		graph.WithCloud(s.Cloud()),
+		graph.WithHTTPClient(s.Client()),
+	}
+}
+
+// NewClient returns a client holding a fresh access token for userID
+func (s *Server) NewClient(userID string, opts ...graph.Option) *graph.Client {
+	tokenResp := s.IssueTokens(userID)
+	return graph.NewClient(tokenResp.AccessToken, append(s.ClientOptions(), opts...)...)
+}
+
+// NewClientWithRefresh returns a client holding a fresh access and refresh
+// token for userID
+func (s *Server) NewClientWithRefresh(userID string, opts ...graph.Option) *graph.ClientWithRefresh {
+	tokenResp := s.IssueTokens(userID)
+	return graph.NewClientWithRefresh(tokenResp.AccessToken, tokenResp.RefreshToken, s.tenantID, append(s.ClientOptions(), opts...)...)
+}
+
+// serveHTTP records the request, applies injected faults and dispatches it
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.record(r)
+
+	if strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token") {
+		s.serveToken(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/download/") {
+		s.serveDownload(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/upload/") {
+		s.serveUpload(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/monitor/") {
+		s.serveMonitor(w, r)
+		return
+	}
+
+	version, path, ok := splitVersion(r.URL.Path)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Invalid version: "+r.URL.Path)
+		return
+	}
+
+	if fault := s.takeFault(r.Method, path); fault != nil {
+		fault.write(w)
+		return
+	}
+
+	userID, ok := s.authenticate(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Access token is empty, invalid or has expired.")
+		return
+	}
+
+	s.serveGraph(w, r, version, path, userID)
+}
+
+// splitVersion separates the API version from a request path
+func splitVersion(path string) (version, rest string, ok bool) {
+	for _, v := range []string{graph.APIVersionV1, graph.APIVersionBeta} {
+		prefix := "/" + v
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return v, strings.TrimPrefix(path, prefix), true
+		}
+	}
+	return "", "", false
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// errorBody mirrors a Graph error response including its innerError
+type errorBody struct {
+	Error struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		InnerError struct {
+			RequestID string `json:"request-id"`
+			Date      string `json:"date"`
+		} `json:"innerError"`
+	} `json:"error"`
+}
+
+// writeError writes a Graph error response
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var body errorBody
+	body.Error.Code = code
+	body.Error.Message = message
+	body.Error.InnerError.RequestID = graph.NewRequestID()
+	body.Error.InnerError.Date = time.Now().UTC().Format("2006-01-02T15:04:05")
+	w.Header().Set("request-id", body.Error.InnerError.RequestID)
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,168 @@
+package graphtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"ms_graph/internal/graph"
+)
+
+// signingKey signs issued tokens; clients never verify them
+var signingKey = []byte("graphtest")
+
+// issuedToken is an access token the server will accept
+type issuedToken struct {
+	userID    string
+	expiresAt time.Time
+}
+
+// IssueTokens returns a new access token and refresh token for userID, as if
+// the user had signed in. userID need not exist, in which case /me returns 404.
+func (s *Server) IssueTokens(userID string) *graph.TokenResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokenResp := s.issueAccessToken(userID)
+	tokenResp.RefreshToken = s.issueRefreshToken(userID)
+	return tokenResp
+}
+
+// issueAccessToken mints a JWT carrying the claims clients read; callers must hold s.mu
+func (s *Server) issueAccessToken(userID string) *graph.TokenResponse {
+	now := time.Now()
+	expiresAt := now.Add(s.tokenLifetime)
+
+	claims := jwt.MapClaims{
+		"aud": s.URL,
+		"iss": s.URL + "/" + s.tenantID + "/v2.0",
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": expiresAt.Unix(),
+		"tid": s.tenantID,
+		"oid": userID,
+		// Make every token distinct even when issued within the same second
+		"uti": randomString(),
+	}
+	if user := s.findUser(userID); user != nil {
+		claims["upn"] = user.UserPrincipalName
+		claims["name"] = user.DisplayName
+	}
+
+	accessToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey)
+	s.accessTokens[accessToken] = issuedToken{userID: userID, expiresAt: expiresAt}
+
+	return &graph.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.tokenLifetime.Seconds()),
+		Scope:       s.URL + "/.default",
+	}
+}
+
+// issueRefreshToken mints an opaque refresh token; callers must hold s.mu
+func (s *Server) issueRefreshToken(userID string) string {
+	refreshToken := "rt-" + randomString()
+	s.refreshTokens[refreshToken] = userID
+	return refreshToken
+}
+
+// ExpireAccessTokens invalidates every issued access token, so the next Graph
+// request with one is rejected with 401 even though it has not expired
+func (s *Server) ExpireAccessTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accessTokens = make(map[string]issuedToken)
+}
+
+// RevokeRefreshTokens invalidates every issued refresh token
+func (s *Server) RevokeRefreshTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshTokens = make(map[string]string)
+}
+
+// ValidRefreshToken reports whether refreshToken can still be redeemed
+func (s *Server) ValidRefreshToken(refreshToken string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.refreshTokens[refreshToken]
+	return ok
+}
+
+// authenticate returns the user an unexpired bearer token was issued to
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, ok := s.accessTokens[accessToken]
+	if !ok || time.Now().After(issued.expiresAt) {
+		return "", false
+	}
+	return issued.userID, true
+}
+
+// serveToken implements the refresh_token grant of the v2.0 token endpoint
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOAuthError(w, http.StatusMethodNotAllowed, "invalid_request", "The token endpoint only accepts POST.")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "refresh_token" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Grant type "+grantType+" is not supported.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refreshToken := r.PostForm.Get("refresh_token")
+	userID, ok := s.refreshTokens[refreshToken]
+	if !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "AADSTS70000: The provided refresh token is invalid or has been revoked.")
+		return
+	}
+
+	tokenResp := s.issueAccessToken(userID)
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		tokenResp.Scope = scope
+	}
+	if s.rotate {
+		delete(s.refreshTokens, refreshToken)
+		tokenResp.RefreshToken = s.issueRefreshToken(userID)
+	}
+
+	writeJSON(w, http.StatusOK, tokenResp)
+}
+
+// writeOAuthError writes an error in the token endpoint's format
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// randomString returns 16 random bytes as hex
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
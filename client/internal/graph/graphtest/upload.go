@@ -0,0 +1,185 @@
+package graphtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ms_graph/internal/graph"
+)
+
+// UploadChunkMultiple is the size every upload session chunk but the last
+// must be a multiple of, as Graph requires
+const UploadChunkMultiple = 320 * 1024
+
+// uploadSession is an upload session in progress
+type uploadSession struct {
+	userID  string
+	name    string
+	size    int64
+	content []byte
+	expires time.Time
+}
+
+// nextExpectedRanges returns the session's remaining byte range
+func (u *uploadSession) nextExpectedRanges() []string {
+	return []string{fmt.Sprintf("%d-%d", len(u.content), u.size-1)}
+}
+
+// createUploadSession starts an upload session for a file in the root of a
+// user's drive, answering /drive/root:/{name}:/createUploadSession
+func (s *Server) createUploadSession(w http.ResponseWriter, r *http.Request, userID, name string) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	var body struct {
+		Item struct {
+			Name string `json:"name"`
+		} `json:"item"`
+		FileSize int64 `json:"fileSize"`
+	}
+	if r.ContentLength != 0 && !decodeBody(w, r, &body) {
+		return
+	}
+	if body.Item.Name != "" {
+		name = body.Item.Name
+	}
+
+	id := graph.NewRequestID()
+	session := &uploadSession{
+		userID:  userID,
+		name:    name,
+		size:    -1,
+		expires: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+
+	s.mu.Lock()
+	s.uploads[id] = session
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"uploadUrl":          s.URL + "/upload/" + id,
+		"expirationDateTime": session.expires,
+		"nextExpectedRanges": []string{"0-"},
+	})
+}
+
+// serveUpload handles requests to an upload session URL: PUT uploads a
+// chunk, GET reports the session's status and DELETE cancels it. Like Graph,
+// it rejects requests carrying a bearer token.
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "" {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Upload session URLs must not carry an Authorization header.")
+		return
+	}
+	if fault := s.takeFault(r.Method, r.URL.Path); fault != nil {
+		fault.write(w)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/upload/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.uploads[id]
+	if !ok || time.Now().After(session.expires) {
+		delete(s.uploads, id)
+		writeError(w, http.StatusNotFound, "itemNotFound", "The upload session was not found.")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"expirationDateTime": session.expires,
+			"nextExpectedRanges": session.nextExpectedRanges(),
+		})
+	case http.MethodDelete:
+		delete(s.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		s.uploadChunk(w, r, id, session)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// uploadChunk appends a chunk to a session, creating the file once the last
+// byte arrives; callers must hold s.mu
+func (s *Server) uploadChunk(w http.ResponseWriter, r *http.Request, id string, session *uploadSession) {
+	start, end, total, ok := parseContentRange(r.Header.Get("Content-Range"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalidRequest", "The Content-Range header is missing or malformed.")
+		return
+	}
+	if session.size >= 0 && total != session.size {
+		writeError(w, http.StatusBadRequest, "invalidRequest", "The Content-Range total does not match the declared file size.")
+		return
+	}
+	if start != int64(len(session.content)) {
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "invalidRange", fmt.Sprintf("The uploaded fragment starts at %d but %d was expected.", start, len(session.content)))
+		return
+	}
+	length := end - start + 1
+	if end+1 < total && length%UploadChunkMultiple != 0 {
+		writeError(w, http.StatusBadRequest, "invalidRequest", fmt.Sprintf("Fragments other than the last must be a multiple of %d bytes.", UploadChunkMultiple))
+		return
+	}
+
+	chunk, err := io.ReadAll(r.Body)
+	if err != nil || int64(len(chunk)) != length {
+		writeError(w, http.StatusBadRequest, "invalidRequest", "The fragment length does not match its Content-Range.")
+		return
+	}
+	session.size = total
+	session.content = append(session.content, chunk...)
+
+	if int64(len(session.content)) < session.size {
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"expirationDateTime": session.expires,
+			"nextExpectedRanges": session.nextExpectedRanges(),
+		})
+		return
+	}
+
+	delete(s.uploads, id)
+	file := s.findFile(session.userID, session.name)
+	if file == nil {
+		file = &driveFile{item: DriveItem{ID: graph.NewRequestID(), Name: session.name, File: &FileInfo{MimeType: "application/octet-stream"}}}
+		s.files[session.userID] = append(s.files[session.userID], file)
+	}
+	file.content = session.content
+	file.item.Size = session.size
+	file.item.LastModifiedDateTime = time.Now().UTC().Truncate(time.Second)
+	writeJSON(w, http.StatusCreated, file.item)
+}
+
+// parseContentRange parses "bytes start-end/total"
+func parseContentRange(value string) (start, end, total int64, ok bool) {
+	spec, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+	byteRange, totalText, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, 0, false
+	}
+	startText, endText, found := strings.Cut(byteRange, "-")
+	if !found {
+		return 0, 0, 0, false
+	}
+
+	var err1, err2, err3 error
+	start, err1 = strconv.ParseInt(startText, 10, 64)
+	end, err2 = strconv.ParseInt(endText, 10, 64)
+	total, err3 = strconv.ParseInt(totalText, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || start < 0 || end < start || end >= total {
+		return 0, 0, 0, false
+	}
+	return start, end, total, true
+}
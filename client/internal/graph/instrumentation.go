@@ -0,0 +1,219 @@
+package graph
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Instrumentation receives events about a client's traffic, for metrics and
+// tracing. Methods are called synchronously from the goroutine sending the
+// request, so they should return quickly. Embed NopInstrumentation to
+// implement only some of them.
+type Instrumentation interface {
+	// RequestStart is called before a request is sent. It may add headers,
+	// such as trace context, to req.
+	RequestStart(req *http.Request, event RequestStartEvent)
+	// RequestEnd is called with the same req once a response or error arrives
+	RequestEnd(req *http.Request, event RequestEndEvent)
+	// Retry is called before a request is sent again, such as after a 401
+	Retry(req *http.Request, event RetryEvent)
+	// Throttle is called when Graph answers 429, 503 or 504
+	Throttle(req *http.Request, event ThrottleEvent)
+	// TokenRefresh is called after the client tries to obtain a new token
+	TokenRefresh(event TokenRefreshEvent)
+}
+
+// RequestStartEvent describes a request about to be sent
+type RequestStartEvent struct {
+	Method string
+	// Route is the request path with IDs replaced by {id}, for use as a
+	// low-cardinality metric label
+	Route string
+	// Attempt is 0 for the first attempt and counts retries after that
+	Attempt int
+	// TokenRequest is true for refresh token redemptions at the login endpoint
+	TokenRequest bool
+	// GraphRequest is true for requests to the client's Graph host. Token
+	// requests and pre-authenticated URLs on other hosts, such as download
+	// redirects, are not Graph requests and should not get extra headers.
+	GraphRequest bool
+	Start        time.Time
+}
+
+// RequestEndEvent describes a finished request
+type RequestEndEvent struct {
+	Method       string
+	Route        string
+	Attempt      int
+	TokenRequest bool
+	// StatusCode is 0 when Err is set
+	StatusCode int
+	// RequestID is Graph's request-id response header, if any
+	RequestID string
+	Err       error
+	Duration  time.Duration
+}
+
+// RetryEvent describes a request being sent again
+type RetryEvent struct {
+	Method  string
+	Route   string
+	Attempt int
+	// Reason is one of the Retry* constants
+	Reason string
+}
+
+// Reasons a client sends a request again
+const (
+	// RetryUnauthorized resends a request with a new token after a 401
+	RetryUnauthorized = "unauthorized"
+)
+
+// ThrottleEvent describes a throttled response
+type ThrottleEvent struct {
+	Method     string
+	Route      string
+	StatusCode int
+	// RetryAfter is the wait Graph asked for, or the backoff the client would use
+	RetryAfter time.Duration
+}
+
+// Reasons a client refreshes its token
+const (
+	RefreshExpiring     = "expiring"
+	RefreshUnauthorized = "unauthorized"
+	RefreshRequested    = "requested"
+	RefreshScope        = "scope"
+	RefreshBackground   = "background"
+)
+
+// TokenRefreshEvent describes an attempt to obtain a new token
+type TokenRefreshEvent struct {
+	// Reason is one of the Refresh* constants
+	Reason   string
+	Err      error
+	Duration time.Duration
+}
+
+// NopInstrumentation ignores every event
+type NopInstrumentation struct{}
+
+// RequestStart does nothing
+func (NopInstrumentation) RequestStart(*http.Request, RequestStartEvent) {}
+
+// RequestEnd does nothing
+func (NopInstrumentation) RequestEnd(*http.Request, RequestEndEvent) {}
+
+// Retry does nothing
+func (NopInstrumentation) Retry(*http.Request, RetryEvent) {}
+
+// Throttle does nothing
+func (NopInstrumentation) Throttle(*http.Request, ThrottleEvent) {}
+
+// TokenRefresh does nothing
+func (NopInstrumentation) TokenRefresh(TokenRefreshEvent) {}
+
+// WithInstrumentation sends the client's request, retry, throttle and token
+// refresh events to instrumentation. It may be given more than once.
+func WithInstrumentation(instrumentation Instrumentation) Option {
+	return func(c *Client) {
+		c.instrumentation = append(c.instrumentation, instrumentation)
+		c.middleware = append(c.middleware, instrument(c, instrumentation))
+	}
+}
+
+// instrument reports requests that c sends through the middleware chain
+func instrument(c *Client, instrumentation Instrumentation) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			method, route, attempt, tokenRequest := req.Method, Route(req.URL.Path), RequestAttempt(req), IsTokenRequest(req)
+
+			if reason := RequestRetryReason(req); reason != "" {
+				instrumentation.Retry(req, RetryEvent{Method: method, Route: route, Attempt: attempt, Reason: reason})
+			}
+
+			start := time.Now()
+			instrumentation.RequestStart(req, RequestStartEvent{
+				Method:       method,
+				Route:        route,
+				Attempt:      attempt,
+				TokenRequest: tokenRequest,
+				GraphRequest: !tokenRequest && strings.EqualFold(req.URL.Scheme+"://"+req.URL.Host, c.cloud.GraphEndpoint),
+				Start:        start,
+			})
+
+			resp, err := next(req)
+
+			end := RequestEndEvent{
+				Method:       method,
+				Route:        route,
+				Attempt:      attempt,
+				TokenRequest: tokenRequest,
+				Err:          err,
+				Duration:     time.Since(start),
+			}
+			if resp != nil {
+				end.StatusCode = resp.StatusCode
+				end.RequestID = resp.Header.Get("request-id")
+				if IsRetryable(resp.StatusCode) {
+					instrumentation.Throttle(req, ThrottleEvent{
+						Method:     method,
+						Route:      route,
+						StatusCode: resp.StatusCode,
+						RetryAfter: RetryDelay(resp, attempt+1),
+					})
+				}
+			}
+			instrumentation.RequestEnd(req, end)
+
+			return resp, err
+		}
+	}
+}
+
+// reportTokenRefresh sends a token refresh event to the client's instrumentation
+func (c *Client) reportTokenRefresh(reason string, start time.Time, err error) {
+	event := TokenRefreshEvent{Reason: reason, Err: err, Duration: time.Since(start)}
+	for _, instrumentation := range c.instrumentation {
+		instrumentation.TokenRefresh(event)
+	}
+}
+
+// idSegment matches path segments that identify a single object: GUIDs,
+// user principal names, numbers and the long opaque IDs of mail and files
+var idSegment = regexp.MustCompile(`^([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[^@]+@[^@]+|[0-9]+|[A-Za-z0-9_=!.-]{32,})$`)
+
+// itemPath matches the path-addressed part of a drive item path, such as
+// ":/Documents/report.docx:" in "/me/drive/root:/Documents/report.docx:/content",
+// up to the closing colon or the end of the path
+var itemPath = regexp.MustCompile(`:/[^:]*(:|$)`)
+
+// Route returns path with object IDs replaced by {id}, such as
+// "/v1.0/users/{id}/messages". Item paths are replaced by {path}, as in
+// "/v1.0/me/drive/root:/{path}:/content", and tenant segments of token
+// endpoint paths by {tenant}.
+func Route(path string) string {
+	path = itemPath.ReplaceAllString(path, ":/{path}$1")
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if i+1 < len(segments) && segments[i+1] == "oauth2" && segment != "" {
+			segments[i] = "{tenant}"
+			continue
+		}
+		// Function-style keys such as users('id') keep their name
+		if name, _, ok := strings.Cut(segment, "("); ok && strings.HasSuffix(segment, ")") {
+			segments[i] = name + "({id})"
+			continue
+		}
+		// An item ID may open an item path, as in items/{id}:/name
+		if id, colon := strings.CutSuffix(segment, ":"); idSegment.MatchString(id) {
+			segments[i] = "{id}"
+			if colon {
+				segments[i] += ":"
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
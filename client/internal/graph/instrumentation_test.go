@@ -0,0 +1,82 @@
+package graph_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1.0/me", "/v1.0/me"},
+		{"/v1.0/users/0af76519-16cd-43dd-8448-eb211c80319c/messages", "/v1.0/users/{id}/messages"},
+		{"/v1.0/users/adele@contoso.com", "/v1.0/users/{id}"},
+		{"/v1.0/groups/42/members", "/v1.0/groups/{id}/members"},
+		{"/v1.0/me/messages/AAMkAGI2THVSAAA=AAAAAAEMAAAAAAAAAAAAAAA", "/v1.0/me/messages/{id}"},
+		{"/v1.0/users('adele@contoso.com')", "/v1.0/users({id})"},
+		{"/v1.0/me/drive/root:/Documents/report.docx:/content", "/v1.0/me/drive/root:/{path}:/content"},
+		{"/v1.0/me/drive/root:/Documents/Q3 budget.xlsx", "/v1.0/me/drive/root:/{path}"},
+		{"/v1.0/me/drive/root:/big.zip:/createUploadSession", "/v1.0/me/drive/root:/{path}:/createUploadSession"},
+		{"/v1.0/drives/42/items/01BYE5RZ6QN3ZWBTUFOFD3GSPGOHDJD36K:/notes.txt:/content", "/v1.0/drives/{id}/items/{id}:/{path}:/content"},
+		{"/contoso.onmicrosoft.com/oauth2/v2.0/token", "/{tenant}/oauth2/v2.0/token"},
+	}
+	for _, tt := range tests {
+		if got := graph.Route(tt.path); got != tt.want {
+			t.Errorf("Route(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// startEvents records request start and retry events
+type startEvents struct {
+	graph.NopInstrumentation
+
+	mu      sync.Mutex
+	starts  []graph.RequestStartEvent
+	retries []graph.RetryEvent
+}
+
+func (e *startEvents) RequestStart(_ *http.Request, event graph.RequestStartEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.starts = append(e.starts, event)
+}
+
+func (e *startEvents) Retry(_ *http.Request, event graph.RetryEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.retries = append(e.retries, event)
+}
+
+func TestInstrumentationReportsRetryReasonAndGraphRequests(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	recorded := &startEvents{}
+	client := srv.NewClientWithRefresh(me.ID, graph.WithInstrumentation(recorded))
+
+	srv.ExpireAccessTokens()
+	if err := client.Get("/me", nil); err != nil {
+		t.Fatalf("Get /me: %v", err)
+	}
+
+	if len(recorded.retries) != 1 || recorded.retries[0].Reason != graph.RetryUnauthorized || recorded.retries[0].Attempt != 1 {
+		t.Errorf("retry events = %+v, want one %q retry", recorded.retries, graph.RetryUnauthorized)
+	}
+
+	// GET /me, the token refresh, then GET /me again
+	if len(recorded.starts) != 3 {
+		t.Fatalf("start events = %+v, want 3", recorded.starts)
+	}
+	for i, want := range []bool{true, false, true} {
+		if got := recorded.starts[i].GraphRequest; got != want {
+			t.Errorf("start event %d (%s %s) GraphRequest = %v, want %v", i, recorded.starts[i].Method, recorded.starts[i].Route, got, want)
+		}
+	}
+}
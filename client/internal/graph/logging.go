@@ -0,0 +1,161 @@
+package graph
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// redacted replaces secrets in log output
+const redacted = "REDACTED"
+
+// Patterns for bearer tokens and the form parameters, query parameters and
+// JSON properties that carry credentials
+var (
+	secretJSONField = regexp.MustCompile(`("(?:access_token|refresh_token|id_token|client_secret|client_assertion)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	secretFormField = regexp.MustCompile(`(^|[?&])(access_token|refresh_token|id_token|client_secret|client_assertion|tempauth)=[^&\s"]*`)
+	bearerToken     = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+)
+
+// WithLogger logs every request the client sends to logger. It is shorthand
+// for WithMiddleware(Logging(logger)).
+func WithLogger(logger *slog.Logger) Option {
+	return WithMiddleware(Logging(logger))
+}
+
+// Logging logs the method, path, status, latency, retry attempt and Graph
+// request-id of each request: Info for successes, Warn for error statuses and
+// Error when no response was received. At Debug level the redacted headers and
+// bodies of requests and responses are logged too, except the bodies of
+// streamed downloads and uploads. Bearer tokens, the tempauth parameter of
+// pre-authenticated URLs, and the access_token, refresh_token, id_token,
+// client_secret and client_assertion fields are always redacted.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			debug := logger.Enabled(ctx, slog.LevelDebug)
+
+			if debug {
+				attrs := []slog.Attr{
+					slog.String("method", req.Method),
+					slog.String("url", RedactText(req.URL.String())),
+					slog.Any("header", RedactHeader(req.Header)),
+				}
+				if !isStreamRequest(req) {
+					body, err := peekRequestBody(req)
+					if err != nil {
+						return nil, err
+					}
+					attrs = append(attrs, slog.String("body", RedactText(string(body))))
+				}
+				logger.LogAttrs(ctx, slog.LevelDebug, "graph request", attrs...)
+			}
+
+			start := time.Now()
+			resp, err := next(req)
+			latency := time.Since(start)
+
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.Duration("latency", latency),
+				slog.Int("attempt", RequestAttempt(req)),
+			}
+			if IsTokenRequest(req) {
+				attrs = append(attrs, slog.Bool("token_request", true))
+			}
+			if id := req.Header.Get("client-request-id"); id != "" {
+				attrs = append(attrs, slog.String("client_request_id", id))
+			}
+
+			if err != nil {
+				attrs = append(attrs, slog.String("error", RedactText(err.Error())))
+				logger.LogAttrs(ctx, slog.LevelError, "graph request failed", attrs...)
+				return nil, err
+			}
+
+			attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			if id := resp.Header.Get("request-id"); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+
+			level := slog.LevelInfo
+			if resp.StatusCode >= 400 {
+				level = slog.LevelWarn
+			}
+			logger.LogAttrs(ctx, level, "graph request", attrs...)
+
+			if debug && !isStreamRequest(req) {
+				body, err := peekResponseBody(resp)
+				if err != nil {
+					return nil, err
+				}
+				logger.LogAttrs(ctx, slog.LevelDebug, "graph response",
+					slog.Int("status", resp.StatusCode),
+					slog.Any("header", RedactHeader(resp.Header)),
+					slog.String("body", RedactText(string(body))),
+				)
+			} else if debug {
+				logger.LogAttrs(ctx, slog.LevelDebug, "graph response",
+					slog.Int("status", resp.StatusCode),
+					slog.Any("header", RedactHeader(resp.Header)),
+				)
+			}
+
+			return resp, nil
+		}
+	}
+}
+
+// RedactHeader returns a copy of header with Authorization values and
+// cookies replaced
+func RedactHeader(header http.Header) http.Header {
+	redactedHeader := make(http.Header, len(header))
+	for name, values := range header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Authorization", "Cookie", "Set-Cookie":
+			redactedHeader[name] = []string{redacted}
+		default:
+			redactedHeader[name] = append([]string(nil), values...)
+		}
+	}
+	return redactedHeader
+}
+
+// RedactText replaces bearer tokens and credential fields in JSON and
+// form-encoded text
+func RedactText(text string) string {
+	text = bearerToken.ReplaceAllString(text, "${1}"+redacted)
+	text = secretJSONField.ReplaceAllString(text, `${1}"`+redacted+`"`)
+	text = secretFormField.ReplaceAllString(text, "${1}${2}="+redacted)
+	return text
+}
+
+// peekRequestBody reads a request body and puts an identical one back
+func peekRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// peekResponseBody reads a response body and puts an identical one back
+func peekResponseBody(resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,258 @@
+// Package metrics exposes Graph client traffic as Prometheus text-format
+// metrics. A Metrics value is both a graph.Instrumentation and an
+// http.Handler:
+//
+//	m := metrics.New()
+//	client := graph.NewClient(token, graph.WithInstrumentation(m))
+//	http.Handle("/metrics", m)
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ms_graph/internal/graph"
+)
+
+// DefaultBuckets are the histogram upper bounds, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics counts requests, latencies, retries, throttling and token refreshes
+type Metrics struct {
+	buckets []float64
+
+	mu               sync.Mutex
+	requests         map[labels]uint64
+	durations        map[labels]*histogram
+	inFlight         int64
+	retries          map[labels]uint64
+	throttled        map[labels]uint64
+	refreshes        map[labels]uint64
+	refreshDurations *histogram
+}
+
+// New creates a Metrics with DefaultBuckets, or the given histogram buckets
+func New(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Metrics{
+		buckets:          buckets,
+		requests:         make(map[labels]uint64),
+		durations:        make(map[labels]*histogram),
+		retries:          make(map[labels]uint64),
+		throttled:        make(map[labels]uint64),
+		refreshes:        make(map[labels]uint64),
+		refreshDurations: newHistogram(buckets),
+	}
+}
+
+// RequestStart counts an in-flight request
+func (m *Metrics) RequestStart(req *http.Request, event graph.RequestStartEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight++
+}
+
+// RequestEnd counts a finished request and observes its latency
+func (m *Metrics) RequestEnd(req *http.Request, event graph.RequestEndEvent) {
+	status := strconv.Itoa(event.StatusCode)
+	if event.Err != nil {
+		status = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight--
+	m.requests[labels{"method", event.Method, "route", event.Route, "status", status}]++
+
+	key := labels{"method", event.Method, "route", event.Route}
+	h, ok := m.durations[key]
+	if !ok {
+		h = newHistogram(m.buckets)
+		m.durations[key] = h
+	}
+	h.observe(event.Duration.Seconds())
+}
+
+// Retry counts a retried request
+func (m *Metrics) Retry(req *http.Request, event graph.RetryEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.retries[labels{"method", event.Method, "route", event.Route, "reason", event.Reason}]++
+}
+
+// Throttle counts a throttled response
+func (m *Metrics) Throttle(req *http.Request, event graph.ThrottleEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.throttled[labels{"method", event.Method, "route", event.Route, "status", strconv.Itoa(event.StatusCode)}]++
+}
+
+// TokenRefresh counts a token refresh and observes its latency
+func (m *Metrics) TokenRefresh(event graph.TokenRefreshEvent) {
+	result := "success"
+	if event.Err != nil {
+		result = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshes[labels{"reason", event.Reason, "result", result}]++
+	m.refreshDurations.observe(event.Duration.Seconds())
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	writeCounter(cw, "msgraph_requests_total", "Graph requests by method, route and status.", m.requests)
+	writeHistograms(cw, "msgraph_request_duration_seconds", "Graph request latency.", m.durations)
+
+	fmt.Fprintf(cw, "# HELP msgraph_requests_in_flight Graph requests waiting for a response.\n")
+	fmt.Fprintf(cw, "# TYPE msgraph_requests_in_flight gauge\n")
+	fmt.Fprintf(cw, "msgraph_requests_in_flight %d\n", m.inFlight)
+
+	writeCounter(cw, "msgraph_retries_total", "Graph requests sent again.", m.retries)
+	writeCounter(cw, "msgraph_throttled_total", "Graph responses asking the client to back off (429, 503, 504).", m.throttled)
+	writeCounter(cw, "msgraph_token_refreshes_total", "Token refreshes by reason and result.", m.refreshes)
+	writeHistograms(cw, "msgraph_token_refresh_duration_seconds", "Token refresh latency.", map[labels]*histogram{{}: m.refreshDurations})
+
+	if err := cw.w.(*bufio.Writer).Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, cw.err
+}
+
+// labels is a metric's label pairs, name then value, in a fixed order
+type labels [6]string
+
+// String formats labels as {name="value",...}, with extra pairs appended
+func (l labels) String(extra ...string) string {
+	pairs := append(l[:], extra...)
+
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == "" {
+			continue
+		}
+		parts = append(parts, pairs[i]+`="`+escape(pairs[i+1])+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escape escapes a label value
+func escape(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// sortedKeys returns map keys in a stable order
+func sortedKeys[V any](m map[labels]V) []labels {
+	keys := make([]labels, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// writeCounter writes a counter family
+func writeCounter(w io.Writer, name, help string, values map[labels]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %d\n", name, key.String(), values[key])
+	}
+}
+
+// writeHistograms writes a histogram family
+func writeHistograms(w io.Writer, name, help string, values map[labels]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, key := range sortedKeys(values) {
+		h := values[key]
+		for i, bound := range h.bounds {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, key.String("le", formatFloat(bound)), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, key.String("le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, key.String(), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, key.String(), h.count)
+	}
+}
+
+// formatFloat formats a float the way Prometheus clients do
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// histogram holds cumulative bucket counts
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// newHistogram creates an empty histogram with the given upper bounds
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// observe records a value
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// countingWriter counts bytes written and remembers the first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+// Write writes p unless an earlier write failed
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,74 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+	"ms_graph/internal/graph/metrics"
+)
+
+func TestMetricsCountTraffic(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	m := metrics.New(0.5, 1)
+	client := srv.NewClientWithRefresh(me.ID, graph.WithInstrumentation(m))
+
+	if err := client.Get("/users/"+me.ID, nil); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	srv.ExpireAccessTokens()
+	if err := client.Get("/me", nil); err != nil {
+		t.Fatalf("Get after expiry: %v", err)
+	}
+	srv.FailNext(http.StatusTooManyRequests, 1)
+	if err := client.Get("/me/drive/root:/Documents/report.docx:", nil); err == nil {
+		t.Fatal("throttled Get succeeded")
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	output := rec.Body.String()
+
+	for _, want := range []string{
+		`msgraph_requests_total{method="GET",route="/v1.0/users/{id}",status="200"} 1`,
+		`msgraph_requests_total{method="GET",route="/v1.0/me",status="401"} 1`,
+		`msgraph_requests_total{method="GET",route="/v1.0/me",status="200"} 1`,
+		`msgraph_requests_total{method="POST",route="/{tenant}/oauth2/v2.0/token",status="200"} 1`,
+		`msgraph_requests_total{method="GET",route="/v1.0/me/drive/root:/{path}:",status="429"} 1`,
+		`msgraph_request_duration_seconds_bucket{method="GET",route="/v1.0/me",le="+Inf"} 2`,
+		`msgraph_request_duration_seconds_count{method="GET",route="/v1.0/me"} 2`,
+		`msgraph_requests_in_flight 0`,
+		`msgraph_retries_total{method="GET",route="/v1.0/me",reason="unauthorized"} 1`,
+		`msgraph_throttled_total{method="GET",route="/v1.0/me/drive/root:/{path}:",status="429"} 1`,
+		`msgraph_token_refreshes_total{reason="unauthorized",result="success"} 1`,
+		`msgraph_token_refresh_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(output, want+"\n") {
+			t.Errorf("metrics are missing %s", want)
+		}
+	}
+	if strings.Contains(output, "report.docx") {
+		t.Error("metrics contain a file name as a label value")
+	}
+}
+
+func TestMetricsEscapeLabelValues(t *testing.T) {
+	m := metrics.New()
+	m.RequestEnd(nil, graph.RequestEndEvent{Method: "GET", Route: `/v1.0/a"b\c`, StatusCode: 200})
+
+	var out strings.Builder
+	if _, err := m.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if want := `route="/v1.0/a\"b\\c"`; !strings.Contains(out.String(), want) {
+		t.Errorf("metrics do not contain %s:\n%s", want, out.String())
+	}
+}
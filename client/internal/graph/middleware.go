@@ -0,0 +1,166 @@
+package graph
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Handler sends a request and returns its response
+type Handler func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps a Handler to inspect or change requests and responses, or
+// to answer a request without calling next
+type Middleware func(next Handler) Handler
+
+// requestInfoKey is the context key of a request's requestInfo
+type requestInfoKey struct{}
+
+// requestInfo tells middleware why the client sent a request
+type requestInfo struct {
+	attempt int
+	// retryReason is set on a resent request to one of the Retry* constants
+	retryReason  string
+	tokenRequest bool
+	// stream is set for requests whose response body is handed to the
+	// caller unread; their redirects are not followed automatically
+	stream bool
+}
+
+// withRequestInfo attaches info to a request's context
+func withRequestInfo(req *http.Request, info requestInfo) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), requestInfoKey{}, info))
+}
+
+// RequestAttempt returns 0 for a request's first attempt and the number of
+// earlier attempts for a retry, such as the retry after a 401
+func RequestAttempt(req *http.Request) int {
+	info, _ := req.Context().Value(requestInfoKey{}).(requestInfo)
+	return info.attempt
+}
+
+// RequestRetryReason returns why a request is being resent, one of the Retry*
+// constants, or "" for a first attempt
+func RequestRetryReason(req *http.Request) string {
+	info, _ := req.Context().Value(requestInfoKey{}).(requestInfo)
+	return info.retryReason
+}
+
+// IsTokenRequest reports whether a request redeems a refresh token at the
+// login endpoint rather than calling Graph
+func IsTokenRequest(req *http.Request) bool {
+	info, _ := req.Context().Value(requestInfoKey{}).(requestInfo)
+	return info.tokenRequest
+}
+
+// isStreamRequest reports whether a request's response body is streamed to
+// the caller, in which case middleware should not buffer it
+func isStreamRequest(req *http.Request) bool {
+	info, _ := req.Context().Value(requestInfoKey{}).(requestInfo)
+	return info.stream
+}
+
+// chain wraps handler in middleware, the first middleware outermost
+func chain(handler Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// send passes a request to the client's HTTP client once its rate limits
+// allow it
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	release, err := c.limits.acquire(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := c.httpClient
+	if isStreamRequest(req) {
+		// Stream requests handle redirects themselves so the bearer token
+		// never reaches pre-authenticated download URLs
+		httpClient = c.noRedirectClient()
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// The request stays in flight until its body has been read
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// noRedirectClient returns a copy of the client's HTTP client that returns
+// redirect responses instead of following them
+func (c *Client) noRedirectClient() *http.Client {
+	noRedirect := *c.httpClient
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &noRedirect
+}
+
+// releaseOnClose runs release once when the body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+// Close closes the body and releases the request's limits
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// do sends a request through the client's middleware
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	return c.handler(req)
+}
+
+// UserAgent sets the User-Agent header of every request, including token requests
+func UserAgent(userAgent string) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("User-Agent", userAgent)
+			return next(req)
+		}
+	}
+}
+
+// ClientRequestID gives every request a client-request-id header, unless it
+// already has one, so failures can be traced in Graph's logs. Token requests
+// get one too, which the login endpoint logs the same way.
+func ClientRequestID() Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("client-request-id") == "" {
+				req.Header.Set("client-request-id", NewRequestID())
+			}
+			return next(req)
+		}
+	}
+}
+
+// SetHeaders sets the given headers on every Graph request, replacing any
+// values the client set, e.g. ConsistencyLevel: eventual for advanced queries.
+// Token requests are left alone, as the headers are meant for Graph.
+func SetHeaders(header http.Header) Middleware {
+	header = header.Clone()
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			if IsTokenRequest(req) {
+				return next(req)
+			}
+			for name, values := range header {
+				req.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+			}
+			return next(req)
+		}
+	}
+}
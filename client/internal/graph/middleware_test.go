@@ -0,0 +1,148 @@
+package graph_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+func TestMiddlewareRunsInRegisteredOrder(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+
+	var calls []string
+	named := func(name string) graph.Middleware {
+		return func(next graph.Handler) graph.Handler {
+			return func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" before")
+				resp, err := next(req)
+				calls = append(calls, name+" after")
+				return resp, err
+			}
+		}
+	}
+	client := srv.NewClient(me.ID, graph.WithMiddleware(named("first"), named("second")), graph.WithMiddleware(named("third")))
+
+	if _, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me"}); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	want := []string{"first before", "second before", "third before", "third after", "second after", "first after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestMiddlewareCanAnswerWithoutNext(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+
+	teapot := func(graph.Handler) graph.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusTeapot, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+		}
+	}
+	client := srv.NewClient(me.ID, graph.WithMiddleware(teapot))
+
+	_, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me"})
+	var graphErr *graph.GraphError
+	if !errors.As(err, &graphErr) || graphErr.StatusCode != http.StatusTeapot {
+		t.Errorf("Do error = %v, want the middleware's 418", err)
+	}
+	srv.AssertNotRequested(t, http.MethodGet, "/v1.0/me")
+}
+
+func TestHeaderMiddleware(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID, graph.WithMiddleware(
+		graph.UserAgent("middleware-test/1.0"),
+		graph.ClientRequestID(),
+		graph.SetHeaders(http.Header{"ConsistencyLevel": {"eventual"}}),
+	))
+
+	// An expired token makes the client send a token request between the
+	// two Graph requests
+	srv.ExpireAccessTokens()
+	if _, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me"}); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	graphRequests := srv.Matching(http.MethodGet, "/v1.0/me")
+	if len(graphRequests) != 2 {
+		t.Fatalf("Graph requests = %d, want 2", len(graphRequests))
+	}
+	ids := map[string]bool{}
+	for _, req := range graphRequests {
+		req.AssertHeader(t, "User-Agent", "middleware-test/1.0")
+		req.AssertHeader(t, "ConsistencyLevel", "eventual")
+		ids[req.Header.Get("client-request-id")] = true
+	}
+	if len(ids) != 2 || ids[""] {
+		t.Errorf("client-request-ids = %v, want a distinct id per request", ids)
+	}
+
+	tokenRequests := srv.TokenRequests()
+	if len(tokenRequests) != 1 {
+		t.Fatalf("token requests = %d, want 1", len(tokenRequests))
+	}
+	if got := tokenRequests[0].Header.Get("ConsistencyLevel"); got != "" {
+		t.Errorf("token request carried ConsistencyLevel %q from SetHeaders", got)
+	}
+	tokenRequests[0].AssertHeader(t, "User-Agent", "middleware-test/1.0")
+	if tokenRequests[0].Header.Get("client-request-id") == "" {
+		t.Error("token request has no client-request-id")
+	}
+}
+
+func TestClientRequestIDKeepsCallerID(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClient(me.ID, graph.WithMiddleware(graph.ClientRequestID()))
+
+	header := http.Header{"client-request-id": {"caller-id"}}
+	if _, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me", Header: header}); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	srv.AssertRequested(t, http.MethodGet, "/v1.0/me").AssertHeader(t, "client-request-id", "caller-id")
+}
+
+func TestMiddlewareSeesAttemptAndRetryReason(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+
+	type seen struct {
+		attempt      int
+		reason       string
+		tokenRequest bool
+	}
+	var requests []seen
+	record := func(next graph.Handler) graph.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			requests = append(requests, seen{graph.RequestAttempt(req), graph.RequestRetryReason(req), graph.IsTokenRequest(req)})
+			return next(req)
+		}
+	}
+	client := srv.NewClientWithRefresh(me.ID, graph.WithMiddleware(record))
+
+	srv.ExpireAccessTokens()
+	if _, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me"}); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	want := []seen{
+		{attempt: 0},
+		{attempt: 0, tokenRequest: true},
+		{attempt: 1, reason: graph.RetryUnauthorized},
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("middleware saw %+v, want %+v", requests, want)
+	}
+}
@@ -0,0 +1,306 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPollInterval is the first wait between polls when Graph sends
+	// no Retry-After header
+	defaultPollInterval = time.Second
+
+	// maxPollInterval caps the growing wait between polls
+	maxPollInterval = 30 * time.Second
+)
+
+// Operation statuses, as reported by drive item and Teams operations
+const (
+	OperationNotStarted = "notStarted"
+	OperationInProgress = "inProgress"
+	OperationCompleted  = "completed"
+	OperationSucceeded  = "succeeded"
+	OperationFailed     = "failed"
+)
+
+// OperationError is returned when a long-running operation fails
+type OperationError struct {
+	Code    string
+	Message string
+	// MonitorURL is the URL that reported the failure
+	MonitorURL string
+}
+
+// Error describes the failure
+func (e *OperationError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("operation failed: %s", e.Code)
+	}
+	return fmt.Sprintf("operation failed: %s - %s", e.Code, e.Message)
+}
+
+// Operation tracks a long-running action that Graph accepted with 202 and a
+// Location or Operation-Location monitor URL, such as copying a drive item or
+// cloning a team
+type Operation struct {
+	// MonitorURL is polled for the operation's status
+	MonitorURL string
+	// Status is the last status Graph reported, e.g. OperationInProgress
+	Status string
+	// PercentComplete is the last reported progress; not every operation reports it
+	PercentComplete float64
+	// ResourceID and ResourceLocation identify the created resource once
+	// the operation has completed, if Graph reports them
+	ResourceID       string
+	ResourceLocation string
+	// Err is set once the operation has failed
+	Err *OperationError
+	// PollInterval is Wait's first wait between polls when Graph sends no
+	// Retry-After header; 0 means one second
+	PollInterval time.Duration
+
+	client        *Client
+	do            doFunc
+	authenticated bool
+	retryAfter    time.Duration
+	interval      time.Duration
+}
+
+// PostAsync performs a POST request for an action that may run in the
+// background. A 202 response yields an Operation to poll; any other success
+// yields one that has already completed.
+func (c *Client) PostAsync(endpoint string, payload interface{}) (*Operation, error) {
+	return c.startOperation(c.Do, endpoint, payload)
+}
+
+// PostAsync performs a POST request for a background action with automatic
+// token refresh, for the request and for polls of Graph-hosted monitor URLs
+func (c *ClientWithRefresh) PostAsync(endpoint string, payload interface{}) (*Operation, error) {
+	return c.Client.startOperation(c.Do, endpoint, payload)
+}
+
+// startOperation sends the request that starts an operation
+func (c *Client) startOperation(do doFunc, endpoint string, payload interface{}) (*Operation, error) {
+	req, err := NewJSONRequest("POST", endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &Operation{client: c, do: do}
+	if resp.StatusCode != http.StatusAccepted {
+		op.Status = OperationCompleted
+		op.PercentComplete = 100
+		op.ResourceLocation = resp.Header.Get("Location")
+		var created struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(resp.Body, &created) == nil {
+			op.ResourceID = created.ID
+		}
+		return op, nil
+	}
+
+	monitor := resp.Header.Get("Operation-Location")
+	if monitor == "" {
+		monitor = resp.Header.Get("Location")
+	}
+	if monitor == "" {
+		return nil, fmt.Errorf("202 Accepted without a Location or Operation-Location header")
+	}
+	op.MonitorURL = monitor
+	op.Status = OperationNotStarted
+	op.authenticated = c.isGraphURL(monitor)
+	op.retryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"))
+	return op, nil
+}
+
+// Done reports whether the operation has completed or failed
+func (op *Operation) Done() bool {
+	switch strings.ToLower(op.Status) {
+	case "completed", "succeeded", "failed", "cancelled", "canceled", "skipped":
+		return true
+	}
+	return false
+}
+
+// Poll asks the monitor URL for the operation's status once. Errors are
+// about the poll itself; a failed operation sets Err instead.
+func (op *Operation) Poll() error {
+	if op.Done() {
+		return nil
+	}
+
+	var resp *Response
+	var err error
+	if op.authenticated {
+		resp, err = op.do(&Request{Method: "GET", Path: op.MonitorURL})
+	} else {
+		// Monitor URLs outside Graph are pre-authenticated
+		resp, err = op.client.getMonitor(op.MonitorURL)
+	}
+	if err != nil {
+		return err
+	}
+
+	op.update(resp)
+	return nil
+}
+
+// Wait polls until the operation is done, honoring Retry-After and otherwise
+// backing off from PollInterval to thirty seconds. It returns an
+// *OperationError if the operation failed. Throttled polls are retried after
+// the Retry-After the throttled response asked for.
+func (op *Operation) Wait(ctx context.Context) error {
+	if op.interval <= 0 {
+		op.interval = op.PollInterval
+		if op.interval <= 0 {
+			op.interval = defaultPollInterval
+		}
+	}
+
+	for !op.Done() {
+		delay := op.retryAfter
+		if delay <= 0 {
+			delay = op.interval
+			op.interval = min(op.interval*3/2, maxPollInterval)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		if err := op.Poll(); err != nil {
+			var graphErr *GraphError
+			if errors.As(err, &graphErr) && IsRetryable(graphErr.StatusCode) {
+				op.retryAfter, _ = parseRetryAfter(graphErr.Header.Get("Retry-After"))
+				continue
+			}
+			return err
+		}
+	}
+
+	if op.Err != nil {
+		return op.Err
+	}
+	return nil
+}
+
+// operationStatus is the union of the drive asyncJobStatus and the Teams
+// teamsAsyncOperation formats
+type operationStatus struct {
+	Status                 string  `json:"status"`
+	PercentageComplete     float64 `json:"percentageComplete"`
+	ResourceID             string  `json:"resourceId"`
+	ResourceLocation       string  `json:"resourceLocation"`
+	TargetResourceID       string  `json:"targetResourceId"`
+	TargetResourceLocation string  `json:"targetResourceLocation"`
+	ErrorCode              string  `json:"errorCode"`
+	Error                  *Error  `json:"error"`
+}
+
+// update applies a monitor response to the operation
+func (op *Operation) update(resp *Response) {
+	op.retryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"))
+
+	// A redirect from the monitor points at the finished resource
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		op.Status = OperationCompleted
+		op.PercentComplete = 100
+		op.ResourceLocation = resp.Header.Get("Location")
+		return
+	}
+
+	var status operationStatus
+	if err := json.Unmarshal(resp.Body, &status); err != nil || status.Status == "" {
+		// Some monitors answer with the resource itself once it exists
+		var created struct {
+			ID string `json:"id"`
+		}
+		if resp.StatusCode == http.StatusOK && json.Unmarshal(resp.Body, &created) == nil && created.ID != "" {
+			op.Status = OperationCompleted
+			op.PercentComplete = 100
+			op.ResourceID = created.ID
+		}
+		return
+	}
+
+	op.Status = status.Status
+	if status.PercentageComplete > 0 {
+		op.PercentComplete = status.PercentageComplete
+	}
+	op.ResourceID = firstNonEmpty(status.ResourceID, status.TargetResourceID)
+	op.ResourceLocation = firstNonEmpty(status.ResourceLocation, status.TargetResourceLocation)
+
+	if strings.EqualFold(op.Status, OperationFailed) {
+		op.Err = &OperationError{Code: status.ErrorCode, MonitorURL: op.MonitorURL}
+		if status.Error != nil {
+			op.Err.Code = firstNonEmpty(status.Error.Code, status.ErrorCode)
+			op.Err.Message = status.Error.Message
+		}
+	} else if op.Done() && op.PercentComplete == 0 {
+		op.PercentComplete = 100
+	}
+}
+
+// getMonitor polls a pre-authenticated monitor URL without the bearer token,
+// leaving redirects to the caller
+func (c *Client) getMonitor(monitorURL string) (*Response, error) {
+	req, err := http.NewRequest("GET", monitorURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req = withRequestInfo(req, requestInfo{stream: true})
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, newGraphError(resp, body)
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// isGraphURL reports whether a URL is a Graph API path that needs the bearer
+// token, as opposed to a pre-authenticated URL on another host or path
+func (c *Client) isGraphURL(rawURL string) bool {
+	if !strings.HasPrefix(rawURL, "https://") && !strings.HasPrefix(rawURL, "http://") {
+		return true
+	}
+	path, ok := strings.CutPrefix(rawURL, c.cloud.GraphEndpoint)
+	if !ok {
+		return false
+	}
+	_, _, ok = cutVersion(path)
+	return ok
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
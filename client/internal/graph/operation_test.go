@@ -0,0 +1,113 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+// startCopy copies report.docx to name and returns the operation
+func startCopy(t *testing.T, srv *graphtest.Server, client *graph.ClientWithRefresh, userID, name string) *graph.Operation {
+	t.Helper()
+	source := srv.AddFile(userID, "report.docx", []byte("quarterly numbers"))
+	op, err := client.PostAsync("/me/drive/items/"+source.ID+"/copy", map[string]string{"name": name})
+	if err != nil {
+		t.Fatalf("PostAsync copy: %v", err)
+	}
+	if op.Done() || op.MonitorURL == "" {
+		t.Fatalf("operation = %+v, want one to poll", op)
+	}
+	op.PollInterval = 10 * time.Millisecond
+	return op
+}
+
+func TestOperationWaitSucceeds(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	op := startCopy(t, srv, client, me.ID, "copy.docx")
+	if err := op.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if op.Status != graph.OperationCompleted || op.PercentComplete != 100 || op.ResourceID == "" {
+		t.Errorf("operation = %+v, want completed with a resource ID", op)
+	}
+	if content, ok := srv.FileContent(me.ID, op.ResourceID); !ok || string(content) != "quarterly numbers" {
+		t.Errorf("copied content = %q, %v", content, ok)
+	}
+	for _, req := range srv.Requests() {
+		if req.Method == http.MethodGet && req.Header.Get("Authorization") != "" && strings.HasPrefix(req.Path, "/monitor/") {
+			t.Error("monitor poll sent the bearer token")
+		}
+	}
+}
+
+func TestOperationWaitReportsFailure(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	// Copying onto the source's own name fails
+	op := startCopy(t, srv, client, me.ID, "report.docx")
+	err := op.Wait(context.Background())
+	var opErr *graph.OperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Wait = %v, want an *OperationError", err)
+	}
+	if opErr.Code != "nameAlreadyExists" || opErr.MonitorURL != op.MonitorURL {
+		t.Errorf("OperationError = %+v", opErr)
+	}
+	if op.Status != graph.OperationFailed || !op.Done() {
+		t.Errorf("Status = %q, want %q", op.Status, graph.OperationFailed)
+	}
+}
+
+func TestOperationWaitStopsWhenCancelled(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	op := startCopy(t, srv, client, me.ID, "copy.docx")
+	op.PollInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if err := op.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait = %v, want context.Canceled", err)
+	}
+	if op.Done() {
+		t.Error("operation is done without a poll")
+	}
+}
+
+func TestOperationWaitHonorsRetryAfterOnThrottledPoll(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	op := startCopy(t, srv, client, me.ID, "copy.docx")
+	srv.Inject(graphtest.Fault{Path: "/monitor", StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second})
+
+	start := time.Now()
+	if err := op.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	// Without Retry-After the three polls would take a few tens of milliseconds
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Wait took %v, want at least the 1s Retry-After", elapsed)
+	}
+	if op.Status != graph.OperationCompleted {
+		t.Errorf("Status = %q, want %q", op.Status, graph.OperationCompleted)
+	}
+}
@@ -0,0 +1,161 @@
+package graph
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Cloud describes the endpoints of one Microsoft Graph deployment
+type Cloud struct {
+	// Name identifies the cloud in configuration, e.g. "global" or "china"
+	Name string
+	// GraphEndpoint is the Graph host, which is also the token audience
+	GraphEndpoint string
+	// LoginEndpoint is the Microsoft identity platform authority host
+	LoginEndpoint string
+}
+
+// Scope returns the .default scope for the cloud's Graph audience
+func (c Cloud) Scope() string {
+	return c.GraphEndpoint + "/.default"
+}
+
+// National cloud deployments of Microsoft Graph
+var (
+	// Global is the worldwide Microsoft Graph service
+	Global = Cloud{
+		Name:          "global",
+		GraphEndpoint: "https://graph.microsoft.com",
+		LoginEndpoint: "https://login.microsoftonline.com",
+	}
+
+	// USGovHigh is Microsoft Graph for US Government L4 (GCC High)
+	USGovHigh = Cloud{
+		Name:          "usgovhigh",
+		GraphEndpoint: "https://graph.microsoft.us",
+		LoginEndpoint: "https://login.microsoftonline.us",
+	}
+
+	// USGovDoD is Microsoft Graph for US Government L5 (DoD)
+	USGovDoD = Cloud{
+		Name:          "usgovdod",
+		GraphEndpoint: "https://dod-graph.microsoft.us",
+		LoginEndpoint: "https://login.microsoftonline.us",
+	}
+
+	// China is Microsoft Graph operated by 21Vianet
+	China = Cloud{
+		Name:          "china",
+		GraphEndpoint: "https://microsoftgraph.chinacloudapi.cn",
+		LoginEndpoint: "https://login.chinacloudapi.cn",
+	}
+)
+
+// Clouds lists the known national clouds
+var Clouds = []Cloud{Global, USGovHigh, USGovDoD, China}
+
+// CloudByName returns the known cloud with the given name; empty selects Global
+func CloudByName(name string) (Cloud, error) {
+	if name == "" {
+		return Global, nil
+	}
+
+	var names []string
+	for _, cloud := range Clouds {
+		if strings.EqualFold(cloud.Name, name) {
+			return cloud, nil
+		}
+		names = append(names, cloud.Name)
+	}
+	return Cloud{}, fmt.Errorf("unknown cloud %q (valid clouds: %s)", name, strings.Join(names, ", "))
+}
+
+// API versions of Microsoft Graph
+const (
+	APIVersionV1   = "v1.0"
+	APIVersionBeta = "beta"
+)
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithCloud selects the Graph host, login authority and token audience of a national cloud
+func WithCloud(cloud Cloud) Option {
+	return func(c *Client) {
+		c.cloud = cloud
+	}
+}
+
+// WithAPIVersion selects the default API version, "v1.0" or "beta".
+// Individual requests can still target the other version with a "/beta/..."
+// or "/v1.0/..." endpoint.
+func WithAPIVersion(version string) Option {
+	return func(c *Client) {
+		c.apiVersion = version
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for Graph requests and token refreshes
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithMiddleware wraps every request the client sends, including token
+// refreshes and retries after a 401, in middleware. The first middleware is
+// the outermost.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// newClient builds a Client with options applied
+func newClient(accessToken string, opts []Option) *Client {
+	c := &Client{
+		accessToken: accessToken,
+		httpClient:  &http.Client{},
+		cloud:       Global,
+		apiVersion:  APIVersionV1,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.baseURL = c.cloud.GraphEndpoint + "/" + c.apiVersion
+	c.handler = chain(c.send, c.middleware)
+	return c
+}
+
+// Cloud returns the cloud the client talks to
+func (c *Client) Cloud() Cloud {
+	return c.cloud
+}
+
+// APIVersion returns the client's default API version
+func (c *Client) APIVersion() string {
+	return c.apiVersion
+}
+
+// resolveURL turns an endpoint into a request URL. Endpoints are normally
+// relative to the client's API version ("/me"), but may name a version
+// explicitly ("/beta/me") or be an absolute URL on the client's Graph host,
+// such as an @odata.nextLink.
+func (c *Client) resolveURL(endpoint string) (string, error) {
+	if strings.HasPrefix(endpoint, "https://") || strings.HasPrefix(endpoint, "http://") {
+		if endpoint != c.cloud.GraphEndpoint && !strings.HasPrefix(endpoint, c.cloud.GraphEndpoint+"/") {
+			return "", fmt.Errorf("refusing to send Graph credentials to %s", endpoint)
+		}
+		return endpoint, nil
+	}
+
+	for _, version := range []string{APIVersionV1, APIVersionBeta} {
+		prefix := "/" + version
+		if endpoint == prefix || strings.HasPrefix(endpoint, prefix+"/") || strings.HasPrefix(endpoint, prefix+"?") {
+			return c.cloud.GraphEndpoint + endpoint, nil
+		}
+	}
+
+	return c.baseURL + endpoint, nil
+}
@@ -0,0 +1,254 @@
+package graph
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit paces requests with a token bucket and caps how many are in flight
+type RateLimit struct {
+	// RequestsPerSecond is the sustained request rate; 0 means unlimited
+	RequestsPerSecond float64
+	// Burst is how many requests may be sent back to back after a quiet
+	// period; 0 means the rate rounded up, at least 1
+	Burst int
+	// MaxConcurrent caps requests waiting for a response; 0 means unlimited
+	MaxConcurrent int
+}
+
+// Workloads that Graph throttles separately
+const (
+	WorkloadMail      = "mail"
+	WorkloadDirectory = "directory"
+	WorkloadFiles     = "files"
+)
+
+// workloadPrefixes are the default path prefixes of each workload, relative to
+// the API version. "*" matches any one segment.
+var workloadPrefixes = map[string][]string{
+	WorkloadMail: {
+		"/me/messages", "/me/mailFolders", "/me/sendMail", "/me/events", "/me/calendar", "/me/calendars",
+		"/users/*/messages", "/users/*/mailFolders", "/users/*/sendMail", "/users/*/events", "/users/*/calendar", "/users/*/calendars",
+	},
+	WorkloadDirectory: {
+		"/users", "/groups", "/me", "/directoryObjects", "/applications", "/servicePrincipals", "/devices", "/organization",
+	},
+	WorkloadFiles: {
+		"/me/drive", "/me/drives", "/users/*/drive", "/users/*/drives", "/groups/*/drive", "/groups/*/drives", "/drives", "/sites", "/shares",
+	},
+}
+
+// WithRateLimit paces every Graph request the client sends, including
+// pagination and retries. Token requests to the login endpoint are not limited.
+func WithRateLimit(limit RateLimit) Option {
+	return func(c *Client) {
+		c.limits.global = newLimiter(limit)
+	}
+}
+
+// WithWorkloadLimit paces requests whose path, after the API version, starts
+// with one of prefixes ("*" matches one segment). With no prefixes, the
+// built-in prefixes of WorkloadMail, WorkloadDirectory or WorkloadFiles are
+// used. When several workloads match, the longest prefix wins. Workload
+// limits apply in addition to WithRateLimit.
+func WithWorkloadLimit(name string, limit RateLimit, prefixes ...string) Option {
+	if len(prefixes) == 0 {
+		prefixes = workloadPrefixes[name]
+	}
+	return func(c *Client) {
+		c.limits.workloads = append(c.limits.workloads, &workload{
+			name:     name,
+			prefixes: prefixes,
+			limiter:  newLimiter(limit),
+		})
+	}
+}
+
+// limits holds a client's rate limiters
+type limits struct {
+	global    *limiter
+	workloads []*workload
+}
+
+// workload is a limiter for a set of path prefixes
+type workload struct {
+	name     string
+	prefixes []string
+	limiter  *limiter
+}
+
+// acquire waits until req may be sent and returns a function that releases
+// its concurrency slots once the response arrives
+func (l *limits) acquire(req *http.Request) (func(), error) {
+	if IsTokenRequest(req) || (l.global == nil && len(l.workloads) == 0) {
+		return func() {}, nil
+	}
+
+	var limiters []*limiter
+	// Wait for the narrower workload limit first so a global slot is not
+	// held while queuing behind it
+	if w := l.match(req.URL.Path); w != nil {
+		limiters = append(limiters, w.limiter)
+	}
+	if l.global != nil {
+		limiters = append(limiters, l.global)
+	}
+
+	var releases []func()
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+	for _, lim := range limiters {
+		r, err := lim.acquire(req.Context())
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
+
+// match returns the workload with the longest prefix matching path
+func (l *limits) match(path string) *workload {
+	if _, rest, ok := cutVersion(path); ok {
+		path = rest
+	}
+
+	var best *workload
+	bestLen := -1
+	for _, w := range l.workloads {
+		for _, prefix := range w.prefixes {
+			if n := matchSegments(path, prefix); n > bestLen {
+				best, bestLen = w, n
+			}
+		}
+	}
+	return best
+}
+
+// cutVersion removes a leading API version from a path
+func cutVersion(path string) (version, rest string, ok bool) {
+	for _, v := range []string{APIVersionV1, APIVersionBeta} {
+		prefix := "/" + v
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return v, strings.TrimPrefix(path, prefix), true
+		}
+	}
+	return "", path, false
+}
+
+// matchSegments returns how many segments of prefix match the start of path,
+// or -1 if path does not start with prefix. Segments compare case-insensitively
+// and "*" matches any one segment.
+func matchSegments(path, prefix string) int {
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	prefixSegments := strings.Split(strings.Trim(prefix, "/"), "/")
+	if len(prefixSegments) > len(pathSegments) {
+		return -1
+	}
+	for i, segment := range prefixSegments {
+		if segment != "*" && !strings.EqualFold(segment, pathSegments[i]) {
+			return -1
+		}
+	}
+	return len(prefixSegments)
+}
+
+// limiter combines a token bucket and a concurrency cap
+type limiter struct {
+	bucket *tokenBucket
+	slots  chan struct{}
+}
+
+// newLimiter creates a limiter; unlimited parts are left nil
+func newLimiter(limit RateLimit) *limiter {
+	l := &limiter{}
+	if limit.RequestsPerSecond > 0 {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = int(math.Max(1, math.Ceil(limit.RequestsPerSecond)))
+		}
+		l.bucket = &tokenBucket{
+			rate:   limit.RequestsPerSecond,
+			burst:  float64(burst),
+			tokens: float64(burst),
+			last:   time.Now(),
+		}
+	}
+	if limit.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	return l
+}
+
+// acquire takes a concurrency slot, then waits for a token
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if l.bucket != nil {
+		if err := l.bucket.wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// tokenBucket refills at rate tokens per second up to burst
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until a token is available and takes it
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	// Take the token now, possibly going negative, so concurrent waiters
+	// queue behind each other instead of all waking at once
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the token back for the next caller
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
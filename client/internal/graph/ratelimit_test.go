@@ -0,0 +1,130 @@
+package graph_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+// timeRequests GETs each path in turn and returns how long they took
+func timeRequests(t *testing.T, client graph.API, paths ...string) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for _, path := range paths {
+		if _, err := client.Do(&graph.Request{Method: http.MethodGet, Path: path}); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+	}
+	return time.Since(start)
+}
+
+// repeat returns n copies of path
+func repeat(path string, n int) []string {
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = path
+	}
+	return paths
+}
+
+func TestRateLimitPacesRequestsAfterBurst(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID, graph.WithRateLimit(graph.RateLimit{RequestsPerSecond: 20, Burst: 2}))
+
+	// The burst goes out at once; each later request waits 50ms for a token
+	if elapsed := timeRequests(t, client, repeat("/me", 2)...); elapsed > 100*time.Millisecond {
+		t.Errorf("burst of 2 took %v, want no pacing", elapsed)
+	}
+	if elapsed := timeRequests(t, client, repeat("/me", 4)...); elapsed < 180*time.Millisecond {
+		t.Errorf("4 requests after the burst took %v, want at least 200ms at 20/s", elapsed)
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/me", 6)
+}
+
+func TestRateLimitRefillsWhileIdle(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID, graph.WithRateLimit(graph.RateLimit{RequestsPerSecond: 5, Burst: 2}))
+
+	timeRequests(t, client, repeat("/me", 2)...)
+	time.Sleep(400 * time.Millisecond)
+	if elapsed := timeRequests(t, client, repeat("/me", 2)...); elapsed > 100*time.Millisecond {
+		t.Errorf("burst after idling took %v, want the bucket refilled", elapsed)
+	}
+}
+
+func TestRateLimitDoesNotPaceTokenRequests(t *testing.T) {
+	// Tokens that expire within ten minutes are refreshed before each request
+	srv := graphtest.NewServer(graphtest.WithTokenLifetime(5 * time.Minute))
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID, graph.WithRateLimit(graph.RateLimit{RequestsPerSecond: 2, Burst: 1}))
+
+	if elapsed := timeRequests(t, client, "/me"); elapsed > 200*time.Millisecond {
+		t.Errorf("one request with a token refresh took %v, want the refresh unpaced", elapsed)
+	}
+	if got := len(srv.TokenRequests()); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+}
+
+func TestWorkloadLimitPacesOnlyItsPaths(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID,
+		graph.WithWorkloadLimit(graph.WorkloadMail, graph.RateLimit{RequestsPerSecond: 10, Burst: 1}))
+
+	if elapsed := timeRequests(t, client, repeat("/me/messages", 3)...); elapsed < 180*time.Millisecond {
+		t.Errorf("3 mail requests took %v, want at least 200ms at 10/s", elapsed)
+	}
+	// Directory requests are not in the mail workload
+	if elapsed := timeRequests(t, client, repeat("/users", 3)...); elapsed > 100*time.Millisecond {
+		t.Errorf("3 directory requests took %v, want no pacing", elapsed)
+	}
+	// Versioned paths and other users' mailboxes match the built-in prefixes,
+	// and the bucket is empty again
+	if elapsed := timeRequests(t, client, repeat("/v1.0/users/"+me.ID+"/messages", 2)...); elapsed < 90*time.Millisecond {
+		t.Errorf("2 more mail requests took %v, want them paced", elapsed)
+	}
+}
+
+func TestWorkloadLimitLongestPrefixWins(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	// /me/messages matches the directory prefix /me and the mail prefix
+	// /me/messages; the longer mail prefix, which is unlimited, wins
+	client := srv.NewClientWithRefresh(me.ID,
+		graph.WithWorkloadLimit(graph.WorkloadDirectory, graph.RateLimit{RequestsPerSecond: 10, Burst: 1}),
+		graph.WithWorkloadLimit(graph.WorkloadMail, graph.RateLimit{}))
+
+	if elapsed := timeRequests(t, client, repeat("/me/messages", 3)...); elapsed > 100*time.Millisecond {
+		t.Errorf("3 mail requests took %v, want no pacing", elapsed)
+	}
+	if elapsed := timeRequests(t, client, repeat("/me", 3)...); elapsed < 180*time.Millisecond {
+		t.Errorf("3 directory requests took %v, want at least 200ms at 10/s", elapsed)
+	}
+}
+
+func TestWorkloadLimitWithCustomPrefixes(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	group := srv.AddGroup(graphtest.Group{DisplayName: "Sales"})
+	client := srv.NewClientWithRefresh(me.ID,
+		graph.WithWorkloadLimit("members", graph.RateLimit{RequestsPerSecond: 10, Burst: 1}, "/groups/*/members"))
+
+	if elapsed := timeRequests(t, client, repeat("/groups/"+group.ID, 3)...); elapsed > 100*time.Millisecond {
+		t.Errorf("3 group requests took %v, want no pacing", elapsed)
+	}
+	if elapsed := timeRequests(t, client, repeat("/groups/"+group.ID+"/members", 3)...); elapsed < 180*time.Millisecond {
+		t.Errorf("3 member requests took %v, want at least 200ms at 10/s", elapsed)
+	}
+}
@@ -0,0 +1,409 @@
+// Package recorder records Microsoft Graph HTTP interactions to a JSON
+// cassette and replays them, for regression tests that run without network
+// access or credentials.
+//
+// Install a Recorder as the transport of the client's HTTP client:
+//
+//	rec, err := recorder.New(recorder.Options{Mode: recorder.ModeReplay, Path: "testdata/me.json"})
+//	client := graph.NewClient(token, graph.WithHTTPClient(rec.Client()))
+//	...
+//	err = rec.Stop()
+//
+// Recorded interactions are scrubbed of credentials, user principal names and
+// tenant IDs before they are written, and incoming requests are scrubbed the
+// same way before they are matched, so replays do not depend on who recorded
+// the cassette.
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode selects whether a Recorder talks to the network
+type Mode int
+
+const (
+	// ModeRecord sends requests to the real service and records them
+	ModeRecord Mode = iota
+	// ModeReplay serves responses from the cassette
+	ModeReplay
+	// ModeAuto replays an existing cassette, or records one if it is missing
+	ModeAuto
+)
+
+// cassetteVersion is written to new cassettes
+const cassetteVersion = 1
+
+// Cassette is the file format of recorded interactions
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one request and the response it received
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a scrubbed HTTP request
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// RecordedResponse is a scrubbed HTTP response
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is a message body. Text bodies are stored as-is so cassettes stay
+// readable; binary bodies are stored base64-encoded.
+type Body []byte
+
+// bodyJSON is the encoding of a binary Body
+type bodyJSON struct {
+	Base64 string `json:"base64"`
+}
+
+// MarshalJSON encodes text bodies as strings and binary bodies as {"base64": ...}
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(bodyJSON{Base64: base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON decodes either form written by MarshalJSON
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = Body(text)
+		return nil
+	}
+
+	var encoded bodyJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("body must be a string or {\"base64\": ...}: %w", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	if err != nil {
+		return fmt.Errorf("failed to decode base64 body: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// Options configures a Recorder
+type Options struct {
+	// Mode selects recording or replaying
+	Mode Mode
+	// Path is the cassette file
+	Path string
+	// Transport sends requests while recording, and unmatched requests while
+	// replaying in non-strict mode; nil uses http.DefaultTransport
+	Transport http.RoundTripper
+	// Match decides whether a recorded request answers an incoming one;
+	// nil uses DefaultMatcher
+	Match Matcher
+	// Strict fails unmatched requests during replay instead of sending them
+	// to Transport, and makes Stop report interactions that were never replayed
+	Strict bool
+	// Scrubber removes secrets and personal data; nil uses a Scrubber with
+	// no extra tenant IDs
+	Scrubber *Scrubber
+}
+
+// Recorder is an http.RoundTripper that records or replays interactions
+type Recorder struct {
+	opts      Options
+	replaying bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// New creates a Recorder. In replay mode the cassette must exist.
+func New(opts Options) (*Recorder, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("recorder: cassette path is required")
+	}
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+	if opts.Match == nil {
+		opts.Match = DefaultMatcher
+	}
+	if opts.Scrubber == nil {
+		opts.Scrubber = &Scrubber{}
+	}
+
+	r := &Recorder{opts: opts}
+
+	switch opts.Mode {
+	case ModeRecord:
+		return r, nil
+	case ModeReplay, ModeAuto:
+	default:
+		return nil, fmt.Errorf("recorder: unknown mode %d", opts.Mode)
+	}
+
+	cassette, err := Load(opts.Path)
+	if err != nil {
+		if opts.Mode == ModeAuto && errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		return nil, err
+	}
+
+	r.replaying = true
+	r.interactions = cassette.Interactions
+	r.used = make([]bool, len(cassette.Interactions))
+	return r, nil
+}
+
+// Load reads a cassette file
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("recorder: failed to read cassette: %w", err)
+	}
+
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("recorder: failed to parse cassette %s: %w", path, err)
+	}
+	return &cassette, nil
+}
+
+// Client returns an HTTP client that uses the recorder as its transport
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Replaying reports whether the recorder serves responses from a cassette
+func (r *Recorder) Replaying() bool {
+	return r.replaying
+}
+
+// RoundTrip records or replays a single request
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := r.opts.Scrubber.Request(RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+
+	if r.replaying {
+		if interaction, ok := r.find(recorded); ok {
+			return interaction.Response.toHTTP(req), nil
+		}
+		if r.opts.Strict {
+			return nil, fmt.Errorf("recorder: no recorded interaction matches %s %s", recorded.Method, recorded.URL)
+		}
+		return r.opts.Transport.RoundTrip(req)
+	}
+
+	resp, err := r.opts.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("recorder: failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: recorded,
+		Response: r.opts.Scrubber.Response(RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       respBody,
+		}),
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// find returns the first unused interaction matching req. Once every match
+// has been used, the last match is replayed again so repeated calls succeed.
+func (r *Recorder) find(req RecordedRequest) (Interaction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last := -1
+	for i, interaction := range r.interactions {
+		if !r.opts.Match(req, interaction.Request) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return interaction, true
+		}
+		last = i
+	}
+	if last >= 0 {
+		return r.interactions[last], true
+	}
+	return Interaction{}, false
+}
+
+// Unused returns the recorded interactions that have not been replayed
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, interaction := range r.interactions {
+		if i < len(r.used) && !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// Stop writes the cassette when recording. When replaying in strict mode it
+// reports an error if any recorded interaction was never replayed.
+func (r *Recorder) Stop() error {
+	if r.replaying {
+		if !r.opts.Strict {
+			return nil
+		}
+		if unused := r.Unused(); len(unused) > 0 {
+			return fmt.Errorf("recorder: %d recorded interactions were not replayed, first: %s %s",
+				len(unused), unused[0].Request.Method, unused[0].Request.URL)
+		}
+		return nil
+	}
+
+	r.mu.Lock()
+	cassette := Cassette{Version: cassetteVersion, Interactions: r.interactions}
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("recorder: failed to encode cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.opts.Path), 0700); err != nil {
+		return fmt.Errorf("recorder: failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(r.opts.Path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("recorder: failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// readBody reads a request body and restores it for the real transport
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("recorder: failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// toHTTP builds the response served for req
+func (r RecordedResponse) toHTTP(req *http.Request) *http.Response {
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// Matcher reports whether a recorded request answers an incoming request.
+// Both requests have been scrubbed.
+type Matcher func(incoming, recorded RecordedRequest) bool
+
+// DefaultMatcher matches on method and URL
+var DefaultMatcher = MatchAll(MatchMethod, MatchURL)
+
+// MatchMethod matches requests with the same method
+func MatchMethod(incoming, recorded RecordedRequest) bool {
+	return incoming.Method == recorded.Method
+}
+
+// MatchURL matches requests with the same URL, including the query
+func MatchURL(incoming, recorded RecordedRequest) bool {
+	return incoming.URL == recorded.URL
+}
+
+// MatchPath matches requests with the same URL, ignoring the query
+func MatchPath(incoming, recorded RecordedRequest) bool {
+	return stripQuery(incoming.URL) == stripQuery(recorded.URL)
+}
+
+// MatchBody matches requests with the same body
+func MatchBody(incoming, recorded RecordedRequest) bool {
+	return bytes.Equal(incoming.Body, recorded.Body)
+}
+
+// MatchHeader returns a matcher for requests with the same value of header
+func MatchHeader(header string) Matcher {
+	return func(incoming, recorded RecordedRequest) bool {
+		return incoming.Header.Get(header) == recorded.Header.Get(header)
+	}
+}
+
+// MatchAll returns a matcher that requires every matcher to match
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(incoming, recorded RecordedRequest) bool {
+		for _, match := range matchers {
+			if !match(incoming, recorded) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// stripQuery removes the query string from a URL
+func stripQuery(url string) string {
+	path, _, _ := strings.Cut(url, "?")
+	return path
+}
@@ -0,0 +1,106 @@
+package recorder_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+	"ms_graph/internal/graph/recorder"
+	"ms_graph/internal/token"
+)
+
+// refreshes counts token refreshes
+type refreshes struct {
+	graph.NopInstrumentation
+
+	mu    sync.Mutex
+	count int
+}
+
+func (r *refreshes) TokenRefresh(graph.TokenRefreshEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count++
+}
+
+// session signs in with a refresh token and makes a few requests
+func session(t *testing.T, srv *graphtest.Server, rec *recorder.Recorder, refreshToken string) int {
+	t.Helper()
+	counted := &refreshes{}
+	client := graph.NewClientWithRefresh("", refreshToken, graphtest.DefaultTenantID,
+		graph.WithCloud(srv.Cloud()),
+		graph.WithHTTPClient(rec.Client()),
+		graph.WithInstrumentation(counted),
+	)
+	for _, path := range []string{"/me", "/users", "/me"} {
+		if err := client.Get(path, nil); err != nil {
+			t.Fatalf("Get %s: %v", path, err)
+		}
+	}
+	return counted.count
+}
+
+func TestReplayedSessionDoesNotRefreshTokens(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance", UserPrincipalName: "adele@contoso.com"})
+	tokens := srv.IssueTokens(me.ID)
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	rec, err := recorder.New(recorder.Options{Mode: recorder.ModeRecord, Path: path, Transport: srv.Client().Transport})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := session(t, srv, rec, tokens.RefreshToken); got != 1 {
+		t.Fatalf("refreshes while recording = %d, want 1", got)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read cassette: %v", err)
+	}
+	if strings.Contains(string(data), tokens.RefreshToken) {
+		t.Error("cassette contains the refresh token")
+	}
+	cassette, err := recorder.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var tokenResp graph.TokenResponse
+	if err := json.Unmarshal(cassette.Interactions[0].Response.Body, &tokenResp); err != nil {
+		t.Fatalf("failed to parse recorded token response: %v", err)
+	}
+	if tokenResp.AccessToken != recorder.ScrubbedToken {
+		t.Errorf("recorded access_token = %q, want ScrubbedToken", tokenResp.AccessToken)
+	}
+	if info, err := token.ParseToken(tokenResp.AccessToken); err != nil || info.IsExpired || info.ExpiresSoon {
+		t.Errorf("recorded access_token does not parse as a valid token: %+v, %v", info, err)
+	}
+
+	tokenRequests := len(srv.TokenRequests())
+	rec, err = recorder.New(recorder.Options{Mode: recorder.ModeReplay, Path: path, Strict: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// The replayed access token does not expire, so only the recorded
+	// sign-in refreshes
+	if got := session(t, srv, rec, "replayed-refresh-token"); got != 1 {
+		t.Errorf("refreshes while replaying = %d, want 1", got)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+	if got := len(srv.TokenRequests()); got != tokenRequests {
+		t.Errorf("replay sent %d token requests to the server", got-tokenRequests)
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/users", 1)
+}
@@ -0,0 +1,231 @@
+package recorder
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"ms_graph/internal/token"
+)
+
+const (
+	// Redacted replaces secret header values and fields
+	Redacted = "REDACTED"
+
+	// ScrubbedTenantID replaces tenant IDs
+	ScrubbedTenantID = "00000000-0000-0000-0000-000000000000"
+
+	// ScrubbedDomain is the domain of scrubbed user principal names
+	ScrubbedDomain = "example.com"
+)
+
+// ScrubbedToken replaces JWTs. It is unsigned and expires in 2100, so clients
+// replaying a cassette never try to refresh it.
+var ScrubbedToken = encodeSegment(`{"alg":"none","typ":"JWT"}`) + "." +
+	encodeSegment(`{"exp":4102444800,"tid":"`+ScrubbedTenantID+`"}`) + "."
+
+// secretHeaders are replaced with Redacted
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// tokenFields are token response properties replaced with ScrubbedToken, so
+// replayed tokens still parse and are not refreshed before every request
+var tokenFields = []string{"access_token", "id_token"}
+
+// secretFields are token endpoint parameters and JSON properties replaced with Redacted
+var secretFields = []string{
+	"refresh_token", "client_secret", "client_assertion", "assertion",
+	"password", "device_code",
+}
+
+var (
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._+-]+(@|%40)[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	tenantPattern = regexp.MustCompile(`/([^/?#]+)/oauth2/`)
+)
+
+// Scrubber removes credentials, user principal names and tenant IDs from
+// recorded interactions. Tenant IDs are learned from token endpoint URLs and
+// the tid claim of tokens as they pass through, and can be listed up front.
+type Scrubber struct {
+	// TenantIDs are replaced with ScrubbedTenantID wherever they appear
+	TenantIDs []string
+	// Headers are additional headers replaced with Redacted
+	Headers []string
+	// Fields are additional JSON properties and form parameters replaced with Redacted
+	Fields []string
+
+	mu      sync.Mutex
+	learned []string
+}
+
+// Request scrubs a recorded request
+func (s *Scrubber) Request(r RecordedRequest) RecordedRequest {
+	s.learn(r.URL, r.Header, r.Body)
+	r.URL = s.Text(r.URL)
+	r.Header = s.header(r.Header)
+	r.Body = Body(s.body(string(r.Body)))
+	return r
+}
+
+// Response scrubs a recorded response
+func (s *Scrubber) Response(r RecordedResponse) RecordedResponse {
+	s.learn("", r.Header, r.Body)
+	r.Header = s.header(r.Header)
+	r.Body = Body(s.body(string(r.Body)))
+	return r
+}
+
+// Text replaces JWTs, email addresses and known tenant IDs in text
+func (s *Scrubber) Text(text string) string {
+	text = jwtPattern.ReplaceAllStringFunc(text, func(string) string {
+		return ScrubbedToken
+	})
+
+	text = emailPattern.ReplaceAllStringFunc(text, func(address string) string {
+		separator := emailPattern.FindStringSubmatch(address)[1]
+		if strings.HasSuffix(strings.ToLower(address), separator+ScrubbedDomain) {
+			return address
+		}
+		// Hash rather than number addresses so the same user always gets the
+		// same placeholder, whichever cassette or replay it appears in
+		sum := sha256.Sum256([]byte(strings.ToLower(strings.Replace(address, separator, "@", 1))))
+		return "user-" + hex.EncodeToString(sum[:4]) + separator + ScrubbedDomain
+	})
+
+	text = tenantPattern.ReplaceAllStringFunc(text, func(segment string) string {
+		tenant := tenantPattern.FindStringSubmatch(segment)[1]
+		switch tenant {
+		case "common", "organizations", "consumers":
+			return segment
+		}
+		return "/" + ScrubbedTenantID + "/oauth2/"
+	})
+
+	for _, tenant := range s.tenants() {
+		text = replaceFold(text, tenant, ScrubbedTenantID)
+	}
+	return text
+}
+
+// header scrubs header values, redacting secret headers entirely
+func (s *Scrubber) header(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	scrubbed := make(http.Header, len(header))
+	for name, values := range header {
+		if s.secretHeader(name) {
+			scrubbed[name] = []string{Redacted}
+			continue
+		}
+		for _, value := range values {
+			scrubbed[name] = append(scrubbed[name], s.Text(value))
+		}
+	}
+	return scrubbed
+}
+
+// body replaces token fields with ScrubbedToken and redacts secret fields in
+// JSON and form bodies, then scrubs the text
+func (s *Scrubber) body(body string) string {
+	if body == "" {
+		return body
+	}
+
+	for _, field := range tokenFields {
+		body = replaceField(body, field, ScrubbedToken)
+	}
+	for _, field := range append(secretFields, s.Fields...) {
+		body = replaceField(body, field, Redacted)
+	}
+	return s.Text(body)
+}
+
+// replaceField replaces the value of a JSON property or form parameter
+func replaceField(body, field, value string) string {
+	quoted := regexp.QuoteMeta(field)
+	jsonField := regexp.MustCompile(`("` + quoted + `"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	body = jsonField.ReplaceAllString(body, `${1}"`+value+`"`)
+	formField := regexp.MustCompile(`(^|&)(` + quoted + `)=[^&]*`)
+	return formField.ReplaceAllString(body, `${1}${2}=`+value)
+}
+
+// secretHeader reports whether a header is always redacted
+func (s *Scrubber) secretHeader(name string) bool {
+	for _, secret := range append(secretHeaders, s.Headers...) {
+		if strings.EqualFold(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// learn records tenant IDs from token endpoint URLs and tid claims so they
+// are also scrubbed where they appear elsewhere
+func (s *Scrubber) learn(url string, header http.Header, body []byte) {
+	var found []string
+	if match := tenantPattern.FindStringSubmatch(url); match != nil {
+		found = append(found, match[1])
+	}
+
+	texts := []string{string(body)}
+	for _, values := range header {
+		texts = append(texts, values...)
+	}
+	for _, text := range texts {
+		for _, jwt := range jwtPattern.FindAllString(text, -1) {
+			if tid, err := token.GetStringClaim(jwt, "tid"); err == nil {
+				found = append(found, tid)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range found {
+		switch strings.ToLower(tenant) {
+		case "", "common", "organizations", "consumers", ScrubbedTenantID:
+			continue
+		}
+		if !containsFold(s.learned, tenant) && !containsFold(s.TenantIDs, tenant) {
+			s.learned = append(s.learned, tenant)
+		}
+	}
+}
+
+// tenants returns the configured and learned tenant IDs
+func (s *Scrubber) tenants() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append(append([]string(nil), s.TenantIDs...), s.learned...)
+}
+
+// replaceFold replaces every case-insensitive occurrence of old in text
+func replaceFold(text, old, replacement string) string {
+	if old == "" {
+		return text
+	}
+	return regexp.MustCompile(`(?i)`+regexp.QuoteMeta(old)).ReplaceAllLiteralString(text, replacement)
+}
+
+// containsFold reports whether values holds value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeSegment base64url-encodes a JWT segment
+func encodeSegment(segment string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(segment))
+}
@@ -0,0 +1,222 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Request is a Graph API request
+type Request struct {
+	Method string
+	// Path is relative to the client's API version, e.g. "/me/messages",
+	// or starts with "/beta/" or "/v1.0/", or is an absolute URL on the
+	// client's Graph endpoint such as an @odata.nextLink
+	Path string
+	// Query is added to any query already in Path
+	Query url.Values
+	// Header holds extra headers such as Prefer or ConsistencyLevel
+	Header http.Header
+	Body   io.Reader
+	// ContentType is sent with a Body and defaults to application/json
+	ContentType string
+	// Context, if set, cancels the request when it is done
+	Context context.Context
+}
+
+// NewJSONRequest creates a request with payload encoded as its JSON body;
+// a nil payload sends no body
+func NewJSONRequest(method, path string, payload interface{}) (*Request, error) {
+	req := &Request{Method: method, Path: path}
+	if payload != nil {
+		var body bytes.Buffer
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return nil, fmt.Errorf("failed to encode payload: %w", err)
+		}
+		req.Body = &body
+	}
+	return req, nil
+}
+
+// Response is a successful Graph response with its body read
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Decode unmarshals the JSON body into v; an empty body or nil v is a no-op
+func (r *Response) Decode(v interface{}) error {
+	if v == nil || len(r.Body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// Do sends a request and reads its response. Non-2xx responses are returned
+// as *GraphError, except 304 Not Modified, which is returned as a Response.
+func (c *Client) Do(req *Request) (*Response, error) {
+	return c.doRequest(req, 0)
+}
+
+// Do sends a request with automatic token refresh: the token is refreshed
+// first if it is expiring, and once more if Graph answers 401, after which the
+// request is sent again. The body is buffered so it can be resent.
+func (c *ClientWithRefresh) Do(req *Request) (*Response, error) {
+	if err := c.checkAndRefreshToken(); err != nil {
+		return nil, fmt.Errorf("token check failed: %w", err)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+	withBody := func() *Request {
+		r := *req
+		if req.Body != nil {
+			r.Body = bytes.NewReader(body)
+		}
+		return &r
+	}
+
+	resp, err := c.Client.doRequest(withBody(), 0)
+	var graphErr *GraphError
+	if !errors.As(err, &graphErr) || graphErr.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if err := c.refreshAfter401(); err != nil {
+		return nil, err
+	}
+
+	resp, err = c.Client.doRequest(withBody(), 1)
+	if errors.As(err, &graphErr) {
+		graphErr.afterRefresh = true
+	}
+	return resp, err
+}
+
+// doRequest sends a request through the middleware; attempt is recorded on
+// it for middleware
+func (c *Client) doRequest(r *Request, attempt int) (*Response, error) {
+	c.mu.RLock()
+	accessToken := c.accessToken
+	c.mu.RUnlock()
+
+	rawURL, err := c.resolveURL(r.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Query) > 0 {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request URL: %w", err)
+		}
+		query := u.Query()
+		for name, values := range r.Query {
+			query[name] = append(query[name], values...)
+		}
+		u.RawQuery = query.Encode()
+		rawURL = u.String()
+	}
+
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, rawURL, r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if attempt > 0 {
+		req = withRequestInfo(req, requestInfo{attempt: attempt, retryReason: RetryUnauthorized})
+	}
+
+	for name, values := range r.Header {
+		req.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if r.Body != nil {
+		contentType := r.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusNotModified && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		return nil, newGraphError(resp, body)
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// doFunc is Client.Do or ClientWithRefresh.Do
+type doFunc func(*Request) (*Response, error)
+
+// getJSON GETs endpoint and decodes the response into result
+func getJSON(do doFunc, endpoint string, result interface{}) error {
+	resp, err := do(&Request{Method: "GET", Path: endpoint})
+	if err != nil {
+		return err
+	}
+	return resp.Decode(result)
+}
+
+// sendJSON sends payload as JSON and decodes the response into result
+func sendJSON(do doFunc, method, endpoint string, payload, result interface{}) error {
+	req, err := NewJSONRequest(method, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	resp, err := do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Decode(result)
+}
+
+// putContent PUTs raw content and decodes the response into result
+func putContent(do doFunc, endpoint, contentType string, content io.Reader, result interface{}) error {
+	resp, err := do(&Request{Method: "PUT", Path: endpoint, Body: content, ContentType: contentType})
+	if err != nil {
+		return err
+	}
+	return resp.Decode(result)
+}
+
+// head sends a HEAD request and returns the response headers
+func head(do doFunc, endpoint string) (http.Header, error) {
+	resp, err := do(&Request{Method: "HEAD", Path: endpoint})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Header, nil
+}
+
+// deleteResource sends a DELETE request
+func deleteResource(do doFunc, endpoint string) error {
+	_, err := do(&Request{Method: "DELETE", Path: endpoint})
+	return err
+}
@@ -0,0 +1,160 @@
+package graph_test
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+func TestDoSendsHeadersButKeepsAuthorization(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClient(me.ID)
+
+	header := http.Header{
+		"ConsistencyLevel": {"eventual"},
+		"Authorization":    {"Bearer caller-token"},
+	}
+	if _, err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/me", Header: header}); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	req := srv.AssertRequested(t, http.MethodGet, "/v1.0/me")
+	req.AssertHeader(t, "ConsistencyLevel", "eventual")
+	if strings.Contains(req.Header.Get("Authorization"), "caller-token") {
+		t.Error("the request's Authorization header replaced the client's token")
+	}
+	if got := req.Header.Get("Content-Type"); got != "" {
+		t.Errorf("GET without a body sent Content-Type %q", got)
+	}
+
+	// The caller's header is copied, not shared with the request
+	header.Set("ConsistencyLevel", "changed")
+	if got := srv.AssertRequested(t, http.MethodGet, "/v1.0/me").Header.Get("ConsistencyLevel"); got != "eventual" {
+		t.Errorf("recorded ConsistencyLevel changed to %q with the caller's header", got)
+	}
+}
+
+func TestDoMergesQuery(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClient(me.ID)
+
+	_, err := client.Do(&graph.Request{
+		Method: http.MethodGet,
+		Path:   "/users?$top=5",
+		Query:  url.Values{"$select": {"displayName"}, "$top": {"10"}},
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	req := srv.AssertRequested(t, http.MethodGet, "/v1.0/users")
+	if got := req.Query["$select"]; !reflect.DeepEqual(got, []string{"displayName"}) {
+		t.Errorf("$select = %v, want displayName", got)
+	}
+	if got := req.Query["$top"]; !reflect.DeepEqual(got, []string{"5", "10"}) {
+		t.Errorf("$top = %v, want the path's value followed by Query's", got)
+	}
+}
+
+func TestHeadReturnsHeadersWithoutBody(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	item := srv.AddFile(me.ID, "notes.txt", []byte("hello"))
+	client := srv.NewClientWithRefresh(me.ID)
+
+	resp, err := client.Do(&graph.Request{Method: http.MethodHead, Path: "/me/drive/items/" + item.ID})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(resp.Body) != 0 {
+		t.Errorf("HEAD = %d with %d body bytes, want 200 and no body", resp.StatusCode, len(resp.Body))
+	}
+
+	header, err := client.Head("/me/drive/items/" + item.ID)
+	if err != nil {
+		t.Fatalf("Head: %v", err)
+	}
+	if !strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		t.Errorf("Content-Type = %q, want the entity's", header.Get("Content-Type"))
+	}
+	for _, req := range srv.Matching(http.MethodHead, "/v1.0/me/drive/items/"+item.ID) {
+		if got := req.Header.Get("Content-Type"); got != "" {
+			t.Errorf("HEAD sent Content-Type %q", got)
+		}
+	}
+}
+
+func TestPutContentSendsContentType(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	item := srv.AddFile(me.ID, "notes.txt", []byte("hello"))
+	client := srv.NewClient(me.ID)
+
+	var updated graphtest.DriveItem
+	if err := client.PutContent("/me/drive/items/"+item.ID+"/content", "text/plain", strings.NewReader("goodbye"), &updated); err != nil {
+		t.Fatalf("PutContent: %v", err)
+	}
+	if updated.Size != int64(len("goodbye")) {
+		t.Errorf("updated size = %d, want %d", updated.Size, len("goodbye"))
+	}
+
+	req := srv.AssertRequested(t, http.MethodPut, "/v1.0/me/drive/items/"+item.ID+"/content")
+	req.AssertHeader(t, "Content-Type", "text/plain")
+	if content, _ := srv.FileContent(me.ID, item.ID); string(content) != "goodbye" {
+		t.Errorf("file content = %q, want goodbye", content)
+	}
+}
+
+func TestPutSendsJSON(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	item := srv.AddFile(me.ID, "data.json", []byte("{}"))
+	client := srv.NewClient(me.ID)
+
+	if err := client.Put("/me/drive/items/"+item.ID+"/content", map[string]int{"count": 1}, nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	req := srv.AssertRequested(t, http.MethodPut, "/v1.0/me/drive/items/"+item.ID+"/content")
+	req.AssertHeader(t, "Content-Type", "application/json")
+	if content, _ := srv.FileContent(me.ID, item.ID); strings.TrimSpace(string(content)) != `{"count":1}` {
+		t.Errorf("file content = %s, want the JSON payload", content)
+	}
+}
+
+func TestDoReplaysBodyAfter401(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	item := srv.AddFile(me.ID, "notes.txt", []byte("hello"))
+	client := srv.NewClientWithRefresh(me.ID)
+
+	srv.ExpireAccessTokens()
+	if err := client.PutContent("/me/drive/items/"+item.ID+"/content", "text/plain", strings.NewReader("replayed"), nil); err != nil {
+		t.Fatalf("PutContent: %v", err)
+	}
+
+	requests := srv.Matching(http.MethodPut, "/v1.0/me/drive/items/"+item.ID+"/content")
+	if len(requests) != 2 {
+		t.Fatalf("PUT requests = %d, want the rejected one and the retry", len(requests))
+	}
+	for i, req := range requests {
+		if string(req.Body) != "replayed" {
+			t.Errorf("attempt %d sent %q, want the full body", i, req.Body)
+		}
+	}
+	if content, _ := srv.FileContent(me.ID, item.ID); string(content) != "replayed" {
+		t.Errorf("file content = %q, want replayed", content)
+	}
+}
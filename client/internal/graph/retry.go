@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxRetryDelay caps how long a single Retry-After or backoff wait may be
+	maxRetryDelay = 2 * time.Minute
+)
+
+// IsRetryable reports whether Graph is asking the caller to back off and retry:
+// 429 Too Many Requests, 503 Service Unavailable or 504 Gateway Timeout
+func IsRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
+
+// RetryDelay returns how long to wait before retry number attempt (starting at 1).
+// It honors the Retry-After header in seconds or HTTP-date form and falls back
+// to exponential backoff from one second.
+func RetryDelay(resp *http.Response, attempt int) time.Duration {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return delay
+		}
+	}
+
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := time.Second << (attempt - 1)
+	if delay > maxRetryDelay || delay <= 0 {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// parseRetryAfter parses a Retry-After header value
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		delay := time.Duration(seconds) * time.Second
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		return delay, true
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		delay := time.Until(when)
+		if delay < 0 {
+			delay = 0
+		}
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,144 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxRedirects is how many redirects GetStream follows
+const maxRedirects = 10
+
+// streamHeaders are the request headers GetStream carries over to the
+// pre-authenticated URL it is redirected to
+var streamHeaders = []string{"Range", "If-Range", "Accept"}
+
+// ByteRange returns a Range header for bytes start through end inclusive.
+// An end below zero requests everything from start, e.g. to resume a download.
+func ByteRange(start, end int64) http.Header {
+	value := "bytes=" + strconv.FormatInt(start, 10) + "-"
+	if end >= 0 {
+		value += strconv.FormatInt(end, 10)
+	}
+	return http.Header{"Range": {value}}
+}
+
+// GetStream performs a GET request and returns the response body unread, for
+// binary content such as /me/photo/$value or drive item content. header may add
+// request headers such as ByteRange; a ranged response has status 206 and a
+// Content-Range header. Redirects to pre-authenticated download URLs are
+// followed without the Authorization header. The caller must close the body.
+func (c *Client) GetStream(endpoint string, header http.Header) (io.ReadCloser, http.Header, error) {
+	return c.GetStreamContext(context.Background(), endpoint, header)
+}
+
+// GetStreamContext is GetStream with a context; cancelling ctx stops the
+// request and any read of the body still in progress
+func (c *Client) GetStreamContext(ctx context.Context, endpoint string, header http.Header) (io.ReadCloser, http.Header, error) {
+	resp, err := c.getStream(ctx, endpoint, header, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, resp.Header, nil
+}
+
+// GetStream performs a streaming GET request with automatic token refresh
+func (c *ClientWithRefresh) GetStream(endpoint string, header http.Header) (io.ReadCloser, http.Header, error) {
+	return c.GetStreamContext(context.Background(), endpoint, header)
+}
+
+// GetStreamContext performs a streaming GET request with a context and
+// automatic token refresh
+func (c *ClientWithRefresh) GetStreamContext(ctx context.Context, endpoint string, header http.Header) (io.ReadCloser, http.Header, error) {
+	if err := c.checkAndRefreshToken(); err != nil {
+		return nil, nil, fmt.Errorf("token check failed: %w", err)
+	}
+
+	resp, err := c.Client.getStream(ctx, endpoint, header, 0)
+	var graphErr *GraphError
+	if errors.As(err, &graphErr) && graphErr.StatusCode == http.StatusUnauthorized {
+		if err := c.refreshAfter401(); err != nil {
+			return nil, nil, err
+		}
+		resp, err = c.Client.getStream(ctx, endpoint, header, 1)
+		if errors.As(err, &graphErr) {
+			graphErr.afterRefresh = true
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, resp.Header, nil
+}
+
+// getStream sends a streaming GET request and follows redirects by hand so
+// the bearer token is only ever sent to Graph. Redirects lead to
+// pre-authenticated URLs, often on storage hosts, so like upload URLs they
+// are requested with the client's HTTP client alone, skipping the middleware.
+func (c *Client) getStream(ctx context.Context, endpoint string, header http.Header, attempt int) (*http.Response, error) {
+	c.mu.RLock()
+	accessToken := c.accessToken
+	c.mu.RUnlock()
+
+	url, err := c.resolveURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	info := requestInfo{attempt: attempt, stream: true}
+	if attempt > 0 {
+		info.retryReason = RetryUnauthorized
+	}
+	req = withRequestInfo(req, info)
+
+	for name, values := range header {
+		req.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	send := c.do
+	for redirects := 0; ; redirects++ {
+		resp, err := send(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute request: %w", err)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			location, err := resp.Location()
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to follow redirect: %w", err)
+			}
+			if redirects == maxRedirects {
+				return nil, fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+
+			next, err := http.NewRequestWithContext(ctx, "GET", location.String(), nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create redirect request: %w", err)
+			}
+			for _, name := range streamHeaders {
+				if values := req.Header.Values(name); len(values) > 0 {
+					next.Header[name] = append([]string(nil), values...)
+				}
+			}
+			req = next
+			send = c.noRedirectClient().Do
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			return nil, newGraphError(resp, body)
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,171 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+// downloadRequests returns the requests sent to graphtest's pre-authenticated
+// download URLs
+func downloadRequests(srv *graphtest.Server) []graphtest.Request {
+	var requests []graphtest.Request
+	for _, req := range srv.Requests() {
+		if strings.HasPrefix(req.Path, "/download/") {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+func TestByteRange(t *testing.T) {
+	tests := []struct {
+		start, end int64
+		want       string
+	}{
+		{0, 99, "bytes=0-99"},
+		{100, -1, "bytes=100-"},
+		{5, 5, "bytes=5-5"},
+	}
+	for _, tc := range tests {
+		if got := graph.ByteRange(tc.start, tc.end).Get("Range"); got != tc.want {
+			t.Errorf("ByteRange(%d, %d) = %q, want %q", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
+
+func TestGetStreamFollowsRedirectWithoutClientHeaders(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	item := srv.AddFile(me.ID, "notes.txt", []byte("hello, world"))
+
+	var seen []string
+	record := func(next graph.Handler) graph.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			seen = append(seen, req.URL.Path)
+			return next(req)
+		}
+	}
+	client := srv.NewClient(me.ID, graph.WithMiddleware(
+		graph.UserAgent("stream-test"),
+		graph.ClientRequestID(),
+		graph.SetHeaders(http.Header{"X-Tenant-Hint": {"contoso"}}),
+		record,
+	))
+
+	body, _, err := client.GetStream("/me/drive/items/"+item.ID+"/content", nil)
+	if err != nil {
+		t.Fatalf("GetStream: %v", err)
+	}
+	defer body.Close()
+	content, _ := io.ReadAll(body)
+	if string(content) != "hello, world" {
+		t.Errorf("content = %q, want the file", content)
+	}
+
+	downloads := downloadRequests(srv)
+	if len(downloads) != 1 {
+		t.Fatalf("download requests = %d, want 1", len(downloads))
+	}
+	for _, name := range []string{"Authorization", "client-request-id", "X-Tenant-Hint"} {
+		if value := downloads[0].Header.Get(name); value != "" {
+			t.Errorf("download request carried %s: %q", name, value)
+		}
+	}
+	if got := downloads[0].Header.Get("User-Agent"); got == "stream-test" {
+		t.Error("download request carried the client's User-Agent")
+	}
+	if len(seen) != 1 {
+		t.Errorf("middleware saw %v, want only the Graph request", seen)
+	}
+}
+
+func TestGetStreamRange(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	item := srv.AddFile(me.ID, "notes.txt", []byte("0123456789"))
+	client := srv.NewClientWithRefresh(me.ID)
+
+	header := graph.ByteRange(2, 5)
+	body, respHeader, err := client.GetStream("/me/drive/items/"+item.ID+"/content", header)
+	if err != nil {
+		t.Fatalf("GetStream: %v", err)
+	}
+	defer body.Close()
+	content, _ := io.ReadAll(body)
+	if string(content) != "2345" {
+		t.Errorf("content = %q, want bytes 2 through 5", content)
+	}
+	if got := respHeader.Get("Content-Range"); got != "bytes 2-5/10" {
+		t.Errorf("Content-Range = %q, want bytes 2-5/10", got)
+	}
+	if got := downloadRequests(srv)[0].Header.Get("Range"); got != "bytes=2-5" {
+		t.Errorf("download Range = %q, want the caller's range", got)
+	}
+
+	// The caller's header is copied, not shared with the request
+	header.Set("Range", "bytes=0-0")
+	if got := downloadRequests(srv)[0].Header.Get("Range"); got != "bytes=2-5" {
+		t.Errorf("download Range changed to %q with the caller's header", got)
+	}
+}
+
+func TestGetStreamStopsRedirectLoop(t *testing.T) {
+	var requests int
+	loop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, "/again", http.StatusFound)
+	}))
+	defer loop.Close()
+
+	cloud := graph.Cloud{Name: "loop", GraphEndpoint: loop.URL, LoginEndpoint: loop.URL}
+	client := graph.NewClient("token", graph.WithCloud(cloud))
+	_, _, err := client.GetStream("/me/drive/items/1/content", nil)
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Fatalf("GetStream error = %v, want a redirect limit error", err)
+	}
+	if requests != 11 {
+		t.Errorf("requests = %d, want the first request and 10 redirects", requests)
+	}
+}
+
+func TestGetStreamReturnsGraphError(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	_, _, err := client.GetStream("/me/drive/items/missing/content", nil)
+	var graphErr *graph.GraphError
+	if !errors.As(err, &graphErr) {
+		t.Fatalf("GetStream error = %v, want a GraphError", err)
+	}
+	if graphErr.StatusCode != http.StatusNotFound || graphErr.Code != "itemNotFound" {
+		t.Errorf("error = %d %s, want 404 itemNotFound", graphErr.StatusCode, graphErr.Code)
+	}
+}
+
+func TestGetStreamContextCancels(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	item := srv.AddFile(me.ID, "notes.txt", []byte("hello"))
+	client := srv.NewClientWithRefresh(me.ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := client.GetStreamContext(ctx, "/me/drive/items/"+item.ID+"/content", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetStreamContext error = %v, want context.Canceled", err)
+	}
+	srv.AssertNotRequested(t, http.MethodGet, "/v1.0/me/drive/items/"+item.ID+"/content")
+}
@@ -0,0 +1,218 @@
+// Package tracing propagates W3C Trace Context to Microsoft Graph and reports
+// a span for every request. It does not send spans anywhere itself; pass an
+// Export function to hand them to your tracing system.
+//
+//	tracer := tracing.New(tracing.Options{
+//		Parent: os.Getenv("TRACEPARENT"),
+//		Export: func(span tracing.Span) { ... },
+//	})
+//	client := graph.NewClient(token, graph.WithInstrumentation(tracer))
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ms_graph/internal/graph"
+)
+
+// TraceContext is a parsed traceparent header
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+	Flags   byte
+}
+
+// Sampled reports whether the sampled flag is set
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&1 == 1
+}
+
+// String formats the trace context as a version 00 traceparent header
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// Parse parses a traceparent header. Invalid headers, including all-zero IDs,
+// are rejected, in which case callers should start a new trace.
+func Parse(traceparent string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return TraceContext{}, false
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return TraceContext{}, false
+	}
+
+	traceID, spanID := parts[1], parts[2]
+	if !isHex(parts[0]) || !isHex(traceID) || len(traceID) != 32 || !isHex(spanID) || len(spanID) != 16 || len(parts[3]) != 2 {
+		return TraceContext{}, false
+	}
+	if traceID == strings.Repeat("0", 32) || spanID == strings.Repeat("0", 16) {
+		return TraceContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return TraceContext{}, false
+	}
+
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: byte(flags)}, true
+}
+
+// Span is one Graph request
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	// Name is the method and route, e.g. "GET /v1.0/users/{id}"
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	// Err is set when no response was received
+	Err error
+}
+
+// Options configures a Tracer
+type Options struct {
+	// Parent is a traceparent header that every request's span is a child
+	// of, e.g. from the TRACEPARENT environment variable. Requests that
+	// already carry a traceparent header use it instead. Empty or invalid
+	// values start a new trace for each request.
+	Parent string
+	// State is a tracestate header sent along with Parent
+	State string
+	// Export receives finished spans; nil discards them
+	Export func(Span)
+	// Sampled sets the sampled flag on new traces
+	Sampled bool
+}
+
+// Tracer is a graph.Instrumentation that adds traceparent and tracestate
+// headers to requests and exports their spans
+type Tracer struct {
+	graph.NopInstrumentation
+
+	parent    TraceContext
+	hasParent bool
+	state     string
+	export    func(Span)
+	sampled   bool
+
+	mu    sync.Mutex
+	spans map[*http.Request]*Span
+}
+
+// New creates a Tracer
+func New(opts Options) *Tracer {
+	parent, ok := Parse(opts.Parent)
+	return &Tracer{
+		parent:    parent,
+		hasParent: ok,
+		state:     opts.State,
+		export:    opts.Export,
+		sampled:   opts.Sampled,
+		spans:     make(map[*http.Request]*Span),
+	}
+}
+
+// RequestStart starts a span and, for requests to Graph, sets the request's
+// traceparent header to it. Token requests and pre-authenticated URLs on
+// other hosts get a span but no trace headers.
+func (t *Tracer) RequestStart(req *http.Request, event graph.RequestStartEvent) {
+	parent, ok := Parse(req.Header.Get("traceparent"))
+	state := req.Header.Get("tracestate")
+	if !ok && t.hasParent {
+		parent, ok, state = t.parent, true, t.state
+	}
+
+	span := &Span{
+		SpanID: randomHex(8),
+		Name:   event.Method + " " + event.Route,
+		Start:  event.Start,
+		Attributes: map[string]string{
+			"http.request.method": event.Method,
+			"http.route":          event.Route,
+			"server.address":      req.URL.Host,
+		},
+	}
+	flags := byte(0)
+	if t.sampled {
+		flags = 1
+	}
+	if ok {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+		flags = parent.Flags
+	} else {
+		span.TraceID = randomHex(16)
+	}
+	if event.Attempt > 0 {
+		span.Attributes["http.request.resend_count"] = strconv.Itoa(event.Attempt)
+	}
+	if event.TokenRequest {
+		span.Attributes["graph.token_request"] = "true"
+	}
+
+	if event.GraphRequest {
+		req.Header.Set("traceparent", TraceContext{TraceID: span.TraceID, SpanID: span.SpanID, Flags: flags}.String())
+		if state != "" {
+			req.Header.Set("tracestate", state)
+		}
+	}
+
+	t.mu.Lock()
+	t.spans[req] = span
+	t.mu.Unlock()
+}
+
+// RequestEnd finishes the request's span and exports it
+func (t *Tracer) RequestEnd(req *http.Request, event graph.RequestEndEvent) {
+	t.mu.Lock()
+	span, ok := t.spans[req]
+	delete(t.spans, req)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	span.End = span.Start.Add(event.Duration)
+	span.Err = event.Err
+	if event.StatusCode != 0 {
+		span.Attributes["http.response.status_code"] = strconv.Itoa(event.StatusCode)
+	}
+	if event.RequestID != "" {
+		span.Attributes["graph.request_id"] = event.RequestID
+	}
+	if event.Err != nil {
+		span.Attributes["error.type"] = fmt.Sprintf("%T", event.Err)
+	}
+
+	if t.export != nil {
+		t.export(*span)
+	}
+}
+
+// isHex reports whether s is lowercase hexadecimal
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// randomHex returns n random bytes as lowercase hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
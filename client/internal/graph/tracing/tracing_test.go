@@ -0,0 +1,116 @@
+package tracing_test
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+	"ms_graph/internal/graph/tracing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"valid", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true},
+		{"future version with extra field", "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", true},
+		{"version 00 with extra field", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", false},
+		{"version ff", "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false},
+		{"zero trace ID", "00-00000000000000000000000000000000-b7ad6b7169203331-01", false},
+		{"zero span ID", "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", false},
+		{"uppercase hex", "00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", false},
+		{"short trace ID", "00-0af7651916cd43dd-b7ad6b7169203331-01", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, ok := tracing.Parse(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("Parse(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+			if ok && tt.value[:2] == "00" && tc.String() != tt.value {
+				t.Errorf("String() = %q, want %q", tc.String(), tt.value)
+			}
+		})
+	}
+}
+
+// spans collects exported spans
+type spans struct {
+	mu    sync.Mutex
+	spans []tracing.Span
+}
+
+func (s *spans) export(span tracing.Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans = append(s.spans, span)
+}
+
+func TestTracerPropagatesToGraphOnly(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+
+	const parent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	exported := &spans{}
+	tracer := tracing.New(tracing.Options{Parent: parent, State: "vendor=1", Export: exported.export})
+	client := srv.NewClientWithRefresh(me.ID, graph.WithInstrumentation(tracer))
+
+	srv.ExpireAccessTokens()
+	if err := client.Get("/me", nil); err != nil {
+		t.Fatalf("Get /me: %v", err)
+	}
+
+	for _, req := range srv.Matching(http.MethodGet, "/v1.0/me") {
+		tc, ok := tracing.Parse(req.Header.Get("traceparent"))
+		if !ok || tc.TraceID != "0af7651916cd43dd8448eb211c80319c" || !tc.Sampled() {
+			t.Errorf("Graph request traceparent = %q, want a child of %s", req.Header.Get("traceparent"), parent)
+		}
+		req.AssertHeader(t, "tracestate", "vendor=1")
+	}
+	for _, req := range srv.TokenRequests() {
+		if value := req.Header.Get("traceparent"); value != "" {
+			t.Errorf("token request traceparent = %q, want none", value)
+		}
+	}
+
+	// One span per request, including the token request
+	if len(exported.spans) != 3 {
+		t.Fatalf("exported spans = %d, want 3", len(exported.spans))
+	}
+	first, refresh, retry := exported.spans[0], exported.spans[1], exported.spans[2]
+	if first.Name != "GET /v1.0/me" || first.ParentSpanID != "b7ad6b7169203331" || first.Attributes["http.response.status_code"] != "401" {
+		t.Errorf("first span = %+v", first)
+	}
+	if refresh.Attributes["graph.token_request"] != "true" || !strings.HasSuffix(refresh.Name, "/oauth2/v2.0/token") {
+		t.Errorf("refresh span = %+v", refresh)
+	}
+	if retry.Attributes["http.request.resend_count"] != "1" || retry.Attributes["http.response.status_code"] != "200" {
+		t.Errorf("retry span = %+v", retry)
+	}
+	if retry.Attributes["graph.request_id"] == "" && first.Attributes["graph.request_id"] == "" {
+		t.Error("spans carry no Graph request-id")
+	}
+}
+
+func TestTracerStartsNewTraceWithoutParent(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID, graph.WithInstrumentation(tracing.New(tracing.Options{})))
+
+	if err := client.Get("/me", nil); err != nil {
+		t.Fatalf("Get /me: %v", err)
+	}
+	req := srv.AssertRequested(t, http.MethodGet, "/v1.0/me")
+	tc, ok := tracing.Parse(req.Header.Get("traceparent"))
+	if !ok || tc.Sampled() {
+		t.Errorf("traceparent = %q, want a new unsampled trace", req.Header.Get("traceparent"))
+	}
+}
@@ -0,0 +1,200 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// API is the set of requests implemented by both Client and
+// ClientWithRefresh, so helpers can accept either
+type API interface {
+	Do(req *Request) (*Response, error)
+	Get(endpoint string, result interface{}) error
+	Post(endpoint string, payload interface{}, result interface{}) error
+	Patch(endpoint string, payload interface{}, result interface{}) error
+	Put(endpoint string, payload interface{}, result interface{}) error
+	Delete(endpoint string) error
+}
+
+// Collection is one page of an OData collection response
+type Collection[T any] struct {
+	Value []T `json:"value"`
+	// Count is set when the request asked for $count=true
+	Count     *int64 `json:"@odata.count,omitempty"`
+	NextLink  string `json:"@odata.nextLink,omitempty"`
+	DeltaLink string `json:"@odata.deltaLink,omitempty"`
+}
+
+// GetAs performs a GET request and decodes the resource into a new T
+func GetAs[T any](client API, endpoint string) (*T, error) {
+	var result T
+	if err := client.Get(endpoint, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Create POSTs item to a collection and returns the created resource as a
+// T. The whole of item is sent, so it is typically a struct with omitempty
+// fields, such as UserChanges, that leaves out what Graph assigns.
+func Create[T any](client API, endpoint string, item interface{}) (*T, error) {
+	var created T
+	if err := client.Post(endpoint, item, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Update PATCHes a resource with changes, typically a map or a struct with
+// omitempty fields so only the changed properties are sent. It returns the
+// updated resource if Graph sends it back, and nil if Graph answers 204.
+func Update[T any](client API, endpoint string, changes interface{}) (*T, error) {
+	var raw json.RawMessage
+	if err := client.Patch(endpoint, changes, &raw); err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+
+	var updated T
+	if err := json.Unmarshal(raw, &updated); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return &updated, nil
+}
+
+// GetPage performs a GET request for one page of a collection
+func GetPage[T any](client API, endpoint string) (*Collection[T], error) {
+	var page Collection[T]
+	if err := client.Get(endpoint, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ListAs returns every item of a collection, following @odata.nextLink
+// until the last page
+func ListAs[T any](client API, endpoint string) ([]T, error) {
+	var items []T
+	for endpoint != "" {
+		page, err := GetPage[T](client, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Value...)
+		endpoint = page.NextLink
+	}
+	return items, nil
+}
+
+// SplitAdditionalData returns the top-level properties of the JSON object
+// data that do not map to a field of the struct v points to. Matching
+// follows encoding/json, so it is case-insensitive.
+func SplitAdditionalData(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return nil, err
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+	for name := range properties {
+		if known[strings.ToLower(name)] {
+			delete(properties, name)
+		}
+	}
+	if len(properties) == 0 {
+		return nil, nil
+	}
+	return properties, nil
+}
+
+// MarshalWithAdditionalData marshals v, which must encode as a JSON object,
+// and adds the properties in additional that v does not already have
+func MarshalWithAdditionalData(v interface{}, additional map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(additional) == 0 {
+		return data, err
+	}
+
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return nil, err
+	}
+
+	// Match existing properties case-insensitively, as encoding/json does
+	// when decoding, so a conflicting key never appears twice
+	existing := make(map[string]bool, len(properties))
+	for name := range properties {
+		existing[strings.ToLower(name)] = true
+	}
+	names := make([]string, 0, len(additional))
+	for name := range additional {
+		if !existing[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return data, nil
+	}
+	sort.Strings(names)
+
+	// Keep v's own property order and append the rest, rather than
+	// re-marshaling the map in alphabetical order
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[len(data)-1] != '}' {
+		return nil, fmt.Errorf("%T does not encode as a JSON object", v)
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for i, name := range names {
+		if len(properties) > 0 || i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(additional[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonFieldNames returns the lowercased JSON property names of a struct type,
+// including those of embedded structs
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	names := make(map[string]bool)
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			for embedded := range jsonFieldNames(field.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
@@ -0,0 +1,172 @@
+package graph_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+func TestMarshalWithAdditionalData(t *testing.T) {
+	type inner struct {
+		B int `json:"b"`
+	}
+	type withInner struct {
+		Name string `json:"name"`
+		In   inner  `json:"in"`
+	}
+	type named struct {
+		Name string `json:"name"`
+	}
+	type empty struct{}
+
+	tests := []struct {
+		name       string
+		v          interface{}
+		additional map[string]json.RawMessage
+		want       string
+	}{
+		{
+			name:       "nested object last",
+			v:          withInner{Name: "x"},
+			additional: map[string]json.RawMessage{"extra": json.RawMessage(`1`)},
+			want:       `{"name":"x","in":{"b":0},"extra":1}`,
+		},
+		{
+			name: "no additional data",
+			v:    withInner{Name: "x"},
+			want: `{"name":"x","in":{"b":0}}`,
+		},
+		{
+			name:       "empty additional data",
+			v:          named{Name: "x"},
+			additional: map[string]json.RawMessage{},
+			want:       `{"name":"x"}`,
+		},
+		{
+			name: "additional data sorted after fields",
+			v:    named{Name: "x"},
+			additional: map[string]json.RawMessage{
+				"zeta":  json.RawMessage(`"z"`),
+				"alpha": json.RawMessage(`{"a":[1,2]}`),
+			},
+			want: `{"name":"x","alpha":{"a":[1,2]},"zeta":"z"}`,
+		},
+		{
+			name:       "conflicting key keeps the field",
+			v:          named{Name: "x"},
+			additional: map[string]json.RawMessage{"name": json.RawMessage(`"y"`)},
+			want:       `{"name":"x"}`,
+		},
+		{
+			name: "conflicting key differing in case keeps the field",
+			v:    named{Name: "x"},
+			additional: map[string]json.RawMessage{
+				"Name":  json.RawMessage(`"y"`),
+				"other": json.RawMessage(`true`),
+			},
+			want: `{"name":"x","other":true}`,
+		},
+		{
+			name:       "empty struct",
+			v:          empty{},
+			additional: map[string]json.RawMessage{"extra": json.RawMessage(`1`)},
+			want:       `{"extra":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := graph.MarshalWithAdditionalData(tt.v, tt.additional)
+			if err != nil {
+				t.Fatalf("MarshalWithAdditionalData: %v", err)
+			}
+			if !json.Valid(got) {
+				t.Fatalf("output is not valid JSON: %s", got)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalWithAdditionalDataRejectsNonObject(t *testing.T) {
+	additional := map[string]json.RawMessage{"extra": json.RawMessage(`1`)}
+	if _, err := graph.MarshalWithAdditionalData((*struct{})(nil), additional); err == nil {
+		t.Error("expected an error for a value that encodes as null")
+	}
+}
+
+func TestUserRoundTripsAdditionalData(t *testing.T) {
+	data := []byte(`{"id":"1","displayName":"Adele","employeeId":"42","@odata.type":"#microsoft.graph.user"}`)
+	var user graph.User
+	if err := json.Unmarshal(data, &user); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(user.AdditionalData) != 2 {
+		t.Errorf("AdditionalData = %v, want employeeId and @odata.type", user.AdditionalData)
+	}
+
+	got, err := json.Marshal(user)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"id":"1","displayName":"Adele","givenName":"","surname":"","mail":"","userPrincipalName":"","jobTitle":"","department":"","officeLocation":"","mobilePhone":"","businessPhones":null,` +
+		`"@odata.type":"#microsoft.graph.user","employeeId":"42"}`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestCreateAndUpdateSendOnlySetFields(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance", JobTitle: "Engineer"})
+	client := srv.NewClient(me.ID)
+
+	created, err := graph.Create[graph.User](client, "/users", graph.UserChanges{DisplayName: "Alex Wilber"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == "" || created.DisplayName != "Alex Wilber" {
+		t.Errorf("created user = %+v, want an ID and the display name", created)
+	}
+
+	if _, err := graph.Update[graph.User](client, "/me", graph.UserChanges{Department: "R&D"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	user, _ := srv.User(me.ID)
+	if user.JobTitle != "Engineer" || user.Department != "R&D" {
+		t.Errorf("user after PATCH = %+v, want JobTitle kept and Department set", user)
+	}
+
+	for _, req := range append(srv.Matching(http.MethodPost, "/users"), srv.Matching(http.MethodPatch, "/me")...) {
+		if strings.Contains(string(req.Body), `"id"`) || strings.Contains(string(req.Body), `""`) {
+			t.Errorf("%s %s sent unset fields: %s", req.Method, req.Path, req.Body)
+		}
+	}
+}
+
+func TestUpdateWithUserClearsFields(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance", JobTitle: "Engineer"})
+	client := srv.NewClient(me.ID)
+
+	// A User sends every field, so its empty JobTitle clears the property
+	if _, err := graph.Update[graph.User](client, "/me", graph.User{DisplayName: "Adele Vance"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	user, _ := srv.User(me.ID)
+	if user.JobTitle != "" {
+		t.Errorf("JobTitle = %q after PATCH with an empty jobTitle, want it cleared", user.JobTitle)
+	}
+	req := srv.AssertRequested(t, http.MethodPatch, "/v1.0/me")
+	if !strings.Contains(string(req.Body), `"jobTitle":""`) {
+		t.Errorf("PATCH body = %s, want jobTitle sent empty", req.Body)
+	}
+}
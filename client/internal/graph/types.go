@@ -1,5 +1,7 @@
 package graph
 
+import "encoding/json"
+
 // User represents a Microsoft Graph user object
 type User struct {
 	ID                string   `json:"id"`
@@ -13,6 +15,48 @@ type User struct {
 	OfficeLocation    string   `json:"officeLocation"`
 	MobilePhone       string   `json:"mobilePhone"`
 	BusinessPhones    []string `json:"businessPhones"`
+
+	// AdditionalData holds properties without a field above, such as
+	// $select-ed extras or @odata annotations, so they survive a round trip
+	AdditionalData map[string]json.RawMessage `json:"-"`
+}
+
+// UserChanges is the body of a request that creates or updates a user with
+// Create or Update. Unlike User, which sends every field, it sends only the
+// fields that are set; to clear a property, Update with a map such as
+// map[string]interface{}{"jobTitle": nil}.
+type UserChanges struct {
+	DisplayName       string   `json:"displayName,omitempty"`
+	GivenName         string   `json:"givenName,omitempty"`
+	Surname           string   `json:"surname,omitempty"`
+	Mail              string   `json:"mail,omitempty"`
+	UserPrincipalName string   `json:"userPrincipalName,omitempty"`
+	JobTitle          string   `json:"jobTitle,omitempty"`
+	Department        string   `json:"department,omitempty"`
+	OfficeLocation    string   `json:"officeLocation,omitempty"`
+	MobilePhone       string   `json:"mobilePhone,omitempty"`
+	BusinessPhones    []string `json:"businessPhones,omitempty"`
+}
+
+// UnmarshalJSON decodes a user, keeping unknown properties in AdditionalData
+func (u *User) UnmarshalJSON(data []byte) error {
+	type user User
+	if err := json.Unmarshal(data, (*user)(u)); err != nil {
+		return err
+	}
+
+	additional, err := SplitAdditionalData(data, u)
+	if err != nil {
+		return err
+	}
+	u.AdditionalData = additional
+	return nil
+}
+
+// MarshalJSON encodes a user along with its AdditionalData
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User
+	return MarshalWithAdditionalData(user(u), u.AdditionalData)
 }
 
 // ErrorResponse represents an error response from Microsoft Graph API
@@ -22,8 +66,16 @@ type ErrorResponse struct {
 
 // Error represents an error object within an ErrorResponse
 type Error struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code       string      `json:"code"`
+	Message    string      `json:"message"`
+	InnerError *InnerError `json:"innerError,omitempty"`
+}
+
+// InnerError carries the request identifiers Graph includes with errors
+type InnerError struct {
+	RequestID       string `json:"request-id"`
+	ClientRequestID string `json:"client-request-id"`
+	Date            string `json:"date"`
 }
 
 // TokenResponse represents a response from the OAuth2 token endpoint
@@ -34,4 +86,3 @@ type TokenResponse struct {
 	RefreshToken string `json:"refresh_token,omitempty"`
 	Scope        string `json:"scope"`
 }
-
@@ -0,0 +1,327 @@
+package graph_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+const uploadEndpoint = "/me/drive/root:/big.bin:/createUploadSession"
+
+// uploadContent returns size bytes of varying content
+func uploadContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+// uploadRequests returns the requests sent to upload session URLs
+func uploadRequests(srv *graphtest.Server) []graphtest.Request {
+	var matched []graphtest.Request
+	for _, req := range srv.Requests() {
+		if strings.HasPrefix(req.Path, "/upload/") {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// contentRanges returns the Content-Range headers of the PUT requests
+func contentRanges(requests []graphtest.Request) []string {
+	var ranges []string
+	for _, req := range requests {
+		if req.Method == http.MethodPut {
+			ranges = append(ranges, req.Header.Get("Content-Range"))
+		}
+	}
+	return ranges
+}
+
+// assertUploaded checks that the uploaded item holds content
+func assertUploaded(t *testing.T, srv *graphtest.Server, userID string, item graphtest.DriveItem, content []byte) {
+	t.Helper()
+	if item.ID == "" {
+		t.Fatal("upload returned no item")
+	}
+	got, ok := srv.FileContent(userID, item.ID)
+	if !ok {
+		t.Fatalf("uploaded item %s not found", item.ID)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("uploaded %d bytes differ from the %d sent", len(got), len(content))
+	}
+}
+
+func TestUploadLargeFileInChunks(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	const chunk = graph.UploadChunkAlignment
+	content := uploadContent(2*chunk + chunk/2)
+	var progress []int64
+	opts := graph.UploadOptions{
+		ChunkSize: chunk + 1000, // rounded down to the alignment
+		Progress:  func(uploaded, total int64) { progress = append(progress, uploaded) },
+	}
+	var item graphtest.DriveItem
+	if err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), opts, &item); err != nil {
+		t.Fatalf("UploadLargeFile: %v", err)
+	}
+	assertUploaded(t, srv, me.ID, item, content)
+
+	requests := uploadRequests(srv)
+	want := []string{
+		fmt.Sprintf("bytes 0-%d/%d", chunk-1, len(content)),
+		fmt.Sprintf("bytes %d-%d/%d", chunk, 2*chunk-1, len(content)),
+		fmt.Sprintf("bytes %d-%d/%d", 2*chunk, len(content)-1, len(content)),
+	}
+	if got := contentRanges(requests); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+	for _, req := range requests {
+		req.AssertHeader(t, "Authorization", "")
+	}
+	if fmt.Sprint(progress) != fmt.Sprint([]int64{chunk, 2 * chunk, int64(len(content))}) {
+		t.Errorf("progress = %v", progress)
+	}
+	srv.AssertRequestCount(t, http.MethodPost, uploadEndpoint, 1)
+}
+
+func TestUploadLargeFileRetriesFailedChunk(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	const chunk = graph.UploadChunkAlignment
+	content := uploadContent(2 * chunk)
+	// A sub-second RetryAfter is sent as "Retry-After: 0", so the retry does not wait
+	srv.Inject(graphtest.Fault{Method: http.MethodPut, Path: "/upload", StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Millisecond})
+	var item graphtest.DriveItem
+	opts := graph.UploadOptions{ChunkSize: chunk}
+	if err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), opts, &item); err != nil {
+		t.Fatalf("UploadLargeFile: %v", err)
+	}
+	assertUploaded(t, srv, me.ID, item, content)
+
+	// The failed chunk is followed by a status request and sent again
+	var methods []string
+	for _, req := range uploadRequests(srv) {
+		methods = append(methods, req.Method)
+	}
+	if want := "[PUT GET PUT PUT]"; fmt.Sprint(methods) != want {
+		t.Errorf("upload requests = %v, want %s", methods, want)
+	}
+}
+
+func TestUploadLargeFileContextCancelsRetryWait(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	content := uploadContent(graph.UploadChunkAlignment)
+	srv.Inject(graphtest.Fault{Method: http.MethodPut, Path: "/upload", StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := client.UploadLargeFileContext(ctx, uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), graph.UploadOptions{}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("UploadLargeFileContext error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("upload returned after %v, want it to stop waiting for Retry-After", elapsed)
+	}
+	if got := len(contentRanges(uploadRequests(srv))); got != 1 {
+		t.Errorf("chunks sent = %d, want only the failed one", got)
+	}
+}
+
+func TestUploadLargeFileGivesUpAfterMaxRetries(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	content := uploadContent(graph.UploadChunkAlignment)
+	// 416 is retried at once, without backing off
+	srv.Inject(graphtest.Fault{Method: http.MethodPut, Path: "/upload", StatusCode: http.StatusRequestedRangeNotSatisfiable, Times: 3})
+	opts := graph.UploadOptions{MaxRetries: 2}
+	err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), opts, nil)
+	var graphErr *graph.GraphError
+	if !errors.As(err, &graphErr) || graphErr.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("UploadLargeFile error = %v, want a 416 GraphError", err)
+	}
+	if got := len(contentRanges(uploadRequests(srv))); got != 3 {
+		t.Errorf("chunks sent = %d, want 3", got)
+	}
+}
+
+func TestUploadLargeFileResumesFromGraphStatus(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	const chunk = graph.UploadChunkAlignment
+	content := uploadContent(3 * chunk)
+	statePath := filepath.Join(t.TempDir(), "upload.json")
+
+	// The first run stops with a non-retryable error after one chunk
+	opts := graph.UploadOptions{
+		ChunkSize: chunk,
+		StatePath: statePath,
+		Progress: func(uploaded, total int64) {
+			if uploaded == chunk {
+				srv.Inject(graphtest.Fault{Method: http.MethodPut, Path: "/upload", StatusCode: http.StatusBadRequest})
+			}
+		},
+	}
+	if err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), opts, nil); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatalf("failed to read upload state: %v", err)
+	}
+	var state struct {
+		Session graph.UploadSession `json:"session"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("failed to parse upload state: %v", err)
+	}
+	if want := fmt.Sprintf("%d-", chunk); len(state.Session.NextExpectedRanges) != 1 || !strings.HasPrefix(state.Session.NextExpectedRanges[0], want) {
+		t.Errorf("saved ranges = %v, want them to start at %d after the accepted chunk", state.Session.NextExpectedRanges, chunk)
+	}
+
+	// Make the saved ranges stale, as if the process died before saving the
+	// last accepted chunk; the resume must ask Graph rather than trust them
+	data = bytes.Replace(data, []byte(state.Session.NextExpectedRanges[0]), []byte("0-"), 1)
+	if err := os.WriteFile(statePath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.ResetRequests()
+	opts.Progress = nil
+	var item graphtest.DriveItem
+	if err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), opts, &item); err != nil {
+		t.Fatalf("resumed UploadLargeFile: %v", err)
+	}
+	assertUploaded(t, srv, me.ID, item, content)
+
+	requests := uploadRequests(srv)
+	if len(requests) == 0 || requests[0].Method != http.MethodGet {
+		t.Fatalf("resume did not start with a status request: %v", requests)
+	}
+	want := []string{
+		fmt.Sprintf("bytes %d-%d/%d", chunk, 2*chunk-1, len(content)),
+		fmt.Sprintf("bytes %d-%d/%d", 2*chunk, len(content)-1, len(content)),
+	}
+	if got := contentRanges(requests); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("resumed Content-Range = %q, want %q", got, want)
+	}
+	srv.AssertNotRequested(t, http.MethodPost, uploadEndpoint)
+	if _, err := os.Stat(statePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("upload state still exists after completing: %v", err)
+	}
+}
+
+func TestUploadLargeFileStartsOverWhenSessionExpired(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	content := uploadContent(2 * graph.UploadChunkAlignment)
+	statePath := filepath.Join(t.TempDir(), "upload.json")
+	session, err := client.CreateUploadSession(uploadEndpoint, nil)
+	if err != nil {
+		t.Fatalf("CreateUploadSession: %v", err)
+	}
+	if err := client.CancelUpload(session.UploadURL); err != nil {
+		t.Fatalf("CancelUpload: %v", err)
+	}
+	state := map[string]interface{}{"endpoint": uploadEndpoint, "size": len(content), "session": session}
+	data, _ := json.Marshal(state)
+	if err := os.WriteFile(statePath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var item graphtest.DriveItem
+	opts := graph.UploadOptions{ChunkSize: graph.UploadChunkAlignment, StatePath: statePath}
+	if err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), opts, &item); err != nil {
+		t.Fatalf("UploadLargeFile: %v", err)
+	}
+	assertUploaded(t, srv, me.ID, item, content)
+	srv.AssertRequestCount(t, http.MethodPost, uploadEndpoint, 2)
+}
+
+func TestUploadLargeFileRejectsEmptyContent(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID)
+
+	if err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(nil), 0, graph.UploadOptions{}, nil); err == nil {
+		t.Fatal("UploadLargeFile of no bytes succeeded")
+	}
+	srv.AssertNotRequested(t, http.MethodPost, uploadEndpoint)
+
+	session := &graph.UploadSession{UploadURL: srv.URL + "/upload/unused"}
+	if err := client.UploadToSession(session, bytes.NewReader(nil), 0, graph.UploadOptions{}, nil); err == nil {
+		t.Fatal("UploadToSession of no bytes succeeded")
+	}
+	if requests := uploadRequests(srv); len(requests) != 0 {
+		t.Errorf("empty upload sent %d chunk requests", len(requests))
+	}
+}
+
+func TestUploadLargeFileSendsNoClientHeadersToUploadURL(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	client := srv.NewClientWithRefresh(me.ID, graph.WithMiddleware(
+		graph.ClientRequestID(),
+		graph.SetHeaders(http.Header{"X-Team": {"storage-must-not-see-this"}}),
+	))
+
+	// A failed chunk makes the upload ask for the session's status too
+	srv.Inject(graphtest.Fault{Method: http.MethodPut, Path: "/upload", StatusCode: http.StatusServiceUnavailable})
+	content := uploadContent(graph.UploadChunkAlignment + 1)
+	var item graphtest.DriveItem
+	opts := graph.UploadOptions{ChunkSize: graph.UploadChunkAlignment}
+	if err := client.UploadLargeFile(uploadEndpoint, nil, bytes.NewReader(content), int64(len(content)), opts, &item); err != nil {
+		t.Fatalf("UploadLargeFile: %v", err)
+	}
+	assertUploaded(t, srv, me.ID, item, content)
+
+	requests := uploadRequests(srv)
+	if len(requests) < 3 {
+		t.Fatalf("upload requests = %d, want chunks and a status request", len(requests))
+	}
+	for _, req := range requests {
+		for _, name := range []string{"Authorization", "X-Team", "client-request-id"} {
+			if value := req.Header.Get(name); value != "" {
+				t.Errorf("%s %s sent %s: %q", req.Method, req.Path, name, value)
+			}
+		}
+	}
+	srv.AssertRequested(t, http.MethodPost, uploadEndpoint).AssertHeader(t, "X-Team", "storage-must-not-see-this")
+}
@@ -0,0 +1,366 @@
+package jmespath
+
+import (
+	"sort"
+	"strings"
+)
+
+// expref is the value of an &expression, passed to functions such as sort_by
+type expref struct {
+	node node
+}
+
+// eval evaluates n against the current value
+func eval(n node, current interface{}) (interface{}, error) {
+	switch n.typ {
+	case nField:
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return object[n.value.(string)], nil
+
+	case nSubexpression, nPipe:
+		left, err := eval(n.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		return eval(n.children[1], left)
+
+	case nIndex:
+		array, ok := current.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		i := n.value.(int)
+		if i < 0 {
+			i += len(array)
+		}
+		if i < 0 || i >= len(array) {
+			return nil, nil
+		}
+		return array[i], nil
+
+	case nSlice:
+		array, ok := current.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return slice(array, n.value.(sliceBounds)), nil
+
+	case nProjection:
+		left, err := eval(n.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		array, ok := left.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return project(array, n.children[1])
+
+	case nValueProjection:
+		left, err := eval(n.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		object, ok := left.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return project(objectValues(object), n.children[1])
+
+	case nFilterProjection:
+		left, err := eval(n.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		array, ok := left.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		var matched []interface{}
+		for _, element := range array {
+			keep, err := eval(n.children[2], element)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(keep) {
+				matched = append(matched, element)
+			}
+		}
+		return project(matched, n.children[1])
+
+	case nFlatten:
+		value, err := eval(n.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		flattened := []interface{}{}
+		for _, element := range array {
+			if inner, ok := element.([]interface{}); ok {
+				flattened = append(flattened, inner...)
+			} else {
+				flattened = append(flattened, element)
+			}
+		}
+		return flattened, nil
+
+	case nComparator:
+		left, err := eval(n.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		right, err := eval(n.children[1], current)
+		if err != nil {
+			return nil, err
+		}
+		return compare(n.value.(tokenType), left, right), nil
+
+	case nOr:
+		left, err := eval(n.children[0], current)
+		if err != nil || truthy(left) {
+			return left, err
+		}
+		return eval(n.children[1], current)
+
+	case nAnd:
+		left, err := eval(n.children[0], current)
+		if err != nil || !truthy(left) {
+			return left, err
+		}
+		return eval(n.children[1], current)
+
+	case nNot:
+		value, err := eval(n.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(value), nil
+
+	case nLiteral:
+		return n.value, nil
+
+	case nCurrent:
+		return current, nil
+
+	case nMultiSelectList:
+		if current == nil {
+			return nil, nil
+		}
+		list := make([]interface{}, len(n.children))
+		for i, child := range n.children {
+			value, err := eval(child, current)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+
+	case nMultiSelectHash:
+		if current == nil {
+			return nil, nil
+		}
+		hash := make(map[string]interface{}, len(n.children))
+		for i, child := range n.children {
+			value, err := eval(child, current)
+			if err != nil {
+				return nil, err
+			}
+			hash[n.keys[i]] = value
+		}
+		return hash, nil
+
+	case nFunction:
+		args := make([]interface{}, len(n.children))
+		for i, child := range n.children {
+			if child.typ == nExpref {
+				args[i] = expref{node: child.children[0]}
+				continue
+			}
+			value, err := eval(child, current)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		return callFunction(n.value.(string), args)
+
+	case nExpref:
+		return expref{node: n.children[0]}, nil
+	}
+	return nil, nil
+}
+
+// project evaluates right against each element, dropping null results
+func project(elements []interface{}, right node) (interface{}, error) {
+	results := []interface{}{}
+	for _, element := range elements {
+		value, err := eval(right, element)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			results = append(results, value)
+		}
+	}
+	return results, nil
+}
+
+// slice applies Python-style slice bounds to array
+func slice(array []interface{}, bounds sliceBounds) []interface{} {
+	step := 1
+	if bounds[2] != nil {
+		step = *bounds[2]
+	}
+	length := len(array)
+
+	// clamp resolves a bound against the array's length
+	clamp := func(bound *int, forward, backward int) int {
+		if bound == nil {
+			if step > 0 {
+				return forward
+			}
+			return backward
+		}
+		i := *bound
+		if i < 0 {
+			i += length
+		}
+		if step > 0 {
+			return min(max(i, 0), length)
+		}
+		return min(max(i, -1), length-1)
+	}
+	start := clamp(bounds[0], 0, length-1)
+	stop := clamp(bounds[1], length, -1)
+
+	result := []interface{}{}
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		result = append(result, array[i])
+	}
+	return result
+}
+
+// objectValues returns an object's values ordered by key, so results are stable
+func objectValues(object map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = object[key]
+	}
+	return values
+}
+
+// truthy reports whether a value is true in JMESPath: anything but null,
+// false, and empty strings, arrays and objects
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// compare applies a comparator. Equality compares any values; ordering
+// compares two numbers or two strings and is null otherwise.
+func compare(op tokenType, left, right interface{}) interface{} {
+	switch op {
+	case tEQ:
+		return equal(left, right)
+	case tNE:
+		return !equal(left, right)
+	}
+
+	var order int
+	if l, ok := number(left); ok {
+		r, ok := number(right)
+		if !ok {
+			return nil
+		}
+		switch {
+		case l < r:
+			order = -1
+		case l > r:
+			order = 1
+		}
+	} else if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			return nil
+		}
+		order = strings.Compare(l, r)
+	} else {
+		return nil
+	}
+
+	switch op {
+	case tLT:
+		return order < 0
+	case tLE:
+		return order <= 0
+	case tGT:
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// equal compares decoded JSON values, treating numbers by value
+func equal(left, right interface{}) bool {
+	if l, ok := number(left); ok {
+		r, ok := number(right)
+		return ok && l == r
+	}
+	switch l := left.(type) {
+	case []interface{}:
+		r, ok := right.([]interface{})
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for i := range l {
+			if !equal(l[i], r[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		r, ok := right.(map[string]interface{})
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for key, value := range l {
+			other, ok := r[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case string:
+		r, ok := right.(string)
+		return ok && l == r
+	case bool:
+		r, ok := right.(bool)
+		return ok && l == r
+	case nil:
+		return right == nil
+	}
+	return false
+}
@@ -0,0 +1,476 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// function is a built-in function; variadic functions accept any number of
+// arguments from minArgs
+type function struct {
+	minArgs  int
+	maxArgs  int
+	variadic bool
+	call     func(name string, args []interface{}) (interface{}, error)
+}
+
+// functions are the JMESPath built-ins
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"abs":         {1, 1, false, mathFunction(math.Abs)},
+		"avg":         {1, 1, false, fnAvg},
+		"ceil":        {1, 1, false, mathFunction(math.Ceil)},
+		"contains":    {2, 2, false, fnContains},
+		"ends_with":   {2, 2, false, fnEndsWith},
+		"floor":       {1, 1, false, mathFunction(math.Floor)},
+		"join":        {2, 2, false, fnJoin},
+		"keys":        {1, 1, false, fnKeys},
+		"length":      {1, 1, false, fnLength},
+		"map":         {2, 2, false, fnMap},
+		"max":         {1, 1, false, extremeFunction(1)},
+		"max_by":      {2, 2, false, extremeByFunction(1)},
+		"merge":       {1, 0, true, fnMerge},
+		"min":         {1, 1, false, extremeFunction(-1)},
+		"min_by":      {2, 2, false, extremeByFunction(-1)},
+		"not_null":    {1, 0, true, fnNotNull},
+		"reverse":     {1, 1, false, fnReverse},
+		"sort":        {1, 1, false, fnSort},
+		"sort_by":     {2, 2, false, fnSortBy},
+		"starts_with": {2, 2, false, fnStartsWith},
+		"sum":         {1, 1, false, fnSum},
+		"to_array":    {1, 1, false, fnToArray},
+		"to_number":   {1, 1, false, fnToNumber},
+		"to_string":   {1, 1, false, fnToString},
+		"type":        {1, 1, false, fnType},
+		"values":      {1, 1, false, fnValues},
+	}
+}
+
+// callFunction calls a built-in after checking its argument count
+func callFunction(name string, args []interface{}) (interface{}, error) {
+	f, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s()", name)
+	}
+	switch {
+	case f.variadic && len(args) < f.minArgs:
+		return nil, fmt.Errorf("%s() takes at least %d arguments, got %d", name, f.minArgs, len(args))
+	case !f.variadic && (len(args) < f.minArgs || len(args) > f.maxArgs):
+		return nil, fmt.Errorf("%s() takes %d arguments, got %d", name, f.minArgs, len(args))
+	}
+	return f.call(name, args)
+}
+
+// typeOf returns the JMESPath type name of a value
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case expref:
+		return "expref"
+	}
+	if _, ok := number(value); ok {
+		return "number"
+	}
+	return "unknown"
+}
+
+// typeError reports an argument of the wrong type
+func typeError(name string, expected string, value interface{}) error {
+	return fmt.Errorf("invalid argument to %s(): expected %s, got %s", name, expected, typeOf(value))
+}
+
+func arrayArg(name string, value interface{}) ([]interface{}, error) {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, typeError(name, "array", value)
+	}
+	return array, nil
+}
+
+func stringArg(name string, value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", typeError(name, "string", value)
+	}
+	return s, nil
+}
+
+func objectArg(name string, value interface{}) (map[string]interface{}, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, typeError(name, "object", value)
+	}
+	return object, nil
+}
+
+func exprefArg(name string, value interface{}) (node, error) {
+	e, ok := value.(expref)
+	if !ok {
+		return node{}, typeError(name, "expression (&expr)", value)
+	}
+	return e.node, nil
+}
+
+// mathFunction applies f to a number
+func mathFunction(f func(float64) float64) func(string, []interface{}) (interface{}, error) {
+	return func(name string, args []interface{}) (interface{}, error) {
+		n, ok := number(args[0])
+		if !ok {
+			return nil, typeError(name, "number", args[0])
+		}
+		return f(n), nil
+	}
+}
+
+func fnAvg(name string, args []interface{}) (interface{}, error) {
+	array, err := arrayArg(name, args[0])
+	if err != nil || len(array) == 0 {
+		return nil, err
+	}
+	sum, err := fnSum(name, args)
+	if err != nil {
+		return nil, err
+	}
+	return sum.(float64) / float64(len(array)), nil
+}
+
+func fnSum(name string, args []interface{}) (interface{}, error) {
+	array, err := arrayArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	sum := 0.0
+	for _, element := range array {
+		n, ok := number(element)
+		if !ok {
+			return nil, typeError(name, "array of numbers", args[0])
+		}
+		sum += n
+	}
+	return sum, nil
+}
+
+func fnContains(name string, args []interface{}) (interface{}, error) {
+	switch subject := args[0].(type) {
+	case string:
+		search, ok := args[1].(string)
+		return ok && strings.Contains(subject, search), nil
+	case []interface{}:
+		for _, element := range subject {
+			if equal(element, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return nil, typeError(name, "string or array", args[0])
+}
+
+func fnStartsWith(name string, args []interface{}) (interface{}, error) {
+	subject, err := stringArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := stringArg(name, args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasPrefix(subject, prefix), nil
+}
+
+func fnEndsWith(name string, args []interface{}) (interface{}, error) {
+	subject, err := stringArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	suffix, err := stringArg(name, args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasSuffix(subject, suffix), nil
+}
+
+func fnJoin(name string, args []interface{}) (interface{}, error) {
+	separator, err := stringArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	array, err := arrayArg(name, args[1])
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(array))
+	for i, element := range array {
+		s, ok := element.(string)
+		if !ok {
+			return nil, typeError(name, "array of strings", args[1])
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, separator), nil
+}
+
+func fnKeys(name string, args []interface{}) (interface{}, error) {
+	object, err := objectArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]interface{}, len(keys))
+	for i, key := range keys {
+		result[i] = key
+	}
+	return result, nil
+}
+
+func fnValues(name string, args []interface{}) (interface{}, error) {
+	object, err := objectArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return objectValues(object), nil
+}
+
+func fnLength(name string, args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return nil, typeError(name, "string, array or object", args[0])
+}
+
+func fnMap(name string, args []interface{}) (interface{}, error) {
+	expression, err := exprefArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	array, err := arrayArg(name, args[1])
+	if err != nil {
+		return nil, err
+	}
+	// Unlike projections, map keeps null results
+	results := make([]interface{}, len(array))
+	for i, element := range array {
+		if results[i], err = eval(expression, element); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func fnMerge(name string, args []interface{}) (interface{}, error) {
+	merged := map[string]interface{}{}
+	for _, arg := range args {
+		object, err := objectArg(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range object {
+			merged[key] = value
+		}
+	}
+	return merged, nil
+}
+
+func fnNotNull(name string, args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+func fnReverse(name string, args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		runes := []rune(v)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	case []interface{}:
+		reversed := make([]interface{}, len(v))
+		for i, element := range v {
+			reversed[len(v)-1-i] = element
+		}
+		return reversed, nil
+	}
+	return nil, typeError(name, "string or array", args[0])
+}
+
+// sortKeys checks that keys are all numbers or all strings, as sort and the
+// *_by functions require
+func sortKeys(name string, keys []interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	kind := typeOf(keys[0])
+	if kind != "number" && kind != "string" {
+		return typeError(name, "numbers or strings", keys[0])
+	}
+	for _, key := range keys[1:] {
+		if typeOf(key) != kind {
+			return fmt.Errorf("invalid argument to %s(): cannot compare %s and %s", name, kind, typeOf(key))
+		}
+	}
+	return nil
+}
+
+// less orders two numbers or two strings
+func less(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, _ := number(b)
+		return x < y
+	}
+	return a.(string) < b.(string)
+}
+
+func fnSort(name string, args []interface{}) (interface{}, error) {
+	array, err := arrayArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := sortKeys(name, array); err != nil {
+		return nil, err
+	}
+	sorted := make([]interface{}, len(array))
+	copy(sorted, array)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted, nil
+}
+
+// keysBy evaluates the expression argument against each element of the
+// array argument
+func keysBy(name string, args []interface{}) ([]interface{}, []interface{}, error) {
+	array, err := arrayArg(name, args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	expression, err := exprefArg(name, args[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([]interface{}, len(array))
+	for i, element := range array {
+		if keys[i], err = eval(expression, element); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := sortKeys(name, keys); err != nil {
+		return nil, nil, err
+	}
+	return array, keys, nil
+}
+
+func fnSortBy(name string, args []interface{}) (interface{}, error) {
+	array, keys, err := keysBy(name, args)
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, len(array))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return less(keys[order[i]], keys[order[j]]) })
+	sorted := make([]interface{}, len(array))
+	for i, index := range order {
+		sorted[i] = array[index]
+	}
+	return sorted, nil
+}
+
+// extremeFunction returns max (sign 1) or min (sign -1) of an array
+func extremeFunction(sign int) func(string, []interface{}) (interface{}, error) {
+	return func(name string, args []interface{}) (interface{}, error) {
+		array, err := arrayArg(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := sortKeys(name, array); err != nil || len(array) == 0 {
+			return nil, err
+		}
+		best := array[0]
+		for _, element := range array[1:] {
+			if (sign > 0 && less(best, element)) || (sign < 0 && less(element, best)) {
+				best = element
+			}
+		}
+		return best, nil
+	}
+}
+
+// extremeByFunction returns max_by (sign 1) or min_by (sign -1)
+func extremeByFunction(sign int) func(string, []interface{}) (interface{}, error) {
+	return func(name string, args []interface{}) (interface{}, error) {
+		array, keys, err := keysBy(name, args)
+		if err != nil || len(array) == 0 {
+			return nil, err
+		}
+		best := 0
+		for i := 1; i < len(array); i++ {
+			if (sign > 0 && less(keys[best], keys[i])) || (sign < 0 && less(keys[i], keys[best])) {
+				best = i
+			}
+		}
+		return array[best], nil
+	}
+}
+
+func fnToArray(name string, args []interface{}) (interface{}, error) {
+	if array, ok := args[0].([]interface{}); ok {
+		return array, nil
+	}
+	return []interface{}{args[0]}, nil
+}
+
+func fnToNumber(name string, args []interface{}) (interface{}, error) {
+	if _, ok := number(args[0]); ok {
+		return args[0], nil
+	}
+	if s, ok := args[0].(string); ok {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n, nil
+		}
+	}
+	return nil, nil
+}
+
+func fnToString(name string, args []interface{}) (interface{}, error) {
+	if s, ok := args[0].(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid argument to %s(): %w", name, err)
+	}
+	return string(data), nil
+}
+
+func fnType(name string, args []interface{}) (interface{}, error) {
+	return typeOf(args[0]), nil
+}
@@ -0,0 +1,80 @@
+// Package jmespath evaluates JMESPath expressions, such as
+// "value[?accountEnabled==`false`].userPrincipalName", against decoded JSON.
+//
+// It implements the JMESPath grammar and built-in functions. Besides numbers,
+// the ordering comparators also compare strings, so ISO 8601 timestamps can be
+// filtered with expressions like "[?receivedDateTime > '2024-06-01']".
+package jmespath
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Expression is a compiled JMESPath expression
+type Expression struct {
+	text string
+	root node
+}
+
+// Compile parses an expression
+func Compile(expression string) (*Expression, error) {
+	tokens, err := lex(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{expression: expression, tokens: tokens}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{text: expression, root: root}, nil
+}
+
+// String returns the expression's source text
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Search evaluates the expression against data decoded by encoding/json:
+// map[string]interface{}, []interface{}, string, float64 or json.Number, bool
+// and nil. Numbers computed by functions are float64.
+func (e *Expression) Search(data interface{}) (interface{}, error) {
+	return eval(e.root, data)
+}
+
+// Search compiles and evaluates an expression
+func Search(expression string, data interface{}) (interface{}, error) {
+	e, err := Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	return e.Search(data)
+}
+
+// SyntaxError reports an invalid expression
+type SyntaxError struct {
+	Expression string
+	// Offset is the byte offset of the error in Expression
+	Offset  int
+	Message string
+}
+
+// Error formats the error with a caret under the offending position
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s\n  %s\n  %*s", e.Offset, e.Message, e.Expression, e.Offset+1, "^")
+}
+
+// number returns v as a float64 when it is a JSON number
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
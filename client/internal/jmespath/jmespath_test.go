@@ -0,0 +1,498 @@
+package jmespath_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ms_graph/internal/jmespath"
+)
+
+// searchCase evaluates expression against data, both JSON, and expects the
+// JSON result want
+type searchCase struct {
+	expression string
+	data       string
+	want       string
+}
+
+// decode parses JSON test data
+func decode(t *testing.T, data string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("invalid test JSON %s: %v", data, err)
+	}
+	return value
+}
+
+func runSearchCases(t *testing.T, cases []searchCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.expression, func(t *testing.T) {
+			got, err := jmespath.Search(tc.expression, decode(t, tc.data))
+			if err != nil {
+				t.Fatalf("Search(%q): %v", tc.expression, err)
+			}
+			// Literals hold json.Number, so compare the JSON encodings'
+			// decoded values
+			gotJSON, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("Search(%q) returned %#v, which is not JSON: %v", tc.expression, got, err)
+			}
+			if !reflect.DeepEqual(decode(t, string(gotJSON)), decode(t, tc.want)) {
+				t.Errorf("Search(%q) = %s, want %s", tc.expression, gotJSON, tc.want)
+			}
+		})
+	}
+}
+
+const people = `{"people": [
+	{"name": "Adele", "age": 30, "mail": "adele@contoso.com", "tags": ["a", "b"]},
+	{"name": "Alex", "age": 25, "mail": null, "tags": ["c"]},
+	{"name": "Diego", "age": 40, "tags": []}
+]}`
+
+func TestSearchIdentifiers(t *testing.T) {
+	runSearchCases(t, []searchCase{
+		{"foo", `{"foo": "value"}`, `"value"`},
+		{"bar", `{"foo": "value"}`, `null`},
+		{"foo.bar.baz", `{"foo": {"bar": {"baz": "correct"}}}`, `"correct"`},
+		{"foo.bar.missing", `{"foo": {"bar": {"baz": "correct"}}}`, `null`},
+		{"foo.bar", `{"foo": "not an object"}`, `null`},
+		{`"with space"`, `{"with space": 1}`, `1`},
+		{`"\"quoted\""`, `{"\"quoted\"": 2}`, `2`},
+		{`"été"`, `{"été": 3}`, `3`},
+		{"foo", `[1, 2]`, `null`},
+		{"@", `{"foo": 1}`, `{"foo": 1}`},
+		{"foo.length(@)", `{"foo": [1, 2]}`, `2`},
+	})
+}
+
+func TestSearchIndexesAndSlices(t *testing.T) {
+	const data = `{"a": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9]}`
+	runSearchCases(t, []searchCase{
+		{"a[0]", data, `0`},
+		{"a[9]", data, `9`},
+		{"a[10]", data, `null`},
+		{"a[-1]", data, `9`},
+		{"a[-10]", data, `0`},
+		{"a[-11]", data, `null`},
+		{"a[0:3]", data, `[0, 1, 2]`},
+		{"a[:3]", data, `[0, 1, 2]`},
+		{"a[7:]", data, `[7, 8, 9]`},
+		{"a[::3]", data, `[0, 3, 6, 9]`},
+		{"a[1:8:2]", data, `[1, 3, 5, 7]`},
+		{"a[::-1]", data, `[9, 8, 7, 6, 5, 4, 3, 2, 1, 0]`},
+		{"a[-3:]", data, `[7, 8, 9]`},
+		{"a[8:2:-2]", data, `[8, 6, 4]`},
+		{"a[100:]", data, `[]`},
+		{"a[:-100]", data, `[]`},
+		{"a[3:1]", data, `[]`},
+		{"a[0:2].foo", data, `[]`},
+		{"[0]", `[["x"]]`, `["x"]`},
+		{"foo[0]", `{"foo": "not an array"}`, `null`},
+		{"foo[0:1]", `{"foo": {"bar": 1}}`, `null`},
+	})
+}
+
+func TestSearchProjections(t *testing.T) {
+	runSearchCases(t, []searchCase{
+		{"people[*].name", people, `["Adele", "Alex", "Diego"]`},
+		// Null results are dropped from projections
+		{"people[*].mail", people, `["adele@contoso.com"]`},
+		{"people[*]", people, `[{"name": "Adele", "age": 30, "mail": "adele@contoso.com", "tags": ["a", "b"]},
+			{"name": "Alex", "age": 25, "mail": null, "tags": ["c"]},
+			{"name": "Diego", "age": 40, "tags": []}]`},
+		{"people[*].tags[0]", people, `["a", "c"]`},
+		{"people[:2].name", people, `["Adele", "Alex"]`},
+		{"people[*].missing", people, `[]`},
+		{"people.name", people, `null`},
+		{"missing[*].name", people, `null`},
+		{"people[*].name[0]", people, `[]`},
+		{"*.name", `{"a": {"name": "x"}, "b": {"name": "y"}, "c": {}}`, `["x", "y"]`},
+		{"*", `{"b": 2, "a": 1}`, `[1, 2]`},
+		{"*.*.x", `{"a": {"b": {"x": 1}}, "c": {"d": {"x": 2}}}`, `[[1], [2]]`},
+		{"foo.*", `{"foo": [1, 2]}`, `null`},
+		{"[*][0]", `[[1, 2], [3, 4], []]`, `[1, 3]`},
+	})
+}
+
+func TestSearchFlatten(t *testing.T) {
+	runSearchCases(t, []searchCase{
+		{"people[].tags[]", people, `["a", "b", "c"]`},
+		{"people[].tags", people, `[["a", "b"], ["c"], []]`},
+		{"[]", `[[1, 2], 3, [4, [5]]]`, `[1, 2, 3, 4, [5]]`},
+		{"[][]", `[[1, [2]], [[3]]]`, `[1, 2, 3]`},
+		{"[].name", `[{"name": "a"}, {"other": 1}, {"name": "b"}]`, `["a", "b"]`},
+		{"foo[]", `{"foo": "not an array"}`, `null`},
+		{"people[].tags[0]", people, `["a", "c"]`},
+		{"people[].tags[][0]", people, `[]`},
+		{"reservations[].instances[].state", `{"reservations": [
+			{"instances": [{"state": "running"}, {"state": "stopped"}]},
+			{"instances": [{"state": "terminated"}]}
+		]}`, `["running", "stopped", "terminated"]`},
+	})
+}
+
+func TestSearchFilters(t *testing.T) {
+	runSearchCases(t, []searchCase{
+		{"people[?age > `28`].name", people, `["Adele", "Diego"]`},
+		{"people[?age >= `30`].name", people, `["Adele", "Diego"]`},
+		{"people[?age < `30`].name", people, `["Alex"]`},
+		{"people[?age <= `30`].name", people, `["Adele", "Alex"]`},
+		{"people[?age == `25`].name", people, `["Alex"]`},
+		{"people[?age != `25`].name", people, `["Adele", "Diego"]`},
+		{"people[?name == 'Diego'].age", people, `[40]`},
+		{"people[?mail].name", people, `["Adele"]`},
+		{"people[?!mail].name", people, `["Alex", "Diego"]`},
+		{"people[?mail == `null`].name", people, `["Alex", "Diego"]`},
+		{"people[?tags == `[]`].name", people, `["Diego"]`},
+		{"people[?tags].name", people, `["Adele", "Alex"]`},
+		{"people[?age > `28` && age < `35`].name", people, `["Adele"]`},
+		{"people[?age < `28` || age > `35`].name", people, `["Alex", "Diego"]`},
+		{"people[?!(age > `28`)].name", people, `["Alex"]`},
+		{"people[?contains(tags, 'c')].name", people, `["Alex"]`},
+		{"people[?age > `100`]", people, `[]`},
+		// Ordering a number against a string is null, which is falsy
+		{"people[?name > `1`].name", people, `[]`},
+		{"people[?age > 'a'].name", people, `[]`},
+		// Strings are ordered too, so ISO 8601 timestamps can be filtered
+		{"value[?received > '2024-06-01'].id", `{"value": [
+			{"id": 1, "received": "2024-05-31T23:59:59Z"},
+			{"id": 2, "received": "2024-06-01T08:00:00Z"}
+		]}`, `[2]`},
+		{"people[?name < 'B'].name", people, `["Adele", "Alex"]`},
+		{"[?@ > `1`]", `[1, 2, 3]`, `[2, 3]`},
+		{"[?a == b]", `[{"a": 1, "b": 1}, {"a": 1, "b": 2}, {"a": {"x": [1]}, "b": {"x": [1]}}]`,
+			`[{"a": 1, "b": 1}, {"a": {"x": [1]}, "b": {"x": [1]}}]`},
+		{"foo[?bar]", `{"foo": {"bar": true}}`, `null`},
+		{"people[?age > `28`].tags[]", people, `["a", "b"]`},
+	})
+}
+
+func TestSearchBooleanExpressions(t *testing.T) {
+	const data = `{"t": true, "f": false, "n": null, "e": "", "s": "x", "zero": 0, "arr": [], "obj": {}}`
+	runSearchCases(t, []searchCase{
+		{"t || f", data, `true`},
+		{"f || s", data, `"x"`},
+		{"n || e || arr || obj || zero", data, `0`},
+		{"e || missing", data, `null`},
+		{"t && s", data, `"x"`},
+		{"e && t", data, `""`},
+		{"arr && t", data, `[]`},
+		{"!t", data, `false`},
+		{"!n", data, `true`},
+		{"!zero", data, `false`},
+		{"!obj", data, `true`},
+		{"f || t && n", data, `null`},
+		{"(f || t) && s", data, `"x"`},
+		{"t == `true`", data, `true`},
+		{"zero == `0.0`", data, `true`},
+		{"obj == arr", data, `false`},
+		{"n == missing", data, `true`},
+		{"s < n", data, `null`},
+	})
+}
+
+func TestSearchPipes(t *testing.T) {
+	runSearchCases(t, []searchCase{
+		{"people[*].name | [0]", people, `"Adele"`},
+		// Without the pipe, [0] applies to each projected name
+		{"people[*].name[0]", people, `[]`},
+		{"people[*].tags | [1]", people, `["c"]`},
+		{"people | length(@)", people, `3`},
+		{"people[?age > `28`] | [-1].name", people, `"Diego"`},
+		{"a | b | c", `{"a": {"b": {"c": "deep"}}}`, `"deep"`},
+		{"a.b || c | d", `{"a": {}, "c": {"d": 1}}`, `1`},
+	})
+}
+
+func TestSearchMultiSelect(t *testing.T) {
+	runSearchCases(t, []searchCase{
+		{"[people[0].name, people[1].age]", people, `["Adele", 25]`},
+		{"{first: people[0].name, count: length(people)}", people, `{"first": "Adele", "count": 3}`},
+		{"people[*].[name, age]", people, `[["Adele", 30], ["Alex", 25], ["Diego", 40]]`},
+		{"people[*].{n: name, m: mail}", people, `[
+			{"n": "Adele", "m": "adele@contoso.com"},
+			{"n": "Alex", "m": null},
+			{"n": "Diego", "m": null}
+		]`},
+		{`{"quoted key": a}`, `{"a": 1}`, `{"quoted key": 1}`},
+		{"[a, missing]", `{"a": 1}`, `[1, null]`},
+		{"missing.[a, b]", `{"a": 1}`, `null`},
+		{"missing.{a: a}", `{"a": 1}`, `null`},
+		{"[[a, b], {c: c}]", `{"a": 1, "b": 2, "c": 3}`, `[[1, 2], {"c": 3}]`},
+		{"value[*].{id: id, to: toRecipients[].emailAddress.address}", `{"value": [
+			{"id": "m1", "toRecipients": [{"emailAddress": {"address": "a@contoso.com"}}, {"emailAddress": {"address": "b@contoso.com"}}]}
+		]}`, `[{"id": "m1", "to": ["a@contoso.com", "b@contoso.com"]}]`},
+	})
+}
+
+func TestSearchLiterals(t *testing.T) {
+	runSearchCases(t, []searchCase{
+		{"`\"json string\"`", `{}`, `"json string"`},
+		{"`1.5`", `{}`, `1.5`},
+		{"`true`", `{}`, `true`},
+		{"`null`", `{}`, `null`},
+		{"`[1, \"two\", {\"three\": 3}]`", `{}`, `[1, "two", {"three": 3}]`},
+		{"`{\"a\": [true]}`", `{}`, `{"a": [true]}`},
+		{"`\"a\\`b\"`", `{}`, "\"a`b\""},
+		{"'raw string'", `{}`, `"raw string"`},
+		{`'it\'s'`, `{}`, `"it's"`},
+		// Raw strings only unescape quotes
+		{`'a\nb'`, `{}`, `"a\\nb"`},
+		{`'\\'`, `{}`, `"\\\\"`},
+		{"''", `{}`, `""`},
+		// Literals that are not JSON are strings, as in JMESPath's legacy syntax
+		{"`foo`", `{}`, `"foo"`},
+		{"`1` == `1.0`", `{}`, `true`},
+		{"'1' == `1`", `{}`, `false`},
+		{"`[]` || 'fallback'", `{}`, `"fallback"`},
+	})
+}
+
+func TestSearchFunctions(t *testing.T) {
+	const numbers = `{"n": [4, -1.5, 10, 2], "empty": [], "s": ["b", "c", "a"], "mixed": [1, "a"], "neg": -3.7}`
+	runSearchCases(t, []searchCase{
+		{"abs(`-2`)", `{}`, `2`},
+		{"abs(neg)", numbers, `3.7`},
+		{"avg(n)", numbers, `3.625`},
+		{"avg(empty)", numbers, `null`},
+		{"ceil(`1.2`)", `{}`, `2`},
+		{"ceil(neg)", numbers, `-3`},
+		{"contains('foobar', 'oba')", `{}`, `true`},
+		{"contains('foobar', 'baz')", `{}`, `false`},
+		{"contains('foobar', `1`)", `{}`, `false`},
+		{"contains(s, 'a')", numbers, `true`},
+		{"contains(n, `10`)", numbers, `true`},
+		{"contains(n, '10')", numbers, `false`},
+		{"ends_with('report.pdf', '.pdf')", `{}`, `true`},
+		{"ends_with('report.pdf', '.doc')", `{}`, `false`},
+		{"floor(`1.8`)", `{}`, `1`},
+		{"floor(neg)", numbers, `-4`},
+		{"join(', ', s)", numbers, `"b, c, a"`},
+		{"join('-', empty)", numbers, `""`},
+		{"keys(@)", `{"b": 1, "a": 2}`, `["a", "b"]`},
+		{"keys(@)", `{}`, `[]`},
+		{"length('héllo')", `{}`, `5`},
+		{"length(n)", numbers, `4`},
+		{"length(@)", `{"a": 1, "b": 2}`, `2`},
+		{"map(&name, people)", people, `["Adele", "Alex", "Diego"]`},
+		// Unlike a projection, map keeps null results
+		{"map(&mail, people)", people, `["adele@contoso.com", null, null]`},
+		{"map(&[0], `[[1], [], [3]]`)", `{}`, `[1, null, 3]`},
+		{"max(n)", numbers, `10`},
+		{"max(s)", numbers, `"c"`},
+		{"max(empty)", numbers, `null`},
+		{"max_by(people, &age).name", people, `"Diego"`},
+		{"max_by(people, &name).name", people, `"Diego"`},
+		{"max_by(empty, &age)", numbers, `null`},
+		{"merge(`{\"a\": 1, \"b\": 1}`, `{\"b\": 2}`, `{\"c\": 3}`)", `{}`, `{"a": 1, "b": 2, "c": 3}`},
+		{"merge(`{}`)", `{}`, `{}`},
+		{"min(n)", numbers, `-1.5`},
+		{"min(s)", numbers, `"a"`},
+		{"min(empty)", numbers, `null`},
+		{"min_by(people, &age).name", people, `"Alex"`},
+		{"min_by(people, &name).name", people, `"Adele"`},
+		{"not_null(missing, people[1].mail, `0`, 'x')", people, `0`},
+		{"not_null(missing, people[1].mail)", people, `null`},
+		{"reverse(n)", numbers, `[2, 10, -1.5, 4]`},
+		{"reverse('héllo')", `{}`, `"olléh"`},
+		{"reverse(empty)", numbers, `[]`},
+		{"sort(n)", numbers, `[-1.5, 2, 4, 10]`},
+		{"sort(s)", numbers, `["a", "b", "c"]`},
+		{"sort(empty)", numbers, `[]`},
+		{"sort_by(people, &age)[*].name", people, `["Alex", "Adele", "Diego"]`},
+		{"sort_by(people, &name)[*].name", people, `["Adele", "Alex", "Diego"]`},
+		// sort_by is stable
+		{"sort_by(@, &k)[*].id", `[{"k": 2, "id": 1}, {"k": 1, "id": 2}, {"k": 2, "id": 3}, {"k": 1, "id": 4}]`, `[2, 4, 1, 3]`},
+		{"starts_with('/me/messages', '/me')", `{}`, `true`},
+		{"starts_with('/users', '/me')", `{}`, `false`},
+		{"sum(n)", numbers, `14.5`},
+		{"sum(empty)", numbers, `0`},
+		{"to_array(`1`)", `{}`, `[1]`},
+		{"to_array(n)", numbers, `[4, -1.5, 10, 2]`},
+		{"to_array(`null`)", `{}`, `[null]`},
+		{"to_number('12.5')", `{}`, `12.5`},
+		{"to_number(`3`)", `{}`, `3`},
+		{"to_number('abc')", `{}`, `null`},
+		{"to_number(`true`)", `{}`, `null`},
+		{"to_string('x')", `{}`, `"x"`},
+		{"to_string(`2`)", `{}`, `"2"`},
+		{"to_string(`[1,2]`)", `{}`, `"[1,2]"`},
+		{"to_string(`null`)", `{}`, `"null"`},
+		{"type('x')", `{}`, `"string"`},
+		{"type(`1`)", `{}`, `"number"`},
+		{"type(`true`)", `{}`, `"boolean"`},
+		{"type(`null`)", `{}`, `"null"`},
+		{"type(n)", numbers, `"array"`},
+		{"type(@)", `{}`, `"object"`},
+		{"values(@)", `{"b": 2, "a": 1}`, `[1, 2]`},
+		{"people[*].name | sort(@) | reverse(@) | join(',', @)", people, `"Diego,Alex,Adele"`},
+		{"length(people[?age > `28`])", people, `2`},
+	})
+}
+
+func TestSearchJSONNumbers(t *testing.T) {
+	// Data decoded with UseNumber holds json.Number rather than float64
+	decoder := json.NewDecoder(strings.NewReader(`{"items": [{"size": 10}, {"size": 200}, {"size": 3}]}`))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expression string
+		want       interface{}
+	}{
+		{"items[?size > `5`].size", []interface{}{json.Number("10"), json.Number("200")}},
+		{"sum(items[*].size)", 213.0},
+		{"max_by(items, &size).size", json.Number("200")},
+		{"items[?size == `3`] | length(@)", 1.0},
+		{"type(items[0].size)", "number"},
+	}
+	for _, tc := range tests {
+		got, err := jmespath.Search(tc.expression, data)
+		if err != nil {
+			t.Errorf("Search(%q): %v", tc.expression, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Search(%q) = %#v, want %#v", tc.expression, got, tc.want)
+		}
+	}
+}
+
+func TestCompileSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		offset     int
+	}{
+		{"", 0},
+		{"foo.", 4},
+		{".foo", 0},
+		{"foo..bar", 4},
+		{"foo[", 4},
+		{"foo[0", 5},
+		{"foo[a]", 4},
+		{"foo]", 3},
+		{"foo[?]", 5},
+		{"foo[?bar", 8},
+		{"foo[::0]", 6},
+		{"foo[1:2:3:4]", 9},
+		{"[a, ]", 4},
+		{"{a}", 2},
+		{"{a: b,}", 6},
+		{"{1: a}", 1},
+		{"foo |", 5},
+		{"foo ||", 6},
+		{"!", 1},
+		{"(foo", 4},
+		{"foo)", 3},
+		{"foo bar", 4},
+		{"'unterminated", 0},
+		{"`unterminated", 0},
+		{`"unterminated`, 0},
+		{`"bad \q escape"`, 0},
+		{"foo = bar", 4},
+		{"foo & bar", 4},
+		{"#", 0},
+		{"length(", 7},
+		{"length(@", 8},
+		{"foo.&bar", 4},
+		{"foo.'bar'", 4},
+		{"foo.`1`", 4},
+		{"'a'(@)", 3},
+	}
+	for _, tc := range tests {
+		_, err := jmespath.Compile(tc.expression)
+		var syntaxErr *jmespath.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Compile(%q) error = %v, want a SyntaxError", tc.expression, err)
+			continue
+		}
+		if syntaxErr.Offset != tc.offset {
+			t.Errorf("Compile(%q) error at %d, want %d: %v", tc.expression, syntaxErr.Offset, tc.offset, err)
+		}
+		if !strings.Contains(err.Error(), tc.expression) {
+			t.Errorf("Compile(%q) error %q does not quote the expression", tc.expression, err)
+		}
+	}
+}
+
+func TestSearchRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		data       string
+		message    string
+	}{
+		{"unknown(@)", `{}`, "unknown function unknown()"},
+		{"length(@, @)", `{}`, "length() takes 1 arguments, got 2"},
+		{"abs()", `{}`, "abs() takes 1 arguments, got 0"},
+		{"merge()", `{}`, "merge() takes at least 1 arguments, got 0"},
+		{"not_null()", `{}`, "not_null() takes at least 1 arguments, got 0"},
+		{"abs('x')", `{}`, "invalid argument to abs(): expected number, got string"},
+		{"avg(`[1, \"a\"]`)", `{}`, "invalid argument to avg(): expected array of numbers, got array"},
+		{"ceil(`null`)", `{}`, "invalid argument to ceil(): expected number, got null"},
+		{"contains(`1`, `1`)", `{}`, "invalid argument to contains(): expected string or array, got number"},
+		{"ends_with(`1`, 'x')", `{}`, "invalid argument to ends_with(): expected string, got number"},
+		{"floor('1')", `{}`, "invalid argument to floor(): expected number, got string"},
+		{"join(`1`, @)", `[]`, "invalid argument to join(): expected string, got number"},
+		{"join(',', `[1]`)", `{}`, "invalid argument to join(): expected array of strings, got array"},
+		{"keys(@)", `[]`, "invalid argument to keys(): expected object, got array"},
+		{"length(`1`)", `{}`, "invalid argument to length(): expected string, array or object, got number"},
+		{"map(name, @)", `[]`, "invalid argument to map(): expected expression (&expr), got null"},
+		{"map(&a, @)", `{}`, "invalid argument to map(): expected array, got object"},
+		{"max(`[1, \"a\"]`)", `{}`, "invalid argument to max(): cannot compare number and string"},
+		{"max(`[true]`)", `{}`, "invalid argument to max(): expected numbers or strings, got boolean"},
+		{"max_by(@, &a)", `[{"a": 1}, {"a": "x"}]`, "invalid argument to max_by(): cannot compare number and string"},
+		{"merge(`{}`, `1`)", `{}`, "invalid argument to merge(): expected object, got number"},
+		{"min('abc')", `{}`, "invalid argument to min(): expected array, got string"},
+		{"min_by(@, a)", `[]`, "invalid argument to min_by(): expected expression (&expr), got null"},
+		{"reverse(`1`)", `{}`, "invalid argument to reverse(): expected string or array, got number"},
+		{"sort(@)", `[1, "a"]`, "invalid argument to sort(): cannot compare number and string"},
+		{"sort(@)", `[{}]`, "invalid argument to sort(): expected numbers or strings, got object"},
+		{"sort_by(@, &a)", `[{"a": 1}, {}]`, "invalid argument to sort_by(): cannot compare number and null"},
+		{"starts_with('x', `null`)", `{}`, "invalid argument to starts_with(): expected string, got null"},
+		{"sum(@)", `{}`, "invalid argument to sum(): expected array, got object"},
+		{"values(@)", `"x"`, "invalid argument to values(): expected object, got string"},
+		// Errors inside projections and filters propagate
+		{"[*].length(@)", `["a", 1]`, "invalid argument to length(): expected string, array or object, got number"},
+		{"[?abs(@) > `1`]", `[1, "a"]`, "invalid argument to abs(): expected number, got string"},
+	}
+	for _, tc := range tests {
+		_, err := jmespath.Search(tc.expression, decode(t, tc.data))
+		if err == nil {
+			t.Errorf("Search(%q) succeeded, want error %q", tc.expression, tc.message)
+			continue
+		}
+		if err.Error() != tc.message {
+			t.Errorf("Search(%q) error = %q, want %q", tc.expression, err, tc.message)
+		}
+	}
+}
+
+func TestExpressionString(t *testing.T) {
+	const text = "people[?age > `28`].name"
+	e, err := jmespath.Compile(text)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if e.String() != text {
+		t.Errorf("String() = %q, want %q", e.String(), text)
+	}
+	// A compiled expression can be evaluated repeatedly
+	for i := 0; i < 2; i++ {
+		got, err := e.Search(decode(t, people))
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if !reflect.DeepEqual(got, []interface{}{"Adele", "Diego"}) {
+			t.Errorf("Search = %v", got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenType identifies a lexical token
+type tokenType int
+
+const (
+	tEOF tokenType = iota
+	tUnquoted
+	tQuoted
+	tRawString
+	tLiteral
+	tNumber
+	tDot
+	tStar
+	tComma
+	tColon
+	tPipe
+	tOr
+	tAnd
+	tNot
+	tLParen
+	tRParen
+	tLBracket
+	tRBracket
+	tLBrace
+	tRBrace
+	tFilter
+	tFlatten
+	tCurrent
+	tExpref
+	tEQ
+	tNE
+	tLT
+	tLE
+	tGT
+	tGE
+)
+
+// token is a lexical token; value holds the decoded identifier, string,
+// number or literal
+type token struct {
+	typ    tokenType
+	value  interface{}
+	offset int
+}
+
+// String describes a token for syntax errors
+func (t token) String() string {
+	switch t.typ {
+	case tEOF:
+		return "end of query"
+	case tUnquoted, tQuoted:
+		return fmt.Sprintf("identifier %q", t.value)
+	case tRawString:
+		return fmt.Sprintf("string %q", t.value)
+	case tLiteral:
+		return "literal"
+	case tNumber:
+		return fmt.Sprintf("number %d", t.value)
+	}
+	for symbol, typ := range symbols {
+		if typ == t.typ {
+			return fmt.Sprintf("%q", symbol)
+		}
+	}
+	return "token"
+}
+
+// symbols maps punctuation to token types; longer symbols are matched first
+var symbols = map[string]tokenType{
+	".": tDot, "*": tStar, ",": tComma, ":": tColon, "|": tPipe, "||": tOr,
+	"&&": tAnd, "!": tNot, "(": tLParen, ")": tRParen, "[": tLBracket,
+	"]": tRBracket, "{": tLBrace, "}": tRBrace, "[?": tFilter, "[]": tFlatten,
+	"@": tCurrent, "&": tExpref, "==": tEQ, "!=": tNE, "<": tLT, "<=": tLE,
+	">": tGT, ">=": tGE,
+}
+
+// lex splits an expression into tokens, ending with tEOF
+func lex(expression string) ([]token, error) {
+	var tokens []token
+	syntaxError := func(offset int, format string, args ...interface{}) error {
+		return &SyntaxError{Expression: expression, Offset: offset, Message: fmt.Sprintf(format, args...)}
+	}
+
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '_' || isLetter(c):
+			start := i
+			for i < len(expression) && (expression[i] == '_' || isLetter(expression[i]) || isDigit(expression[i])) {
+				i++
+			}
+			tokens = append(tokens, token{typ: tUnquoted, value: expression[start:i], offset: start})
+
+		case isDigit(c) || (c == '-' && i+1 < len(expression) && isDigit(expression[i+1])):
+			start := i
+			i++
+			for i < len(expression) && isDigit(expression[i]) {
+				i++
+			}
+			n, err := strconv.Atoi(expression[start:i])
+			if err != nil {
+				return nil, syntaxError(start, "invalid number %s", expression[start:i])
+			}
+			tokens = append(tokens, token{typ: tNumber, value: n, offset: start})
+
+		case c == '"':
+			end, err := closingQuote(expression, i, '"')
+			if err != nil {
+				return nil, syntaxError(i, "unterminated quoted identifier")
+			}
+			var name string
+			if err := json.Unmarshal([]byte(expression[i:end+1]), &name); err != nil {
+				return nil, syntaxError(i, "invalid quoted identifier: %v", err)
+			}
+			tokens = append(tokens, token{typ: tQuoted, value: name, offset: i})
+			i = end + 1
+
+		case c == '\'':
+			end, err := closingQuote(expression, i, '\'')
+			if err != nil {
+				return nil, syntaxError(i, "unterminated raw string")
+			}
+			value := strings.ReplaceAll(expression[i+1:end], `\'`, `'`)
+			tokens = append(tokens, token{typ: tRawString, value: value, offset: i})
+			i = end + 1
+
+		case c == '`':
+			end, err := closingQuote(expression, i, '`')
+			if err != nil {
+				return nil, syntaxError(i, "unterminated literal")
+			}
+			text := strings.TrimSpace(strings.ReplaceAll(expression[i+1:end], "\\`", "`"))
+			value, err := decodeLiteral(text)
+			if err != nil {
+				return nil, syntaxError(i, "invalid literal: %v", err)
+			}
+			tokens = append(tokens, token{typ: tLiteral, value: value, offset: i})
+			i = end + 1
+
+		default:
+			matched := ""
+			for symbol := range symbols {
+				if strings.HasPrefix(expression[i:], symbol) && len(symbol) > len(matched) {
+					matched = symbol
+				}
+			}
+			if matched == "" {
+				if c == '=' {
+					return nil, syntaxError(i, "unexpected \"=\" (use \"==\" to compare)")
+				}
+				return nil, syntaxError(i, "unexpected character %q", c)
+			}
+			tokens = append(tokens, token{typ: symbols[matched], offset: i})
+			i += len(matched)
+		}
+	}
+	return append(tokens, token{typ: tEOF, offset: len(expression)}), nil
+}
+
+// closingQuote returns the index of the quote closing the one at start,
+// skipping backslash escapes
+func closingQuote(expression string, start int, quote byte) (int, error) {
+	for i := start + 1; i < len(expression); i++ {
+		switch expression[i] {
+		case '\\':
+			i++
+		case quote:
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated")
+}
+
+// decodeLiteral decodes the JSON in a `literal`. Text that is not JSON is
+// taken as a string, as older JMESPath versions did.
+func decodeLiteral(text string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		return value, nil
+	}
+	if text == "" {
+		return nil, fmt.Errorf("empty literal")
+	}
+	return text, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,406 @@
+package jmespath
+
+import "fmt"
+
+// nodeType identifies an AST node
+type nodeType int
+
+const (
+	nField nodeType = iota
+	nSubexpression
+	nIndex
+	nSlice
+	nProjection
+	nValueProjection
+	nFilterProjection
+	nFlatten
+	nComparator
+	nOr
+	nAnd
+	nNot
+	nLiteral
+	nCurrent
+	nMultiSelectList
+	nMultiSelectHash
+	nPipe
+	nFunction
+	nExpref
+)
+
+// node is an expression's abstract syntax tree. value holds a field or
+// function name, an index, slice bounds, a comparator or a literal; hash
+// keys are in keys, parallel to children.
+type node struct {
+	typ      nodeType
+	value    interface{}
+	keys     []string
+	children []node
+}
+
+// sliceBounds are the start, stop and step of a slice; nil means omitted
+type sliceBounds [3]*int
+
+// bindingPowers are the Pratt parser's left binding powers
+var bindingPowers = map[tokenType]int{
+	tPipe:     1,
+	tOr:       2,
+	tAnd:      3,
+	tEQ:       5,
+	tNE:       5,
+	tLT:       5,
+	tLE:       5,
+	tGT:       5,
+	tGE:       5,
+	tFlatten:  9,
+	tStar:     20,
+	tFilter:   21,
+	tDot:      40,
+	tNot:      45,
+	tLBrace:   50,
+	tLBracket: 55,
+	tLParen:   60,
+}
+
+// parser is a Pratt parser over a token list
+type parser struct {
+	expression string
+	tokens     []token
+	pos        int
+}
+
+func (p *parser) parse() (node, error) {
+	n, err := p.parseExpression(0)
+	if err != nil {
+		return node{}, err
+	}
+	if t := p.peek(); t.typ != tEOF {
+		return node{}, p.errorAt(t, "unexpected %s", t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(typ tokenType, what string) error {
+	if t := p.next(); t.typ != typ {
+		return p.errorAt(t, "expected %s, found %s", what, t)
+	}
+	return nil
+}
+
+func (p *parser) errorAt(t token, format string, args ...interface{}) error {
+	return &SyntaxError{Expression: p.expression, Offset: t.offset, Message: fmt.Sprintf(format, args...)}
+}
+
+// parseExpression parses an expression whose operators bind tighter than
+// bindingPower
+func (p *parser) parseExpression(bindingPower int) (node, error) {
+	left, err := p.nud(p.next())
+	if err != nil {
+		return node{}, err
+	}
+	for bindingPower < bindingPowers[p.peek().typ] {
+		if left, err = p.led(p.next(), left); err != nil {
+			return node{}, err
+		}
+	}
+	return left, nil
+}
+
+// nud parses a token that starts an expression
+func (p *parser) nud(t token) (node, error) {
+	switch t.typ {
+	case tUnquoted:
+		return node{typ: nField, value: t.value}, nil
+	case tQuoted:
+		if p.peek().typ == tLParen {
+			return node{}, p.errorAt(p.peek(), "quoted identifiers cannot be function names")
+		}
+		return node{typ: nField, value: t.value}, nil
+	case tRawString, tLiteral:
+		return node{typ: nLiteral, value: t.value}, nil
+	case tCurrent:
+		return node{typ: nCurrent}, nil
+	case tStar:
+		right, err := p.projectionRHS(bindingPowers[tStar])
+		if err != nil {
+			return node{}, err
+		}
+		return node{typ: nValueProjection, children: []node{{typ: nCurrent}, right}}, nil
+	case tFilter:
+		return p.led(t, node{typ: nCurrent})
+	case tFlatten:
+		right, err := p.projectionRHS(bindingPowers[tFlatten])
+		if err != nil {
+			return node{}, err
+		}
+		flatten := node{typ: nFlatten, children: []node{{typ: nCurrent}}}
+		return node{typ: nProjection, children: []node{flatten, right}}, nil
+	case tLBracket:
+		switch p.peek().typ {
+		case tNumber, tColon:
+			return p.indexExpression(node{typ: nCurrent})
+		case tStar:
+			if p.tokens[p.pos+1].typ == tRBracket {
+				p.pos += 2
+				right, err := p.projectionRHS(bindingPowers[tStar])
+				if err != nil {
+					return node{}, err
+				}
+				return node{typ: nProjection, children: []node{{typ: nCurrent}, right}}, nil
+			}
+		}
+		return p.multiSelectList()
+	case tLBrace:
+		return p.multiSelectHash()
+	case tNot:
+		expr, err := p.parseExpression(bindingPowers[tNot])
+		if err != nil {
+			return node{}, err
+		}
+		return node{typ: nNot, children: []node{expr}}, nil
+	case tExpref:
+		expr, err := p.parseExpression(bindingPowers[tExpref])
+		if err != nil {
+			return node{}, err
+		}
+		return node{typ: nExpref, children: []node{expr}}, nil
+	case tLParen:
+		expr, err := p.parseExpression(0)
+		if err != nil {
+			return node{}, err
+		}
+		if err := p.expect(tRParen, `")"`); err != nil {
+			return node{}, err
+		}
+		return expr, nil
+	}
+	return node{}, p.errorAt(t, "unexpected %s", t)
+}
+
+// led parses a token that continues the expression left
+func (p *parser) led(t token, left node) (node, error) {
+	switch t.typ {
+	case tDot:
+		if p.peek().typ == tStar {
+			p.next()
+			right, err := p.projectionRHS(bindingPowers[tDot])
+			if err != nil {
+				return node{}, err
+			}
+			return node{typ: nValueProjection, children: []node{left, right}}, nil
+		}
+		right, err := p.dotRHS(bindingPowers[tDot])
+		if err != nil {
+			return node{}, err
+		}
+		return node{typ: nSubexpression, children: []node{left, right}}, nil
+
+	case tPipe, tOr, tAnd:
+		right, err := p.parseExpression(bindingPowers[t.typ])
+		if err != nil {
+			return node{}, err
+		}
+		typ := map[tokenType]nodeType{tPipe: nPipe, tOr: nOr, tAnd: nAnd}[t.typ]
+		return node{typ: typ, children: []node{left, right}}, nil
+
+	case tEQ, tNE, tLT, tLE, tGT, tGE:
+		right, err := p.parseExpression(bindingPowers[t.typ])
+		if err != nil {
+			return node{}, err
+		}
+		return node{typ: nComparator, value: t.typ, children: []node{left, right}}, nil
+
+	case tLParen:
+		if left.typ != nField {
+			return node{}, p.errorAt(t, "unexpected \"(\"")
+		}
+		var args []node
+		for p.peek().typ != tRParen {
+			arg, err := p.parseExpression(0)
+			if err != nil {
+				return node{}, err
+			}
+			args = append(args, arg)
+			if p.peek().typ == tComma {
+				p.next()
+			} else if p.peek().typ != tRParen {
+				return node{}, p.errorAt(p.peek(), "expected \",\" or \")\", found %s", p.peek())
+			}
+		}
+		p.next()
+		return node{typ: nFunction, value: left.value, children: args}, nil
+
+	case tFilter:
+		condition, err := p.parseExpression(0)
+		if err != nil {
+			return node{}, err
+		}
+		if err := p.expect(tRBracket, `"]"`); err != nil {
+			return node{}, err
+		}
+		right, err := p.projectionRHS(bindingPowers[tFilter])
+		if err != nil {
+			return node{}, err
+		}
+		return node{typ: nFilterProjection, children: []node{left, right, condition}}, nil
+
+	case tFlatten:
+		right, err := p.projectionRHS(bindingPowers[tFlatten])
+		if err != nil {
+			return node{}, err
+		}
+		flatten := node{typ: nFlatten, children: []node{left}}
+		return node{typ: nProjection, children: []node{flatten, right}}, nil
+
+	case tLBracket:
+		switch p.peek().typ {
+		case tNumber, tColon:
+			return p.indexExpression(left)
+		case tStar:
+			p.next()
+			if err := p.expect(tRBracket, `"]"`); err != nil {
+				return node{}, err
+			}
+			right, err := p.projectionRHS(bindingPowers[tStar])
+			if err != nil {
+				return node{}, err
+			}
+			return node{typ: nProjection, children: []node{left, right}}, nil
+		}
+		return node{}, p.errorAt(p.peek(), "expected an index, slice or \"*\", found %s", p.peek())
+	}
+	return node{}, p.errorAt(t, "unexpected %s", t)
+}
+
+// indexExpression parses [N] or [start:stop:step] after the "[" and applies
+// it to left; slices project what follows over their elements
+func (p *parser) indexExpression(left node) (node, error) {
+	var bounds sliceBounds
+	part := 0
+	for {
+		t := p.next()
+		switch t.typ {
+		case tNumber:
+			if bounds[part] != nil {
+				return node{}, p.errorAt(t, "unexpected %s", t)
+			}
+			n := t.value.(int)
+			if part == 2 && n == 0 {
+				return node{}, p.errorAt(t, "slice step cannot be 0")
+			}
+			bounds[part] = &n
+		case tColon:
+			if part++; part > 2 {
+				return node{}, p.errorAt(t, "too many colons in slice")
+			}
+		case tRBracket:
+			if part == 0 {
+				if bounds[0] == nil {
+					return node{}, p.errorAt(t, "expected an index")
+				}
+				index := node{typ: nIndex, value: *bounds[0]}
+				return node{typ: nSubexpression, children: []node{left, index}}, nil
+			}
+			slice := node{typ: nSlice, value: bounds}
+			right, err := p.projectionRHS(bindingPowers[tStar])
+			if err != nil {
+				return node{}, err
+			}
+			sliced := node{typ: nSubexpression, children: []node{left, slice}}
+			return node{typ: nProjection, children: []node{sliced, right}}, nil
+		default:
+			return node{}, p.errorAt(t, "expected a number, \":\" or \"]\", found %s", t)
+		}
+	}
+}
+
+// projectionRHS parses what a projection applies to each element, or the
+// element itself when the projection ends
+func (p *parser) projectionRHS(bindingPower int) (node, error) {
+	t := p.peek()
+	switch {
+	case bindingPowers[t.typ] < 10:
+		return node{typ: nCurrent}, nil
+	case t.typ == tLBracket || t.typ == tFilter:
+		return p.parseExpression(bindingPower)
+	case t.typ == tDot:
+		p.next()
+		return p.dotRHS(bindingPower)
+	}
+	return node{}, p.errorAt(t, "unexpected %s", t)
+}
+
+// dotRHS parses what follows a "."
+func (p *parser) dotRHS(bindingPower int) (node, error) {
+	switch t := p.peek(); t.typ {
+	case tUnquoted, tQuoted, tStar:
+		return p.parseExpression(bindingPower)
+	case tLBracket:
+		p.next()
+		return p.multiSelectList()
+	case tLBrace:
+		p.next()
+		return p.multiSelectHash()
+	default:
+		return node{}, p.errorAt(t, "expected an identifier, \"*\", \"[\" or \"{\" after \".\", found %s", t)
+	}
+}
+
+// multiSelectList parses [expr, expr, ...] after the "["
+func (p *parser) multiSelectList() (node, error) {
+	var items []node
+	for {
+		item, err := p.parseExpression(0)
+		if err != nil {
+			return node{}, err
+		}
+		items = append(items, item)
+		t := p.next()
+		if t.typ == tRBracket {
+			return node{typ: nMultiSelectList, children: items}, nil
+		}
+		if t.typ != tComma {
+			return node{}, p.errorAt(t, "expected \",\" or \"]\", found %s", t)
+		}
+	}
+}
+
+// multiSelectHash parses {key: expr, ...} after the "{"
+func (p *parser) multiSelectHash() (node, error) {
+	var keys []string
+	var values []node
+	for {
+		t := p.next()
+		if t.typ != tUnquoted && t.typ != tQuoted {
+			return node{}, p.errorAt(t, "expected a key, found %s", t)
+		}
+		if err := p.expect(tColon, `":"`); err != nil {
+			return node{}, err
+		}
+		value, err := p.parseExpression(0)
+		if err != nil {
+			return node{}, err
+		}
+		keys = append(keys, t.value.(string))
+		values = append(values, value)
+
+		t = p.next()
+		if t.typ == tRBrace {
+			return node{typ: nMultiSelectHash, keys: keys, children: values}, nil
+		}
+		if t.typ != tComma {
+			return node{}, p.errorAt(t, "expected \",\" or \"}\", found %s", t)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package nativemsg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"ms_graph/internal/token"
+	"ms_graph/internal/tokencache"
+)
+
+const (
+	// HostName is the native messaging host name the extension connects to
+	HostName = "com.msgraph.toolkit"
+
+	// maxIncomingMessage is the largest message Chrome sends to a host (64 MiB)
+	maxIncomingMessage = 64 * 1024 * 1024
+
+	// maxOutgoingMessage is the largest message a host may send to Chrome (1 MiB)
+	maxOutgoingMessage = 1024 * 1024
+)
+
+// TokenMessage is the object built by handleTokenResponse in the extension's content.js
+type TokenMessage struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+	Timestamp    string `json:"timestamp"`
+	// Key selects the token cache entry; empty uses tokencache.DefaultKey
+	Key string `json:"key,omitempty"`
+}
+
+// Reply is sent back to the extension for every message
+type Reply struct {
+	Status    string    `json:"status"`
+	Key       string    `json:"key,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ReadMessage reads one length-prefixed JSON message from r into v.
+// It returns io.EOF when the browser closes the pipe.
+func ReadMessage(r io.Reader, v interface{}) error {
+	var length uint32
+	if err := binary.Read(r, binary.NativeEndian, &length); err != nil {
+		// binary.Read returns io.EOF only when no bytes were read
+		return err
+	}
+
+	if length > maxIncomingMessage {
+		return fmt.Errorf("message of %d bytes exceeds the %d byte limit", length, maxIncomingMessage)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("failed to read message body: %w", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse message: %w", err)
+	}
+	return nil
+}
+
+// WriteMessage writes v to w as one length-prefixed JSON message
+func WriteMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	if len(data) > maxOutgoingMessage {
+		return fmt.Errorf("message of %d bytes exceeds the %d byte limit", len(data), maxOutgoingMessage)
+	}
+
+	if err := binary.Write(w, binary.NativeEndian, uint32(len(data))); err != nil {
+		return fmt.Errorf("failed to write message length: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write message body: %w", err)
+	}
+	return nil
+}
+
+// Serve handles token messages from r until the browser disconnects, storing
+// each one in cache and replying on w
+func Serve(r io.Reader, w io.Writer, cache *tokencache.Cache) error {
+	for {
+		var msg TokenMessage
+		err := ReadMessage(r, &msg)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			// A malformed message leaves the stream unusable, so report and stop
+			WriteMessage(w, Reply{Status: "error", Error: err.Error()})
+			return err
+		}
+
+		reply := store(cache, &msg)
+		if err := WriteMessage(w, reply); err != nil {
+			return err
+		}
+	}
+}
+
+// store writes a token message into the cache
+func store(cache *tokencache.Cache, msg *TokenMessage) Reply {
+	if msg.AccessToken == "" && msg.RefreshToken == "" {
+		return Reply{Status: "error", Error: "message contains no tokens"}
+	}
+
+	key := msg.Key
+	if key == "" {
+		key = tokencache.DefaultKey
+	}
+
+	entry := &tokencache.Entry{
+		AccessToken:  msg.AccessToken,
+		RefreshToken: msg.RefreshToken,
+		ExpiresAt:    messageExpiry(msg),
+		Source:       "chrome-extension",
+	}
+
+	// Keep the tenant and app so the refresh token is redeemed against the right authority
+	if msg.AccessToken != "" {
+		if tid, err := token.GetStringClaim(msg.AccessToken, "tid"); err == nil {
+			entry.TenantID = tid
+		}
+		if appID, err := token.GetStringClaim(msg.AccessToken, "appid"); err == nil {
+			entry.ClientID = appID
+		} else if azp, err := token.GetStringClaim(msg.AccessToken, "azp"); err == nil {
+			entry.ClientID = azp
+		}
+	}
+
+	if err := cache.Save(key, entry); err != nil {
+		return Reply{Status: "error", Key: key, Error: err.Error()}
+	}
+	return Reply{Status: "ok", Key: key, ExpiresAt: entry.ExpiresAt}
+}
+
+// messageExpiry prefers the token's exp claim and falls back to timestamp + expiresIn
+func messageExpiry(msg *TokenMessage) time.Time {
+	if exp, err := token.GetExpirationTime(msg.AccessToken); err == nil {
+		return exp
+	}
+
+	issued, err := time.Parse(time.RFC3339, msg.Timestamp)
+	if err != nil {
+		issued = time.Now()
+	}
+	return issued.Add(time.Duration(msg.ExpiresIn) * time.Second)
+}
+
+// Manifest is a Chrome native messaging host manifest
+type Manifest struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Path           string   `json:"path"`
+	Type           string   `json:"type"`
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// NewManifest builds the host manifest for the binary at hostPath, allowing
+// the given extension IDs to connect
+func NewManifest(hostPath string, extensionIDs ...string) (*Manifest, error) {
+	if len(extensionIDs) == 0 {
+		return nil, fmt.Errorf("at least one extension ID is required")
+	}
+
+	absPath, err := filepath.Abs(hostPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve host path: %w", err)
+	}
+
+	origins := make([]string, 0, len(extensionIDs))
+	for _, id := range extensionIDs {
+		origins = append(origins, fmt.Sprintf("chrome-extension://%s/", id))
+	}
+
+	return &Manifest{
+		Name:           HostName,
+		Description:    "Microsoft Graph Toolkit token receiver",
+		Path:           absPath,
+		Type:           "stdio",
+		AllowedOrigins: origins,
+	}, nil
+}
+
+// ManifestDirs returns the per-user directories Chrome and Chromium read host
+// manifests from. Windows registers manifests in the registry instead and is
+// not supported.
+func ManifestDirs() ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine home directory: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		support := filepath.Join(home, "Library", "Application Support")
+		return []string{
+			filepath.Join(support, "Google", "Chrome", "NativeMessagingHosts"),
+			filepath.Join(support, "Chromium", "NativeMessagingHosts"),
+		}, nil
+	case "linux":
+		return []string{
+			filepath.Join(home, ".config", "google-chrome", "NativeMessagingHosts"),
+			filepath.Join(home, ".config", "chromium", "NativeMessagingHosts"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("native messaging host installation is not supported on %s", runtime.GOOS)
+	}
+}
+
+// Install writes the manifest into dir as <HostName>.json and returns its path
+func (m *Manifest) Install(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	path := filepath.Join(dir, HostName+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return path, nil
+}
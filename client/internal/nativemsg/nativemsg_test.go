@@ -0,0 +1,89 @@
+package nativemsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// frame prefixes body with its length, as Chrome does
+func frame(length uint32, body string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.NativeEndian, length)
+	buf.WriteString(body)
+	return buf.Bytes()
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	sent := []TokenMessage{
+		{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 3600, Key: "work"},
+		{RefreshToken: "refresh-only"},
+	}
+	for _, msg := range sent {
+		if err := WriteMessage(&buf, msg); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+	}
+
+	// Each prefix holds the length of the JSON body that follows it
+	data := buf.Bytes()
+	first := binary.NativeEndian.Uint32(data)
+	second := binary.NativeEndian.Uint32(data[4+first:])
+	if total := 8 + int(first) + int(second); total != len(data) {
+		t.Errorf("length prefixes %d and %d cover %d bytes, want %d", first, second, total, len(data))
+	}
+
+	for _, want := range sent {
+		var got TokenMessage
+		if err := ReadMessage(&buf, &got); err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if got != want {
+			t.Errorf("read %+v, want %+v", got, want)
+		}
+	}
+	var msg TokenMessage
+	if err := ReadMessage(&buf, &msg); err != io.EOF {
+		t.Errorf("ReadMessage at end of stream = %v, want io.EOF", err)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"oversized message", frame(maxIncomingMessage+1, "{}"), "exceeds the"},
+		{"truncated length", []byte{1, 0}, "unexpected EOF"},
+		{"truncated body", frame(10, `{"a":`), "failed to read message body"},
+		{"invalid JSON", frame(3, "{x}"), "failed to parse message"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var msg TokenMessage
+			err := ReadMessage(bytes.NewReader(tc.input), &msg)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ReadMessage error = %v, want %q", err, tc.want)
+			}
+			if errors.Is(err, io.EOF) {
+				t.Error("a partial message was reported as a clean end of stream")
+			}
+		})
+	}
+}
+
+func TestWriteMessageRejectsOversizedMessage(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteMessage(&buf, Reply{Status: "error", Error: strings.Repeat("x", maxOutgoingMessage)})
+	if err == nil || !strings.Contains(err.Error(), "exceeds the") {
+		t.Errorf("WriteMessage error = %v, want a size error", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes of an oversized message", buf.Len())
+	}
+}
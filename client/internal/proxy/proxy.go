@@ -0,0 +1,391 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ms_graph/internal/graph"
+)
+
+const (
+
+	// DefaultMaxRetries is how many times a throttled request is retried
+	DefaultMaxRetries = 3
+
+	// maxRequestBody bounds request bodies, which are buffered so they can be replayed
+	maxRequestBody = 32 * 1024 * 1024
+
+	// viaHeader marks responses and upstream requests that passed through the proxy
+	viaHeader = "1.1 msgraph-proxy"
+)
+
+// hopHeaders are connection-specific and never forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// callerHeaders are request headers the proxy sets itself or must not pass on.
+// Accept-Encoding is left to the Go transport, which decodes gzip so paging
+// links can be rewritten.
+var callerHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Accept-Encoding",
+	"Content-Length",
+	"Content-Type",
+	"client-request-id",
+	"return-client-request-id",
+}
+
+// Config controls what the proxy forwards
+type Config struct {
+	// ListenAddr is the address the proxy serves on. Requests must name a
+	// loopback host or this address's host in their Host header, so web pages
+	// cannot reach the proxy through DNS rebinding.
+	ListenAddr string
+	// AllowedMethods lists HTTP methods that may be forwarded; nil allows only GET
+	AllowedMethods []string
+	// AllowedPaths lists path prefixes that may be forwarded, such as "/v1.0/me"
+	// or "/v1.0/users/*/messages" where * matches one segment; nil allows
+	// everything under /v1.0 and /beta
+	AllowedPaths []string
+	// MaxRetries is how many times 429/503/504 responses are retried; 0
+	// disables retries
+	MaxRetries int
+	// Logger receives one line per request; nil uses the standard logger
+	Logger *log.Logger
+}
+
+// Proxy is an http.Handler that forwards requests to Microsoft Graph through
+// a ClientWithRefresh, which adds the bearer token and runs the client's
+// middleware. Requests go to the client's cloud; use UpstreamCloud to point
+// the client at another host.
+type Proxy struct {
+	client     *graph.ClientWithRefresh
+	upstream   string
+	hosts      map[string]bool
+	methods    map[string]bool
+	paths      [][]string
+	maxRetries int
+	logger     *log.Logger
+}
+
+// New creates a proxy that authenticates with client
+func New(client *graph.ClientWithRefresh, config Config) (*Proxy, error) {
+	if config.MaxRetries < 0 {
+		return nil, fmt.Errorf("max retries must not be negative")
+	}
+
+	hosts := map[string]bool{"localhost": true}
+	if config.ListenAddr != "" {
+		host, _, err := net.SplitHostPort(config.ListenAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %w", config.ListenAddr, err)
+		}
+		if host != "" {
+			hosts[strings.ToLower(host)] = true
+		}
+	}
+
+	methods := config.AllowedMethods
+	if methods == nil {
+		methods = []string{http.MethodGet}
+	}
+	allowedMethods := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		allowedMethods[strings.ToUpper(strings.TrimSpace(method))] = true
+	}
+
+	paths := config.AllowedPaths
+	if paths == nil {
+		paths = []string{"/v1.0", "/beta"}
+	}
+	var allowedPaths [][]string
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("allowed path %q must start with /", p)
+		}
+		allowedPaths = append(allowedPaths, splitPath(p))
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return &Proxy{
+		client:     client,
+		upstream:   strings.TrimSuffix(client.Cloud().GraphEndpoint, "/"),
+		hosts:      hosts,
+		methods:    allowedMethods,
+		paths:      allowedPaths,
+		maxRetries: config.MaxRetries,
+		logger:     logger,
+	}, nil
+}
+
+// UpstreamCloud returns cloud with its Graph endpoint replaced by upstream,
+// for a client the proxy forwards through. An empty upstream or the cloud's
+// own endpoint returns cloud unchanged. Any other host is refused unless
+// insecure is set, since the client sends it bearer tokens, and must still
+// use https.
+func UpstreamCloud(cloud graph.Cloud, upstream string, insecure bool) (graph.Cloud, error) {
+	graphURL, err := url.Parse(cloud.GraphEndpoint)
+	if err != nil {
+		return graph.Cloud{}, fmt.Errorf("invalid Graph endpoint %q: %w", cloud.GraphEndpoint, err)
+	}
+	if upstream == "" {
+		return cloud, nil
+	}
+
+	upstreamURL, err := url.Parse(upstream)
+	if err != nil || upstreamURL.Scheme == "" || upstreamURL.Host == "" {
+		return graph.Cloud{}, fmt.Errorf("invalid upstream URL %q", upstream)
+	}
+	if strings.EqualFold(upstreamURL.Scheme, graphURL.Scheme) && strings.EqualFold(upstreamURL.Host, graphURL.Host) && strings.Trim(upstreamURL.Path, "/") == "" {
+		return cloud, nil
+	}
+	if !insecure {
+		return graph.Cloud{}, fmt.Errorf("upstream %s is not the Graph endpoint %s; refusing to send it tokens without the insecure upstream option", upstream, cloud.GraphEndpoint)
+	}
+	if upstreamURL.Scheme != "https" {
+		return graph.Cloud{}, fmt.Errorf("upstream %s must use https", upstream)
+	}
+	if strings.Trim(upstreamURL.Path, "/") != "" {
+		return graph.Cloud{}, fmt.Errorf("upstream %s must not have a path", upstream)
+	}
+
+	cloud.GraphEndpoint = upstreamURL.Scheme + "://" + upstreamURL.Host
+	return cloud, nil
+}
+
+// ServeHTTP forwards one request to Graph
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	// Each hop gets its own client-request-id, so Graph's logs tell proxied
+	// requests apart; the caller's id, if any, is logged alongside it
+	requestID := graph.NewRequestID()
+	callerID := r.Header.Get("client-request-id")
+	w.Header().Set("client-request-id", requestID)
+	w.Header().Set("Via", viaHeader)
+
+	// Browsers send Origin on cross-origin requests, and a rebound DNS name
+	// shows up in Host; either means a web page is using the proxy
+	if r.Header.Get("Origin") != "" {
+		p.logger.Printf("proxy: %s %s denied: Origin %s (client-request-id %s)", r.Method, r.URL.Path, r.Header.Get("Origin"), requestID)
+		http.Error(w, "cross-origin requests are not allowed by the proxy", http.StatusForbidden)
+		return
+	}
+	if !p.hostAllowed(r.Host) {
+		p.logger.Printf("proxy: %s %s denied: Host %s (client-request-id %s)", r.Method, r.URL.Path, r.Host, requestID)
+		http.Error(w, fmt.Sprintf("host %s is not allowed by the proxy", r.Host), http.StatusForbidden)
+		return
+	}
+	if !p.methods[r.Method] {
+		p.logger.Printf("proxy: %s %s denied: method not allowed (client-request-id %s)", r.Method, r.URL.Path, requestID)
+		http.Error(w, fmt.Sprintf("method %s is not allowed by the proxy", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if hasDotSegment(r.URL.Path) {
+		http.Error(w, "path must not contain . or .. segments", http.StatusBadRequest)
+		return
+	}
+	if !p.pathAllowed(r.URL.Path) {
+		p.logger.Printf("proxy: %s %s denied: path not allowed (client-request-id %s)", r.Method, r.URL.Path, requestID)
+		http.Error(w, fmt.Sprintf("path %s is not allowed by the proxy", r.URL.Path), http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxRequestBody {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp, attempt, err := p.forward(r, body, requestID)
+	if err != nil {
+		p.logger.Printf("proxy: %s %s failed after %d attempt(s) in %v: %v (client-request-id %s, caller %s)",
+			r.Method, r.URL.Path, attempt, time.Since(start).Round(time.Millisecond), err, requestID, callerID)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	p.logger.Printf("proxy: %s %s -> %d in %v (attempt %d, client-request-id %s, caller %s, request-id %s)",
+		r.Method, r.URL.Path, resp.StatusCode, time.Since(start).Round(time.Millisecond),
+		attempt, requestID, callerID, resp.Header.Get("request-id"))
+
+	p.writeResponse(w, r, resp)
+}
+
+// forward sends the request through the client, which refreshes the token
+// on 401, and retries throttled responses. Graph's error responses are
+// returned as responses so they reach the caller unchanged.
+func (p *Proxy) forward(r *http.Request, body []byte, requestID string) (*graph.Response, int, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := p.client.Do(p.upstreamRequest(r, body, requestID))
+		var graphErr *graph.GraphError
+		if errors.As(err, &graphErr) {
+			resp = &graph.Response{StatusCode: graphErr.StatusCode, Header: graphErr.Header, Body: []byte(graphErr.Body)}
+		} else if err != nil {
+			return nil, attempt, err
+		}
+
+		if graph.IsRetryable(resp.StatusCode) && attempt <= p.maxRetries {
+			delay := graph.RetryDelay(&http.Response{Header: resp.Header}, attempt)
+			p.logger.Printf("proxy: %s %s throttled with %d, retrying in %v (attempt %d, client-request-id %s)",
+				r.Method, r.URL.Path, resp.StatusCode, delay, attempt, requestID)
+
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return nil, attempt, r.Context().Err()
+			}
+			continue
+		}
+
+		return resp, attempt, nil
+	}
+}
+
+// upstreamRequest builds the request sent to Graph
+func (p *Proxy) upstreamRequest(r *http.Request, body []byte, requestID string) *graph.Request {
+	target := p.upstream + r.URL.EscapedPath()
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	header := r.Header.Clone()
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+	for _, h := range callerHeaders {
+		header.Del(h)
+	}
+	header.Set("client-request-id", requestID)
+	header.Set("return-client-request-id", "true")
+	header.Add("Via", viaHeader)
+
+	req := &graph.Request{
+		Method:      r.Method,
+		Path:        target,
+		Header:      header,
+		ContentType: r.Header.Get("Content-Type"),
+		Context:     r.Context(),
+	}
+	if len(body) > 0 {
+		req.Body = bytes.NewReader(body)
+	}
+	return req
+}
+
+// writeResponse copies Graph's response to the caller, pointing paging links back at the proxy
+func (p *Proxy) writeResponse(w http.ResponseWriter, r *http.Request, resp *graph.Response) {
+	// Graph's headers replace the ones set before forwarding, such as client-request-id
+	for key, values := range resp.Header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Via", viaHeader)
+
+	// Rewrite @odata.nextLink and friends so paging clients stay on the
+	// proxy; r.Host has been checked by hostAllowed
+	data := resp.Body
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		local := "http://" + r.Host
+		data = bytes.ReplaceAll(data, []byte(`"`+p.upstream+`/`), []byte(`"`+local+`/`))
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// hostAllowed reports whether a Host header names a loopback address or the
+// proxy's listen address
+func (p *Proxy) hostAllowed(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	if host == "" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	return p.hosts[host]
+}
+
+// pathAllowed reports whether path matches one of the allowed prefixes
+func (p *Proxy) pathAllowed(path string) bool {
+	segments := splitPath(path)
+	for _, pattern := range p.paths {
+		if matchPrefix(pattern, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath splits a URL path into its non-empty segments
+func splitPath(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// hasDotSegment reports whether path contains . or .. segments that could escape an allowed prefix
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix reports whether pattern matches the leading segments of path.
+// Segments compare case-insensitively, as Graph paths do, and * matches any one segment.
+func matchPrefix(pattern, path []string) bool {
+	if len(pattern) > len(path) {
+		return false
+	}
+	for i, segment := range pattern {
+		if segment == "*" {
+			continue
+		}
+		if !strings.EqualFold(segment, path[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ms_graph/internal/graph"
+	"ms_graph/internal/graph/graphtest"
+)
+
+func TestUpstreamCloudRestrictsHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream string
+		insecure bool
+		wantHost string
+	}{
+		{"default", "", false, "https://graph.microsoft.us"},
+		{"cloud endpoint", "https://graph.microsoft.us/", false, "https://graph.microsoft.us"},
+		{"cloud endpoint in another case", "HTTPS://Graph.Microsoft.US", false, "https://graph.microsoft.us"},
+		{"other cloud", "https://graph.microsoft.com", false, ""},
+		{"other host", "https://attacker.example.com", false, ""},
+		{"cloud host over http", "http://graph.microsoft.us", false, ""},
+		{"cloud host with a path", "https://graph.microsoft.us/v1.0", false, ""},
+		{"insecure https test server", "https://localhost:8443", true, "https://localhost:8443"},
+		{"insecure http test server", "http://localhost:8080", true, ""},
+		{"insecure test server with a path", "https://localhost:8443/graph", true, ""},
+		{"invalid URL", "graph.microsoft.us", true, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud, err := UpstreamCloud(graph.USGovHigh, tc.upstream, tc.insecure)
+			if tc.wantHost == "" {
+				if err == nil {
+					t.Fatalf("UpstreamCloud(%q, %v) succeeded, want an error", tc.upstream, tc.insecure)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpstreamCloud(%q, %v): %v", tc.upstream, tc.insecure, err)
+			}
+			if cloud.GraphEndpoint != tc.wantHost {
+				t.Errorf("Graph endpoint = %q, want %q", cloud.GraphEndpoint, tc.wantHost)
+			}
+			if cloud.LoginEndpoint != graph.USGovHigh.LoginEndpoint {
+				t.Errorf("login endpoint = %q, want %q", cloud.LoginEndpoint, graph.USGovHigh.LoginEndpoint)
+			}
+		})
+	}
+}
+
+// newTestProxy returns a proxy for a signed-in graphtest user
+func newTestProxy(t *testing.T, srv *graphtest.Server, config Config) *Proxy {
+	t.Helper()
+	me := srv.AddUser(graph.User{DisplayName: "Adele Vance"})
+	config.ListenAddr = "127.0.0.1:8080"
+	config.Logger = log.New(io.Discard, "", 0)
+	p, err := New(srv.NewClientWithRefresh(me.ID), config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p
+}
+
+// serve sends a request to the proxy as a local caller
+func serve(p *Proxy, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "http://127.0.0.1:8080"+target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServeHTTPAllowList(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	p := newTestProxy(t, srv, Config{
+		AllowedMethods: []string{"GET"},
+		AllowedPaths:   []string{"/v1.0/me", "/v1.0/users/*/messages"},
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"allowed path", http.MethodGet, "/v1.0/me", http.StatusOK},
+		{"allowed path in another case is forwarded", http.MethodGet, "/v1.0/ME", http.StatusBadRequest},
+		{"wildcard segment", http.MethodGet, "/v1.0/users/someone/messages", http.StatusNotFound},
+		{"method not allowed", http.MethodDelete, "/v1.0/me", http.StatusMethodNotAllowed},
+		{"path not allowed", http.MethodGet, "/v1.0/users", http.StatusForbidden},
+		{"other version", http.MethodGet, "/beta/me", http.StatusForbidden},
+		{"dot-dot segment", http.MethodGet, "/v1.0/me/../users", http.StatusBadRequest},
+		{"dot segment", http.MethodGet, "/v1.0/me/./", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := serve(p, tc.method, tc.target, nil).Code; got != tc.want {
+				t.Errorf("%s %s = %d, want %d", tc.method, tc.target, got, tc.want)
+			}
+		})
+	}
+
+	srv.AssertNotRequested(t, http.MethodDelete, "/v1.0/me")
+	srv.AssertNotRequested(t, http.MethodGet, "/v1.0/users")
+}
+
+func TestServeHTTPRejectsForeignHostAndOrigin(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	p := newTestProxy(t, srv, Config{})
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   int
+	}{
+		{"listen address", "127.0.0.1:8080", "", http.StatusOK},
+		{"localhost", "localhost:8080", "", http.StatusOK},
+		{"ipv6 loopback", "[::1]:8080", "", http.StatusOK},
+		{"rebound DNS name", "attacker.example.com:8080", "", http.StatusForbidden},
+		{"other address", "192.0.2.1:8080", "", http.StatusForbidden},
+		{"cross-origin fetch", "127.0.0.1:8080", "https://attacker.example.com", http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1.0/me", nil)
+			req.Host = tc.host
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+
+	srv.AssertRequestCount(t, http.MethodGet, "/v1.0/me", 3)
+}
+
+func TestServeHTTPForwardsThroughClient(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	p := newTestProxy(t, srv, Config{})
+
+	rec := serve(p, http.MethodGet, "/v1.0/me", http.Header{
+		"Client-Request-Id": {"caller-id"},
+		"Accept-Encoding":   {"br"},
+		"Authorization":     {"Bearer caller-token"},
+		"Cookie":            {"session=1"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Via"); got != viaHeader {
+		t.Errorf("Via = %q, want %q", got, viaHeader)
+	}
+
+	req := srv.AssertRequested(t, http.MethodGet, "/v1.0/me")
+	if id := req.Header.Get("client-request-id"); id == "" || id == "caller-id" {
+		t.Errorf("upstream client-request-id = %q, want a proxy-issued id", id)
+	}
+	if got := rec.Header().Get("client-request-id"); got != req.Header.Get("client-request-id") {
+		t.Errorf("response client-request-id = %q, want the upstream id %q", got, req.Header.Get("client-request-id"))
+	}
+	if strings.Contains(req.Header.Get("Authorization"), "caller-token") {
+		t.Error("the caller's Authorization header was forwarded")
+	}
+	if req.Header.Get("Cookie") != "" {
+		t.Error("the caller's Cookie header was forwarded")
+	}
+	if req.Header.Get("Accept-Encoding") == "br" {
+		t.Error("the caller's Accept-Encoding header was forwarded")
+	}
+	req.AssertHeader(t, "Via", viaHeader)
+}
+
+func TestServeHTTPRefreshesAfter401(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	p := newTestProxy(t, srv, Config{})
+
+	srv.ExpireAccessTokens()
+	if rec := serve(p, http.MethodGet, "/v1.0/me", nil); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/v1.0/me", 2)
+	if got := len(srv.TokenRequests()); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+}
+
+func TestServeHTTPRetriesThrottledRequests(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	p := newTestProxy(t, srv, Config{MaxRetries: 1})
+
+	srv.FailNext(http.StatusTooManyRequests, 1)
+	if rec := serve(p, http.MethodGet, "/v1.0/me", nil); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 after a retry: %s", rec.Code, rec.Body)
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/v1.0/me", 2)
+
+	// Once retries run out, Graph's error reaches the caller unchanged
+	srv.ResetRequests()
+	srv.Inject(graphtest.Fault{StatusCode: http.StatusServiceUnavailable, Times: 2})
+	rec := serve(p, http.MethodGet, "/v1.0/me", nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"ServiceUnavailable"`) {
+		t.Errorf("body = %s, want Graph's error", rec.Body)
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/v1.0/me", 2)
+}
+
+func TestServeHTTPWithoutRetries(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	p := newTestProxy(t, srv, Config{MaxRetries: 0})
+
+	srv.FailNext(http.StatusTooManyRequests, 1)
+	if rec := serve(p, http.MethodGet, "/v1.0/me", nil); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	srv.AssertRequestCount(t, http.MethodGet, "/v1.0/me", 1)
+}
+
+func TestServeHTTPRewritesNextLink(t *testing.T) {
+	srv := graphtest.NewServer(graphtest.WithPageSize(1))
+	defer srv.Close()
+	p := newTestProxy(t, srv, Config{})
+	srv.AddUser(graph.User{DisplayName: "Alex Wilber"})
+
+	rec := serve(p, http.MethodGet, "/v1.0/users", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var page graph.Collection[graph.User]
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to decode page: %v", err)
+	}
+	if !strings.HasPrefix(page.NextLink, "http://127.0.0.1:8080/v1.0/users?") {
+		t.Fatalf("nextLink = %q, want it on the proxy", page.NextLink)
+	}
+
+	// The rewritten link pages through the proxy
+	next := strings.TrimPrefix(page.NextLink, "http://127.0.0.1:8080")
+	rec = serve(p, http.MethodGet, next, nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to decode page: %v", err)
+	}
+	if len(page.Value) != 1 || page.Value[0].DisplayName != "Alex Wilber" {
+		t.Errorf("second page = %+v, want Alex Wilber", page.Value)
+	}
+}
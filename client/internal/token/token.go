@@ -94,3 +94,47 @@ func GetTimeUntilExpiration(tokenString string) (time.Duration, error) {
 	return info.TimeUntilExp, nil
 }
 
+// GetStringClaim returns a string claim such as "tid" or "oid" from a token
+func GetStringClaim(tokenString, claim string) (string, error) {
+	parser := jwt.NewParser()
+	token, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return "", fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("invalid token claims")
+	}
+
+	value, ok := claims[claim].(string)
+	if !ok {
+		return "", fmt.Errorf("token does not contain %s claim", claim)
+	}
+	return value, nil
+}
+
+
+// GetStringListClaim returns a claim holding a list of strings, such as
+// "roles"; a missing claim yields nil
+func GetStringListClaim(tokenString, claim string) []string {
+	parser := jwt.NewParser()
+	token, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+
+	values, _ := claims[claim].([]interface{})
+	var list []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
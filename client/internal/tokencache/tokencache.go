@@ -0,0 +1,192 @@
+package tokencache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultKey is the cache entry used when no profile name is given
+const DefaultKey = "default"
+
+// ErrNotFound is returned when the cache has no entry for a key
+var ErrNotFound = errors.New("no cached token")
+
+// Entry represents a cached set of tokens
+type Entry struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	TenantID     string    `json:"tenantId,omitempty"`
+	ClientID     string    `json:"clientId,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Cache is a JSON file holding token entries keyed by name
+type Cache struct {
+	path string
+	mu   sync.Mutex // Serializes read-modify-write cycles within the process
+}
+
+// New creates a cache backed by the file at path
+func New(path string) *Cache {
+	return &Cache{path: path}
+}
+
+// DefaultPath returns the cache file location.
+// MS_GRAPH_TOKEN_CACHE overrides the default of ~/.config/msgraph/tokens.json.
+func DefaultPath() (string, error) {
+	if path := os.Getenv("MS_GRAPH_TOKEN_CACHE"); path != "" {
+		return path, nil
+	}
+
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine home directory: %w", err)
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "msgraph", "tokens.json"), nil
+}
+
+// Default creates a cache backed by the file at DefaultPath
+func Default() (*Cache, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return New(path), nil
+}
+
+// Path returns the location of the cache file
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// Load returns the entry stored under key
+func (c *Cache) Load(key string) (*Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+// Save stores entry under key, replacing any existing entry
+func (c *Cache) Save(key string, entry *Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	entry.UpdatedAt = time.Now()
+	entries[key] = entry
+	return c.write(entries)
+}
+
+// Delete removes the entry stored under key
+func (c *Cache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := entries[key]; !ok {
+		return nil
+	}
+	delete(entries, key)
+	return c.write(entries)
+}
+
+// Keys returns the names of all cached entries
+func (c *Cache) Keys() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// read loads all entries from disk; a missing file is an empty cache
+func (c *Cache) read() (map[string]*Entry, error) {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]*Entry{}, nil
+		}
+		return nil, fmt.Errorf("failed to read token cache: %w", err)
+	}
+
+	entries := map[string]*Entry{}
+	if len(data) == 0 {
+		return entries, nil
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse token cache %s: %w", c.path, err)
+	}
+	return entries, nil
+}
+
+// write atomically replaces the cache file, readable only by the owner
+func (c *Cache) write(entries map[string]*Entry) error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token cache: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".tokens-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary token cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set token cache permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to replace token cache: %w", err)
+	}
+	return nil
+}
@@ -31,11 +31,32 @@ chrome.webRequest.onCompleted.addListener(
   ["responseHeaders"]
 );
 
+// Name of the Go client's native messaging host (see client/cmd/nativehost)
+const NATIVE_HOST_NAME = 'com.msgraph.toolkit';
+
+// Forward tokens to the Go client's token cache via native messaging
+function sendTokensToNativeHost(tokens) {
+  chrome.runtime.sendNativeMessage(NATIVE_HOST_NAME, tokens, (response) => {
+    if (chrome.runtime.lastError) {
+      // Host not installed - the popup's copy buttons still work
+      console.log('Native host not available:', chrome.runtime.lastError.message);
+      return;
+    }
+    if (response && response.status === 'ok') {
+      console.log('Tokens saved to Go client token cache:', response.key);
+    } else {
+      console.error('Native host rejected tokens:', response && response.error);
+    }
+  });
+}
+
 // Listen for messages from content script
 chrome.runtime.onMessage.addListener((request, sender, sendResponse) => {
   if (request.action === 'tokensExtracted') {
     console.log('Tokens extracted notification received');
-    // Could trigger a notification or badge update here
+    if (request.tokens) {
+      sendTokensToNativeHost(request.tokens);
+    }
   }
   return true;
 });
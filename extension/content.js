@@ -103,7 +103,7 @@
         });
         
         // Notify background script
-        chrome.runtime.sendMessage({ action: 'tokensExtracted' }, (response) => {
+        chrome.runtime.sendMessage({ action: 'tokensExtracted', tokens: tokens }, (response) => {
           if (chrome.runtime.lastError) {
             console.log('Background script not available:', chrome.runtime.lastError);
           }